@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+)
+
+// ddlCmd writes the statements creating the given tables and the ones they reference on an empty database
+var ddlCmd = &cobra.Command{
+	Use:   "ddl TABLE...",
+	Short: "Write the statements creating the given tables and the tables they reference, to bootstrap an empty database",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		db := schemareader.GetDBconnection(serverConfig)
+		defer db.Close()
+		tablesMap, err := schemareader.ReadTablesSchema(db, args)
+		if err := reportSkippedTables(err); err != nil {
+			log.Fatal().Err(err).Msg("Unable to read the database schema")
+		}
+		// the referenced tables are created with the given ones, like reachable lists them
+		tables := make([]schemareader.Table, 0, len(tablesMap))
+		for _, name := range schemareader.ReachableTables(tablesMap, args...) {
+			if table, ok := tablesMap[name]; ok {
+				tables = append(tables, table)
+			}
+		}
+		if err := schemareader.WriteDDL(tables, os.Stdout); err != nil {
+			log.Fatal().Err(err).Msg("Unable to write the DDL")
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(ddlCmd)
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/uyuni-project/inter-server-sync/dumper"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+)
+
+// describeCmd prints how the export sees a table, to debug the rows matched differently on the target
+var describeCmd = &cobra.Command{
+	Use:   "describe TABLE",
+	Short: "Print the columns, keys and references of a table and explain how its rows are matched on the target",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		db := schemareader.GetDBconnection(serverConfig)
+		defer db.Close()
+		table, err := schemareader.ReadTable(db, args[0])
+		if err != nil {
+			log.Fatal().Err(err).Msg("Unable to read the table schema")
+		}
+		// the dictionary tables are matched by label, as in the export
+		tables := map[string]schemareader.Table{table.Name: table}
+		if err := dumper.ApplyDictionaryTables(tables, dumper.DefaultDictionaryTables); err != nil {
+			log.Fatal().Err(err).Msg("Unable to match the dictionary tables by label")
+		}
+		if err := schemareader.WriteTableDescription(tables[table.Name], os.Stdout); err != nil {
+			log.Fatal().Err(err).Msg("Unable to write the table description")
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(describeCmd)
+}
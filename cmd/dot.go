@@ -1,6 +1,9 @@
 package cmd
 
 import (
+	"os"
+
+	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 	"github.com/uyuni-project/inter-server-sync/entityDumper"
 	"github.com/uyuni-project/inter-server-sync/schemareader"
@@ -14,11 +17,35 @@ var dotCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		db := schemareader.GetDBconnection(serverConfig)
 		defer db.Close()
-		tables := schemareader.ReadTablesSchema(db, entityDumper.SoftwareChannelTableNames())
+		tables, err := schemareader.ReadTablesSchema(db, entityDumper.SoftwareChannelTableNames())
+		if err := reportSkippedTables(err); err != nil {
+			log.Fatal().Err(err).Msg("Unable to read the database schema")
+		}
+		if jsonModel {
+			tablesList := make([]schemareader.Table, 0, len(tables))
+			for _, table := range tables {
+				tablesList = append(tablesList, table)
+			}
+			if err := schemareader.DumpSchemaJSON(tablesList, os.Stdout); err != nil {
+				log.Fatal().Err(err).Msg("Unable to write the schema model")
+			}
+			return
+		}
+		if dependencies {
+			if err := schemareader.WriteDependencyGraph(tables, os.Stdout); err != nil {
+				log.Fatal().Err(err).Msg("Unable to write the dependency graph")
+			}
+			return
+		}
 		schemareader.DumpToGraphviz(tables)
 	},
 }
 
+var dependencies bool
+var jsonModel bool
+
 func init() {
+	dotCmd.Flags().BoolVar(&dependencies, "dependencies", false, "Only show the tables and their foreign keys")
+	dotCmd.Flags().BoolVar(&jsonModel, "json", false, "Write the schema model read from the database as JSON instead of a graph")
 	rootCmd.AddCommand(dotCmd)
 }
@@ -1,13 +1,16 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
 	"path"
 	"strings"
 
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+	"github.com/uyuni-project/inter-server-sync/dumper"
 	"github.com/uyuni-project/inter-server-sync/entityDumper"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
 	"github.com/uyuni-project/inter-server-sync/utils"
 )
 
@@ -19,6 +22,7 @@ var exportCmd = &cobra.Command{
 
 var channels []string
 var channelWithChildren []string
+var channelFamilies []string
 var configChannels []string
 var outputDir string
 var metadataOnly bool
@@ -26,10 +30,51 @@ var startingDate string
 var includeImages bool
 var includeContainers bool
 var orgs []uint
+var idOnlyStrategy string
+var rowChecksums bool
+var pageSize int
+var exportTables []string
+var excludeTables []string
+var includeColumns []string
+var excludeColumns []string
+var defaultColumns []string
+var rowLimits map[string]int
+var rowFilters []string
+var mainIndexColumns map[string]string
+var referenceIndexes map[string]string
+var referenceIdMaps []string
+var targetDbUrl string
+var checkOrphans bool
+var skipOrphans bool
+var assumePresentTables []string
+var tableStats bool
+var replaceByLabelTables []string
+var dictionaryTables []string
+var extraDictionaryTables []string
+var copyTables []string
+var undoScript bool
+var cleanupScript bool
+var importVerification bool
+var validateDump bool
+var skipSecondaryConflicts bool
+var errataDeltaFrom string
+var errataDeltaDeletes bool
+var schemaCacheDir string
+var sequenceValues bool
+var since string
+var advisories []string
+var splitTables bool
+var schemaQueryStats bool
+var snapshot bool
+var archive bool
+var dependencyTrace bool
+var insertBatchSize int
 
 func init() {
 	exportCmd.Flags().StringSliceVar(&channels, "channels", nil, "Channels to be exported")
 	exportCmd.Flags().StringSliceVar(&channelWithChildren, "channel-with-children", nil, "Channels to be exported")
+	exportCmd.Flags().StringSliceVar(&channelFamilies, "channel-families", nil, "Channel families whose channels are to be exported")
+	exportCmd.Flags().StringSliceVar(&advisories, "advisories", nil, "Advisories to be exported with their packages and channels, without the rest of the channels content")
 	exportCmd.Flags().StringVar(&outputDir, "outputDir", ".", "Location for generated data")
 	exportCmd.Flags().BoolVar(&metadataOnly, "metadataOnly", false, "export only metadata")
 	exportCmd.Flags().StringVar(&startingDate, "packagesOnlyAfter", "", "Only export packages added or modified after the specified date (date format can be 'YYYY-MM-DD' or 'YYYY-MM-DD hh:mm:ss')")
@@ -37,6 +82,48 @@ func init() {
 	exportCmd.Flags().BoolVar(&includeImages, "images", false, "Export OS images and associated metadata")
 	exportCmd.Flags().BoolVar(&includeContainers, "containers", false, "Export containers metadata")
 	exportCmd.Flags().UintSliceVar(&orgs, "orgLimit", nil, "Export only for specified organizations")
+	exportCmd.Flags().StringVar(&idOnlyStrategy, "idOnlyStrategy", "", fmt.Sprintf("How to export tables only matched by id: '%s', '%s' or '%s', inserted without conflict check with a warning by default",
+		dumper.IdOnlyInsert, dumper.IdOnlyRemap, dumper.IdOnlySkip))
+	exportCmd.Flags().IntVar(&pageSize, "pageSize", 0, "Maximum number of rows read at once when exporting full tables, 0 to read them at once. The tables without primary key or unique index without nullable column are always read at once")
+	exportCmd.Flags().StringSliceVar(&exportTables, "tables", nil, "Tables to export with the channels instead of the default channel tables, the references to other tables are not followed")
+	exportCmd.Flags().StringSliceVar(&excludeTables, "exclude-tables", nil, "Tables not to export with the channels, warning about the exported tables referencing them")
+	exportCmd.Flags().StringSliceVar(&includeColumns, "includeColumns", nil, "Only export the given columns of their tables, e.g. rhnpackage.id, the other columns get their default value on the target")
+	exportCmd.Flags().StringSliceVar(&excludeColumns, "excludeColumns", nil, "Columns not to export, e.g. rhnpackage.build_host, they get their default value on the target")
+	exportCmd.Flags().StringSliceVar(&defaultColumns, "defaultColumns", nil, "Columns with a default expression evaluated on the target instead of copying the source value, e.g. a creation date defaulting to now()")
+	exportCmd.Flags().StringSliceVar(&assumePresentTables, "assumePresentTables", nil, "Tables already present on the target: they are not exported but still referenced")
+	exportCmd.Flags().BoolVar(&rowChecksums, "rowChecksums", false, "Write the checksum of each exported channel row in row_checksums.txt")
+	exportCmd.Flags().BoolVar(&tableStats, "tableStats", false, "Add comments with the row count, check constraints and export duration of each table in the generated SQL")
+	exportCmd.Flags().StringSliceVar(&replaceByLabelTables, "replaceByLabelTables", nil, "Dictionary tables whose rows are updated by label on the target, keeping the target ids (e.g. rhnchecksumtype)")
+	exportCmd.Flags().StringSliceVar(&dictionaryTables, "dictionaryTables", dumper.DefaultDictionaryTables, "Dictionary tables whose rows and the references to them are matched by label on the target")
+	exportCmd.Flags().StringSliceVar(&extraDictionaryTables, "extraDictionaryTables", nil, "Dictionary tables to match by label in addition to the --dictionaryTables ones (e.g. rhnpackagekeytype)")
+	exportCmd.Flags().StringToStringVar(&mainIndexColumns, "mainIndexColumns", nil, "Natural key column of tables whose rows are matched on the target by the wrong unique index, e.g. rhnchecksum=checksum")
+	exportCmd.Flags().StringToStringVar(&referenceIndexes, "referenceIndexes", nil, "Unique index of the referenced table matching the rows referenced by a foreign key column instead of its main one, as table.column=index")
+	exportCmd.Flags().StringSliceVar(&copyTables, "copyTables", nil, "Tables with a unique index, neither referencing nor referenced by other tables, whose rows are written with COPY for a faster first-time import")
+	exportCmd.Flags().BoolVar(&undoScript, "undoScript", false, "Generate undo_statements.sql.gz removing the rows inserted by the import of a first-time sync")
+	exportCmd.Flags().BoolVar(&cleanupScript, "cleanupScript", false, "Generate cleanup_statements.sql.gz removing the exported rows from the target, to run before the import to replace them")
+	exportCmd.Flags().BoolVar(&importVerification, "importVerification", false, "Write import_verification.txt.gz matching the exported rows on the target, to count them after the import with import --verifyImport")
+	exportCmd.Flags().BoolVar(&validateDump, "validate", false, "Check the generated SQL has the rows planned for each table, by key, without duplicated row, implies --tableStats")
+	exportCmd.Flags().BoolVar(&splitTables, "splitTables", false, "Write the SQL statements in the tables directory, in one file per run of consecutive statements of a table, with their import order in tables/order.txt")
+	exportCmd.Flags().BoolVar(&skipSecondaryConflicts, "skipSecondaryConflicts", false, "Skip the rows conflicting on the target with a unique index other than the one used to match them")
+	exportCmd.Flags().StringVar(&errataDeltaFrom, "errataDeltaFrom", "", "Previous export directory: only the channel errata added since are exported, implies --rowChecksums")
+	exportCmd.Flags().BoolVar(&errataDeltaDeletes, "errataDeltaDeletes", false, "Remove the channel errata exported previously and not found anymore, requires --errataDeltaFrom")
+	exportCmd.Flags().StringVar(&schemaCacheDir, "schemaCacheDir", "", "Directory caching the schema read from the database for the next exports, reread when the schema changes")
+	exportCmd.Flags().BoolVar(&snapshot, "snapshot", false, "Read the schema and the data in a single snapshot of the database, ignoring the changes committed during the export")
+	exportCmd.Flags().BoolVar(&schemaQueryStats, "schemaQueryStats", false, "Log the number of queries run to read the schema and their cumulated duration")
+	exportCmd.Flags().BoolVar(&sequenceValues, "sequenceValues", false, "Move the primary key sequences of the target at least to their value on the source")
+	exportCmd.Flags().StringToIntVar(&rowLimits, "limit", nil, "Maximum number of rows to export per table, e.g. rhnchannelpackage=1000, the rows referenced by the exported ones are still exported")
+	exportCmd.Flags().StringArrayVar(&rowFilters, "rowFilter", nil, "Condition of the rows to export for a table, as table=condition, e.g. \"rhnerrata=advisory_status IS DISTINCT FROM 'retracted'\", repeat the flag for several tables")
+	exportCmd.Flags().BoolVar(&checkOrphans, "checkOrphans", false, "Report the rows of the exported tables referencing rows missing on the source before exporting")
+	exportCmd.Flags().BoolVar(&skipOrphans, "skipOrphans", false, "Do not export the rows referencing rows missing on the source, implies --checkOrphans")
+	exportCmd.Flags().StringVar(&since, "since", "", "Only export the rows with a modified column changed after the specified date, keeping their referenced rows (date format can be 'YYYY-MM-DD' or 'YYYY-MM-DD hh:mm:ss')")
+	exportCmd.Flags().BoolVar(&archive, "archive", false, "Bundle the export directory with its manifest in a single <outputDir>.tar.gz, to import with import --archive")
+	exportCmd.Flags().BoolVar(&dependencyTrace, "dependencyTrace", false, "Write in dependency_trace.txt why each row found from the exported channels, advisories or images is exported")
+	exportCmd.Flags().StringVar(&dumper.TargetSchema, "targetSchema", "", "Schema of the tables on the target database, qualifying the table names of the generated SQL, when it differs from the source one")
+	exportCmd.Flags().StringVar(&schemareader.DatabaseURL, "dbUrl", "", "PostgreSQL connection URL or key=value DSN of the source database, with its SSL options, instead of the database of --serverConfig")
+	exportCmd.Flags().IntVar(&insertBatchSize, "insertBatchSize", 0, "Maximum number of rows of a table inserted by a single statement, like 500 for a faster import, 0 for one statement per row")
+	exportCmd.Flags().StringSliceVar(&referenceIdMaps, "referenceIdMaps", nil, "Foreign key columns, as table.column, whose referenced ids are mapped once to the target ids instead of a sub query per row, requires --targetDbUrl")
+	exportCmd.Flags().StringVar(&summaryPath, "summary", "", "Write the JSON summary of the export to this file at the end, - for the standard output with the logs on the standard error")
+	exportCmd.Flags().StringVar(&targetDbUrl, "targetDbUrl", "", "PostgreSQL connection URL or key=value DSN of the target database, read to build the maps of --referenceIdMaps")
 	exportCmd.Args = cobra.NoArgs
 
 	rootCmd.AddCommand(exportCmd)
@@ -53,20 +140,103 @@ func runExport(cmd *cobra.Command, args []string) {
 	if !ok {
 		log.Fatal().Msg("Unable to validate the date. Allowed formats are 'YYYY-MM-DD' or 'YYYY-MM-DD hh:mm:ss'")
 	}
+	validatedSince, ok := utils.ValidateDate(since)
+	if !ok {
+		log.Fatal().Msg("Unable to validate the --since date. Allowed formats are 'YYYY-MM-DD' or 'YYYY-MM-DD hh:mm:ss'")
+	}
+	if errataDeltaDeletes && errataDeltaFrom == "" {
+		log.Fatal().Msg("--errataDeltaDeletes requires --errataDeltaFrom")
+	}
+	if validateDump && errataDeltaFrom != "" {
+		log.Fatal().Msg("--validate can't check the rows skipped by --errataDeltaFrom")
+	}
+	if schemareader.DatabaseURL != "" {
+		if err := schemareader.ValidateDatabaseURL(schemareader.DatabaseURL); err != nil {
+			log.Fatal().Err(err).Msg("Unable to use the --dbUrl connection")
+		}
+	}
+	if len(referenceIdMaps) > 0 {
+		if targetDbUrl == "" {
+			log.Fatal().Msg("--referenceIdMaps requires --targetDbUrl")
+		}
+		if err := schemareader.ValidateDatabaseURL(targetDbUrl); err != nil {
+			log.Fatal().Err(err).Msg("Unable to use the --targetDbUrl connection")
+		}
+	}
+	switch idOnlyStrategy {
+	case "", dumper.IdOnlyInsert, dumper.IdOnlyRemap, dumper.IdOnlySkip:
+	default:
+		log.Fatal().Msgf("Unknown strategy for tables only matched by id: %s", idOnlyStrategy)
+	}
 
 	options := entityDumper.DumperOptions{
 		ServerConfig:              serverConfig,
 		ChannelLabels:             channels,
 		ConfigLabels:              configChannels,
 		ChannelWithChildrenLabels: channelWithChildren,
+		ChannelFamilyLabels:       channelFamilies,
+		Advisories:                advisories,
 		OutputFolder:              outputDir,
 		MetadataOnly:              metadataOnly,
 		StartingDate:              validatedDate,
 		OSImages:                  includeImages,
 		Containers:                includeContainers,
 		Orgs:                      orgs,
+		IdOnlyStrategy:            idOnlyStrategy,
+		RowChecksums:              rowChecksums || errataDeltaFrom != "",
+		PageSize:                  pageSize,
+		Tables:                    exportTables,
+		ExcludeTables:             excludeTables,
+		IncludeColumns:            includeColumns,
+		ExcludeColumns:            excludeColumns,
+		DefaultColumns:            defaultColumns,
+		AssumePresentTables:       assumePresentTables,
+		TableStats:                tableStats || validateDump,
+		RowKeys:                   validateDump,
+		ReplaceByLabelTables:      replaceByLabelTables,
+		DictionaryTables:          dumper.ExtendDictionaryTables(dictionaryTables, extraDictionaryTables),
+		CopyTables:                copyTables,
+		UndoScript:                undoScript,
+		CleanupScript:             cleanupScript,
+		ImportVerification:        importVerification,
+		SkipSecondaryConflicts:    skipSecondaryConflicts,
+		ErrataDeltaFrom:           errataDeltaFrom,
+		ErrataDeltaDeletes:        errataDeltaDeletes,
+		SchemaCacheDir:            schemaCacheDir,
+		SequenceValues:            sequenceValues,
+		ModifiedSince:             validatedSince,
+		RowLimits:                 rowLimits,
+		RowFilters:                rowFilters,
+		MainIndexColumns:          mainIndexColumns,
+		ReferenceIndexes:          referenceIndexes,
+		ReferenceIdMaps:           referenceIdMaps,
+		TargetDatabaseURL:         targetDbUrl,
+		CheckOrphans:              checkOrphans,
+		SkipOrphans:               skipOrphans,
+		Snapshot:                  snapshot,
+		DependencyTrace:           dependencyTrace,
+		InsertBatchSize:           insertBatchSize,
+		Provenance:                dumper.NewExportProvenance(),
+	}
+	schemareader.SetProgress(logProgress("Reading the schema"))
+	dumper.SetProgress(logProgress("Writing the data"))
+	var queryStats *schemareader.QueryStats
+	if schemaQueryStats {
+		queryStats = &schemareader.QueryStats{}
+		schemareader.SetQueryHook(queryStats.Record)
 	}
 	entityDumper.DumpAllEntities(options)
+	if queryStats != nil {
+		log.Info().Msgf("Schema read with %d queries taking %s", queryStats.Queries(), queryStats.Duration())
+	}
+	if validateDump {
+		entityDumper.ValidateDump(options)
+	}
+	// the table sections checked by the validation are not kept in the split files
+	if splitTables {
+		entityDumper.SplitSqlStatements(options)
+	}
+	entityDumper.WriteManifest(options)
 	var versionfile string
 	versionfile = path.Join(utils.GetAbsPath(outputDir), "version.txt")
 	vf, err := os.Open(versionfile)
@@ -80,6 +250,50 @@ func runExport(cmd *cobra.Command, args []string) {
 	}
 	version, product := utils.GetCurrentServerVersion(serverConfig)
 	vf.WriteString("product_name = " + product + "\n" + "version = " + version + "\n")
+	vf.WriteString(getSourceIdentity())
+	if len(assumePresentTables) > 0 {
+		// the import relies on the target to contain the data of these tables
+		vf.WriteString("assume_present_tables = " + strings.Join(assumePresentTables, ",") + "\n")
+	}
+	if validatedSince != "" {
+		// the rows deleted or not modified since the date are left untouched on the target
+		vf.WriteString("modified_since = " + validatedSince + "\n")
+	}
+	if archive {
+		archivePath, err := entityDumper.WriteArchive(utils.GetAbsPath(outputDir))
+		if err != nil {
+			log.Fatal().Err(err).Msg("Unable to write the export archive")
+		}
+		log.Info().Msgf("Export archive: %s", archivePath)
+	}
 
 	log.Info().Msgf("Export done. Directory: %s", outputDir)
+	writeRunSummary(utils.GetAbsPath(outputDir))
+}
+
+// logProgress returns a progress function logging each tenth of the tables of the phase
+func logProgress(phase string) schemareader.ProgressFunc {
+	return func(tableName string, index, total int) {
+		if index == total || index*10/total != (index-1)*10/total {
+			log.Info().Msgf("%s: %d/%d tables", phase, index, total)
+		}
+	}
+}
+
+// getSourceIdentity returns the version file lines identifying the server the data is exported from
+func getSourceIdentity() string {
+	db := schemareader.GetDBconnection(serverConfig)
+	defer db.Close()
+	dbHost, dbName := schemareader.GetDatabaseIdentity(serverConfig)
+	identity := "source_host = " + utils.GetCurrentServerFQDN(serverConfig) + "\n" +
+		"source_db_host = " + dbHost + "\n" +
+		"source_db_name = " + dbName + "\n"
+	schemaVersion, err := schemareader.ReadSchemaVersion(db)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Unable to read the schema version")
+	}
+	if schemaVersion != "" {
+		identity = identity + "source_schema_version = " + schemaVersion + "\n"
+	}
+	return identity
 }
@@ -1,16 +1,25 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+	"github.com/uyuni-project/inter-server-sync/dumper"
 	"github.com/uyuni-project/inter-server-sync/dumper/pillarDumper"
+	"github.com/uyuni-project/inter-server-sync/entityDumper"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
 	"github.com/uyuni-project/inter-server-sync/utils"
 	"github.com/uyuni-project/inter-server-sync/xmlrpc"
 )
@@ -24,19 +33,50 @@ var importCmd = &cobra.Command{
 var importDir string
 var xmlRpcUser string
 var xmlRpcPassword string
+var verifyManifest bool
+var dryRun bool
+var deferConstraints bool
+var checkpoint bool
+var resume bool
+var verifyImport bool
+var importArchive string
+var transactionRetries int
 
 func init() {
 
 	importCmd.Flags().StringVar(&importDir, "importDir", ".", "Location import data from")
 	importCmd.Flags().StringVar(&xmlRpcUser, "xmlRpcUser", "admin", "A username to access the XML-RPC Api")
 	importCmd.Flags().StringVar(&xmlRpcPassword, "xmlRpcPassword", "admin", "A password to access the XML-RPC Api")
+	importCmd.Flags().BoolVar(&verifyManifest, "verify", false, "Check the SQL statements match the manifest of the export before importing anything")
+	importCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Run the SQL import in a transaction rolled back at the end, without copying any file. The sequences of the target still advance")
+	importCmd.Flags().BoolVar(&deferConstraints, "deferConstraints", false, "Check the deferrable foreign keys when committing the SQL import, to tolerate the cycles of references between rows already on the target")
+	importCmd.Flags().BoolVar(&checkpoint, "checkpoint", false, "Import the files of the split SQL statements in one transaction each, recording the committed files to resume a failed import")
+	importCmd.Flags().BoolVar(&resume, "resume", false, "Resume a failed import with checkpoints, skipping the files already committed, implies --checkpoint")
+	importCmd.Flags().BoolVar(&verifyImport, "verifyImport", false, "Check the distinct exported rows are all found on the server after the import, requires an export with --importVerification")
+	importCmd.Flags().StringVar(&importArchive, "archive", "", "Export archive written by export --archive, extracted in --importDir and verified with its manifest before importing")
+	importCmd.Flags().StringVar(&summaryPath, "summary", "", "Write the JSON summary of the import to this file at the end, - for the standard output with the logs on the standard error")
+	importCmd.Flags().IntVar(&transactionRetries, "transactionRetries", 0, "Run the SQL import transaction again up to this number of times when it fails on a deadlock or a serialization failure")
 	importCmd.Args = cobra.NoArgs
 
 	rootCmd.AddCommand(importCmd)
 }
 
 func runImport(cmd *cobra.Command, args []string) {
+	// an interrupted import rolls back its open transaction instead of being killed in the middle of it
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if dryRun && runSummary != nil {
+		runSummary.SetDryRun()
+	}
 	absImportDir := utils.GetAbsPath(importDir)
+	if importArchive != "" {
+		log.Info().Msgf("extracting %s in %s", importArchive, absImportDir)
+		if err := entityDumper.ExtractArchive(utils.GetAbsPath(importArchive), absImportDir); err != nil {
+			log.Fatal().Err(err).Msg("Unable to extract the export archive")
+		}
+		// the archive crossed the gap: check it before touching the database
+		verifyManifest = true
+	}
 	log.Info().Msg(fmt.Sprintf("starting import from dir %s", absImportDir))
 	fversion, fproduct := getImportVersionProduct(absImportDir)
 	sversion, sproduct := utils.GetCurrentServerVersion(serverConfig)
@@ -44,12 +84,34 @@ func runImport(cmd *cobra.Command, args []string) {
 		log.Panic().Msgf("Wrong version detected. Fileversion = %s ; Serverversion = %s", fversion, sversion)
 	}
 	validateFolder(absImportDir)
+	if verifyManifest {
+		verifyDump(absImportDir)
+	}
+	reportPartialTables(absImportDir)
+	if deferConstraints {
+		reportNonDeferrableCycles(absImportDir)
+	}
+	if dryRun {
+		runDryRunImportSql(ctx, absImportDir)
+		writeRunSummary(absImportDir)
+		return
+	}
+	if (checkpoint || resume) && deferConstraints {
+		log.Warn().Msg("The constraints are only deferred until the commit of each file with --checkpoint")
+	}
 	runPackageFileSync(absImportDir)
 
 	runImageFileSync(absImportDir, serverConfig)
+	if ctx.Err() != nil {
+		log.Fatal().Msg("The import was cancelled before the SQL import, the target database is unchanged")
+	}
 
-	runImportSql(absImportDir)
+	runImportSql(ctx, absImportDir)
+	if verifyImport {
+		verifyImportedRows(absImportDir)
+	}
 	log.Info().Msg("import finished")
+	writeRunSummary(absImportDir)
 }
 
 func getImportVersionProduct(path string) (string, string) {
@@ -64,10 +126,37 @@ func getImportVersionProduct(path string) (string, string) {
 		log.Fatal().Msg("Product not found")
 	}
 	log.Debug().Msgf("Import Product: %s; Version: %s", product, version)
+	logSourceIdentity(versionfile)
 	return version, product
 }
 
+// logSourceIdentity shows where the data comes from for the operator to confirm it is the right dump
+func logSourceIdentity(versionfile string) {
+	sourceHost, err := utils.ScannerFunc(versionfile, "source_host")
+	if err != nil {
+		log.Info().Msg("No source server identity in the export, it was made by an older version")
+		return
+	}
+	dbHost, _ := utils.ScannerFunc(versionfile, "source_db_host")
+	dbName, _ := utils.ScannerFunc(versionfile, "source_db_name")
+	schemaVersion, err := utils.ScannerFunc(versionfile, "source_schema_version")
+	if err != nil {
+		schemaVersion = "unknown"
+	}
+	log.Info().Msgf("Importing data exported from server %s (database %s on %s, schema version %s)",
+		sourceHost, dbName, dbHost, schemaVersion)
+	if assumedTables, err := utils.ScannerFunc(versionfile, "assume_present_tables"); err == nil {
+		log.Warn().Msgf("The export assumes the data of these tables to be present already: %s", assumedTables)
+	}
+	if modifiedSince, err := utils.ScannerFunc(versionfile, "modified_since"); err == nil {
+		log.Warn().Msgf("Incremental export: only the rows modified since %s are imported, the rows deleted on the source are kept", modifiedSince)
+	}
+}
+
 func validateFolder(absImportDir string) {
+	if _, err := os.Stat(path.Join(absImportDir, entityDumper.SplitDumpDir)); err == nil {
+		return
+	}
 	_, err := os.Stat(fmt.Sprintf("%s/sql_statements.sql.gz", absImportDir))
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -81,6 +170,53 @@ func validateFolder(absImportDir string) {
 	}
 }
 
+// verifyDump stops the import if the SQL statements were truncated or modified since the export
+func verifyDump(absImportDir string) {
+	differences, err := entityDumper.VerifyManifest(absImportDir)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Unable to verify the SQL statements")
+	}
+	for _, difference := range differences {
+		log.Error().Msg(difference)
+	}
+	if len(differences) > 0 {
+		log.Fatal().Msgf("The SQL statements don't match the manifest of the export: %d differences", len(differences))
+	}
+	log.Info().Msg("The SQL statements match the manifest of the export")
+}
+
+// reportPartialTables warns about the tables the export didn't write all the rows of
+func reportPartialTables(absImportDir string) {
+	partialTables, err := entityDumper.ReadPartialTables(absImportDir)
+	if err != nil {
+		log.Warn().Err(err).Msg("Unable to read the provenance of the exported tables")
+		return
+	}
+	for _, partialTable := range partialTables {
+		log.Warn().Msgf("Partial export of table %s", partialTable)
+	}
+}
+
+// verifyImportedRows reports the tables whose exported rows are not all found on the server after the import
+func verifyImportedRows(absImportDir string) {
+	db := schemareader.GetDBconnection(serverConfig)
+	defer db.Close()
+	counts, differences, err := entityDumper.VerifyImportedRows(db, absImportDir)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Unable to verify the imported rows")
+	}
+	if runSummary != nil {
+		runSummary.SetImportedRows(counts)
+	}
+	for _, difference := range differences {
+		log.Error().Msg(difference)
+	}
+	if len(differences) > 0 {
+		log.Fatal().Msgf("The exported rows are not all found after the import: %d differences", len(differences))
+	}
+	log.Info().Msg("The exported rows are all found after the import")
+}
+
 func hasConfigChannels(absImportDir string) bool {
 	_, err := os.Stat(fmt.Sprintf("%s/exportedConfigs.txt", absImportDir))
 	log.Info().Err(err).Msg(fmt.Sprintf("no export config file found: %s/exportedConfigs.txt", absImportDir))
@@ -165,51 +301,191 @@ func runImageFileSync(absImportDir string, serverFQDN string) {
 	pillarDumper.ImportImagePillars(pillarImportDir, serverConfig)
 }
 
-func importSqlFile(absImportDir string) {
-	cmd := exec.Command("spacewalk-sql", fmt.Sprintf("%s/sql_statements.sql", absImportDir))
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	log.Info().Msg("Starting SQL import")
-	err := cmd.Run()
+// importSqlStatements runs the SQL statements of the export on the server database.
+// The errors are also written to output, if any, to find out why the import failed.
+// When the context is cancelled, the statement being run completes and the transaction is rolled back.
+func importSqlStatements(ctx context.Context, statements io.Reader, output io.Writer) error {
+	reader := dumper.NewCancellableReader(ctx, statements)
+	cImport := exec.Command("spacewalk-sql", "-")
+	cImport.Stdin = reader
+	// the interrupt of the terminal is left to the import: it rolls the transaction back instead of killing psql
+	cImport.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cImport.Stdout = os.Stdout
+	cImport.Stderr = os.Stderr
+	if output != nil {
+		cImport.Stderr = io.MultiWriter(os.Stderr, output)
+	}
+	err := cImport.Run()
+	if reader.RolledBack() {
+		return fmt.Errorf("the SQL import transaction was rolled back: %w", ctx.Err())
+	}
+	return err
+}
+
+// importSqlStatementsWithRetries imports the statements opened by open, running their transaction again when it was
+// rolled back on a deadlock or a serialization failure with a concurrent transaction of the server.
+// Running it again is safe: the rows are inserted or updated on their main unique index.
+func importSqlStatementsWithRetries(ctx context.Context, open func() (io.ReadCloser, error)) error {
+	for attempt := 1; ; attempt++ {
+		statements, err := open()
+		if err != nil {
+			return fmt.Errorf("opening the SQL statements: %w", err)
+		}
+		reader := importedStatements(statements)
+		if transactionRetries > 0 {
+			reader = dumper.NewVerboseErrorsReader(reader)
+		}
+		var output bytes.Buffer
+		err = importSqlStatements(ctx, reader, &output)
+		statements.Close()
+		if err == nil || ctx.Err() != nil || attempt > transactionRetries || !dumper.IsTransactionConflict(output.Bytes()) {
+			return err
+		}
+		log.Warn().Msgf("The SQL import transaction conflicted with a concurrent one, running it again (%d/%d)", attempt, transactionRetries)
+		select {
+		case <-time.After(time.Duration(attempt) * time.Second):
+		case <-ctx.Done():
+			return fmt.Errorf("the SQL import was cancelled before running it again: %w", ctx.Err())
+		}
+	}
+}
+
+// openSqlStatements opens the SQL statements of the export, compressed or not
+func openSqlStatements(absImportDir string) io.ReadCloser {
+	statements, err := entityDumper.OpenSqlStatements(absImportDir)
 	if err != nil {
-		log.Fatal().Err(err).Msgf("Error running the SQL script")
+		log.Fatal().Err(err).Msg("Error opening the SQL statements")
 	}
+	return statements
 }
 
-func importGzFile(absImportDir string) {
-	cUnzip := exec.Command("gunzip", "-c", fmt.Sprintf("%s/sql_statements.sql.gz", absImportDir))
-	cImport := exec.Command("spacewalk-sql", "-")
+// importedStatements returns the statements to run for the import, with the constraints deferred if requested
+func importedStatements(statements io.Reader) io.Reader {
+	if deferConstraints {
+		return dumper.NewDeferredConstraintsReader(statements)
+	}
+	return statements
+}
 
-	pr, pw := io.Pipe()
-	cUnzip.Stdout = pw
-	cUnzip.Stderr = os.Stderr
+// reportNonDeferrableCycles warns about the foreign keys of the target database which can't be deferred
+// while their tables reference each other: the rows of these tables may still fail to import.
+func reportNonDeferrableCycles(absImportDir string) {
+	statements := openSqlStatements(absImportDir)
+	entries, err := dumper.ComputeManifest(statements)
+	statements.Close()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error reading the SQL statements")
+	}
+	tableNames := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Name != dumper.ManifestDumpEntry {
+			tableNames = append(tableNames, entry.Name)
+		}
+	}
 
-	cImport.Stdin = pr
-	cImport.Stdout = os.Stdout
-	cImport.Stderr = os.Stderr
+	db := schemareader.GetDBconnection(serverConfig)
+	defer db.Close()
+	tables, err := schemareader.ReadTablesFromList(db, tableNames)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Unable to read the schema of the imported tables")
+	}
+	tablesMap := make(map[string]schemareader.Table, len(tables))
+	for _, table := range tables {
+		tablesMap[table.Name] = table
+	}
+	for _, cycle := range schemareader.DetectCycles(tablesMap) {
+		for _, reference := range schemareader.NonDeferrableCycleReferences(tablesMap, cycle) {
+			log.Warn().Msgf("Foreign key %s is not deferrable: the import fails if it references rows inserted later", reference)
+		}
+	}
+}
 
-	log.Info().Msg("Starting SQL/GZ import")
-	cUnzip.Start()
-	cImport.Start()
+// runDryRunImportSql runs the SQL import like a real one, but rolls it back instead of committing it.
+// The import stops at the first failing statement, like a real import would.
+// The rollback doesn't restore the sequences: nextval and setval are not transactional.
+func runDryRunImportSql(ctx context.Context, absImportDir string) {
+	statements := openSqlStatements(absImportDir)
+	entries, err := dumper.ComputeManifest(statements)
+	statements.Close()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error reading the SQL statements")
+	}
+	for _, entry := range entries {
+		if entry.Name != dumper.ManifestDumpEntry {
+			log.Info().Msgf("Dry run: %d rows of %s in the dump", entry.Rows, entry.Name)
+		}
+	}
 
-	go func() {
-		defer pw.Close()
-		cUnzip.Wait()
-	}()
-	err := cImport.Wait()
+	statements = openSqlStatements(absImportDir)
+	defer statements.Close()
+	log.Info().Msg("Starting SQL dry run import")
+	if err := importSqlStatements(ctx, dumper.NewRollbackReader(importedStatements(statements)), nil); err != nil {
+		if errors.Is(err, context.Canceled) {
+			log.Fatal().Msg("The SQL dry run import was cancelled")
+		}
+		log.Fatal().Err(err).Msg("The SQL dry run import failed, the real import would fail too")
+	}
+	log.Info().Msg("The SQL dry run import succeeded and was rolled back, the sequences of the target were still advanced")
+}
+
+// runCheckpointImportSql imports the files of the split dump in one transaction each, recording the committed ones.
+// The tables committed by a previous import are skipped when resuming it: a failed table is imported again from
+// its first row since its transaction was rolled back.
+func runCheckpointImportSql(ctx context.Context, absImportDir string) {
+	fileNames, err := entityDumper.SplitDumpFiles(absImportDir)
 	if err != nil {
-		log.Fatal().Err(err).Msgf("Error running the SQL script")
+		log.Fatal().Err(err).Msg("Error splitting the SQL statements")
+	}
+	log.Info().Msg("Starting SQL import with checkpoints")
+	committed := make(map[string]bool)
+	if resume {
+		committed, err = entityDumper.ReadImportCheckpoint(absImportDir)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Error reading the import checkpoint")
+		}
+		log.Info().Msgf("Resuming the SQL import: %d of %d files already imported", len(committed), len(fileNames))
+	} else if err := os.Remove(path.Join(absImportDir, entityDumper.ImportCheckpointFile)); err != nil && !os.IsNotExist(err) {
+		log.Fatal().Err(err).Msg("Error removing the previous import checkpoint")
+	}
+
+	for _, fileName := range fileNames {
+		if committed[fileName] {
+			log.Debug().Msgf("Skipping %s, already imported", fileName)
+			continue
+		}
+		log.Info().Msgf("Importing %s", fileName)
+		err := importSqlStatementsWithRetries(ctx, func() (io.ReadCloser, error) {
+			return entityDumper.OpenSplitDumpFile(absImportDir, fileName)
+		})
+		if errors.Is(err, context.Canceled) {
+			log.Fatal().Msgf("The import was cancelled and %s rolled back, run the import again with --resume", fileName)
+		}
+		if err != nil {
+			log.Fatal().Err(err).Msgf("Error importing %s, fix the error and run the import again with --resume", fileName)
+		}
+		if err := entityDumper.RecordImportCheckpoint(absImportDir, fileName); err != nil {
+			log.Fatal().Err(err).Msgf("%s was imported but not recorded in the checkpoint", fileName)
+		}
+	}
+	if err := os.Remove(path.Join(absImportDir, entityDumper.ImportCheckpointFile)); err != nil && !os.IsNotExist(err) {
+		log.Warn().Err(err).Msg("Unable to remove the import checkpoint")
 	}
 }
 
-func runImportSql(absImportDir string) {
+func runImportSql(ctx context.Context, absImportDir string) {
 
-	if _, err := os.Stat(fmt.Sprintf("%s/sql_statements.sql.gz", absImportDir)); err == nil {
-		importGzFile(absImportDir)
+	if checkpoint || resume {
+		runCheckpointImportSql(ctx, absImportDir)
 	} else {
-		if _, err := os.Stat(fmt.Sprintf("%s/sql_statements.sql", absImportDir)); err == nil {
-			importSqlFile(absImportDir)
+		log.Info().Msg("Starting SQL import")
+		err := importSqlStatementsWithRetries(ctx, func() (io.ReadCloser, error) {
+			return entityDumper.OpenSqlStatements(absImportDir)
+		})
+		if errors.Is(err, context.Canceled) {
+			log.Fatal().Msg("The SQL import was cancelled and rolled back, the target database is unchanged")
+		}
+		if err != nil {
+			log.Fatal().Err(err).Msgf("Error running the SQL script")
 		}
 	}
 
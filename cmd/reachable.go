@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+)
+
+// reachableCmd lists the tables reached from the given ones by following their foreign keys
+var reachableCmd = &cobra.Command{
+	Use:   "reachable TABLE...",
+	Short: "List the tables referenced by the given tables, directly or not",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		db := schemareader.GetDBconnection(serverConfig)
+		defer db.Close()
+		tables, err := schemareader.ReadTablesSchema(db, args)
+		if err := reportSkippedTables(err); err != nil {
+			log.Fatal().Err(err).Msg("Unable to read the database schema")
+		}
+		for _, name := range schemareader.ReachableTables(tables, args...) {
+			fmt.Println(name)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reachableCmd)
+}
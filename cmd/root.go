@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"log/syslog"
 	"os"
@@ -12,6 +13,7 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
 )
 
 var rootCmd = &cobra.Command{
@@ -29,10 +31,15 @@ var logLevel string
 var serverConfig string
 var cpuProfile string
 var memProfile string
+var failFast bool
 
 func init() {
 	rootCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		summaryInit(cmd)
 		logInit()
+		if failFast && schemareader.ContinueOnTableErrors {
+			log.Fatal().Msg("--fail-fast and --continue can't be used together")
+		}
 		cpuProfileInit()
 		memProfileDump()
 	}
@@ -43,6 +50,22 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&serverConfig, "serverConfig", "/etc/rhn/rhn.conf", "Server configuration file")
 	rootCmd.PersistentFlags().StringVar(&cpuProfile, "cpuProfile", "", "cpuProfile export folder location")
 	rootCmd.PersistentFlags().StringVar(&memProfile, "memProfile", "", "memProfile export folder location")
+	rootCmd.PersistentFlags().DurationVar(&schemareader.QueryTimeout, "query-timeout", 0, "Maximum duration of each query reading the database schema, like 30s, 0 to wait forever")
+	rootCmd.PersistentFlags().BoolVar(&failFast, "fail-fast", false, "Stop reading the database schema at the first table which can't be read, the default")
+	rootCmd.PersistentFlags().BoolVar(&schemareader.ContinueOnTableErrors, "continue", false, "Skip the tables whose schema can't be read and report them at the end, for a best-effort schema of the ddl, dot, reachable and schemaDiff commands")
+}
+
+// reportSkippedTables logs the tables skipped with --continue and returns the error if the schema read failed otherwise
+func reportSkippedTables(err error) error {
+	var skipped schemareader.TableErrors
+	if !errors.As(err, &skipped) {
+		return err
+	}
+	for _, tableError := range skipped {
+		log.Warn().Err(tableError.Err).Msgf("Schema of table %s not read", tableError.TableName)
+	}
+	log.Warn().Msgf("The schema of %d tables was not read: it is incomplete", len(skipped))
+	return nil
 }
 
 func logCallerMarshalFunction(file string, line int) string {
@@ -70,13 +93,24 @@ func logInit() {
 
 	syslogwriter := zerolog.SyslogLevelWriter(syslogger)
 
-	multi := zerolog.MultiLevelWriter(syslogwriter, os.Stdout)
-	log.Logger = zerolog.New(multi).With().Timestamp().Caller().Logger()
+	// the summary written to the standard output is kept apart from the logs
+	output := os.Stdout
+	if summaryPath == "-" {
+		output = os.Stderr
+	}
+	multi := zerolog.MultiLevelWriter(syslogwriter, output)
 	zerolog.CallerMarshalFunc = logCallerMarshalFunction
 	level, err := zerolog.ParseLevel(logLevel)
 	if err != nil {
 		level = zerolog.InfoLevel
 	}
+	if runSummary != nil {
+		multi = summaryWriter{LevelWriter: multi, level: level}
+		if level > zerolog.WarnLevel {
+			level = zerolog.WarnLevel
+		}
+	}
+	log.Logger = zerolog.New(multi).With().Timestamp().Caller().Logger()
 	zerolog.SetGlobalLevel(level)
 	log.Info().Msg("Inter server sync started")
 }
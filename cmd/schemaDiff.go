@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/uyuni-project/inter-server-sync/entityDumper"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+)
+
+var schemaDiffCmd = &cobra.Command{
+	Use:   "schemaDiff",
+	Short: "Compare the schema of the exported tables with the one of the target server",
+	Run:   runSchemaDiff,
+}
+
+var targetServerConfig string
+
+func init() {
+	schemaDiffCmd.Flags().StringVar(&targetServerConfig, "targetServerConfig", "", "Configuration file of the target server to connect to its database")
+	schemaDiffCmd.MarkFlagRequired("targetServerConfig")
+	schemaDiffCmd.Args = cobra.NoArgs
+
+	rootCmd.AddCommand(schemaDiffCmd)
+}
+
+func runSchemaDiff(cmd *cobra.Command, args []string) {
+	tableNames := exportedTableNames()
+	source := readSchemaOf(serverConfig, tableNames)
+	target := readSchemaOf(targetServerConfig, tableNames)
+
+	differences := schemareader.DiffSchemas(source, target)
+	for _, difference := range differences {
+		fmt.Println(difference)
+	}
+	if len(differences) > 0 {
+		log.Fatal().Msgf("%d schema differences: the import on the target may fail", len(differences))
+	}
+	fmt.Println("The schemas of the exported tables are identical")
+}
+
+// exportedTableNames returns the tables of all the exported entities
+func exportedTableNames() []string {
+	seen := make(map[string]bool)
+	result := make([]string, 0)
+	for _, names := range [][]string{entityDumper.ProductsTableNames(), entityDumper.SoftwareChannelTableNames(),
+		entityDumper.ConfigTableNames(), entityDumper.ImageTableNames()} {
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				result = append(result, name)
+			}
+		}
+	}
+	return result
+}
+
+// readSchemaOf reads the tables from the database of the server configuration.
+// The tables missing from the database are not read, for the diff to report them.
+func readSchemaOf(config string, tableNames []string) map[string]schemareader.Table {
+	db := schemareader.GetDBconnection(config)
+	defer db.Close()
+	tables, missing, err := schemareader.ReadExistingTablesSchema(context.Background(), db, tableNames)
+	if err := reportSkippedTables(err); err != nil {
+		log.Fatal().Err(err).Msgf("Unable to read the database schema of %s", config)
+	}
+	if len(missing) > 0 {
+		log.Info().Msgf("Tables missing from the database of %s: %s", config, strings.Join(missing, ", "))
+	}
+	return tables
+}
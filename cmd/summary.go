@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/uyuni-project/inter-server-sync/dumper"
+	"github.com/uyuni-project/inter-server-sync/entityDumper"
+)
+
+// summaryPath is where the export and import write the JSON summary of the run, - for the standard output
+var summaryPath string
+
+// runSummary collects the summary of the run written with --summary, nil without it
+var runSummary *dumper.RunSummary
+
+// summaryInit starts collecting the summary of the run of the command if requested
+func summaryInit(cmd *cobra.Command) {
+	if summaryPath != "" {
+		runSummary = dumper.NewRunSummary(cmd.Name())
+	}
+}
+
+// summaryWriter counts the warnings and errors of the run in its summary, writes the summary of the run stopped by
+// a fatal error or a panic before the process exits, and drops the logs below the level: with a summary, the
+// warnings reach it at any log level. The summary is taken from the written event for its error field.
+type summaryWriter struct {
+	zerolog.LevelWriter
+	level zerolog.Level
+}
+
+func (w summaryWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	switch level {
+	case zerolog.WarnLevel:
+		runSummary.AddWarning()
+	case zerolog.ErrorLevel:
+		runSummary.AddError()
+	case zerolog.FatalLevel, zerolog.PanicLevel:
+		runSummary.AddError()
+		if err := runSummary.WriteFile(summaryPath, eventError(p)); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to write the run summary: %s\n", err)
+		}
+	}
+	if level < w.level {
+		return len(p), nil
+	}
+	return w.LevelWriter.WriteLevel(level, p)
+}
+
+// eventError returns the error stopping the run from the JSON event logging it: its message followed by the
+// error logged with it, if any
+func eventError(p []byte) error {
+	var event map[string]interface{}
+	if err := json.Unmarshal(p, &event); err != nil {
+		return errors.New(strings.TrimSpace(string(p)))
+	}
+	message, _ := event[zerolog.MessageFieldName].(string)
+	cause, ok := event[zerolog.ErrorFieldName]
+	if !ok {
+		return errors.New(message)
+	}
+	if message == "" {
+		return fmt.Errorf("%v", cause)
+	}
+	return fmt.Errorf("%s: %v", message, cause)
+}
+
+// writeRunSummary writes the summary of the successful run with the tables of the manifest of the directory
+func writeRunSummary(absDir string) {
+	if runSummary == nil {
+		return
+	}
+	entries, err := entityDumper.ReadManifest(absDir)
+	if err != nil {
+		log.Warn().Err(err).Msg("Unable to read the manifest for the run summary, it has no tables")
+	} else {
+		runSummary.SetManifest(entries)
+	}
+	if err := runSummary.WriteFile(summaryPath, nil); err != nil {
+		log.Error().Err(err).Msg("Unable to write the run summary")
+	}
+}
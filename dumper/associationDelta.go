@@ -0,0 +1,72 @@
+package dumper
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/sqlUtil"
+)
+
+// AssociationDelta exports only the rows of an association table which were not in a previous export.
+// The previous rows are read from the row checksums file of that export, identified by their natural key.
+type AssociationDelta struct {
+	TableName string
+	// Deletes removes on the target the previously exported rows not found anymore on the source
+	Deletes bool
+	// Scope is the natural key part the removed rows must contain, like the sub query of the exported channel
+	Scope    string
+	previous map[string]bool
+	current  map[string]bool
+}
+
+// LoadAssociationDelta reads the natural keys of the table rows from a previous row checksums file
+func LoadAssociationDelta(reader io.Reader, tableName string, deletes bool) (*AssociationDelta, error) {
+	delta := &AssociationDelta{TableName: tableName, Deletes: deletes,
+		previous: make(map[string]bool), current: make(map[string]bool)}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) == 3 && fields[0] == tableName {
+			delta.previous[fields[1]] = true
+		}
+	}
+	return delta, scanner.Err()
+}
+
+// isPrevious records the row as currently exported and tells if it was already in the previous export
+func (delta *AssociationDelta) isPrevious(naturalKey string) bool {
+	delta.current[naturalKey] = true
+	return delta.previous[naturalKey]
+}
+
+// SetLabelScope limits the removed rows to the ones referencing the row of the table with the label. The reference is
+// formatted like the foreign keys of the exported rows, for the scope to be found in their natural keys.
+func (delta *AssociationDelta) SetLabelScope(tableName string, label string) {
+	labelValue := sqlUtil.RowDataStructure{ColumnName: "label", ColumnType: "VARCHAR", Value: label}
+	delta.Scope = formatField(sqlUtil.RowDataStructure{ColumnName: "id", ColumnType: "SQL",
+		Value: fmt.Sprintf("SELECT %s FROM %s WHERE %s = %s LIMIT 1", quoteIdentifier("id"), QuoteTableName(tableName),
+			quoteIdentifier("label"), formatField(labelValue))})
+}
+
+// writeRemoved writes the deletion of the rows of the previous export in scope which are not exported anymore
+func (delta *AssociationDelta) writeRemoved(writer *bufio.Writer, table schemareader.Table) {
+	if !delta.Deletes {
+		return
+	}
+	removed := make([]string, 0)
+	for naturalKey := range delta.previous {
+		if !delta.current[naturalKey] && strings.Contains(naturalKey, delta.Scope) {
+			removed = append(removed, naturalKey)
+		}
+	}
+	sort.Strings(removed)
+	mainUniqueColumns := strings.Join(quoteIdentifiers(table.UniqueIndexes[table.MainUniqueIndexName].Columns), ", ")
+	for _, naturalKey := range removed {
+		writer.WriteString(fmt.Sprintf("DELETE FROM %s WHERE (%s) = (%s);\n", QuoteTableName(table.Name), mainUniqueColumns, naturalKey))
+	}
+}
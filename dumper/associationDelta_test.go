@@ -0,0 +1,108 @@
+package dumper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/sqlUtil"
+	"github.com/uyuni-project/inter-server-sync/tests"
+)
+
+func TestAssociationDeltaBetweenSnapshots(t *testing.T) {
+	// 01 Arrange
+	table := schemareader.Table{
+		Name:                "rhnchannelerrata",
+		Export:              true,
+		Columns:             []string{"channel_id", "errata_id"},
+		ColumnIndexes:       map[string]int{"channel_id": 0, "errata_id": 1},
+		PKColumns:           map[string]bool{},
+		MainUniqueIndexName: "rhn_cerr_ceid_uq",
+		UniqueIndexes: map[string]schemareader.UniqueIndex{
+			"rhn_cerr_ceid_uq": {Name: "rhn_cerr_ceid_uq", Columns: []string{"channel_id", "errata_id"}}},
+	}
+	schema := map[string]schemareader.Table{"rhnchannelerrata": table}
+	row := func(channelId string, errataId string) []sqlUtil.RowDataStructure {
+		return []sqlUtil.RowDataStructure{
+			{ColumnName: "channel_id", ColumnType: "NUMERIC", Value: channelId},
+			{ColumnName: "errata_id", ColumnType: "NUMERIC", Value: errataId},
+		}
+	}
+	// first snapshot: channel 1 had errata 10 and 11, channel 2 had errata 10
+	previousChecksums := strings.Join([]string{
+		"rhnchannelerrata\t1,10\tchecksum",
+		"rhnchannelerrata\t1,11\tchecksum",
+		"rhnchannelerrata\t2,10\tchecksum",
+		"rhnchannel\t'channel-1'\tchecksum",
+	}, "\n")
+	delta, err := LoadAssociationDelta(strings.NewReader(previousChecksums), "rhnchannelerrata", true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	delta.Scope = "1,"
+	repo := tests.CreateDataRepository()
+	options := PrintSqlOptions{AssociationDelta: delta}
+
+	// 02 Act
+	// second snapshot: channel 1 has errata 10 and 12
+	writeRowsInsertStatements(repo.DB, repo.Writer, schema, table, [][]sqlUtil.RowDataStructure{row("1", "10"), row("1", "12")}, nil, options)
+	delta.writeRemoved(repo.Writer, table)
+	lines := strings.Split(strings.TrimSpace(strings.Join(repo.GetWriterBuffer(), "")), "\n")
+
+	// 03 Assert
+	expected := []string{
+		"INSERT INTO rhnchannelerrata (channel_id, errata_id)\tVALUES (1,12) ON CONFLICT (channel_id, errata_id) " +
+			"DO UPDATE SET channel_id = excluded.channel_id,errata_id = excluded.errata_id;",
+		"DELETE FROM rhnchannelerrata WHERE (channel_id, errata_id) = (1,11);",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected delta: expected %v, got %v", expected, lines)
+	}
+}
+
+func TestAssociationDeltaLabelScope(t *testing.T) {
+	// 01 Arrange
+	repo := tests.CreateDataRepository()
+	t.Cleanup(func() { cache = make(map[string]string) })
+	channel := schemareader.Table{
+		Name:                "rhnchannel",
+		Export:              true,
+		Columns:             []string{"id", "label"},
+		ColumnIndexes:       map[string]int{"id": 0, "label": 1},
+		PKColumns:           map[string]bool{"id": true},
+		MainUniqueIndexName: "rhn_channel_label_uq",
+		UniqueIndexes: map[string]schemareader.UniqueIndex{
+			"rhn_channel_label_uq": {Name: "rhn_channel_label_uq", Columns: []string{"label"}}},
+	}
+	channelErrata := schemareader.Table{
+		Name:                "rhnchannelerrata",
+		Export:              true,
+		Columns:             []string{"channel_id", "errata_id"},
+		ColumnIndexes:       map[string]int{"channel_id": 0, "errata_id": 1},
+		PKColumns:           map[string]bool{},
+		MainUniqueIndexName: "rhn_cerr_ceid_uq",
+		UniqueIndexes: map[string]schemareader.UniqueIndex{
+			"rhn_cerr_ceid_uq": {Name: "rhn_cerr_ceid_uq", Columns: []string{"channel_id", "errata_id"}}},
+		References: []schemareader.Reference{{TableName: "rhnchannel", ColumnMapping: map[string]string{"channel_id": "id"}}},
+	}
+	schema := map[string]schemareader.Table{"rhnchannel": channel, "rhnchannelerrata": channelErrata}
+	// the label needs escaping
+	label := "dev\\channel\nupdates"
+	repo.ExpectWithRecords("SELECT id, label FROM rhnchannel WHERE id = $1;",
+		sqlmock.NewRows(channel.Columns).AddRow("1", label), "1")
+	row := []sqlUtil.RowDataStructure{
+		{ColumnName: "channel_id", ColumnType: "NUMERIC", Value: "1"},
+		{ColumnName: "errata_id", ColumnType: "NUMERIC", Value: "10"},
+	}
+	delta := &AssociationDelta{TableName: "rhnchannelerrata"}
+
+	// 02 Act
+	delta.SetLabelScope("rhnchannel", label)
+	naturalKey := formatRowNaturalKey(channelErrata, substituteRow(repo.DB, channelErrata, row, schema))
+
+	// 03 Assert
+	if !strings.Contains(naturalKey, delta.Scope) {
+		t.Errorf("The scope %s should be found in the natural key %s", delta.Scope, naturalKey)
+	}
+}
@@ -0,0 +1,57 @@
+package dumper
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/sqlUtil"
+)
+
+// CleanupScript collects the statements removing the exported rows from the target before the import,
+// for the import to replace them instead of updating them.
+// The rows are matched by their main unique index: the target rows of a previous import of the same data are removed.
+type CleanupScript struct {
+	statements      []string
+	skippedTables   map[string]bool
+	notCleanedNames []string
+}
+
+func NewCleanupScript() *CleanupScript {
+	return &CleanupScript{statements: make([]string, 0), skippedTables: make(map[string]bool), notCleanedNames: make([]string, 0)}
+}
+
+// isCleanable tells if the rows of the table can be removed from the target before the import.
+// The dictionary rows are shared with the rest of the target data and the id only rows can't be matched.
+func isCleanable(table schemareader.Table) bool {
+	return !table.IsDictionary && !table.ReplaceByLabel && len(table.UniqueIndexes[table.MainUniqueIndexName].Columns) > 0
+}
+
+func (cleanup *CleanupScript) addRow(db *sql.DB, row []sqlUtil.RowDataStructure, table schemareader.Table,
+	schemaMetadata map[string]schemareader.Table) {
+	if !isCleanable(table) {
+		if !cleanup.skippedTables[table.Name] {
+			log.Warn().Msgf("Rows of %s cannot be matched on the target or are shared: they are not cleaned up", table.Name)
+			cleanup.skippedTables[table.Name] = true
+			cleanup.notCleanedNames = append(cleanup.notCleanedNames, table.Name)
+		}
+		return
+	}
+	cleanup.statements = append(cleanup.statements, formatDeleteByMainUniqueIndex(db, row, table, schemaMetadata))
+}
+
+// Write writes the cleanup statements in the reverse order of the export, children first, for the foreign keys
+// to be satisfied after each statement
+func (cleanup *CleanupScript) Write(writer *bufio.Writer) {
+	writer.WriteString("BEGIN;\n")
+	if len(cleanup.notCleanedNames) > 0 {
+		writer.WriteString(fmt.Sprintf("-- rows not cleaned up in tables: %s\n", strings.Join(cleanup.notCleanedNames, ", ")))
+	}
+	for i := len(cleanup.statements) - 1; i >= 0; i-- {
+		writer.WriteString(cleanup.statements[i] + "\n")
+	}
+	writer.WriteString("COMMIT;\n")
+}
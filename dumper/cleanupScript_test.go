@@ -0,0 +1,56 @@
+package dumper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/uyuni-project/inter-server-sync/tests"
+)
+
+func TestCleanupScriptDeletesChildrenFirst(t *testing.T) {
+	// 01 Arrange
+	graph := TablesGraph{
+		"root": []string{"v51", "v52"},
+		"v51":  []string{},
+		"v52":  []string{},
+	}
+	root := "root"
+	cleanup := NewCleanupScript()
+	testCase := createTestCase(graph, root, PrintSqlOptions{Cleanup: cleanup})
+	// v52 is a dictionary shared with the rest of the target data, it is not cleaned up
+	dictionary := testCase.schemaMetadata["v52"]
+	dictionary.IsDictionary = true
+	testCase.schemaMetadata["v52"] = dictionary
+	// the resolved references are cached like by PrintTableDataOrdered, clean them for the next tests
+	t.Cleanup(func() { cache = make(map[string]string) })
+
+	testCase.repo.Expect("SELECT id FROM v51 WHERE (id) IN (('0001')) ORDER BY id;", testCase.schemaMetadata["v51"].Columns, 1)
+	testCase.repo.Expect("SELECT id FROM v52 WHERE (id) IN (('0001')) ORDER BY id;", testCase.schemaMetadata["v52"].Columns, 1)
+	testCase.repo.Expect("SELECT id, v51_fk_id, v52_fk_id FROM root WHERE (id) IN (('0001')) ORDER BY id;", testCase.schemaMetadata["root"].Columns, 1)
+	testCase.repo.Expect("SELECT id FROM v51 WHERE id = $1;", testCase.schemaMetadata["v51"].Columns, 1)
+	testCase.repo.Expect("SELECT id FROM v52 WHERE id = $1;", testCase.schemaMetadata["v52"].Columns, 1)
+
+	// 02 Act
+	orderedTables := getTablesExportOrder(testCase.schemaMetadata, testCase.startingTable, testCase.processedTables, testCase.path)
+	exportTablesData(testCase.repo.DB, testCase.repo.Writer, testCase.schemaMetadata, orderedTables,
+		testCase.dumper, testCase.options)
+	cleanupRepo := tests.CreateDataRepository()
+	cleanup.Write(cleanupRepo.Writer)
+	cleanupLines := strings.Split(strings.Join(cleanupRepo.GetWriterBuffer(), ""), "\n")
+
+	// 03 Assert
+	expected := []string{
+		"BEGIN;",
+		"-- rows not cleaned up in tables: v52",
+		"DELETE FROM root WHERE id = '0001';",
+		"DELETE FROM v51 WHERE id = '0001';",
+		"COMMIT;",
+		"",
+	}
+	if strings.Join(cleanupLines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected cleanup script: expected %v, got %v", expected, cleanupLines)
+	}
+	if err := testCase.repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("Some rows were not exported. Error message: %s", err)
+	}
+}
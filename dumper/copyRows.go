@@ -0,0 +1,118 @@
+package dumper
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/sqlUtil"
+)
+
+// copyEndOfData ends the rows of a COPY block
+const copyEndOfData = `\.`
+
+// copyEscaper escapes the characters with a meaning in the COPY text format
+var copyEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// ApplyCopyTables makes the rows of the given tables written in a COPY block instead of INSERT statements.
+// COPY neither checks conflicts nor resolves foreign keys: the tables can't reference other tables
+// and their sequence generated primary key gets the target default value. Their rows can't be referenced either:
+// the other rows find them by their main unique index, which COPY doesn't check.
+func ApplyCopyTables(schemaMetadata map[string]schemareader.Table, tableNames []string) error {
+	for _, tableName := range tableNames {
+		table, ok := schemaMetadata[strings.ToLower(tableName)]
+		if !ok {
+			continue
+		}
+		if len(table.References) > 0 {
+			return fmt.Errorf("table %s references other tables: its rows need INSERT statements to resolve the foreign keys", table.Name)
+		}
+		if len(table.ReferencedBy) > 0 {
+			return fmt.Errorf("table %s is referenced by other tables: its rows need INSERT statements to be matched by their unique index", table.Name)
+		}
+		if len(table.MainUniqueIndexName) == 0 {
+			return fmt.Errorf("table %s has no unique index to match its rows on the target", table.Name)
+		}
+		for column := range sequencePKColumns(table) {
+			if table.ColumnDefinitions[column].ColumnDefault == "" {
+				return fmt.Errorf("table %s has no default value for its primary key %s to be generated on the target", table.Name, column)
+			}
+		}
+		table.CopyRows = true
+		schemaMetadata[table.Name] = table
+	}
+	return nil
+}
+
+// sequencePKColumns returns the primary key column generated by a sequence on the target, if any
+func sequencePKColumns(table schemareader.Table) map[string]bool {
+	if len(table.PKSequence) == 0 || len(table.PKColumns) != 1 {
+		return map[string]bool{}
+	}
+	return table.PKColumns
+}
+
+// copyColumns returns the columns written in the COPY block of the table
+func copyColumns(table schemareader.Table) []string {
+	pkColumns := sequencePKColumns(table)
+	columns := make([]string, 0, len(table.Columns))
+	for _, column := range table.Columns {
+		if !table.UnexportColumns[column] && !pkColumns[column] {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// generateRowLine returns the line writing the row: a line of the COPY block of the table or an INSERT statement
+func generateRowLine(db *sql.DB, values []sqlUtil.RowDataStructure, table schemareader.Table,
+	schemaMetadata map[string]schemareader.Table, onlyIfParentExistsTables []string) string {
+	line, insert := generateRowWrite(db, values, table, schemaMetadata, onlyIfParentExistsTables)
+	if insert != nil {
+		return insert.statement()
+	}
+	return line
+}
+
+// generateRowWrite is generateRowLine returning the INSERT of VALUES apart, to merge it with the ones of other rows
+func generateRowWrite(db *sql.DB, values []sqlUtil.RowDataStructure, table schemareader.Table,
+	schemaMetadata map[string]schemareader.Table, onlyIfParentExistsTables []string) (string, *rowInsert) {
+	if table.CopyRows {
+		return formatCopyRow(table, transformRow(table, values)), nil
+	}
+	return generateRowInsert(db, values, table, schemaMetadata, onlyIfParentExistsTables)
+}
+
+// formatCopyHeader starts the COPY block of the table rows
+func formatCopyHeader(table schemareader.Table) string {
+	return fmt.Sprintf("COPY %s (%s) FROM stdin;", QuoteTableName(table.Name), strings.Join(quoteIdentifiers(copyColumns(table)), ", "))
+}
+
+// formatCopyRow formats the row as a line of the COPY text format, in the order of the copyColumns
+func formatCopyRow(table schemareader.Table, values []sqlUtil.RowDataStructure) string {
+	columns := copyColumns(table)
+	fields := make([]string, len(columns))
+	for i, column := range columns {
+		fields[i] = formatCopyField(values[table.ColumnIndexes[column]])
+	}
+	return strings.Join(fields, "\t")
+}
+
+func formatCopyField(col sqlUtil.RowDataStructure) string {
+	if col.Value == nil {
+		return `\N`
+	}
+	switch col.ColumnType {
+	case "TIMESTAMPTZ", "TIMESTAMP":
+		return copyEscaper.Replace(string(pq.FormatTimestamp(col.Value.(time.Time))))
+	case "BYTEA":
+		if value, ok := col.Value.([]byte); ok {
+			return `\\x` + hex.EncodeToString(value)
+		}
+	}
+	return copyEscaper.Replace(fmt.Sprintf("%s", col.Value))
+}
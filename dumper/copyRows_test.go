@@ -0,0 +1,131 @@
+package dumper
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/sqlUtil"
+)
+
+func TestApplyCopyTables(t *testing.T) {
+	// 01 Arrange
+	schema := map[string]schemareader.Table{
+		"rhnpackagechangelogdata": {
+			Name:              "rhnpackagechangelogdata",
+			Export:            true,
+			Columns:           []string{"id", "name", "text", "time", "created"},
+			ColumnIndexes:     map[string]int{"id": 0, "name": 1, "text": 2, "time": 3, "created": 4},
+			ColumnDefinitions: map[string]schemareader.Column{"id": {ColumnDefault: "nextval('rhn_pkg_cld_id_seq'::regclass)"}},
+			UnexportColumns:   map[string]bool{"created": true},
+			PKColumns:         map[string]bool{"id": true},
+			PKSequence:        "rhn_pkg_cld_id_seq",
+			UniqueIndexes: map[string]schemareader.UniqueIndex{
+				"rhn_pkg_cld_uq": {Name: "rhn_pkg_cld_uq", Columns: []string{"name", "text", "time"}}},
+			MainUniqueIndexName: "rhn_pkg_cld_uq",
+		},
+		"rhnpackagechangelogrec": {
+			Name:       "rhnpackagechangelogrec",
+			Export:     true,
+			References: []schemareader.Reference{{TableName: "rhnpackagechangelogdata", ColumnMapping: map[string]string{"changelog_data_id": "id"}}},
+		},
+		"rhnnodefault": {
+			Name:                "rhnnodefault",
+			Export:              true,
+			Columns:             []string{"id"},
+			PKColumns:           map[string]bool{"id": true},
+			PKSequence:          "rhn_no_default_seq",
+			MainUniqueIndexName: "rhn_no_default_pk",
+		},
+		"rhnreferenced": {
+			Name:                "rhnreferenced",
+			Export:              true,
+			MainUniqueIndexName: "rhn_referenced_uq",
+			ReferencedBy:        []schemareader.Reference{{TableName: "rhnreferencing", ColumnMapping: map[string]string{"referenced_id": "id"}}},
+		},
+		"rhnnounique": {
+			Name:   "rhnnounique",
+			Export: true,
+		},
+	}
+	row := []sqlUtil.RowDataStructure{
+		{ColumnName: "id", ColumnType: "NUMERIC", Value: "12"},
+		{ColumnName: "name", ColumnType: "VARCHAR", Value: `Joe \ Doe`},
+		{ColumnName: "text", ColumnType: "VARCHAR", Value: "- fix\tbug\n- add feature"},
+		{ColumnName: "time", ColumnType: "TIMESTAMPTZ", Value: time.Date(2021, 5, 12, 8, 30, 0, 0, time.UTC)},
+		{ColumnName: "created", ColumnType: "TIMESTAMPTZ", Value: nil},
+	}
+
+	// 02 Act
+	err := ApplyCopyTables(schema, []string{"rhnPackageChangelogData", "missing"})
+	errReferences := ApplyCopyTables(schema, []string{"rhnpackagechangelogrec"})
+	errNoDefault := ApplyCopyTables(schema, []string{"rhnnodefault"})
+	errReferenced := ApplyCopyTables(schema, []string{"rhnreferenced"})
+	errNoUnique := ApplyCopyTables(schema, []string{"rhnnounique"})
+	table := schema["rhnpackagechangelogdata"]
+
+	// 03 Assert
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if errReferences == nil {
+		t.Errorf("Tables referencing other tables should be rejected")
+	}
+	if errNoDefault == nil {
+		t.Errorf("Tables without default primary key value should be rejected")
+	}
+	if errReferenced == nil {
+		t.Errorf("Tables referenced by other tables should be rejected")
+	}
+	if errNoUnique == nil {
+		t.Errorf("Tables without unique index should be rejected")
+	}
+	if !table.CopyRows {
+		t.Errorf("rhnpackagechangelogdata rows should be copied")
+	}
+	expectedHeader := "COPY rhnpackagechangelogdata (name, text, time) FROM stdin;"
+	if header := formatCopyHeader(table); header != expectedHeader {
+		t.Errorf("Expected %s, but got %s", expectedHeader, header)
+	}
+	expectedRow := `Joe \\ Doe` + "\t" + `- fix\tbug\n- add feature` + "\t" + "2021-05-12 08:30:00Z"
+	if line := formatCopyRow(table, row); line != expectedRow {
+		t.Errorf("Expected %s, but got %s", expectedRow, line)
+	}
+}
+
+func TestComputeManifestOfCopyBlocks(t *testing.T) {
+	// 01 Arrange
+	dump := strings.Join([]string{
+		"BEGIN;",
+		"COPY rhnpackagechangelogdata (name, text, time) FROM stdin;",
+		"Joe\t- fix\t2021-05-12 08:30:00Z",
+		"Jane\t\\N\t2021-05-13 08:30:00Z",
+		`\.`,
+		"INSERT INTO rhnchannel (id, label)\tVALUES (1,'sles') ON CONFLICT (label) DO UPDATE SET label = excluded.label;",
+		"COMMIT;",
+	}, "\n")
+
+	// 02 Act
+	entries, err := ComputeManifest(strings.NewReader(dump))
+	discrepancies := ValidateDump(strings.NewReader(strings.Replace(strings.Replace(dump,
+		"COPY ", "-- table rhnpackagechangelogdata: 2 rows\nCOPY ", 1),
+		`\.`, "\\.\n-- table rhnpackagechangelogdata: 2 rows exported in 1ms", 1)))
+
+	// 03 Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	rows := make(map[string]int)
+	for _, entry := range entries {
+		rows[entry.Name] = entry.Rows
+	}
+	expected := map[string]int{ManifestDumpEntry: 7, "rhnpackagechangelogdata": 2, "rhnchannel": 1}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Unexpected row counts: expected %v, got %v", expected, rows)
+	}
+	if len(discrepancies) != 0 {
+		t.Errorf("Unexpected discrepancies: %v", discrepancies)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/uyuni-project/inter-server-sync/schemareader"
 	"github.com/uyuni-project/inter-server-sync/tests"
 )
@@ -36,16 +37,16 @@ func TestShouldCreateDataDumper(t *testing.T) {
 	testCase := createDataCrawlerTestCase(graph, root)
 
 	// the data repository expect these statements in the exact same order
-	testCase.repo.Expect("SELECT * FROM root WHERE CUSTOM ;", testCase.schemaMetadata["root"].Columns, 1)
-	testCase.repo.Expect("SELECT id, v35_fk_id, v36_fk_id FROM v31 WHERE id = $1;", testCase.schemaMetadata["v31"].Columns, 1)
-	testCase.repo.Expect("SELECT id, v33_fk_id FROM v32 WHERE id = $1;", testCase.schemaMetadata["v32"].Columns, 1)
-	testCase.repo.Expect("SELECT id, v34_fk_id FROM v33 WHERE id = $1;", testCase.schemaMetadata["v33"].Columns, 1)
-	testCase.repo.Expect("SELECT id, v35_fk_id, v36_fk_id FROM v34 WHERE id = $1;", testCase.schemaMetadata["v34"].Columns, 1)
-	testCase.repo.Expect("SELECT id, v34_fk_id FROM v35 WHERE id = $1;", testCase.schemaMetadata["v35"].Columns, 1)
-	testCase.repo.Expect("SELECT id FROM v36 WHERE id = $1;", testCase.schemaMetadata["v36"].Columns, 1)
+	testCase.repo.Expect("SELECT id, v31_fk_id, v32_fk_id FROM root WHERE CUSTOM ORDER BY id ;", testCase.schemaMetadata["root"].Columns, 1)
+	testCase.repo.Expect("SELECT id, v35_fk_id, v36_fk_id FROM v31 WHERE id = $1 ORDER BY id;", testCase.schemaMetadata["v31"].Columns, 1)
+	testCase.repo.Expect("SELECT id, v33_fk_id FROM v32 WHERE id = $1 ORDER BY id;", testCase.schemaMetadata["v32"].Columns, 1)
+	testCase.repo.Expect("SELECT id, v34_fk_id FROM v33 WHERE id = $1 ORDER BY id;", testCase.schemaMetadata["v33"].Columns, 1)
+	testCase.repo.Expect("SELECT id, v35_fk_id, v36_fk_id FROM v34 WHERE id = $1 ORDER BY id;", testCase.schemaMetadata["v34"].Columns, 1)
+	testCase.repo.Expect("SELECT id, v34_fk_id FROM v35 WHERE id = $1 ORDER BY id;", testCase.schemaMetadata["v35"].Columns, 1)
+	testCase.repo.Expect("SELECT id FROM v36 WHERE id = $1 ORDER BY id;", testCase.schemaMetadata["v36"].Columns, 1)
 
-	testCase.repo.Expect("SELECT id, v34_fk_id FROM v35 WHERE id = $1;", testCase.schemaMetadata["v35"].Columns, 1)
-	testCase.repo.Expect("SELECT id FROM v36 WHERE id = $1;", testCase.schemaMetadata["v36"].Columns, 1)
+	testCase.repo.Expect("SELECT id, v34_fk_id FROM v35 WHERE id = $1 ORDER BY id;", testCase.schemaMetadata["v35"].Columns, 1)
+	testCase.repo.Expect("SELECT id FROM v36 WHERE id = $1 ORDER BY id;", testCase.schemaMetadata["v36"].Columns, 1)
 
 	// Act
 	dataDumper := DataCrawler(
@@ -54,6 +55,7 @@ func TestShouldCreateDataDumper(t *testing.T) {
 		testCase.startTable,
 		testCase.startQueryFilter,
 		"2022-01-01",
+		nil,
 	)
 
 	// Assert
@@ -227,3 +229,146 @@ func TestShouldNotFollowReferencedLinkingTable(t *testing.T) {
 		t.Errorf("Should not follow the referencedTable if it is a linking table but also is referenced by others")
 	}
 }
+
+func TestShouldNotFollowOtherChannelsFromErrata(t *testing.T) {
+
+	// Arrange
+	var shouldFollow bool
+	testCase := followLinkTestCase{
+		path: []string{"rhnchannel", "rhnchannelerrata", "rhnerrata"},
+		currentTable: schemareader.Table{
+			Name: "rhnerrata",
+		},
+		referencedTable: schemareader.Table{
+			Name:       "rhnchannelerrata",
+			References: []schemareader.Reference{{TableName: "rhnchannel"}, {TableName: "rhnerrata"}},
+		},
+	}
+
+	// Act
+	shouldFollow = shouldFollowReferenceToLink(
+		testCase.path,
+		testCase.currentTable,
+		testCase.referencedTable,
+	)
+
+	// Assert
+	if shouldFollow {
+		t.Errorf("Should not follow the channels of an errata: only the exported channel is linked to it")
+	}
+}
+
+func TestShouldOnlyFollowRowsModifiedSince(t *testing.T) {
+
+	// Arrange
+	repo := tests.CreateDataRepository()
+	schemaMetadata := map[string]schemareader.Table{
+		"rhnchannel": {
+			Name:              "rhnchannel",
+			Export:            true,
+			Columns:           []string{"id", "modified"},
+			ColumnIndexes:     map[string]int{"id": 0, "modified": 1},
+			ColumnDefinitions: map[string]schemareader.Column{"id": {Name: "id"}, "modified": {Name: "modified"}},
+			PKColumns:         map[string]bool{"id": true},
+			ReferencedBy:      []schemareader.Reference{{TableName: "susemddata", ColumnMapping: map[string]string{"channel_id": "id"}}},
+		},
+		"susemddata": {
+			Name:              "susemddata",
+			Export:            true,
+			Columns:           []string{"id", "channel_id", "modified"},
+			ColumnIndexes:     map[string]int{"id": 0, "channel_id": 1, "modified": 2},
+			ColumnDefinitions: map[string]schemareader.Column{"id": {Name: "id"}, "channel_id": {Name: "channel_id"}, "modified": {Name: "modified"}},
+			PKColumns:         map[string]bool{"id": true},
+			References:        []schemareader.Reference{{TableName: "rhnchannel", ColumnMapping: map[string]string{"channel_id": "id"}}},
+		},
+		"rhnchecksumtype": {
+			Name:    "rhnchecksumtype",
+			Export:  true,
+			Columns: []string{"id", "label"},
+		},
+	}
+
+	// Act
+	filteredTables := ApplyModifiedSince(schemaMetadata, "2024-01-01")
+	repo.Expect("SELECT id, modified FROM rhnchannel WHERE label = 'sles' ORDER BY id ;", schemaMetadata["rhnchannel"].Columns, 1)
+	repo.Expect("SELECT id, channel_id, modified FROM susemddata WHERE channel_id = $1 and modified >= $2::timestamp ORDER BY id;",
+		schemaMetadata["susemddata"].Columns, 1, "0001", "2024-01-01")
+	dataDumper := DataCrawler(repo.DB, schemaMetadata, schemaMetadata["rhnchannel"], "label = 'sles'", "", nil)
+
+	// Assert
+	if !reflect.DeepEqual(filteredTables, []string{"rhnchannel", "susemddata"}) {
+		t.Errorf("Unexpected filtered tables: %v", filteredTables)
+	}
+	if len(dataDumper.TableData["susemddata"].Keys) != 1 {
+		t.Errorf("The modified rows should be exported")
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestShouldLimitRowsReachedFromParents(t *testing.T) {
+
+	// Arrange
+	repo := tests.CreateDataRepository()
+	schemaMetadata := map[string]schemareader.Table{
+		"rhnchannel": {
+			Name:          "rhnchannel",
+			Export:        true,
+			Columns:       []string{"id"},
+			ColumnIndexes: map[string]int{"id": 0},
+			PKColumns:     map[string]bool{"id": true},
+			ReferencedBy:  []schemareader.Reference{{TableName: "rhnchannelpackage", ColumnMapping: map[string]string{"channel_id": "id"}}},
+		},
+		"rhnchannelpackage": {
+			Name:                "rhnchannelpackage",
+			Export:              true,
+			Columns:             []string{"package_id", "channel_id"},
+			ColumnIndexes:       map[string]int{"package_id": 0, "channel_id": 1},
+			UniqueIndexes:       map[string]schemareader.UniqueIndex{"rhn_cp_cp_uq": {Name: "rhn_cp_cp_uq", Columns: []string{"channel_id", "package_id"}}},
+			MainUniqueIndexName: "rhn_cp_cp_uq",
+			References: []schemareader.Reference{
+				{TableName: "rhnchannel", ColumnMapping: map[string]string{"channel_id": "id"}},
+				{TableName: "rhnpackage", ColumnMapping: map[string]string{"package_id": "id"}},
+			},
+		},
+		"rhnpackage": {
+			Name:          "rhnpackage",
+			Export:        true,
+			Columns:       []string{"id"},
+			ColumnIndexes: map[string]int{"id": 0},
+			PKColumns:     map[string]bool{"id": true},
+		},
+	}
+
+	// Act
+	err := ApplyRowLimits(schemaMetadata, map[string]int{"rhnchannelpackage": 2, "rhnpackage": 1})
+	repo.Expect("SELECT id FROM rhnchannel WHERE label = 'sles' ORDER BY id ;", schemaMetadata["rhnchannel"].Columns, 1)
+	repo.Expect("SELECT package_id, channel_id FROM rhnchannelpackage WHERE channel_id = $1 ORDER BY channel_id, package_id;",
+		schemaMetadata["rhnchannelpackage"].Columns, 3, "0001")
+	repo.ExpectWithRecords("SELECT id FROM rhnpackage WHERE id = $1 ORDER BY id;", sqlmock.NewRows([]string{"id"}).AddRow("0003"), "0003")
+	repo.ExpectWithRecords("SELECT id FROM rhnpackage WHERE id = $1 ORDER BY id;", sqlmock.NewRows([]string{"id"}).AddRow("0002"), "0002")
+	dataDumper := DataCrawler(repo.DB, schemaMetadata, schemaMetadata["rhnchannel"], "label = 'sles'", "", nil)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error applying the row limits: %s", err)
+	}
+	if len(dataDumper.TableData["rhnchannelpackage"].Keys) != 2 {
+		t.Errorf("Only 2 channel packages should be exported, got %d", len(dataDumper.TableData["rhnchannelpackage"].Keys))
+	}
+	if len(dataDumper.TableData["rhnpackage"].Keys) != 2 {
+		t.Errorf("The packages referenced by the exported channel packages should not be limited, got %d", len(dataDumper.TableData["rhnpackage"].Keys))
+	}
+	expectedProvenance := TableProvenance{RowLimit: 2, RowLimitReached: true}
+	if !reflect.DeepEqual(dataDumper.Provenance["rhnchannelpackage"], expectedProvenance) ||
+		!reflect.DeepEqual(dataDumper.Provenance["rhnchannel"].Filters, []string{"label = 'sles'"}) {
+		t.Errorf("The provenance should record the limit reached and the starting filter, got %v", dataDumper.Provenance)
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+	if err := ApplyRowLimits(schemaMetadata, map[string]int{"rhnpackage": 0}); err == nil {
+		t.Errorf("A row limit which is not positive should be rejected")
+	}
+}
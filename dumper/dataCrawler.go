@@ -3,6 +3,7 @@ package dumper
 import (
 	"database/sql"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
@@ -15,12 +16,26 @@ import (
 // DataCrawler will go through all the elements in the initialDataSet an extract related data
 // for all tables presented in the schemaMetadata by following foreign keys and references to the table row
 // The result will be a structure containing ID of each row which should be exported per table
+// The rows found are written to the trace with the reason they are exported when it is set.
 func DataCrawler(db *sql.DB, schemaMetadata map[string]schemareader.Table, startTable schemareader.Table,
-	startQueryFilter string, startingDate string) DataDumper {
+	startQueryFilter string, startingDate string, trace *DependencyTrace) DataDumper {
+	return DataCrawlerFrom(db, schemaMetadata, []CrawlerStart{{Table: startTable, QueryFilter: startQueryFilter}}, startingDate, trace)
+}
+
+// DataCrawlerFrom is DataCrawler starting from the rows of several tables.
+// The rows reached from several starting rows are only exported once.
+func DataCrawlerFrom(db *sql.DB, schemaMetadata map[string]schemareader.Table, starts []CrawlerStart,
+	startingDate string, trace *DependencyTrace) DataDumper {
 
-	result := DataDumper{make(map[string]TableDump, 0), make(map[string]bool)}
+	result := DataDumper{make(map[string]TableDump, 0), make(map[string]bool), make(map[string]TableProvenance)}
 
-	itemsToProcess := initialDataSet(db, startTable, startQueryFilter)
+	itemsToProcess := make([]processItem, 0)
+	for _, start := range starts {
+		itemsToProcess = append(itemsToProcess, initialDataSet(db, start.Table, start.QueryFilter)...)
+		provenance := result.Provenance[start.Table.Name]
+		provenance.merge(TableProvenance{Filters: formatStartFilters(start)})
+		result.Provenance[start.Table.Name] = provenance
+	}
 
 	if log.Debug().Enabled() {
 		go func() {
@@ -47,6 +62,10 @@ func DataCrawler(db *sql.DB, schemaMetadata map[string]schemareader.Table, start
 		}()
 	}
 
+	// the number of rows reached from their parents exported per table with a row limit
+	limitedRows := make(map[string]int)
+	filtered := make(filteredReferences)
+
 IterateItemsLoop:
 	for len(itemsToProcess) > 0 {
 
@@ -71,33 +90,70 @@ IterateItemsLoop:
 		} else {
 			resultTableValues = TableDump{TableName: table.Name, KeyMap: make(map[string]bool), Keys: make([]TableKey, 0)}
 		}
+		// the referenced rows are never limited: the foreign keys of the exported rows have to be valid
+		if itemToProcess.child && table.RowLimit > 0 {
+			if limitedRows[table.Name] >= table.RowLimit {
+				provenance := result.Provenance[table.Name]
+				provenance.RowLimitReached = true
+				result.Provenance[table.Name] = provenance
+				continue IterateItemsLoop
+			}
+			limitedRows[table.Name]++
+		}
 		resultTableValues.KeyMap[keyIdToMap] = true
 		resultTableValues.Keys = append(resultTableValues.Keys, keyColumnData)
 
 		result.TableData[table.Name] = resultTableValues
+		if trace != nil {
+			trace.addRow(schemaMetadata, &itemToProcess)
+		}
 		_, okPath := result.Paths[strings.Join(itemToProcess.path, ",")]
 		if !okPath {
 			result.Paths[strings.Join(itemToProcess.path, ",")] = true
 		}
 
 		newItems := append(followReferencesTo(db, schemaMetadata, table, itemToProcess, startingDate),
-			followReferencesFrom(db, schemaMetadata, table, itemToProcess, startingDate)...)
+			followReferencesFrom(db, schemaMetadata, table, itemToProcess, startingDate, filtered)...)
 		itemsToProcess = append(itemsToProcess, newItems...)
 
 	}
+	for tableName := range result.TableData {
+		table := schemaMetadata[tableName]
+		provenance := result.Provenance[tableName]
+		provenance.RowLimit = table.RowLimit
+		provenance.ModifiedSince = modifiedSince(startingDate, table)
+		provenance.merge(TableProvenance{Filters: formatRowFilter(table)})
+		result.Provenance[tableName] = provenance
+	}
+	filtered.report()
 	return result
 }
 
+// formatStartFilters returns the filter of the starting rows as provenance, none when all the rows are started from
+func formatStartFilters(start CrawlerStart) []string {
+	if strings.TrimSpace(start.QueryFilter) == "" {
+		return nil
+	}
+	return []string{strings.Join(strings.Fields(start.QueryFilter), " ")}
+}
+
 func initialDataSet(db *sql.DB, startTable schemareader.Table, whereFilter string) []processItem {
+	conditions := append(formatRowFilter(startTable), formatOrphanFilter(startTable)...)
+	if len(whereFilter) > 0 && len(conditions) > 0 {
+		conditions = append([]string{fmt.Sprintf("(%s)", whereFilter)}, conditions...)
+	} else if len(whereFilter) > 0 {
+		conditions = []string{whereFilter}
+	}
 	whereClause := ""
-	if len(whereFilter) > 0 {
-		whereClause = fmt.Sprintf("WHERE %s", whereFilter)
+	if len(conditions) > 0 {
+		whereClause = fmt.Sprintf("WHERE %s", strings.Join(conditions, " AND "))
 	}
-	sql := fmt.Sprintf(`SELECT * FROM %s %s ;`, startTable.Name, whereClause)
+	sql := fmt.Sprintf(`SELECT %s FROM %s %s%s ;`, strings.Join(quoteIdentifiers(startTable.Columns), ", "), quoteIdentifier(startTable.Name), whereClause,
+		formatOrderByClause(startTable))
 	rows := sqlUtil.ExecuteQueryWithResults(db, sql)
 	initialDataSet := make([]processItem, 0)
 	for _, row := range rows {
-		initialDataSet = append(initialDataSet, processItem{startTable.Name, row, []string{startTable.Name}})
+		initialDataSet = append(initialDataSet, processItem{startTable.Name, row, []string{startTable.Name}, false, nil})
 	}
 	return initialDataSet
 }
@@ -112,14 +168,20 @@ func generateKeyIdToMap(data TableKey) string {
 }
 
 func extractRowKeyData(table schemareader.Table, itemToProcess processItem) TableKey {
+	return rowKeyData(table, itemToProcess.row)
+}
+
+// rowKeyData returns the key the rows of the table are read by: the primary key or, without one,
+// the main unique index columns
+func rowKeyData(table schemareader.Table, row []sqlUtil.RowDataStructure) TableKey {
 	keys := make([]RowKey, 0)
 	if len(table.PKColumns) > 0 {
 		for pkColumn, _ := range table.PKColumns {
-			keys = append(keys, RowKey{pkColumn, formatField(itemToProcess.row[table.ColumnIndexes[pkColumn]])})
+			keys = append(keys, RowKey{pkColumn, formatField(row[table.ColumnIndexes[pkColumn]])})
 		}
 	} else {
 		for _, pkColumn := range table.UniqueIndexes[table.MainUniqueIndexName].Columns {
-			keys = append(keys, RowKey{pkColumn, formatField(itemToProcess.row[table.ColumnIndexes[pkColumn]])})
+			keys = append(keys, RowKey{pkColumn, formatField(row[table.ColumnIndexes[pkColumn]])})
 		}
 	}
 	return TableKey{keys}
@@ -131,7 +193,55 @@ func shouldApplyStartingDate(startingDate string, tableName string) bool {
 			tableName == "susemddata" || tableName == "rhnerratafilechannel")
 }
 
-func followReferencesFrom(db *sql.DB, schemaMetadata map[string]schemareader.Table, table schemareader.Table, row processItem, startingDate string) []processItem {
+// modifiedSince returns the date the rows of the table must be modified since to be followed, empty to follow all of them
+func modifiedSince(startingDate string, table schemareader.Table) string {
+	if table.ModifiedSince != "" {
+		return table.ModifiedSince
+	}
+	if shouldApplyStartingDate(startingDate, table.Name) {
+		return startingDate
+	}
+	return ""
+}
+
+// ApplyModifiedSince only exports the rows of the tables with a modified column which were modified since the date.
+// The filter only applies to the rows reached from their parents: the referenced rows are still exported for the
+// foreign keys to be valid. It returns the sorted names of the filtered tables.
+func ApplyModifiedSince(schemaMetadata map[string]schemareader.Table, since string) []string {
+	filteredTables := make([]string, 0)
+	for name, table := range schemaMetadata {
+		if _, ok := table.ColumnDefinitions["modified"]; !ok || !table.Export {
+			continue
+		}
+		table.ModifiedSince = since
+		schemaMetadata[name] = table
+		filteredTables = append(filteredTables, name)
+	}
+	sort.Strings(filteredTables)
+	return filteredTables
+}
+
+// ApplyRowLimits only exports up to the given number of rows of the tables, to produce smaller exports.
+// The limit only applies to the rows reached from their parents: the rows referenced by the exported rows are
+// still exported for the foreign keys to be valid. The limits of the tables not in the schema are ignored with a warning.
+func ApplyRowLimits(schemaMetadata map[string]schemareader.Table, limits map[string]int) error {
+	for tableName, limit := range limits {
+		if limit <= 0 {
+			return fmt.Errorf("invalid row limit %d for table %s: it has to be positive", limit, tableName)
+		}
+		table, ok := schemaMetadata[strings.ToLower(tableName)]
+		if !ok {
+			log.Warn().Msgf("The row limit of table %s is ignored: the table is not in the schema read", tableName)
+			continue
+		}
+		table.RowLimit = limit
+		schemaMetadata[table.Name] = table
+	}
+	return nil
+}
+
+func followReferencesFrom(db *sql.DB, schemaMetadata map[string]schemareader.Table, table schemareader.Table, row processItem, startingDate string,
+	filtered filteredReferences) []processItem {
 	result := make([]processItem, 0)
 
 	for _, reference := range table.References {
@@ -153,26 +263,33 @@ func followReferencesFrom(db *sql.DB, schemaMetadata map[string]schemareader.Tab
 		whereParameters := make([]string, 0)
 		scanParameters := make([]interface{}, 0)
 		for localColumn, foreignColumn := range reference.ColumnMapping {
-			whereParameters = append(whereParameters, fmt.Sprintf("%s = $%d", foreignColumn, len(whereParameters)+1))
+			whereParameters = append(whereParameters, fmt.Sprintf("%s = $%d", quoteIdentifier(foreignColumn), len(whereParameters)+1))
 			scanParameters = append(scanParameters, row.row[table.ColumnIndexes[localColumn]].Value)
 		}
+		referenceConditions := append([]string{}, whereParameters...)
+		referenceParameters := append([]interface{}{}, scanParameters...)
 
 		if shouldApplyStartingDate(startingDate, reference.TableName) {
 			whereParameters = append(whereParameters, fmt.Sprintf("%s >= '$%d'::timestamp", "modified", len(whereParameters)+1))
 			scanParameters = append(scanParameters, startingDate)
 		}
+		whereParameters = append(whereParameters, formatRowFilter(foreignTable)...)
 
-		formattedColumns := strings.Join(foreignTable.Columns, ", ")
+		formattedColumns := strings.Join(quoteIdentifiers(foreignTable.Columns), ", ")
 		formattedWhereParameters := strings.Join(whereParameters, " and ")
-		sql := fmt.Sprintf(`SELECT %s FROM %s WHERE %s;`, formattedColumns, reference.TableName, formattedWhereParameters)
+		sql := fmt.Sprintf(`SELECT %s FROM %s WHERE %s%s;`, formattedColumns, quoteIdentifier(reference.TableName), formattedWhereParameters,
+			formatOrderByClause(foreignTable))
 		followRows := sqlUtil.ExecuteQueryWithResults(db, sql, scanParameters...)
+		if len(followRows) == 0 {
+			filtered.add(db, table, foreignTable, reference, referenceConditions, referenceParameters)
+		}
 
 		if len(followRows) > 0 {
 			for _, followRow := range followRows {
 				newPath := make([]string, 0)
 				newPath = append(newPath, row.path...)
 				newPath = append(newPath, foreignTable.Name)
-				result = append(result, processItem{foreignTable.Name, followRow, newPath})
+				result = append(result, processItem{foreignTable.Name, followRow, newPath, false, &row})
 			}
 		}
 	}
@@ -257,18 +374,21 @@ func followReferencesTo(db *sql.DB, schemaMetadata map[string]schemareader.Table
 		whereParameters := make([]string, 0)
 		scanParameters := make([]interface{}, 0)
 		for localColumn, foreignColumn := range reference.ColumnMapping {
-			whereParameters = append(whereParameters, fmt.Sprintf("%s = $%d", localColumn, len(whereParameters)+1))
+			whereParameters = append(whereParameters, fmt.Sprintf("%s = $%d", quoteIdentifier(localColumn), len(whereParameters)+1))
 			scanParameters = append(scanParameters, row.row[table.ColumnIndexes[foreignColumn]].Value)
 		}
 
-		if shouldApplyStartingDate(startingDate, referencedTable.Name) {
+		if since := modifiedSince(startingDate, referencedTable); since != "" {
 			whereParameters = append(whereParameters, fmt.Sprintf("%s >= $%d::timestamp", "modified", len(whereParameters)+1))
-			scanParameters = append(scanParameters, startingDate)
+			scanParameters = append(scanParameters, since)
 		}
+		whereParameters = append(whereParameters, formatRowFilter(referencedTable)...)
+		whereParameters = append(whereParameters, formatOrphanFilter(referencedTable)...)
 
-		formattedColumns := strings.Join(referencedTable.Columns, ", ")
+		formattedColumns := strings.Join(quoteIdentifiers(referencedTable.Columns), ", ")
 		formattedWhereParameters := strings.Join(whereParameters, " and ")
-		sql := fmt.Sprintf(`SELECT %s FROM %s WHERE %s;`, formattedColumns, reference.TableName, formattedWhereParameters)
+		sql := fmt.Sprintf(`SELECT %s FROM %s WHERE %s%s;`, formattedColumns, quoteIdentifier(reference.TableName), formattedWhereParameters,
+			formatOrderByClause(referencedTable))
 		followRows := sqlUtil.ExecuteQueryWithResults(db, sql, scanParameters...)
 
 		if len(followRows) > 0 {
@@ -276,7 +396,7 @@ func followReferencesTo(db *sql.DB, schemaMetadata map[string]schemareader.Table
 				newPath := make([]string, 0)
 				newPath = append(newPath, row.path...)
 				newPath = append(newPath, referencedTable.Name)
-				result = append(result, processItem{referencedTable.Name, followRow, newPath})
+				result = append(result, processItem{referencedTable.Name, followRow, newPath, true, &row})
 			}
 		}
 	}
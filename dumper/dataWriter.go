@@ -28,6 +28,7 @@ func PrintTableDataOrdered(db *sql.DB, writer *bufio.Writer, schemaMetadata map[
 	writer.WriteString("\n")
 	orderedTables := getTablesExportOrder(schemaMetadata, startingTable, make(map[string]bool), make([]string, 0))
 	exportTablesData(db, writer, schemaMetadata, orderedTables, data, options)
+	options.Provenance.record(schemaMetadata, data)
 	// clean cache for the next channel that can be exported
 	cache = make(map[string]string)
 }
@@ -60,7 +61,8 @@ func printCleanTables(db *sql.DB, writer *bufio.Writer, schemaMetadata map[strin
 		printCleanTables(db, writer, schemaMetadata, tableReference, processedTables, path, options)
 	}
 
-	if utils.Contains(options.TablesToClean, table.Name) {
+	// the rows not modified since the cutoff, over the row limit or filtered out are not exported, cleaning would remove them from the target
+	if utils.Contains(options.TablesToClean, table.Name) && table.ModifiedSince == "" && table.RowLimit == 0 && table.RowFilter == "" {
 		generateClearTable(db, writer, table, path, schemaMetadata, options)
 	}
 
@@ -100,11 +102,39 @@ func exportTablesData(db *sql.DB, writer *bufio.Writer, schemaMetadata map[strin
 	}
 
 	tableCount := 1
+	progress := tableProgress{total: len(tablesOrdered)}
 	for _, table := range tablesOrdered {
 		// export current table data
 		log.Debug().Msg(fmt.Sprintf("Writing data for table [%d/%d] %s", tableCount, len(tablesOrdered), table.Name))
 		tableCount++
-		totalExportedRecords += exportCurrentTableData(db, writer, schemaMetadata, table, data, options)
+		if options.TableStats {
+			writer.WriteString(fmt.Sprintf("-- table %s: %d rows\n", table.Name, len(data.TableData[table.Name].Keys)))
+			// the constraints a stricter target may reject the rows for
+			for _, constraint := range table.CheckConstraints {
+				writer.WriteString(fmt.Sprintf("-- table %s: check constraint %s %s\n", table.Name, constraint.Name,
+					strings.Join(strings.Fields(constraint.Definition), " ")))
+			}
+			if options.RowKeys {
+				for _, key := range data.TableData[table.Name].Keys {
+					writer.WriteString(fmt.Sprintf("-- table %s: planned key %s\n", table.Name, formatTableKey(key)))
+				}
+			}
+		}
+		// the duration can only be known once the table section is written
+		start := time.Now()
+		tableExportedRecords, writtenKeys := exportCurrentTableData(db, writer, schemaMetadata, table, data, options)
+		if options.TableStats {
+			// the keys can't be written in the COPY blocks: they follow the rows of the table
+			if options.RowKeys {
+				for _, key := range writtenKeys {
+					writer.WriteString(fmt.Sprintf("-- table %s: written key %s\n", table.Name, key))
+				}
+			}
+			writer.WriteString(fmt.Sprintf("-- table %s: %d rows exported in %s\n", table.Name, tableExportedRecords,
+				time.Since(start).Round(time.Millisecond)))
+		}
+		totalExportedRecords += tableExportedRecords
+		progress.next(table.Name)
 	}
 	// post-processing callback
 	for _, table := range tablesOrdered {
@@ -124,29 +154,116 @@ func exportTablesData(db *sql.DB, writer *bufio.Writer, schemaMetadata map[strin
 
 }
 
+// exportCurrentTableData writes the rows of the table and returns their number, with their formatted keys
+// if requested by the options
 func exportCurrentTableData(db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table,
-	table schemareader.Table, data DataDumper, options PrintSqlOptions) int {
+	table schemareader.Table, data DataDumper, options PrintSqlOptions) (int, []string) {
 
 	totalExportedRecords := 0
+	writtenKeys := make([]string, 0)
 	tableData, dataOK := data.TableData[table.Name]
+	if dataOK && table.CopyRows {
+		writer.WriteString(formatCopyHeader(table) + "\n")
+		defer writer.WriteString(copyEndOfData + "\n")
+	}
 	if dataOK {
+		// rows of self referencing tables are all loaded to write the parents before their children
+		selfReferencing := len(getSelfReferences(table)) > 0
+		pendingRows := make([][]sqlUtil.RowDataStructure, 0)
+		// the rows are read by page but merged in batched inserts across the pages
+		batch := newInsertBatch(writer, table, options.InsertBatchSize)
 		exportPoint := 0
-		batch := 100
+		pageSize := 100
 		for len(tableData.Keys) > exportPoint {
-			upperLimit := exportPoint + batch
+			upperLimit := exportPoint + pageSize
 			if upperLimit > len(tableData.Keys) {
 				upperLimit = len(tableData.Keys)
 			}
 			rows := GetRowsFromKeys(db, table, tableData.Keys[exportPoint:upperLimit])
 			totalExportedRecords = totalExportedRecords + len(rows)
-			for _, rowValue := range rows {
-				rowToInsert := generateRowInsertStatement(db, rowValue, table, schemaMetadata, options.OnlyIfParentExistsTables)
-				writer.WriteString(rowToInsert + "\n")
+			if options.RowKeys {
+				for _, row := range rows {
+					writtenKeys = append(writtenKeys, formatTableKey(rowKeyData(table, row)))
+				}
+			}
+			if selfReferencing {
+				pendingRows = append(pendingRows, rows...)
+			} else {
+				writeRowsInsertStatements(db, writer, schemaMetadata, table, rows, batch, options)
 			}
 			exportPoint = upperLimit
 		}
+		batch.flush()
+		if selfReferencing {
+			orderedRows, backReferences := orderRowsBySelfReference(table, pendingRows)
+			writeRowsInsertStatements(db, writer, schemaMetadata, table, orderedRows, nil, options)
+			if len(backReferences) > 0 {
+				log.Warn().Msgf("Cyclic self reference in %s rows: %d references are set once all the rows are inserted",
+					table.Name, len(backReferences))
+			}
+			for _, backReference := range backReferences {
+				update, err := formatSelfBackReferenceUpdate(db, table, schemaMetadata, backReference)
+				if err != nil {
+					log.Warn().Err(err).Msg("The cyclic self reference will fail the import")
+					break
+				}
+				writer.WriteString(update + "\n")
+			}
+		}
+	}
+	if options.AssociationDelta != nil && options.AssociationDelta.TableName == table.Name {
+		options.AssociationDelta.writeRemoved(writer, table)
+	}
+	return totalExportedRecords, writtenKeys
+}
+
+// writeRowsInsertStatements writes the rows of the table, the inserts added to the batch if not nil: the caller flushes it
+// once all the rows of the table are written
+func writeRowsInsertStatements(db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table,
+	table schemareader.Table, rows [][]sqlUtil.RowDataStructure, batch *insertBatch, options PrintSqlOptions) {
+	delta := options.AssociationDelta
+	if delta != nil && delta.TableName != table.Name {
+		delta = nil
+	}
+	for _, rowValue := range rows {
+		values := transformRow(table, rowValue)
+		// the keys of the row are substituted once for its statement, its checksum and the association delta
+		var substituted []sqlUtil.RowDataStructure
+		if !table.CopyRows || delta != nil || options.RowChecksumWriter != nil {
+			substituted = substituteRow(db, table, values, schemaMetadata)
+		}
+		alreadyExported := delta != nil && delta.isPrevious(formatRowNaturalKey(table, substituted))
+		if !alreadyExported {
+			var line string
+			var insert *rowInsert
+			if table.CopyRows {
+				line = formatCopyRow(table, values)
+			} else {
+				line, insert = formatRowInsert(substituted, table, options.OnlyIfParentExistsTables)
+			}
+			switch {
+			case batch != nil && insert != nil:
+				batch.add(insert)
+			case insert != nil:
+				writer.WriteString(insert.statement() + "\n")
+			default:
+				batch.flush()
+				writer.WriteString(line + "\n")
+			}
+			if options.Verification != nil {
+				options.Verification.addRow(db, values, table, schemaMetadata)
+			}
+		}
+		if options.RowChecksumWriter != nil {
+			writeRowChecksum(options.RowChecksumWriter, substituted, table)
+		}
+		if options.Undo != nil {
+			options.Undo.addRow(db, values, table, schemaMetadata, options.OnlyIfParentExistsTables)
+		}
+		if options.Cleanup != nil {
+			options.Cleanup.addRow(db, values, table, schemaMetadata)
+		}
 	}
-	return totalExportedRecords
 }
 
 func getTablesExportOrder(schemaMetadata map[string]schemareader.Table,
@@ -187,7 +304,7 @@ func GetRowsFromKeys(db *sql.DB, table schemareader.Table, keys []TableKey) [][]
 	if len(keys) == 0 {
 		return make([][]sqlUtil.RowDataStructure, 0)
 	}
-	formattedColumns := strings.Join(table.Columns, ", ")
+	formattedColumns := strings.Join(quoteIdentifiers(table.Columns), ", ")
 
 	columnsFilter := make([]string, 0)
 	for _, value := range keys[0].Key {
@@ -211,10 +328,10 @@ func GetRowsFromKeys(db *sql.DB, table schemareader.Table, keys []TableKey) [][]
 	// TODO: how it can happen to have no columnFilter when keys check at the beginning?
 	where_clause := ""
 	if len(columnsFilter) > 0 {
-		where_clause = fmt.Sprintf("WHERE (%s) IN (%s)", strings.Join(columnsFilter, ", "), strings.Join(values, ","))
+		where_clause = fmt.Sprintf("WHERE (%s) IN (%s)", strings.Join(quoteIdentifiers(columnsFilter), ", "), strings.Join(values, ","))
 	}
 
-	sql := fmt.Sprintf(`SELECT %s FROM %s %s;`, formattedColumns, table.Name, where_clause)
+	sql := fmt.Sprintf(`SELECT %s FROM %s %s%s;`, formattedColumns, quoteIdentifier(table.Name), where_clause, formatOrderByClause(table))
 	return sqlUtil.ExecuteQueryWithResults(db, sql)
 }
 
@@ -239,6 +356,13 @@ func filterRowData(value []sqlUtil.RowDataStructure, table schemareader.Table) [
 	return value
 }
 
+// substituteRow returns the values of the row as written on the target: with its keys substituted and without its
+// unexported columns
+func substituteRow(db *sql.DB, table schemareader.Table, row []sqlUtil.RowDataStructure,
+	schemaMetadata map[string]schemareader.Table) []sqlUtil.RowDataStructure {
+	return filterRowData(substituteKeys(db, table, row, schemaMetadata), table)
+}
+
 func substituteKeys(db *sql.DB, table schemareader.Table, row []sqlUtil.RowDataStructure, tableMap map[string]schemareader.Table) []sqlUtil.RowDataStructure {
 	values := substitutePrimaryKey(table, row)
 	values = SubstituteForeignKey(db, table, tableMap, values)
@@ -254,7 +378,7 @@ func substitutePrimaryKey(table schemareader.Table, row []sqlUtil.RowDataStructu
 	for _, column := range row {
 		if pkSequence && table.PKColumns[column.ColumnName] && len(table.PKColumns) == 1 {
 			column.ColumnType = "SQL"
-			column.Value = fmt.Sprintf("SELECT nextval('%s')", table.PKSequence)
+			column.Value = fmt.Sprintf("SELECT nextval(%s)", pq.QuoteLiteral(qualifySequenceName(table.PKSequence)))
 			rowResult = append(rowResult, column)
 		} else {
 			rowResult = append(rowResult, column)
@@ -272,34 +396,45 @@ func SubstituteForeignKey(db *sql.DB, table schemareader.Table, tables map[strin
 
 func substituteForeignKeyReference(db *sql.DB, table schemareader.Table,
 	tables map[string]schemareader.Table, reference schemareader.Reference, row []sqlUtil.RowDataStructure) []sqlUtil.RowDataStructure {
+	if mapReferenceId(table, reference, row) {
+		return row
+	}
 	foreignTable := tables[reference.TableName]
 
-	foreignMainUniqueColumns := foreignTable.UniqueIndexes[foreignTable.MainUniqueIndexName].Columns
-	localColumns := make([]string, 0)
-	foreignColumns := make([]string, 0)
+	foreignIndexName := foreignTable.MainUniqueIndexName
+	if reference.UniqueIndexName != "" {
+		foreignIndexName = reference.UniqueIndexName
+	}
+	foreignMainUniqueColumns := foreignTable.UniqueIndexes[foreignIndexName].Columns
+	localColumns := reference.LocalColumns()
+	foreignColumns := reference.ForeignColumns()
 
 	whereParameters := make([]string, 0)
 	scanParameters := make([]interface{}, 0)
-	for localColumn, foreignColumn := range reference.ColumnMapping {
-		localColumns = append(localColumns, localColumn)
-		foreignColumns = append(foreignColumns, foreignColumn)
-
-		whereParameters = append(whereParameters, fmt.Sprintf("%s = $%d", foreignColumn, len(whereParameters)+1))
+	for i, localColumn := range localColumns {
+		foreignColumn := foreignColumns[i]
+		whereParameters = append(whereParameters, fmt.Sprintf("%s = $%d", quoteIdentifier(foreignColumn), len(whereParameters)+1))
 		scanParameters = append(scanParameters, row[table.ColumnIndexes[localColumn]].Value)
 	}
 
-	formattedColumns := strings.Join(foreignTable.Columns, ", ")
+	formattedColumns := strings.Join(quoteIdentifiers(foreignTable.Columns), ", ")
 	formattedWhereParameters := strings.Join(whereParameters, " AND ")
 
-	sql := fmt.Sprintf(`SELECT %s FROM %s WHERE %s;`, formattedColumns, reference.TableName, formattedWhereParameters)
+	sql := fmt.Sprintf(`SELECT %s FROM %s WHERE %s;`, formattedColumns, quoteIdentifier(reference.TableName), formattedWhereParameters)
 	key := fmt.Sprintf("%s,%s,%s", reference.TableName, formattedWhereParameters, scanParameters)
+	if reference.UniqueIndexName != "" {
+		// the same row is matched by another index for the other references
+		key = fmt.Sprintf("%s,%s", key, reference.UniqueIndexName)
+	}
 
-	cachedValue, found := cache[key]
+	// the cache holds one sub query per referenced column for composite references
+	_, found := cache[fmt.Sprintf("%s,%s", key, foreignColumns[0])]
 
 	if found {
-		//Assuming there will be one entry in reference.ColumnMapping
-		row[table.ColumnIndexes[localColumns[0]]].Value = cachedValue
-		row[table.ColumnIndexes[localColumns[0]]].ColumnType = "SQL"
+		for i, localColumn := range localColumns {
+			row[table.ColumnIndexes[localColumn]].Value = cache[fmt.Sprintf("%s,%s", key, foreignColumns[i])]
+			row[table.ColumnIndexes[localColumn]].ColumnType = "SQL"
+		}
 	} else {
 		rows := sqlUtil.ExecuteQueryWithResults(db, sql, scanParameters...)
 		// we will only change for a sub query if we were able to find the target Value
@@ -321,12 +456,12 @@ func substituteForeignKeyReference(db *sql.DB, table schemareader.Table,
 					if strings.Compare(c.ColumnName, foreignColumn) == 0 {
 						if c.Value == nil {
 							whereParameters = append(whereParameters, fmt.Sprintf("%s IS NULL",
-								foreignColumn))
+								quoteIdentifier(foreignColumn)))
 						} else {
 							foreignReference := foreignTable.GetFirstReferenceFromColumn(foreignColumn)
 							if strings.Compare(foreignReference.TableName, "") == 0 {
 								whereParameters = append(whereParameters, fmt.Sprintf("%s = %s",
-									foreignColumn, formatField(c)))
+									quoteIdentifier(foreignColumn), formatField(c)))
 							} else {
 								//copiedrow := make([]sqlUtil.RowDataStructure, len(rows[0]))
 								//copy(copiedrow, rows[0])
@@ -339,7 +474,7 @@ func substituteForeignKeyReference(db *sql.DB, table schemareader.Table,
 									}
 								}
 								whereParameters = append(whereParameters, fmt.Sprintf("%s = %s",
-									foreignColumn, fieldToUpdate))
+									quoteIdentifier(foreignColumn), fieldToUpdate))
 							}
 
 						}
@@ -349,10 +484,11 @@ func substituteForeignKeyReference(db *sql.DB, table schemareader.Table,
 			}
 
 			for localColumn, foreignColumn := range reference.ColumnMapping {
-				updateSql := fmt.Sprintf(`SELECT %s FROM %s WHERE %s LIMIT 1`, foreignColumn, reference.TableName, strings.Join(whereParameters, " AND "))
+				updateSql := fmt.Sprintf(`SELECT %s FROM %s WHERE %s LIMIT 1`, quoteIdentifier(foreignColumn), QuoteTableName(reference.TableName),
+					strings.Join(whereParameters, " AND "))
 				row[table.ColumnIndexes[localColumn]].Value = updateSql
 				row[table.ColumnIndexes[localColumn]].ColumnType = "SQL"
-				cache[key] = updateSql
+				cache[fmt.Sprintf("%s,%s", key, foreignColumn)] = updateSql
 			}
 		}
 	}
@@ -367,6 +503,10 @@ func formatRowValue(value []sqlUtil.RowDataStructure) string {
 	return strings.Join(result, ",")
 }
 
+// formatField writes the value as a SQL literal. NULL values are scanned as nil and written as null,
+// so they are not mixed up with empty strings, written as ''.
+// The array and JSON literals are cast to their type: in the SELECT of an INSERT an untyped literal is read as text,
+// which can't be assigned to such a column.
 func formatField(col sqlUtil.RowDataStructure) string {
 	if col.Value == nil {
 		return "null"
@@ -379,8 +519,15 @@ func formatField(col sqlUtil.RowDataStructure) string {
 		val = pq.QuoteLiteral(string(pq.FormatTimestamp(col.Value.(time.Time))))
 	case "SQL":
 		val = fmt.Sprintf(`(%s)`, col.Value)
+	case "JSON", "JSONB":
+		val = quoteLiteral(fmt.Sprintf("%s", col.Value)) + "::" + strings.ToLower(col.ColumnType)
 	default:
-		val = pq.QuoteLiteral(fmt.Sprintf("%s", col.Value))
+		val = quoteLiteral(fmt.Sprintf("%s", col.Value))
+		// the array types are named after their element type prefixed by an underscore, like _TEXT for text[].
+		// The value is read in the array literal syntax, like {a,"b c"}, and kept as is.
+		if strings.HasPrefix(col.ColumnType, "_") {
+			val = fmt.Sprintf("%s::%s[]", val, strings.ToLower(col.ColumnType[1:]))
+		}
 	}
 	return val
 }
@@ -389,14 +536,29 @@ func formatColumnAssignment(table schemareader.Table) string {
 	assignments := make([]string, 0)
 	for _, column := range table.Columns {
 		if !table.PKColumns[column] && !table.UnexportColumns[column] {
-			assignments = append(assignments, fmt.Sprintf("%s = excluded.%s", column, column))
+			assignments = append(assignments, fmt.Sprintf("%s = excluded.%s", quoteIdentifier(column), quoteIdentifier(column)))
 		}
 	}
 	return strings.Join(assignments, ",")
 }
 
+// formatConflictTarget returns the columns matching the rows of the table on the target:
+// the ones of the main unique index or, without one, the primary key columns
+func formatConflictTarget(table schemareader.Table) string {
+	columns := table.UniqueIndexes[table.MainUniqueIndexName].Columns
+	if table.MainUniqueIndexName == "" {
+		columns = make([]string, 0)
+		for _, column := range table.Columns {
+			if table.PKColumns[column] {
+				columns = append(columns, column)
+			}
+		}
+	}
+	return "(" + strings.Join(quoteIdentifiers(columns), ", ") + ")"
+}
+
 func formatOnConflict(row []sqlUtil.RowDataStructure, table schemareader.Table) string {
-	constraint := "(" + strings.Join(table.UniqueIndexes[table.MainUniqueIndexName].Columns, ", ") + ")"
+	constraint := formatConflictTarget(table)
 	switch table.Name {
 	case "rhnerrataseverity":
 		constraint = "(id)"
@@ -466,16 +628,17 @@ func generateClearTable(db *sql.DB, writer *bufio.Writer, table schemareader.Tab
 	schemaMetadata map[string]schemareader.Table, options PrintSqlOptions) {
 
 	// generates the delete statement for the table
-	existingRecords := buildQueryToGetExistingRecords(path, table, schemaMetadata, options.CleanWhereClause)
-	mainUniqueColumns := strings.Join(table.UniqueIndexes[table.MainUniqueIndexName].Columns, ",")
+	existingRecords := buildQueryToGetExistingRecords(path, table, schemaMetadata, options.CleanWhereClause, quoteIdentifier)
+	targetRecords := buildQueryToGetExistingRecords(path, table, schemaMetadata, options.CleanWhereClause, QuoteTableName)
+	mainUniqueColumns := strings.Join(quoteIdentifiers(table.UniqueIndexes[table.MainUniqueIndexName].Columns), ",")
 
 	cleanEmptyTable := fmt.Sprintf("\nDELETE FROM %s WHERE (%s) IN (%s);",
-		table.Name, mainUniqueColumns, existingRecords)
+		QuoteTableName(table.Name), mainUniqueColumns, targetRecords)
 	writer.WriteString(cleanEmptyTable + "\n")
 
 	// repopulate all pre-existing data
-	allTableRecordsSql := fmt.Sprintf("SELECT * FROM %s WHERE (%s) IN (%s);",
-		table.Name, mainUniqueColumns, existingRecords)
+	allTableRecordsSql := fmt.Sprintf("SELECT %s FROM %s WHERE (%s) IN (%s);",
+		strings.Join(quoteIdentifiers(table.Columns), ", "), quoteIdentifier(table.Name), mainUniqueColumns, existingRecords)
 	allTableRecords := sqlUtil.ExecuteQueryWithResults(db, allTableRecordsSql)
 	for _, record := range allTableRecords {
 		insertStatement := generateRowInsertStatement(db, record, table, schemaMetadata, []string{table.Name})
@@ -484,20 +647,27 @@ func generateClearTable(db *sql.DB, writer *bufio.Writer, table schemareader.Tab
 	}
 }
 
-func buildQueryToGetExistingRecords(path []string, table schemareader.Table, schemaMetadata map[string]schemareader.Table, cleanWhereClause string) string {
+// buildQueryToGetExistingRecords returns the query of the main unique index values of the rows of the table reached
+// through the path, with the table names written by quoteTable: the query is run on the source and on the target
+func buildQueryToGetExistingRecords(path []string, table schemareader.Table, schemaMetadata map[string]schemareader.Table,
+	cleanWhereClause func(quoteTable func(string) string) string, quoteTable func(string) string) string {
 	mainUniqueColumns := ""
 	for _, column := range table.UniqueIndexes[table.MainUniqueIndexName].Columns {
 		if len(mainUniqueColumns) > 0 {
 			mainUniqueColumns = mainUniqueColumns + ", "
 		}
-		mainUniqueColumns = mainUniqueColumns + table.Name + "." + column
+		mainUniqueColumns = mainUniqueColumns + quoteIdentifier(table.Name) + "." + quoteIdentifier(column)
 	}
 
-	joinsClause := getJoinsClause(path, schemaMetadata)
-	return fmt.Sprintf(`SELECT %s FROM %s %s %s`, mainUniqueColumns, table.Name, joinsClause, cleanWhereClause)
+	joinsClause := getJoinsClause(path, schemaMetadata, quoteTable)
+	whereClause := ""
+	if cleanWhereClause != nil {
+		whereClause = cleanWhereClause(quoteTable)
+	}
+	return fmt.Sprintf(`SELECT %s FROM %s %s %s`, mainUniqueColumns, quoteTable(table.Name), joinsClause, whereClause)
 }
 
-func getJoinsClause(path []string, schemaMetadata map[string]schemareader.Table) string {
+func getJoinsClause(path []string, schemaMetadata map[string]schemareader.Table, quoteTable func(string) string) string {
 	var result strings.Builder
 	reversePath := make([]string, len(path))
 	copy(reversePath, path)
@@ -505,6 +675,8 @@ func getJoinsClause(path []string, schemaMetadata map[string]schemareader.Table)
 	for i := 0; i < len(reversePath)-1; i++ {
 		firstTable := reversePath[i]
 		secondTable := reversePath[i+1]
+		quotedFirstTable := quoteIdentifier(firstTable)
+		quotedSecondTable := quoteIdentifier(secondTable)
 		reverseRelationLookup := false
 		relationFound := findRelationInfo(schemaMetadata[firstTable].ReferencedBy, firstTable, secondTable)
 		if relationFound == nil {
@@ -513,9 +685,11 @@ func getJoinsClause(path []string, schemaMetadata map[string]schemareader.Table)
 		}
 		for key, value := range relationFound {
 			if reverseRelationLookup {
-				result.WriteString(fmt.Sprintf(` INNER JOIN %s on %s.%s = %s.%s`, secondTable, secondTable, value, firstTable, key))
+				result.WriteString(fmt.Sprintf(` INNER JOIN %s on %s.%s = %s.%s`, quoteTable(secondTable), quotedSecondTable, quoteIdentifier(value),
+					quotedFirstTable, quoteIdentifier(key)))
 			} else {
-				result.WriteString(fmt.Sprintf(` INNER JOIN %s on %s.%s = %s.%s`, secondTable, secondTable, key, firstTable, value))
+				result.WriteString(fmt.Sprintf(` INNER JOIN %s on %s.%s = %s.%s`, quoteTable(secondTable), quotedSecondTable, quoteIdentifier(key),
+					quotedFirstTable, quoteIdentifier(value)))
 			}
 
 		}
@@ -547,9 +721,9 @@ func prepareColumnNames(table schemareader.Table) string {
 		_, ignore := table.UnexportColumns[column]
 		if !ignore {
 			if len(returnColumn) == 0 {
-				returnColumn = returnColumn + column
+				returnColumn = returnColumn + quoteIdentifier(column)
 			} else {
-				returnColumn = returnColumn + ", " + column
+				returnColumn = returnColumn + ", " + quoteIdentifier(column)
 			}
 		}
 	}
@@ -558,11 +732,30 @@ func prepareColumnNames(table schemareader.Table) string {
 
 func generateRowInsertStatement(db *sql.DB, values []sqlUtil.RowDataStructure, table schemareader.Table,
 	schemaMetadata map[string]schemareader.Table, onlyIfParentExistsTables []string) string {
+	statement, insert := generateRowInsert(db, values, table, schemaMetadata, onlyIfParentExistsTables)
+	if insert != nil {
+		return insert.statement()
+	}
+	return statement
+}
+
+// generateRowInsert returns the statement inserting the row with its values transformed or, for an INSERT of VALUES
+// which can be merged with the ones of the other rows of the table, its parts
+func generateRowInsert(db *sql.DB, values []sqlUtil.RowDataStructure, table schemareader.Table,
+	schemaMetadata map[string]schemareader.Table, onlyIfParentExistsTables []string) (string, *rowInsert) {
+	return formatRowInsert(substituteRow(db, table, transformRow(table, values), schemaMetadata), table, onlyIfParentExistsTables)
+}
 
-	tableName := table.Name
+// formatRowInsert is generateRowInsert for the values of a row already substituted by substituteRow
+func formatRowInsert(valueFiltered []sqlUtil.RowDataStructure, table schemareader.Table,
+	onlyIfParentExistsTables []string) (string, *rowInsert) {
+
+	tableName := QuoteTableName(table.Name)
 	columnNames := prepareColumnNames(table)
-	rowKeysProcessed := substituteKeys(db, table, values, schemaMetadata)
-	valueFiltered := filterRowData(rowKeysProcessed, table)
+
+	if table.ReplaceByLabel {
+		return formatReplaceByLabel(table, valueFiltered), nil
+	}
 
 	if strings.Compare(table.MainUniqueIndexName, schemareader.VirtualIndexName) == 0 || utils.Contains(onlyIfParentExistsTables, table.Name) {
 		whereClauseList := make([]string, 0)
@@ -571,10 +764,10 @@ func generateRowInsertStatement(db *sql.DB, values []sqlUtil.RowDataStructure, t
 			for _, value := range valueFiltered {
 				if strings.Compare(indexColumn, value.ColumnName) == 0 {
 					if value.Value == nil {
-						whereClauseList = append(whereClauseList, fmt.Sprintf(" %s IS NULL", value.ColumnName))
+						whereClauseList = append(whereClauseList, fmt.Sprintf(" %s IS NULL", quoteIdentifier(value.ColumnName)))
 					} else {
 						whereClauseList = append(whereClauseList, fmt.Sprintf(" %s = %s",
-							value.ColumnName, formatField(value)))
+							quoteIdentifier(value.ColumnName), formatField(value)))
 					}
 				}
 			}
@@ -597,16 +790,188 @@ func generateRowInsertStatement(db *sql.DB, values []sqlUtil.RowDataStructure, t
 			}
 			parentRecordsExistsClause := strings.Join(parentsRecordsCheckList, " AND ")
 			return fmt.Sprintf(`INSERT INTO %s (%s)	SELECT %s WHERE NOT EXISTS (SELECT 1 FROM %s WHERE %s) AND %s;`,
-				tableName, columnNames, formatRowValue(valueFiltered), tableName, whereClause, parentRecordsExistsClause)
+				tableName, columnNames, formatRowValue(valueFiltered), tableName, whereClause, parentRecordsExistsClause), nil
 		}
 
 		return fmt.Sprintf(`INSERT INTO %s (%s)	SELECT %s WHERE NOT EXISTS (SELECT 1 FROM %s WHERE %s);`,
-			tableName, columnNames, formatRowValue(valueFiltered), tableName, whereClause)
+			tableName, columnNames, formatRowValue(valueFiltered), tableName, whereClause), nil
 
+	} else if table.IdOnly {
+		// the strategy chosen by the user is to insert without any conflict check
+		return "", &rowInsert{head: fmt.Sprintf(`INSERT INTO %s (%s)	VALUES`, tableName, columnNames),
+			values: formatRowValue(valueFiltered)}
 	} else {
 		onConflictFormatted := formatOnConflict(valueFiltered, table)
-		return fmt.Sprintf(`INSERT INTO %s (%s)	VALUES (%s) ON CONFLICT %s;`,
-			tableName, columnNames, formatRowValue(valueFiltered), onConflictFormatted)
+		if secondaryGuard := formatSecondaryUniqueGuard(table, valueFiltered); secondaryGuard != "" {
+			return fmt.Sprintf(`INSERT INTO %s (%s)	SELECT %s WHERE %s ON CONFLICT %s;`,
+				tableName, columnNames, formatRowValue(valueFiltered), secondaryGuard, onConflictFormatted), nil
+		}
+		return "", &rowInsert{head: fmt.Sprintf(`INSERT INTO %s (%s)	VALUES`, tableName, columnNames),
+			values: formatRowValue(valueFiltered), onConflict: " ON CONFLICT " + onConflictFormatted}
+	}
+
+}
+
+// ApplyIdOnlyStrategy adapts the tables which can only be matched by id to the export strategy chosen by the user,
+// inserted without conflict check when no strategy is chosen for the exports to keep running
+func ApplyIdOnlyStrategy(schemaMetadata map[string]schemareader.Table, strategy string) error {
+	for _, tableName := range schemareader.IdOnlyTables(schemaMetadata) {
+		table := schemaMetadata[tableName]
+		switch strategy {
+		case "", IdOnlyInsert:
+			continue
+		case IdOnlyRemap:
+			// use all the exported columns as a virtual natural key
+			virtualIndexColumns := make([]string, 0)
+			for _, column := range table.Columns {
+				if !table.PKColumns[column] && !table.UnexportColumns[column] {
+					virtualIndexColumns = append(virtualIndexColumns, column)
+				}
+			}
+			table.UniqueIndexes[schemareader.VirtualIndexName] = schemareader.UniqueIndex{
+				Name: schemareader.VirtualIndexName, Columns: virtualIndexColumns}
+			table.MainUniqueIndexName = schemareader.VirtualIndexName
+			table.IdOnly = false
+		case IdOnlySkip:
+			table.Export = false
+		default:
+			return fmt.Errorf("unknown strategy %q to export tables only matched by id: %s", strategy, strings.Join(schemareader.IdOnlyTables(schemaMetadata), ", "))
+		}
+		schemaMetadata[tableName] = table
+	}
+	return nil
+}
+
+// formatReplaceByLabel updates the row with the same label in place or inserts it if missing.
+// Contrary to an upsert, the id of an existing row is never changed so the references to it stay valid.
+func formatReplaceByLabel(table schemareader.Table, values []sqlUtil.RowDataStructure) string {
+	labelClause := ""
+	assignments := make([]string, 0)
+	for _, value := range values {
+		if strings.Compare(value.ColumnName, "label") == 0 {
+			labelClause = fmt.Sprintf("label = %s", formatField(value))
+		} else if !table.PKColumns[value.ColumnName] {
+			assignments = append(assignments, fmt.Sprintf("%s = %s", quoteIdentifier(value.ColumnName), formatField(value)))
+		}
+	}
+	update := ""
+	if len(assignments) > 0 {
+		update = fmt.Sprintf("UPDATE %s SET %s WHERE %s; ", QuoteTableName(table.Name), strings.Join(assignments, ", "), labelClause)
+	}
+	return fmt.Sprintf(`%sINSERT INTO %s (%s)	SELECT %s WHERE NOT EXISTS (SELECT 1 FROM %s WHERE %s);`,
+		update, QuoteTableName(table.Name), prepareColumnNames(table), formatRowValue(values), QuoteTableName(table.Name), labelClause)
+}
+
+// ApplyReplaceByLabel makes the rows of the given dictionary tables replaced by label on the target
+func ApplyReplaceByLabel(schemaMetadata map[string]schemareader.Table, tableNames []string) error {
+	for _, tableName := range tableNames {
+		table, ok := schemaMetadata[strings.ToLower(tableName)]
+		if !ok {
+			continue
+		}
+		if _, hasLabel := table.ColumnIndexes["label"]; !hasLabel || table.UnexportColumns["label"] {
+			return fmt.Errorf("table %s has no label column to replace its rows by", table.Name)
+		}
+		table.ReplaceByLabel = true
+		schemaMetadata[table.Name] = table
+	}
+	return nil
+}
+
+// DefaultDictionaryTables are the dictionary tables matched by label when none are given
+var DefaultDictionaryTables = []string{"rhnarchtype", "rhnchecksumtype", "rhnerrataseverity", "rhnpackagearch"}
+
+// ExtendDictionaryTables returns the dictionary tables with the extra ones, like the ones of a customized schema
+func ExtendDictionaryTables(tableNames []string, extraTableNames []string) []string {
+	result := make([]string, 0, len(tableNames)+len(extraTableNames))
+	result = append(result, tableNames...)
+	for _, tableName := range extraTableNames {
+		if !utils.Contains(result, strings.ToLower(tableName)) {
+			result = append(result, strings.ToLower(tableName))
+		}
+	}
+	return result
+}
+
+// ApplyDictionaryTables makes the rows of the given dictionary tables and the references to them matched by label,
+// since their ids differ between servers
+func ApplyDictionaryTables(schemaMetadata map[string]schemareader.Table, tableNames []string) error {
+	for _, tableName := range tableNames {
+		table, ok := schemaMetadata[strings.ToLower(tableName)]
+		if !ok {
+			continue
+		}
+		if _, hasLabel := table.ColumnIndexes["label"]; !hasLabel || table.UnexportColumns["label"] {
+			return fmt.Errorf("dictionary table %s has no label column to match its rows by", table.Name)
+		}
+		table.IsDictionary = true
+		table.IdOnly = false
+		if table.UniqueIndexes == nil {
+			table.UniqueIndexes = make(map[string]schemareader.UniqueIndex)
+		}
+		table.MainUniqueIndexName = findLabelIndex(table)
+		schemaMetadata[table.Name] = table
+	}
+	return nil
+}
+
+// findLabelIndex returns the unique index on the label column of the table,
+// or a virtual one added to the table if there is none
+func findLabelIndex(table schemareader.Table) string {
+	for name, index := range table.UniqueIndexes {
+		if index.Predicate == "" && len(index.Columns) == 1 && index.Columns[0] == "label" {
+			return name
+		}
+	}
+	table.UniqueIndexes[schemareader.VirtualIndexName] = schemareader.UniqueIndex{
+		Name: schemareader.VirtualIndexName, Columns: []string{"label"}}
+	return schemareader.VirtualIndexName
+}
+
+// formatIndexMatch returns the condition matching the index values of the row.
+// The second returned value is false if a value is NULL, since NULL values never conflict in a unique index.
+func formatIndexMatch(index schemareader.UniqueIndex, values []sqlUtil.RowDataStructure) (string, bool) {
+	matchList := make([]string, 0)
+	for _, indexColumn := range index.Columns {
+		for _, value := range values {
+			if strings.Compare(indexColumn, value.ColumnName) == 0 {
+				if value.Value == nil {
+					return "", false
+				}
+				matchList = append(matchList, fmt.Sprintf("%s = %s", quoteIdentifier(value.ColumnName), formatField(value)))
+			}
+		}
 	}
+	return strings.Join(matchList, " AND "), len(matchList) == len(index.Columns)
+}
 
+// formatSecondaryUniqueGuard returns the condition skipping the row if another row of the target
+// already uses the same values for a secondary unique index: ON CONFLICT only handles the main one.
+func formatSecondaryUniqueGuard(table schemareader.Table, values []sqlUtil.RowDataStructure) string {
+	if !table.SkipSecondaryUniqueConflicts {
+		return ""
+	}
+	mainMatch, mainComplete := formatIndexMatch(table.UniqueIndexes[table.MainUniqueIndexName], values)
+	guards := make([]string, 0)
+	for _, indexName := range table.SecondaryUniqueIndexes() {
+		secondaryMatch, complete := formatIndexMatch(table.UniqueIndexes[indexName], values)
+		if !complete {
+			continue
+		}
+		if mainComplete {
+			secondaryMatch = fmt.Sprintf("%s AND NOT (%s)", secondaryMatch, mainMatch)
+		}
+		guards = append(guards, fmt.Sprintf("NOT EXISTS (SELECT 1 FROM %s WHERE %s)", QuoteTableName(table.Name), secondaryMatch))
+	}
+	return strings.Join(guards, " AND ")
+}
+
+// ApplySkipSecondaryUniqueConflicts makes the rows conflicting on secondary unique indexes skipped on import
+func ApplySkipSecondaryUniqueConflicts(schemaMetadata map[string]schemareader.Table) {
+	for name, table := range schemaMetadata {
+		if len(table.SecondaryUniqueIndexes()) > 0 {
+			table.SkipSecondaryUniqueConflicts = true
+			schemaMetadata[name] = table
+		}
+	}
 }
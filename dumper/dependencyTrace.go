@@ -0,0 +1,71 @@
+package dumper
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/sqlUtil"
+)
+
+// Reasons for a row to be exported, written in the dependency trace
+const (
+	// TraceSeed is a starting row of the export, like the channel of a channel export
+	TraceSeed = "seed"
+	// TraceReferencedBy is a row referenced by the row it was reached from
+	TraceReferencedBy = "referenced by"
+	// TraceReferences is a row referencing the row it was reached from
+	TraceReferences = "references"
+)
+
+// DependencyTrace writes why each row found by the crawler is exported, one tab separated line per row with the row,
+// the reason, the row it was first reached from and the starting row of the export it comes from.
+// The rows are named by their main unique index, or their primary key, like rhnchannel(label='sles15').
+type DependencyTrace struct {
+	writer *bufio.Writer
+}
+
+func NewDependencyTrace(writer *bufio.Writer) *DependencyTrace {
+	return &DependencyTrace{writer: writer}
+}
+
+func (trace *DependencyTrace) addRow(schemaMetadata map[string]schemareader.Table, item *processItem) {
+	row := describeRow(schemaMetadata[item.tableName], item.row)
+	if item.parent == nil {
+		trace.writer.WriteString(fmt.Sprintf("%s\t%s\t\t%s\n", row, TraceSeed, row))
+		return
+	}
+	reason := TraceReferencedBy
+	if item.child {
+		reason = TraceReferences
+	}
+	seed := item.parent
+	for seed.parent != nil {
+		seed = seed.parent
+	}
+	trace.writer.WriteString(fmt.Sprintf("%s\t%s\t%s\t%s\n", row, reason,
+		describeRow(schemaMetadata[item.parent.tableName], item.parent.row),
+		describeRow(schemaMetadata[seed.tableName], seed.row)))
+}
+
+// describeRow names the row by the columns matching it on the target: its main unique index, its primary key or,
+// without them, all its columns
+func describeRow(table schemareader.Table, row []sqlUtil.RowDataStructure) string {
+	columns := table.Columns
+	if table.MainUniqueIndexName != "" && table.MainUniqueIndexName != schemareader.VirtualIndexName {
+		columns = table.UniqueIndexes[table.MainUniqueIndexName].Columns
+	} else if len(table.PKColumns) > 0 {
+		columns = make([]string, 0, len(table.PKColumns))
+		for _, column := range table.Columns {
+			if table.PKColumns[column] {
+				columns = append(columns, column)
+			}
+		}
+	}
+	values := make([]string, 0, len(columns))
+	for _, column := range columns {
+		values = append(values, fmt.Sprintf("%s=%s", column, formatField(row[table.ColumnIndexes[column]])))
+	}
+	return fmt.Sprintf("%s(%s)", table.Name, strings.Join(values, ", "))
+}
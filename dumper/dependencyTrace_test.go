@@ -0,0 +1,70 @@
+package dumper
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/tests"
+)
+
+func TestDependencyTrace(t *testing.T) {
+
+	// Arrange
+	repo := tests.CreateDataRepository()
+	schemaMetadata := map[string]schemareader.Table{
+		"rhnchannel": {
+			Name:                "rhnchannel",
+			Export:              true,
+			Columns:             []string{"id", "label"},
+			ColumnIndexes:       map[string]int{"id": 0, "label": 1},
+			PKColumns:           map[string]bool{"id": true},
+			UniqueIndexes:       map[string]schemareader.UniqueIndex{"rhn_channel_label_uq": {Name: "rhn_channel_label_uq", Columns: []string{"label"}}},
+			MainUniqueIndexName: "rhn_channel_label_uq",
+			ReferencedBy:        []schemareader.Reference{{TableName: "rhnchannelpackage", ColumnMapping: map[string]string{"channel_id": "id"}}},
+		},
+		"rhnchannelpackage": {
+			Name:                "rhnchannelpackage",
+			Export:              true,
+			Columns:             []string{"package_id", "channel_id"},
+			ColumnIndexes:       map[string]int{"package_id": 0, "channel_id": 1},
+			UniqueIndexes:       map[string]schemareader.UniqueIndex{"rhn_cp_cp_uq": {Name: "rhn_cp_cp_uq", Columns: []string{"channel_id", "package_id"}}},
+			MainUniqueIndexName: "rhn_cp_cp_uq",
+			References: []schemareader.Reference{
+				{TableName: "rhnchannel", ColumnMapping: map[string]string{"channel_id": "id"}},
+				{TableName: "rhnpackage", ColumnMapping: map[string]string{"package_id": "id"}},
+			},
+		},
+		"rhnpackage": {
+			Name:          "rhnpackage",
+			Export:        true,
+			Columns:       []string{"id"},
+			ColumnIndexes: map[string]int{"id": 0},
+			PKColumns:     map[string]bool{"id": true},
+		},
+	}
+	repo.ExpectWithRecords("SELECT id, label FROM rhnchannel WHERE label = 'sles' ORDER BY id ;",
+		sqlmock.NewRows([]string{"id", "label"}).AddRow("0001", "sles"))
+	repo.ExpectWithRecords("SELECT package_id, channel_id FROM rhnchannelpackage WHERE channel_id = $1 ORDER BY channel_id, package_id;",
+		sqlmock.NewRows([]string{"package_id", "channel_id"}).AddRow("0002", "0001"), "0001")
+	repo.ExpectWithRecords("SELECT id FROM rhnpackage WHERE id = $1 ORDER BY id;", sqlmock.NewRows([]string{"id"}).AddRow("0002"), "0002")
+	var buffer bytes.Buffer
+	writer := bufio.NewWriter(&buffer)
+
+	// Act
+	DataCrawler(repo.DB, schemaMetadata, schemaMetadata["rhnchannel"], "label = 'sles'", "", NewDependencyTrace(writer))
+	writer.Flush()
+
+	// Assert
+	expected := "rhnchannel(label='sles')\tseed\t\trhnchannel(label='sles')\n" +
+		"rhnchannelpackage(channel_id='0001', package_id='0002')\treferences\trhnchannel(label='sles')\trhnchannel(label='sles')\n" +
+		"rhnpackage(id='0002')\treferenced by\trhnchannelpackage(channel_id='0001', package_id='0002')\trhnchannel(label='sles')\n"
+	if buffer.String() != expected {
+		t.Errorf("Unexpected dependency trace:\n%s", buffer.String())
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
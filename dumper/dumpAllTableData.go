@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"database/sql"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/rs/zerolog/log"
@@ -12,10 +13,13 @@ import (
 )
 
 func DumpAllTablesData(db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table,
-	startingTables []schemareader.Table, whereFilterClause func(table schemareader.Table) string, onlyIfParentExistsTables []string) {
+	startingTables []schemareader.Table, whereFilterClause func(table schemareader.Table) string, onlyIfParentExistsTables []string,
+	pagination Pagination) {
 
+	progress := newExportedTablesProgress(schemaMetadata)
 	// exporting from the starting tables.
-	processedTables := DumpReachableTablesData(db, writer, schemaMetadata, startingTables, whereFilterClause, onlyIfParentExistsTables, make(map[string]bool))
+	processedTables := dumpReachableTablesData(db, writer, schemaMetadata, startingTables, whereFilterClause, onlyIfParentExistsTables,
+		make(map[string]bool), pagination, progress)
 	// Export tables not visited when exporting the starting tables
 	for schemaTableName, schemaTable := range schemaMetadata {
 		if !schemaTable.Export {
@@ -25,26 +29,36 @@ func DumpAllTablesData(db *sql.DB, writer *bufio.Writer, schemaMetadata map[stri
 		if ok {
 			continue
 		}
-		exportAllTableData(db, writer, schemaMetadata, schemaTable, whereFilterClause, onlyIfParentExistsTables)
+		exportAllTableData(db, writer, schemaMetadata, schemaTable, whereFilterClause, onlyIfParentExistsTables, pagination)
+		progress.next(schemaTableName)
 	}
 }
 
 func DumpReachableTablesData(db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table,
-	startingTables []schemareader.Table, whereFilterClause func(table schemareader.Table) string, onlyIfParentExistsTables []string, processedTables map[string]bool) map[string]bool {
+	startingTables []schemareader.Table, whereFilterClause func(table schemareader.Table) string, onlyIfParentExistsTables []string, processedTables map[string]bool,
+	pagination Pagination) map[string]bool {
+	return dumpReachableTablesData(db, writer, schemaMetadata, startingTables, whereFilterClause, onlyIfParentExistsTables,
+		processedTables, pagination, newExportedTablesProgress(schemaMetadata))
+}
+
+func dumpReachableTablesData(db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table,
+	startingTables []schemareader.Table, whereFilterClause func(table schemareader.Table) string, onlyIfParentExistsTables []string, processedTables map[string]bool,
+	pagination Pagination, progress *tableProgress) map[string]bool {
 
 	for _, startingTable := range startingTables {
 		_, ok := processedTables[startingTable.Name]
 		if ok {
 			continue
 		}
-		processedTables = processTableDataWithLinks(db, writer, schemaMetadata, startingTable, whereFilterClause, processedTables, make([]string, 0), onlyIfParentExistsTables)
+		processedTables = processTableDataWithLinks(db, writer, schemaMetadata, startingTable, whereFilterClause, processedTables, make([]string, 0), onlyIfParentExistsTables, pagination, progress)
 	}
 
 	return processedTables
 }
 
 func processTableDataWithLinks(db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table, table schemareader.Table,
-	whereFilterClause func(table schemareader.Table) string, processedTables map[string]bool, path []string, onlyIfParentExistsTables []string) map[string]bool {
+	whereFilterClause func(table schemareader.Table) string, processedTables map[string]bool, path []string, onlyIfParentExistsTables []string,
+	pagination Pagination, progress *tableProgress) map[string]bool {
 	log.Trace().Msgf("Processing table: %s", table.Name)
 	_, tableProcessed := processedTables[table.Name]
 	currentTable := schemaMetadata[table.Name]
@@ -60,11 +74,12 @@ func processTableDataWithLinks(db *sql.DB, writer *bufio.Writer, schemaMetadata
 			continue
 		}
 		log.Trace().Msgf("Table processed: %s", table.Name)
-		processTableDataWithLinks(db, writer, schemaMetadata, tableReference, whereFilterClause, processedTables, path, onlyIfParentExistsTables)
+		processTableDataWithLinks(db, writer, schemaMetadata, tableReference, whereFilterClause, processedTables, path, onlyIfParentExistsTables, pagination, progress)
 
 	}
 
-	exportAllTableData(db, writer, schemaMetadata, table, whereFilterClause, onlyIfParentExistsTables)
+	exportAllTableData(db, writer, schemaMetadata, table, whereFilterClause, onlyIfParentExistsTables, pagination)
+	progress.next(table.Name)
 
 	for _, reference := range table.ReferencedBy {
 		tableReference, ok := schemaMetadata[reference.TableName]
@@ -74,22 +89,158 @@ func processTableDataWithLinks(db *sql.DB, writer *bufio.Writer, schemaMetadata
 		if !shouldFollowReferenceToLink(path, table, tableReference) {
 			continue
 		}
-		processTableDataWithLinks(db, writer, schemaMetadata, tableReference, whereFilterClause, processedTables, path, onlyIfParentExistsTables)
+		processTableDataWithLinks(db, writer, schemaMetadata, tableReference, whereFilterClause, processedTables, path, onlyIfParentExistsTables, pagination, progress)
 
 	}
 	return processedTables
 }
 
 func exportAllTableData(db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table, table schemareader.Table,
-	whereFilterClause func(table schemareader.Table) string, onlyIfParentExistsTables []string) {
+	whereFilterClause func(table schemareader.Table) string, onlyIfParentExistsTables []string, pagination Pagination) {
 
 	log.Trace().Msgf("Exporting data for table %s", table.Name)
-	formattedColumns := strings.Join(table.Columns, ", ")
-	sql := fmt.Sprintf(`SELECT %s FROM %s %s;`, formattedColumns, table.Name, whereFilterClause(table))
-	rows := sqlUtil.ExecuteQueryWithResults(db, sql)
+	if table.CopyRows {
+		writer.WriteString(formatCopyHeader(table) + "\n")
+		defer writer.WriteString(copyEndOfData + "\n")
+	}
+	// the rows are merged in batched inserts across the pages
+	batch := newInsertBatch(writer, table, pagination.InsertBatchSize)
+	defer batch.flush()
+	formattedColumns := strings.Join(quoteIdentifiers(table.Columns), ", ")
+	keyColumns := getPaginationKeyColumns(table)
+	if pagination.PageSize <= 0 || len(keyColumns) == 0 {
+		sql := fmt.Sprintf(`SELECT %s FROM %s %s%s;`, formattedColumns, quoteIdentifier(table.Name), addRowFilter(whereFilterClause(table), table),
+			formatOrderByClause(table))
+		rows := sqlUtil.ExecuteQueryWithResults(db, sql)
+
+		for _, row := range rows {
+			writeAllTableRow(db, writer, batch, row, table, schemaMetadata, onlyIfParentExistsTables)
+		}
+		return
+	}
+
+	// keyset pagination: each page starts after the key of the last row of the previous one
+	var lastRow []sqlUtil.RowDataStructure
+	for {
+		whereClause := addRowFilter(whereFilterClause(table), table)
+		if lastRow != nil {
+			keysetClause := formatKeysetClause(table, keyColumns, lastRow)
+			if len(strings.TrimSpace(whereClause)) > 0 {
+				whereClause = fmt.Sprintf("%s AND (%s)", whereClause, keysetClause)
+			} else {
+				whereClause = fmt.Sprintf("WHERE %s", keysetClause)
+			}
+		}
+		sql := fmt.Sprintf(`SELECT %s FROM %s %s ORDER BY %s LIMIT %d;`, formattedColumns, quoteIdentifier(table.Name), whereClause,
+			formatKeysetOrderBy(keyColumns), pagination.PageSize)
+		rows := sqlUtil.ExecuteQueryWithResults(db, sql)
+
+		for _, row := range rows {
+			writeAllTableRow(db, writer, batch, row, table, schemaMetadata, onlyIfParentExistsTables)
+		}
+		if len(rows) < pagination.PageSize {
+			return
+		}
+		lastRow = rows[len(rows)-1]
+	}
+}
+
+// writeAllTableRow writes the row of a full table, its insert added to the batch if not nil
+func writeAllTableRow(db *sql.DB, writer *bufio.Writer, batch *insertBatch, row []sqlUtil.RowDataStructure,
+	table schemareader.Table, schemaMetadata map[string]schemareader.Table, onlyIfParentExistsTables []string) {
+	line, insert := generateRowWrite(db, row, table, schemaMetadata, onlyIfParentExistsTables)
+	switch {
+	case batch != nil && insert != nil:
+		batch.add(insert)
+	case insert != nil:
+		writer.WriteString(insert.statement() + "\n")
+	default:
+		batch.flush()
+		writer.WriteString(line + "\n")
+	}
+}
+
+// getOrderKeyColumns returns the columns sorting the rows of the table, the primary key is preferred
+func getOrderKeyColumns(table schemareader.Table) []string {
+	if keyColumns := getPKColumns(table); len(keyColumns) > 0 {
+		return keyColumns
+	}
+	return table.UniqueIndexes[table.MainUniqueIndexName].Columns
+}
+
+// getPKColumns returns the primary key columns in the table order
+func getPKColumns(table schemareader.Table) []string {
+	keyColumns := make([]string, 0)
+	for _, column := range table.Columns {
+		if table.PKColumns[column] {
+			keyColumns = append(keyColumns, column)
+		}
+	}
+	return keyColumns
+}
 
-	for _, row := range rows {
-		writer.WriteString(generateRowInsertStatement(db, row, table, schemaMetadata, onlyIfParentExistsTables) + "\n")
+// getPaginationKeyColumns returns the columns totally ordering the rows of the table for the keyset pagination: the
+// primary key, or else a unique index without nullable column, the main one first. The rows sharing NULL values of a
+// unique index can't be ordered, they would be skipped at the page boundaries: a table without such a key is read at once.
+func getPaginationKeyColumns(table schemareader.Table) []string {
+	if keyColumns := getPKColumns(table); len(keyColumns) > 0 {
+		return keyColumns
+	}
+	indexNames := make([]string, 0, len(table.UniqueIndexes))
+	for indexName := range table.UniqueIndexes {
+		if indexName != table.MainUniqueIndexName {
+			indexNames = append(indexNames, indexName)
+		}
 	}
+	sort.Strings(indexNames)
+	if _, ok := table.UniqueIndexes[table.MainUniqueIndexName]; ok {
+		indexNames = append([]string{table.MainUniqueIndexName}, indexNames...)
+	}
+	for _, indexName := range indexNames {
+		if isNotNullUniqueIndex(table, indexName) {
+			return table.UniqueIndexes[indexName].Columns
+		}
+	}
+	return nil
+}
 
+// isNotNullUniqueIndex tells if the index is a unique index of all the rows of the table without nullable column.
+// The virtual index of the tables remapped by content isn't unique on the source.
+func isNotNullUniqueIndex(table schemareader.Table, indexName string) bool {
+	index := table.UniqueIndexes[indexName]
+	if indexName == schemareader.VirtualIndexName || index.Predicate != "" || len(index.Columns) == 0 {
+		return false
+	}
+	for _, column := range index.Columns {
+		definition, ok := table.ColumnDefinitions[column]
+		if !ok || definition.IsNullable {
+			return false
+		}
+	}
+	return true
+}
+
+func formatKeysetOrderBy(keyColumns []string) string {
+	orderBy := make([]string, 0)
+	for _, column := range keyColumns {
+		orderBy = append(orderBy, fmt.Sprintf("%s ASC", quoteIdentifier(column)))
+	}
+	return strings.Join(orderBy, ", ")
+}
+
+// formatKeysetClause selects the rows following lastRow in the ORDER BY of formatKeysetOrderBy.
+// The key columns are never NULL: the comparison is expanded column by column.
+func formatKeysetClause(table schemareader.Table, keyColumns []string, lastRow []sqlUtil.RowDataStructure) string {
+	alternatives := make([]string, 0)
+	for i, column := range keyColumns {
+		conditions := make([]string, 0)
+		for _, previousColumn := range keyColumns[:i] {
+			previousValue := lastRow[table.ColumnIndexes[previousColumn]]
+			conditions = append(conditions, fmt.Sprintf("%s = %s", quoteIdentifier(previousColumn), formatField(previousValue)))
+		}
+		value := lastRow[table.ColumnIndexes[column]]
+		conditions = append(conditions, fmt.Sprintf("%s > %s", quoteIdentifier(column), formatField(value)))
+		alternatives = append(alternatives, "("+strings.Join(conditions, " AND ")+")")
+	}
+	return strings.Join(alternatives, " OR ")
 }
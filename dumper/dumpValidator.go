@@ -0,0 +1,172 @@
+package dumper
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var tableHeaderRegexp = regexp.MustCompile(`^-- table (\S+): (\d+) rows$`)
+var tableFooterRegexp = regexp.MustCompile(`^-- table (\S+): \d+ rows exported in `)
+var tableKeyRegexp = regexp.MustCompile(`^-- table (\S+): (planned|written) key (.*)$`)
+
+// formatTableKey formats the key of a row in the table key comments, its columns sorted
+// since the primary key columns are not ordered
+func formatTableKey(key TableKey) string {
+	columns := make([]string, 0, len(key.Key))
+	for _, rowKey := range key.Key {
+		columns = append(columns, fmt.Sprintf("%s=%s", rowKey.Column, rowKey.Value))
+	}
+	sort.Strings(columns)
+	return strings.Join(columns, ", ")
+}
+
+type validatedTable struct {
+	name         string
+	expectedRows int
+	rows         int
+	statements   map[string]bool
+	// the keys of the planned and written rows, without key comments only the counts are checked
+	plannedKeys []string
+	writtenKeys []string
+	// the table of the COPY block being read, if any
+	copyTable string
+}
+
+func (table *validatedTable) addRow(statement string) []string {
+	duplicated := table.statements[statement]
+	table.statements[statement] = true
+	table.rows++
+	if duplicated {
+		return []string{fmt.Sprintf("table %s: duplicated row %s", table.name, statement)}
+	}
+	return nil
+}
+
+func (table *validatedTable) close() []string {
+	discrepancies := make([]string, 0)
+	if table.rows != table.expectedRows {
+		discrepancies = append(discrepancies,
+			fmt.Sprintf("table %s: %d rows planned, %d rows written", table.name, table.expectedRows, table.rows))
+	}
+	if len(table.plannedKeys) == 0 && len(table.writtenKeys) == 0 {
+		return discrepancies
+	}
+	if len(table.writtenKeys) != table.rows {
+		discrepancies = append(discrepancies,
+			fmt.Sprintf("table %s: %d row keys written, %d rows written", table.name, len(table.writtenKeys), table.rows))
+	}
+	// the keys are counted to report the duplicated ones
+	writtenKeys := make(map[string]int)
+	for _, key := range table.writtenKeys {
+		writtenKeys[key]++
+		if writtenKeys[key] == 2 {
+			discrepancies = append(discrepancies, fmt.Sprintf("table %s: duplicated key %s", table.name, key))
+		}
+	}
+	plannedKeys := make(map[string]bool)
+	for _, key := range table.plannedKeys {
+		plannedKeys[key] = true
+		if writtenKeys[key] == 0 {
+			discrepancies = append(discrepancies, fmt.Sprintf("table %s: planned key %s missing", table.name, key))
+		}
+	}
+	for _, key := range table.writtenKeys {
+		if !plannedKeys[key] {
+			discrepancies = append(discrepancies, fmt.Sprintf("table %s: key %s not planned", table.name, key))
+			// reported once
+			plannedKeys[key] = true
+		}
+	}
+	return discrepancies
+}
+
+// ValidateDump scans a dump generated with the table stats comments and checks that each table section
+// contains the number of rows planned by the data crawler, no duplicated row and no row of another table.
+// When the dump has the row key comments, the keys of the written rows are also checked against the planned ones:
+// each missing or unplanned key is reported with its table.
+// It returns the found discrepancies.
+func ValidateDump(reader io.Reader) []string {
+	discrepancies := make([]string, 0)
+	var current *validatedTable
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if match := tableHeaderRegexp.FindStringSubmatch(line); match != nil {
+			if current != nil {
+				discrepancies = append(discrepancies, fmt.Sprintf("table %s: section not terminated", current.name))
+			}
+			expectedRows, _ := strconv.Atoi(match[2])
+			current = &validatedTable{name: match[1], expectedRows: expectedRows, statements: make(map[string]bool)}
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		if match := tableFooterRegexp.FindStringSubmatch(line); match != nil && match[1] == current.name {
+			discrepancies = append(discrepancies, current.close()...)
+			current = nil
+			continue
+		}
+		if match := tableKeyRegexp.FindStringSubmatch(line); match != nil && match[1] == current.name {
+			if match[2] == "planned" {
+				current.plannedKeys = append(current.plannedKeys, match[3])
+			} else {
+				current.writtenKeys = append(current.writtenKeys, match[3])
+			}
+			continue
+		}
+		if current.copyTable != "" {
+			switch {
+			case line == copyEndOfData:
+				current.copyTable = ""
+			case current.copyTable == quoteIdentifier(current.name):
+				discrepancies = append(discrepancies, current.addRow(line)...)
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "COPY ") {
+			current.copyTable = leadingIdentifier(line[len("COPY "):])
+			if current.copyTable != quoteIdentifier(current.name) {
+				discrepancies = append(discrepancies, fmt.Sprintf("table %s: unexpected rows %s", current.name, line))
+			}
+			continue
+		}
+		// rows replaced by label are updated before being inserted if missing
+		statement := line
+		if strings.HasPrefix(statement, "UPDATE ") {
+			if index := strings.Index(statement, "; INSERT INTO "); index >= 0 {
+				statement = statement[index+2:]
+			}
+		}
+		if !strings.HasPrefix(statement, "INSERT INTO ") {
+			continue
+		}
+		if !strings.HasPrefix(statement, fmt.Sprintf("INSERT INTO %s ", QuoteTableName(current.name))) {
+			discrepancies = append(discrepancies, fmt.Sprintf("table %s: unexpected row %s", current.name, statement))
+			continue
+		}
+		if rows := insertValuesRows(statement); len(rows) > 1 {
+			// the rows of a batched INSERT statement are checked one by one
+			head := statement[:strings.Index(statement, "\t")+1] + "VALUES "
+			for _, row := range rows {
+				discrepancies = append(discrepancies, current.addRow(head+row)...)
+			}
+			continue
+		}
+		discrepancies = append(discrepancies, current.addRow(statement)...)
+	}
+	if err := scanner.Err(); err != nil {
+		discrepancies = append(discrepancies, fmt.Sprintf("error reading the dump: %s", err))
+	}
+	if current != nil {
+		discrepancies = append(discrepancies, fmt.Sprintf("table %s: section not terminated", current.name))
+	}
+	return discrepancies
+}
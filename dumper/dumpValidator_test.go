@@ -0,0 +1,89 @@
+package dumper
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateDump(t *testing.T) {
+	// 01 Arrange
+	dump := strings.Join([]string{
+		"BEGIN;",
+		"-- table rhnchannel: 1 rows",
+		"INSERT INTO rhnchannel (id, label)\tVALUES (1, 'a') ON CONFLICT (label) DO UPDATE SET label = excluded.label;",
+		"-- table rhnchannel: 1 rows exported in 2ms",
+		"-- table rhnchecksumtype: 1 rows",
+		"UPDATE rhnchecksumtype SET description = 'SHA-256' WHERE label = 'sha256'; INSERT INTO rhnchecksumtype (id, label)\tSELECT 1, 'sha256';",
+		"-- table rhnchecksumtype: 1 rows exported in 1ms",
+		"-- table rhnpackage: 3 rows",
+		"INSERT INTO rhnpackage (id)\tSELECT 1;",
+		"INSERT INTO rhnpackage (id)\tSELECT 1;",
+		"INSERT INTO rhnchannel (id)\tSELECT 2;",
+		"-- table rhnpackage: 3 rows exported in 5ms",
+		"-- table rhnerrata: 1 rows",
+		"COMMIT;",
+	}, "\n")
+
+	// 02 Act
+	discrepancies := ValidateDump(strings.NewReader(dump))
+
+	// 03 Assert
+	expected := []string{
+		"table rhnpackage: duplicated row INSERT INTO rhnpackage (id)\tSELECT 1;",
+		"table rhnpackage: unexpected row INSERT INTO rhnchannel (id)\tSELECT 2;",
+		"table rhnpackage: 3 rows planned, 2 rows written",
+		"table rhnerrata: section not terminated",
+	}
+	if !reflect.DeepEqual(discrepancies, expected) {
+		t.Errorf("Unexpected discrepancies: expected %v, got %v", expected, discrepancies)
+	}
+}
+
+func TestValidateDumpKeys(t *testing.T) {
+	// 01 Arrange
+	dump := strings.Join([]string{
+		"BEGIN;",
+		"-- table rhnchannel: 2 rows",
+		"-- table rhnchannel: planned key id=1",
+		"-- table rhnchannel: planned key id=2",
+		"INSERT INTO rhnchannel (id, label)\tVALUES (1, 'a') ON CONFLICT (label) DO UPDATE SET label = excluded.label;",
+		"INSERT INTO rhnchannel (id, label)\tVALUES (3, 'c') ON CONFLICT (label) DO UPDATE SET label = excluded.label;",
+		"-- table rhnchannel: written key id=1",
+		"-- table rhnchannel: written key id=3",
+		"-- table rhnchannel: 2 rows exported in 2ms",
+		"-- table rhnpackagechangelogdata: 1 rows",
+		"-- table rhnpackagechangelogdata: planned key changelog_id=1, name='Joe'",
+		"COPY rhnpackagechangelogdata (changelog_id, name) FROM stdin;",
+		"1\tJoe",
+		`\.`,
+		"-- table rhnpackagechangelogdata: written key changelog_id=1, name='Joe'",
+		"-- table rhnpackagechangelogdata: 1 rows exported in 1ms",
+		"COMMIT;",
+	}, "\n")
+
+	// 02 Act
+	discrepancies := ValidateDump(strings.NewReader(dump))
+
+	// 03 Assert
+	expected := []string{
+		"table rhnchannel: planned key id=2 missing",
+		"table rhnchannel: key id=3 not planned",
+	}
+	if !reflect.DeepEqual(discrepancies, expected) {
+		t.Errorf("Unexpected discrepancies: expected %v, got %v", expected, discrepancies)
+	}
+}
+
+func TestFormatTableKeySortsColumns(t *testing.T) {
+	// 01 Arrange
+	key := TableKey{Key: []RowKey{{"name", "'Joe'"}, {"changelog_id", "1"}}}
+
+	// 02 Act
+	formatted := formatTableKey(key)
+
+	// 03 Assert
+	if expected := "changelog_id=1, name='Joe'"; formatted != expected {
+		t.Errorf("Expected %s, but got %s", expected, formatted)
+	}
+}
@@ -0,0 +1,114 @@
+package dumper
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/sqlUtil"
+)
+
+// importVerificationBatch is the number of rows counted by each query of CountImportedRows
+const importVerificationBatch = 100
+
+// ImportVerification writes the condition matching each exported row on the target by its main unique index,
+// one tab separated table and condition line per row, for the import to count the rows actually imported.
+// The rows of the tables only matched by id can't be found on the target and are not written.
+type ImportVerification struct {
+	writer *bufio.Writer
+}
+
+func NewImportVerification(writer *bufio.Writer) *ImportVerification {
+	return &ImportVerification{writer: writer}
+}
+
+func (verification *ImportVerification) addRow(db *sql.DB, row []sqlUtil.RowDataStructure, table schemareader.Table,
+	schemaMetadata map[string]schemareader.Table) {
+	if len(table.UniqueIndexes[table.MainUniqueIndexName].Columns) == 0 {
+		return
+	}
+	verification.writer.WriteString(fmt.Sprintf("%s\t%s\n", QuoteTableName(table.Name),
+		formatMainUniqueIndexCondition(db, row, table, schemaMetadata)))
+}
+
+// ImportedRows is the number of distinct rows of a table written by ImportVerification and the number found on the target
+type ImportedRows struct {
+	Exported int
+	Found    int
+}
+
+// CountImportedRows reads the lines written by ImportVerification and returns the number of distinct rows they match
+// and the number of these rows found in the database, per table named like in the manifest.
+// A row exported several times, like the package of several channels, is written and counted once.
+func CountImportedRows(db *sql.DB, reader io.Reader) (map[string]ImportedRows, error) {
+	result := make(map[string]ImportedRows)
+	seen := make(map[string]bool)
+	tableName := ""
+	conditions := make([]string, 0, importVerificationBatch)
+	count := func() error {
+		if len(conditions) == 0 {
+			return nil
+		}
+		query := fmt.Sprintf("SELECT count(*) FROM %s WHERE (%s);", tableName, strings.Join(conditions, ") OR ("))
+		found := 0
+		if err := db.QueryRow(query).Scan(&found); err != nil {
+			return fmt.Errorf("counting the imported rows of %s: %w", tableName, err)
+		}
+		// the table name may be qualified with the target schema, the manifest names it without
+		counts := result[leadingIdentifier(tableName)]
+		counts.Exported += len(conditions)
+		counts.Found += found
+		result[leadingIdentifier(tableName)] = counts
+		conditions = conditions[:0]
+		return nil
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), "\t", 2)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid import verification line: %s", scanner.Text())
+		}
+		if seen[scanner.Text()] {
+			continue
+		}
+		seen[scanner.Text()] = true
+		if fields[0] != tableName || len(conditions) == importVerificationBatch {
+			if err := count(); err != nil {
+				return nil, err
+			}
+			tableName = fields[0]
+		}
+		conditions = append(conditions, fields[1])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading the import verification: %w", err)
+	}
+	if err := count(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// CompareImportedRows returns the tables counted by CountImportedRows without all their distinct exported rows found
+// on the target, sorted by table
+func CompareImportedRows(counts map[string]ImportedRows) []string {
+	tableNames := make([]string, 0, len(counts))
+	for tableName := range counts {
+		tableNames = append(tableNames, tableName)
+	}
+	sort.Strings(tableNames)
+	differences := make([]string, 0)
+	for _, tableName := range tableNames {
+		if count := counts[tableName]; count.Found != count.Exported {
+			differences = append(differences, fmt.Sprintf("%s: %d distinct rows exported, %d found on the target",
+				tableName, count.Exported, count.Found))
+		}
+	}
+	return differences
+}
@@ -0,0 +1,75 @@
+package dumper
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/sqlUtil"
+	"github.com/uyuni-project/inter-server-sync/tests"
+)
+
+func TestImportVerificationWritesMainIndexConditions(t *testing.T) {
+	// 01 Arrange
+	repo := tests.CreateDataRepository()
+	verification := NewImportVerification(repo.Writer)
+	table := schemareader.Table{
+		Name:                "rhnchannel",
+		Columns:             []string{"id", "label"},
+		ColumnIndexes:       map[string]int{"id": 0, "label": 1},
+		PKColumns:           map[string]bool{"id": true},
+		UniqueIndexes:       map[string]schemareader.UniqueIndex{"rhn_channel_label_uq": {Name: "rhn_channel_label_uq", Columns: []string{"label"}}},
+		MainUniqueIndexName: "rhn_channel_label_uq",
+	}
+	idOnly := schemareader.Table{Name: "rhnpackagechangelogdata", Columns: []string{"id"}, ColumnIndexes: map[string]int{"id": 0}}
+	row := []sqlUtil.RowDataStructure{{ColumnName: "id", ColumnType: "NUMERIC", Value: "1"}, {ColumnName: "label", ColumnType: "VARCHAR", Value: "sles"}}
+
+	// 02 Act
+	verification.addRow(repo.DB, row, table, map[string]schemareader.Table{"rhnchannel": table})
+	verification.addRow(repo.DB, row[:1], idOnly, map[string]schemareader.Table{"rhnpackagechangelogdata": idOnly})
+
+	// 03 Assert
+	lines := strings.Join(repo.GetWriterBuffer(), "")
+	if lines != "rhnchannel\tlabel = 'sles'\n" {
+		t.Errorf("Unexpected import verification lines: %q", lines)
+	}
+}
+
+func TestCountImportedRows(t *testing.T) {
+	// 01 Arrange
+	repo := tests.CreateDataRepository()
+	verification := strings.Join([]string{
+		"rhnchannel\tlabel = 'sles'",
+		"rhnchannel\tlabel = 'sles-updates'",
+		// the channel exported twice is counted once
+		"rhnchannel\tlabel = 'sles'",
+		"rhnerrata\tadvisory = 'SUSE-1' AND org_id IS NULL",
+	}, "\n") + "\n"
+	repo.ExpectWithRecords("SELECT count(*) FROM rhnchannel WHERE (label = 'sles') OR (label = 'sles-updates');",
+		sqlmock.NewRows([]string{"count"}).AddRow(2))
+	repo.ExpectWithRecords("SELECT count(*) FROM rhnerrata WHERE (advisory = 'SUSE-1' AND org_id IS NULL);",
+		sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	// 02 Act
+	counts, err := CountImportedRows(repo.DB, bufio.NewReader(strings.NewReader(verification)))
+	differences := CompareImportedRows(counts)
+
+	// 03 Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expectedCounts := map[string]ImportedRows{"rhnchannel": {Exported: 2, Found: 2}, "rhnerrata": {Exported: 1, Found: 0}}
+	if !reflect.DeepEqual(counts, expectedCounts) {
+		t.Errorf("Unexpected counts: %v", counts)
+	}
+	expected := []string{"rhnerrata: 1 distinct rows exported, 0 found on the target"}
+	if !reflect.DeepEqual(differences, expected) {
+		t.Errorf("Unexpected differences: expected %v, got %v", expected, differences)
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,129 @@
+package dumper
+
+import (
+	"bufio"
+	"strings"
+
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+)
+
+// maxInsertBatchBytes is the size of the values of a batched INSERT statement above which it is written with fewer
+// rows than the batch size: PostgreSQL parses each statement at once, the rows with large values make huge ones.
+const maxInsertBatchBytes = 1024 * 1024
+
+// rowInsert is the INSERT statement of the VALUES of a single row, which can be merged with the ones of the other
+// rows of the table with the same conflict clause
+type rowInsert struct {
+	// INSERT INTO with the columns and the VALUES keyword
+	head   string
+	values string
+	// the ON CONFLICT clause with a leading space, empty without one
+	onConflict string
+}
+
+func (insert *rowInsert) statement() string {
+	return insert.head + " (" + insert.values + ")" + insert.onConflict + ";"
+}
+
+// insertBatch merges the consecutive rows of a table with the same conflict clause in multi-row INSERT statements,
+// much faster to import than one statement per row. The clause applies to each row of the statement.
+type insertBatch struct {
+	writer  *bufio.Writer
+	maxRows int
+	// the insert of the first row of the pending statement, nil if there is none
+	first  *rowInsert
+	values []string
+	size   int
+}
+
+// newInsertBatch returns the batch merging the inserts of the rows of the table by up to maxRows rows, nil if they are
+// inserted one by one. The rows of a self referencing table are inserted one by one: the subqueries resolving the
+// references to the parent rows can't see the rows inserted by the same statement.
+func newInsertBatch(writer *bufio.Writer, table schemareader.Table, maxRows int) *insertBatch {
+	if maxRows <= 1 || table.CopyRows || len(getSelfReferences(table)) > 0 {
+		return nil
+	}
+	return &insertBatch{writer: writer, maxRows: maxRows}
+}
+
+func (batch *insertBatch) add(insert *rowInsert) {
+	if batch.first != nil && (batch.first.head != insert.head || batch.first.onConflict != insert.onConflict) {
+		batch.flush()
+	}
+	if batch.first == nil {
+		batch.first = insert
+	}
+	batch.values = append(batch.values, insert.values)
+	batch.size += len(insert.values)
+	if len(batch.values) >= batch.maxRows || batch.size >= maxInsertBatchBytes {
+		batch.flush()
+	}
+}
+
+// flush writes the pending statement, if any
+func (batch *insertBatch) flush() {
+	if batch == nil || batch.first == nil {
+		return
+	}
+	batch.writer.WriteString(batch.first.head + " (" + strings.Join(batch.values, "),(") + ")" + batch.first.onConflict + ";\n")
+	batch.first = nil
+	batch.values = batch.values[:0]
+	batch.size = 0
+}
+
+// insertValuesRows returns the values of each row inserted by an INSERT of VALUES written by the export, with their
+// parentheses, or nil for the other statements
+func insertValuesRows(statement string) []string {
+	tab := strings.Index(statement, "\t")
+	if !strings.HasPrefix(statement, "INSERT INTO ") || tab < 0 || !strings.HasPrefix(statement[tab+1:], "VALUES (") {
+		return nil
+	}
+	rows := make([]string, 0, 1)
+	text := statement[tab+1+len("VALUES "):]
+	for strings.HasPrefix(text, "(") {
+		end := closingParenthesis(text)
+		if end < 0 {
+			return nil
+		}
+		rows = append(rows, text[:end+1])
+		text = strings.TrimLeft(text[end+1:], " ")
+		if !strings.HasPrefix(text, ",") {
+			break
+		}
+		text = strings.TrimLeft(text[1:], " ")
+	}
+	return rows
+}
+
+// closingParenthesis returns the index of the parenthesis closing the one starting the text, skipping the string
+// literals and quoted identifiers, -1 if there is none
+func closingParenthesis(text string) int {
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		case '\'', '"':
+			// the E'...' literals escape with backslashes, all of them double the quotes
+			escapes := text[i] == '\'' && i > 0 && text[i-1] == 'E'
+			quote := text[i]
+			for i++; i < len(text); i++ {
+				if escapes && text[i] == '\\' {
+					i++
+				} else if text[i] == quote {
+					if i+1 < len(text) && text[i+1] == quote {
+						i++
+					} else {
+						break
+					}
+				}
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,84 @@
+package dumper
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/sqlUtil"
+)
+
+func TestWriteRowsInsertStatementsInBatches(t *testing.T) {
+	// 01 Arrange
+	table := schemareader.Table{
+		Name:                "rhnerrata",
+		Export:              true,
+		Columns:             []string{"id", "advisory", "org_id"},
+		ColumnIndexes:       map[string]int{"id": 0, "advisory": 1, "org_id": 2},
+		PKColumns:           map[string]bool{"id": true},
+		MainUniqueIndexName: "rhn_errata_adv_uq",
+		UniqueIndexes: map[string]schemareader.UniqueIndex{
+			"rhn_errata_adv_uq": {Name: "rhn_errata_adv_uq", Columns: []string{"advisory"}},
+		},
+	}
+	schema := map[string]schemareader.Table{"rhnerrata": table}
+	row := func(id string, advisory string, orgId interface{}) []sqlUtil.RowDataStructure {
+		return []sqlUtil.RowDataStructure{
+			{ColumnName: "id", ColumnType: "NUMERIC", Value: id},
+			{ColumnName: "advisory", ColumnType: "VARCHAR", Value: advisory},
+			{ColumnName: "org_id", ColumnType: "NUMERIC", Value: orgId},
+		}
+	}
+	rows := [][]sqlUtil.RowDataStructure{
+		row("1", "SUSE-1", nil), row("2", "SUSE-2 (it's)", nil), row("3", "SUSE-3", nil), row("4", "SUSE-4", "1"),
+	}
+	var buffer bytes.Buffer
+	writer := bufio.NewWriter(&buffer)
+
+	options := PrintSqlOptions{InsertBatchSize: 2}
+	batch := newInsertBatch(writer, table, options.InsertBatchSize)
+
+	// 02 Act
+	// the rows of a table are written by page, the batches span the pages
+	writeRowsInsertStatements(nil, writer, schema, table, rows[:1], batch, options)
+	writeRowsInsertStatements(nil, writer, schema, table, rows[1:], batch, options)
+	batch.flush()
+	writer.Flush()
+
+	// 03 Assert
+	head := "INSERT INTO rhnerrata (id, advisory, org_id)\tVALUES "
+	nullOrg := " ON CONFLICT (advisory) WHERE org_id IS NULL DO UPDATE SET advisory = excluded.advisory,org_id = excluded.org_id;\n"
+	expected := head + "(1,'SUSE-1',null),(2,'SUSE-2 (it''s)',null)" + nullOrg +
+		head + "(3,'SUSE-3',null)" + nullOrg +
+		head + "(4,'SUSE-4',1) ON CONFLICT (advisory, org_id) WHERE org_id IS NOT NULL DO UPDATE SET advisory = excluded.advisory,org_id = excluded.org_id;\n"
+	if buffer.String() != expected {
+		t.Errorf("Unexpected statements:\n%s", buffer.String())
+	}
+	manifest, err := ComputeManifest(strings.NewReader(buffer.String()))
+	if err != nil || len(manifest) != 2 || manifest[1].Rows != 4 {
+		t.Errorf("The manifest should count each row of the batches, got %v %v", manifest, err)
+	}
+	dump := "-- table rhnerrata: 4 rows\n" + buffer.String() + "-- table rhnerrata: 4 rows exported in 1ms\n"
+	if discrepancies := ValidateDump(strings.NewReader(dump)); len(discrepancies) > 0 {
+		t.Errorf("The batched rows should be validated, got %v", discrepancies)
+	}
+}
+
+func TestInsertValuesRows(t *testing.T) {
+	cases := map[string][]string{
+		"INSERT INTO rhnchannel (id, label)\tVALUES (1,'a'),(2,E'b\\')\\n'' ('),(3,(SELECT id FROM rhnorg WHERE name = 'x)')) ON CONFLICT (label) DO NOTHING;": {
+			"(1,'a')", "(2,E'b\\')\\n'' (')", "(3,(SELECT id FROM rhnorg WHERE name = 'x)'))",
+		},
+		"INSERT INTO \"order\" (\"group\")\tVALUES ('a;b');":                                                                       {"('a;b')"},
+		"INSERT INTO rhnchannel (id, label)\tSELECT 1,'a' WHERE NOT EXISTS (SELECT 1 FROM rhnchannel WHERE label = 'a');":          nil,
+		"UPDATE rhnchecksumtype SET description = 'x' WHERE label = 'sha1'; INSERT INTO rhnchecksumtype (label)\tVALUES ('sha1');": nil,
+	}
+	for statement, expected := range cases {
+		if rows := insertValuesRows(statement); !reflect.DeepEqual(rows, expected) {
+			t.Errorf("Unexpected rows for %s: %v", statement, rows)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package dumper
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ManifestDumpEntry is the name of the manifest entry covering the whole dump
+const ManifestDumpEntry = "sql_statements"
+
+// ManifestEntry describes the statements of a table in a dump, or of the whole dump for ManifestDumpEntry
+type ManifestEntry struct {
+	Name string
+	// the number of inserted rows, or of lines for the whole dump
+	Rows int
+	// the hex encoded SHA-256 of the statement lines, in the dump order
+	Checksum string
+	// how the rows of the table were selected, only known by the export
+	Provenance TableProvenance
+}
+
+type manifestCounter struct {
+	rows int
+	hash hash.Hash
+}
+
+func (counter *manifestCounter) add(line string) {
+	counter.hash.Write([]byte(line + "\n"))
+}
+
+// ComputeManifest reads a dump and returns an entry for the whole dump followed by one per table, sorted by name.
+// The lines of a table are its INSERT, UPDATE and DELETE statements and its COPY blocks.
+func ComputeManifest(reader io.Reader) ([]ManifestEntry, error) {
+	dump := &manifestCounter{hash: sha256.New()}
+	tables := make(map[string]*manifestCounter)
+
+	// the table of the COPY block being read, if any
+	copyTable := ""
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		dump.rows++
+		dump.add(line)
+		tableName, isInsert := statementTable(line)
+		switch {
+		case copyTable != "":
+			// each line of a COPY block is a row, up to the end of data marker
+			tableName, isInsert = copyTable, line != copyEndOfData
+			if !isInsert {
+				copyTable = ""
+			}
+		case strings.HasPrefix(line, "COPY "):
+			tableName = leadingIdentifier(line[len("COPY "):])
+			copyTable = tableName
+		}
+		if tableName == "" {
+			continue
+		}
+		table, ok := tables[tableName]
+		if !ok {
+			table = &manifestCounter{hash: sha256.New()}
+			tables[tableName] = table
+		}
+		if rows := insertValuesRows(line); len(rows) > 1 {
+			// a batched INSERT statement inserts several rows
+			table.rows += len(rows)
+		} else if isInsert {
+			table.rows++
+		}
+		table.add(line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading the dump: %w", err)
+	}
+
+	tableNames := make([]string, 0, len(tables))
+	for name := range tables {
+		tableNames = append(tableNames, name)
+	}
+	sort.Strings(tableNames)
+	result := []ManifestEntry{{Name: ManifestDumpEntry, Rows: dump.rows, Checksum: hex.EncodeToString(dump.hash.Sum(nil))}}
+	for _, name := range tableNames {
+		result = append(result, ManifestEntry{Name: name, Rows: tables[name].rows, Checksum: hex.EncodeToString(tables[name].hash.Sum(nil))})
+	}
+	return result, nil
+}
+
+// statementTable returns the table changed by the statement line, if any, and if the line inserts a row
+func statementTable(line string) (string, bool) {
+	// rows replaced by label are updated before being inserted if missing
+	isInsert := strings.HasPrefix(line, "INSERT INTO ") || strings.Contains(line, "; INSERT INTO ")
+	for _, prefix := range []string{"INSERT INTO ", "UPDATE ", "DELETE FROM "} {
+		if strings.HasPrefix(line, prefix) {
+			return leadingIdentifier(line[len(prefix):]), isInsert
+		}
+	}
+	return "", false
+}
+
+// leadingIdentifier returns the table name at the start of the text, as written by QuoteTableName,
+// without the schema qualifying it
+func leadingIdentifier(text string) string {
+	identifier := text[:identifierLength(text)]
+	if rest := text[len(identifier):]; strings.HasPrefix(rest, ".") {
+		return leadingIdentifier(rest[1:])
+	}
+	return identifier
+}
+
+// identifierLength returns the length of the identifier at the start of the text, as written by quoteIdentifier
+func identifierLength(text string) int {
+	if strings.HasPrefix(text, `"`) {
+		for i := 1; i < len(text); i++ {
+			if text[i] != '"' {
+				continue
+			}
+			if i+1 < len(text) && text[i+1] == '"' {
+				i++
+				continue
+			}
+			return i + 1
+		}
+		return len(text)
+	}
+	if end := strings.IndexAny(text, " \t(."); end >= 0 {
+		return end
+	}
+	return len(text)
+}
+
+// AddManifestProvenance sets the provenance of the table entries from the one collected by the export
+func AddManifestProvenance(entries []ManifestEntry, provenance *ExportProvenance) {
+	if provenance == nil {
+		return
+	}
+	tableNames := make(map[string]string, len(provenance.tables))
+	for tableName := range provenance.tables {
+		tableNames[quoteIdentifier(tableName)] = tableName
+	}
+	for i, entry := range entries {
+		if tableName, ok := tableNames[entry.Name]; ok {
+			entries[i].Provenance = provenance.Table(tableName)
+		}
+	}
+}
+
+// WriteManifest writes the entries as tab separated name, rows and checksum lines, followed by the provenance
+// of the table if any: filter="..." per starting filter, limit=N, limitReached and since=date
+func WriteManifest(writer io.Writer, entries []ManifestEntry) error {
+	for _, entry := range entries {
+		fields := []string{entry.Name, strconv.Itoa(entry.Rows), entry.Checksum}
+		for _, filter := range entry.Provenance.Filters {
+			fields = append(fields, "filter="+strconv.Quote(filter))
+		}
+		if entry.Provenance.RowLimit > 0 {
+			fields = append(fields, fmt.Sprintf("limit=%d", entry.Provenance.RowLimit))
+		}
+		if entry.Provenance.RowLimitReached {
+			fields = append(fields, "limitReached")
+		}
+		if entry.Provenance.ModifiedSince != "" {
+			fields = append(fields, "since="+entry.Provenance.ModifiedSince)
+		}
+		if _, err := fmt.Fprintln(writer, strings.Join(fields, "\t")); err != nil {
+			return fmt.Errorf("writing the manifest: %w", err)
+		}
+	}
+	return nil
+}
+
+// ReadManifest reads the entries written by WriteManifest
+func ReadManifest(reader io.Reader) ([]ManifestEntry, error) {
+	result := make([]ManifestEntry, 0)
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("invalid manifest line: %s", scanner.Text())
+		}
+		rows, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid row count in manifest line %s: %w", scanner.Text(), err)
+		}
+		provenance, err := parseManifestProvenance(fields[3:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid provenance in manifest line %s: %w", scanner.Text(), err)
+		}
+		result = append(result, ManifestEntry{Name: fields[0], Rows: rows, Checksum: fields[2], Provenance: provenance})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading the manifest: %w", err)
+	}
+	return result, nil
+}
+
+// parseManifestProvenance reads the provenance fields written by WriteManifest
+func parseManifestProvenance(fields []string) (TableProvenance, error) {
+	provenance := TableProvenance{}
+	for _, field := range fields {
+		key, value := field, ""
+		if equal := strings.Index(field, "="); equal >= 0 {
+			key, value = field[:equal], field[equal+1:]
+		}
+		switch key {
+		case "filter":
+			filter, err := strconv.Unquote(value)
+			if err != nil {
+				return provenance, fmt.Errorf("invalid filter %s: %w", value, err)
+			}
+			provenance.Filters = append(provenance.Filters, filter)
+		case "limit":
+			limit, err := strconv.Atoi(value)
+			if err != nil {
+				return provenance, fmt.Errorf("invalid row limit %s: %w", value, err)
+			}
+			provenance.RowLimit = limit
+		case "limitReached":
+			provenance.RowLimitReached = true
+		case "since":
+			provenance.ModifiedSince = value
+		default:
+			return provenance, fmt.Errorf("unknown field %s", key)
+		}
+	}
+	return provenance, nil
+}
+
+// PartialTables returns a description of each table of the manifest whose rows may not all have been exported
+func PartialTables(entries []ManifestEntry) []string {
+	result := make([]string, 0)
+	for _, entry := range entries {
+		if !entry.Provenance.Partial() {
+			continue
+		}
+		switch {
+		case entry.Provenance.RowLimitReached && entry.Provenance.ModifiedSince != "":
+			result = append(result, fmt.Sprintf("%s: limited to %d rows and to the rows modified since %s", entry.Name,
+				entry.Provenance.RowLimit, entry.Provenance.ModifiedSince))
+		case entry.Provenance.RowLimitReached:
+			result = append(result, fmt.Sprintf("%s: limited to %d rows", entry.Name, entry.Provenance.RowLimit))
+		default:
+			result = append(result, fmt.Sprintf("%s: only the rows modified since %s", entry.Name, entry.Provenance.ModifiedSince))
+		}
+	}
+	return result
+}
+
+// CompareManifests returns the differences between the manifest of the export and the one computed on the dump
+func CompareManifests(expected []ManifestEntry, actual []ManifestEntry) []string {
+	differences := make([]string, 0)
+	actualEntries := make(map[string]ManifestEntry)
+	for _, entry := range actual {
+		actualEntries[entry.Name] = entry
+	}
+	for _, entry := range expected {
+		found, ok := actualEntries[entry.Name]
+		delete(actualEntries, entry.Name)
+		switch {
+		case !ok:
+			differences = append(differences, fmt.Sprintf("%s: missing from the dump", entry.Name))
+		case found.Rows != entry.Rows:
+			differences = append(differences, fmt.Sprintf("%s: %d rows expected, %d found", entry.Name, entry.Rows, found.Rows))
+		case found.Checksum != entry.Checksum:
+			differences = append(differences, fmt.Sprintf("%s: checksum mismatch", entry.Name))
+		}
+	}
+	unexpected := make([]string, 0, len(actualEntries))
+	for name := range actualEntries {
+		unexpected = append(unexpected, name)
+	}
+	sort.Strings(unexpected)
+	for _, name := range unexpected {
+		differences = append(differences, fmt.Sprintf("%s: not in the manifest", name))
+	}
+	return differences
+}
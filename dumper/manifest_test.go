@@ -0,0 +1,113 @@
+package dumper
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+)
+
+const manifestDump = `BEGIN;
+INSERT INTO rhnchannel (id, label)	VALUES (1,'sles') ON CONFLICT (label) DO UPDATE SET label = excluded.label;
+INSERT INTO "order" (id)	VALUES (2);
+UPDATE rhnchecksumtype SET description = 'sha256' WHERE label = 'sha256'; INSERT INTO rhnchecksumtype (id, label)	SELECT 1,'sha256' WHERE NOT EXISTS (SELECT 1 FROM rhnchecksumtype WHERE label = 'sha256');
+DELETE FROM rhnchannelerrata WHERE (channel_id) = (1);
+INSERT INTO rhnchannel (id, label)	VALUES (3,'sled') ON CONFLICT (label) DO UPDATE SET label = excluded.label;
+COMMIT;
+`
+
+func TestComputeManifest(t *testing.T) {
+	// 01 Arrange
+	reader := strings.NewReader(manifestDump)
+
+	// 02 Act
+	entries, err := ComputeManifest(reader)
+
+	// 03 Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	names := make([]string, 0)
+	rows := make([]int, 0)
+	for _, entry := range entries {
+		names = append(names, entry.Name)
+		rows = append(rows, entry.Rows)
+	}
+	if !reflect.DeepEqual(names, []string{ManifestDumpEntry, `"order"`, "rhnchannel", "rhnchannelerrata", "rhnchecksumtype"}) {
+		t.Errorf("Unexpected manifest entries: %v", names)
+	}
+	if !reflect.DeepEqual(rows, []int{7, 1, 2, 0, 1}) {
+		t.Errorf("Unexpected row counts: %v", rows)
+	}
+}
+
+func TestVerifyManifest(t *testing.T) {
+	// 01 Arrange
+	entries, _ := ComputeManifest(strings.NewReader(manifestDump))
+	var manifest bytes.Buffer
+	if err := WriteManifest(&manifest, entries); err != nil {
+		t.Fatalf("Unexpected error writing the manifest: %s", err)
+	}
+	truncated := manifestDump[:strings.Index(manifestDump, "INSERT INTO rhnchannel (id, label)\tVALUES (3")]
+	edited := strings.Replace(manifestDump, "'sles'", "'sles-edited'", 1)
+
+	// 02 Act
+	expected, err := ReadManifest(&manifest)
+	if err != nil {
+		t.Fatalf("Unexpected error reading the manifest: %s", err)
+	}
+	intact, _ := ComputeManifest(strings.NewReader(manifestDump))
+	truncatedEntries, _ := ComputeManifest(strings.NewReader(truncated))
+	editedEntries, _ := ComputeManifest(strings.NewReader(edited))
+
+	// 03 Assert
+	if differences := CompareManifests(expected, intact); len(differences) > 0 {
+		t.Errorf("Intact dump should match its manifest, got %v", differences)
+	}
+	truncatedDifferences := CompareManifests(expected, truncatedEntries)
+	if !reflect.DeepEqual(truncatedDifferences, []string{"sql_statements: 7 rows expected, 5 found", "rhnchannel: 2 rows expected, 1 found"}) {
+		t.Errorf("Unexpected differences for the truncated dump: %v", truncatedDifferences)
+	}
+	editedDifferences := CompareManifests(expected, editedEntries)
+	if !reflect.DeepEqual(editedDifferences, []string{"sql_statements: checksum mismatch", "rhnchannel: checksum mismatch"}) {
+		t.Errorf("Unexpected differences for the edited dump: %v", editedDifferences)
+	}
+}
+
+func TestManifestProvenance(t *testing.T) {
+	// 01 Arrange
+	entries, _ := ComputeManifest(strings.NewReader(manifestDump))
+	provenance := NewExportProvenance()
+	schema := map[string]schemareader.Table{"rhnchannel": {Name: "rhnchannel", Export: true}, "order": {Name: "order", Export: true}}
+	provenance.record(schema, DataDumper{Provenance: map[string]TableProvenance{
+		"rhnchannel": {Filters: []string{"label = 'sles\tsp1'"}, ModifiedSince: "2024-01-01"},
+		"order":      {RowLimit: 1000, RowLimitReached: true},
+	}})
+	provenance.record(schema, DataDumper{Provenance: map[string]TableProvenance{"rhnchannel": {Filters: []string{"label = 'sled'"}}}})
+	AddManifestProvenance(entries, provenance)
+	var manifest bytes.Buffer
+
+	// 02 Act
+	err := WriteManifest(&manifest, entries)
+	read, readErr := ReadManifest(bytes.NewReader(manifest.Bytes()))
+
+	// 03 Assert
+	if err != nil || readErr != nil {
+		t.Fatalf("Unexpected error: %v %v", err, readErr)
+	}
+	if !strings.Contains(manifest.String(), "\tlimit=1000\tlimitReached\n") {
+		t.Errorf("The row limit should be written in the manifest, got %s", manifest.String())
+	}
+	if !reflect.DeepEqual(read, entries) {
+		t.Errorf("The provenance should be read back, expected %v, got %v", entries, read)
+	}
+	expected := []string{`"order": limited to 1000 rows`, "rhnchannel: only the rows modified since 2024-01-01"}
+	if partial := PartialTables(read); !reflect.DeepEqual(partial, expected) {
+		t.Errorf("Expected the partial tables %v, got %v", expected, partial)
+	}
+	if differences := CompareManifests(read, entries); len(differences) > 0 {
+		t.Errorf("The provenance should not change the verification, got %v", differences)
+	}
+}
@@ -0,0 +1,101 @@
+package dumper
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+)
+
+// OrphanRows counts the rows of a table referencing a row missing from the referenced table
+type OrphanRows struct {
+	TableName string
+	Reference schemareader.Reference
+	Count     int
+}
+
+// FindOrphanRows counts, for each reference of the exported tables, the rows whose referenced row is missing on the
+// source: the broken foreign keys would fail the import on the target. Only the references with orphan rows are
+// returned, sorted by table and referenced table.
+func FindOrphanRows(db *sql.DB, schemaMetadata map[string]schemareader.Table) ([]OrphanRows, error) {
+	tableNames := make([]string, 0, len(schemaMetadata))
+	for name, table := range schemaMetadata {
+		if table.Export {
+			tableNames = append(tableNames, name)
+		}
+	}
+	sort.Strings(tableNames)
+
+	result := make([]OrphanRows, 0)
+	for _, name := range tableNames {
+		table := schemaMetadata[name]
+		references := append([]schemareader.Reference{}, table.References...)
+		sort.SliceStable(references, func(i, j int) bool { return references[i].TableName < references[j].TableName })
+		for _, reference := range references {
+			if _, ok := schemaMetadata[reference.TableName]; !ok {
+				continue
+			}
+			query := fmt.Sprintf("SELECT count(*) FROM %s WHERE %s;", quoteIdentifier(table.Name), formatOrphanCondition(table, reference))
+			count := 0
+			if err := db.QueryRow(query).Scan(&count); err != nil {
+				return nil, fmt.Errorf("counting the orphan rows of %s referencing %s: %w", table.Name, reference.TableName, err)
+			}
+			if count > 0 {
+				result = append(result, OrphanRows{TableName: table.Name, Reference: reference, Count: count})
+			}
+		}
+	}
+	return result, nil
+}
+
+// ApplySkipOrphans stops exporting the orphan rows found by FindOrphanRows.
+// The rows are only skipped when reached from their parents or starting the export: a row referenced by an exported row
+// is still exported for the foreign key of the referencing row.
+func ApplySkipOrphans(schemaMetadata map[string]schemareader.Table, orphans []OrphanRows) {
+	for _, orphan := range orphans {
+		table, ok := schemaMetadata[orphan.TableName]
+		if !ok {
+			continue
+		}
+		table.OrphanReferences = append(table.OrphanReferences, orphan.Reference)
+		schemaMetadata[table.Name] = table
+	}
+}
+
+// formatOrphanCondition returns the condition matching the rows of the table whose referenced row is missing.
+// Like for the foreign keys, the rows with a NULL referencing column reference no row.
+func formatOrphanCondition(table schemareader.Table, reference schemareader.Reference) string {
+	conditions := make([]string, 0)
+	for _, column := range reference.LocalColumns() {
+		conditions = append(conditions, fmt.Sprintf("%s.%s IS NOT NULL", quoteIdentifier(table.Name), quoteIdentifier(column)))
+	}
+	conditions = append(conditions, "NOT "+formatReferencedRowExists(table, reference))
+	return strings.Join(conditions, " AND ")
+}
+
+// formatOrphanFilter returns the conditions excluding the orphan rows of the references set by ApplySkipOrphans
+func formatOrphanFilter(table schemareader.Table) []string {
+	result := make([]string, 0, len(table.OrphanReferences))
+	for _, reference := range table.OrphanReferences {
+		conditions := make([]string, 0)
+		for _, column := range reference.LocalColumns() {
+			conditions = append(conditions, fmt.Sprintf("%s.%s IS NULL", quoteIdentifier(table.Name), quoteIdentifier(column)))
+		}
+		conditions = append(conditions, formatReferencedRowExists(table, reference))
+		result = append(result, fmt.Sprintf("(%s)", strings.Join(conditions, " OR ")))
+	}
+	return result
+}
+
+// formatReferencedRowExists returns the condition checking the row referenced by a row of the table exists.
+// The referenced table is aliased for self references.
+func formatReferencedRowExists(table schemareader.Table, reference schemareader.Reference) string {
+	joins := make([]string, 0)
+	foreignColumns := reference.ForeignColumns()
+	for i, column := range reference.LocalColumns() {
+		joins = append(joins, fmt.Sprintf("parent.%s = %s.%s", quoteIdentifier(foreignColumns[i]), quoteIdentifier(table.Name), quoteIdentifier(column)))
+	}
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM %s parent WHERE %s)", quoteIdentifier(reference.TableName), strings.Join(joins, " AND "))
+}
@@ -0,0 +1,76 @@
+package dumper
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/tests"
+)
+
+func orphansTestSchema() map[string]schemareader.Table {
+	return map[string]schemareader.Table{
+		"rhnchannelerrata": {
+			Name:          "rhnchannelerrata",
+			Export:        true,
+			Columns:       []string{"channel_id", "errata_id"},
+			ColumnIndexes: map[string]int{"channel_id": 0, "errata_id": 1},
+			References: []schemareader.Reference{
+				{TableName: "rhnerrata", ColumnMapping: map[string]string{"errata_id": "id"}},
+				{TableName: "rhnchannel", ColumnMapping: map[string]string{"channel_id": "id"}},
+			},
+		},
+		"rhnchannel": {Name: "rhnchannel", Export: true, Columns: []string{"id"}},
+		"rhnerrata":  {Name: "rhnerrata", Export: true, Columns: []string{"id"}},
+	}
+}
+
+func TestFindOrphanRows(t *testing.T) {
+	// 01 Arrange
+	repo := tests.CreateDataRepository()
+	schemaMetadata := orphansTestSchema()
+	repo.ExpectWithRecords("SELECT count(*) FROM rhnchannelerrata WHERE rhnchannelerrata.channel_id IS NOT NULL AND "+
+		"NOT EXISTS (SELECT 1 FROM rhnchannel parent WHERE parent.id = rhnchannelerrata.channel_id);",
+		sqlmock.NewRows([]string{"count"}).AddRow(0))
+	repo.ExpectWithRecords("SELECT count(*) FROM rhnchannelerrata WHERE rhnchannelerrata.errata_id IS NOT NULL AND "+
+		"NOT EXISTS (SELECT 1 FROM rhnerrata parent WHERE parent.id = rhnchannelerrata.errata_id);",
+		sqlmock.NewRows([]string{"count"}).AddRow(2))
+
+	// 02 Act
+	orphans, err := FindOrphanRows(repo.DB, schemaMetadata)
+
+	// 03 Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := []OrphanRows{{TableName: "rhnchannelerrata", Reference: schemaMetadata["rhnchannelerrata"].References[0], Count: 2}}
+	if !reflect.DeepEqual(orphans, expected) {
+		t.Errorf("Unexpected orphan rows: expected %v, got %v", expected, orphans)
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestShouldSkipOrphanRows(t *testing.T) {
+	// 01 Arrange
+	repo := tests.CreateDataRepository()
+	schemaMetadata := orphansTestSchema()
+	ApplySkipOrphans(schemaMetadata, []OrphanRows{
+		{TableName: "rhnchannelerrata", Reference: schemaMetadata["rhnchannelerrata"].References[0], Count: 2}})
+	repo.Expect("SELECT channel_id, errata_id FROM rhnchannelerrata WHERE (channel_id = 1 OR channel_id = 2) AND "+
+		"(rhnchannelerrata.errata_id IS NULL OR EXISTS (SELECT 1 FROM rhnerrata parent WHERE parent.id = rhnchannelerrata.errata_id)) ;",
+		schemaMetadata["rhnchannelerrata"].Columns, 1)
+
+	// 02 Act
+	items := initialDataSet(repo.DB, schemaMetadata["rhnchannelerrata"], "channel_id = 1 OR channel_id = 2")
+
+	// 03 Assert
+	if len(items) != 1 {
+		t.Errorf("Unexpected number of rows: %d", len(items))
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,37 @@
+package dumper
+
+import "github.com/uyuni-project/inter-server-sync/schemareader"
+
+// progressFunc is the function set with SetProgress
+var progressFunc schemareader.ProgressFunc
+
+// SetProgress sets the function called after writing the data of each table, nil to disable it.
+// Each channel, product set or image is counted in its own round.
+func SetProgress(progress schemareader.ProgressFunc) {
+	progressFunc = progress
+}
+
+// tableProgress counts the tables written in a round of the export
+type tableProgress struct {
+	index int
+	total int
+}
+
+// next reports the table as written to the function set with SetProgress, if any
+func (p *tableProgress) next(tableName string) {
+	p.index++
+	if progressFunc != nil {
+		progressFunc(tableName, p.index, p.total)
+	}
+}
+
+// newExportedTablesProgress counts the exported tables of the schema
+func newExportedTablesProgress(schemaMetadata map[string]schemareader.Table) *tableProgress {
+	progress := &tableProgress{}
+	for _, table := range schemaMetadata {
+		if table.Export {
+			progress.total++
+		}
+	}
+	return progress
+}
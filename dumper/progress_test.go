@@ -0,0 +1,32 @@
+package dumper
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+)
+
+func TestExportTablesDataProgress(t *testing.T) {
+	// 01 Arrange
+	graph := TablesGraph{
+		"root": []string{"v01"},
+		"v01":  []string{},
+	}
+	testCase := createTestCase(graph, "root", PrintSqlOptions{})
+	progress := make([]string, 0)
+	SetProgress(func(tableName string, index, total int) {
+		progress = append(progress, fmt.Sprintf("%s %d/%d", tableName, index, total))
+	})
+	defer SetProgress(nil)
+
+	// 02 Act
+	exportTablesData(testCase.repo.DB, testCase.repo.Writer, testCase.schemaMetadata,
+		[]schemareader.Table{testCase.schemaMetadata["v01"], testCase.schemaMetadata["root"]}, DataDumper{}, testCase.options)
+
+	// 03 Assert
+	if !reflect.DeepEqual(progress, []string{"v01 1/2", "root 2/2"}) {
+		t.Errorf("Unexpected progress: %v", progress)
+	}
+}
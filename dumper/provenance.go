@@ -0,0 +1,76 @@
+package dumper
+
+import (
+	"sort"
+
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/utils"
+)
+
+// TableProvenance records how the rows of a table were selected for an export, to tell if the table is complete
+type TableProvenance struct {
+	// the filters of the rows the export started from, only for the starting tables
+	Filters []string
+	// the maximum number of rows reached from their parents, 0 without limit
+	RowLimit int
+	// rows reached from their parents were left out because of the row limit
+	RowLimitReached bool
+	// the rows reached from their parents were only exported if modified since the date, empty for all of them
+	ModifiedSince string
+}
+
+// Partial tells if rows of the table may be missing from the export because of a row limit or a date cutoff
+func (provenance TableProvenance) Partial() bool {
+	return provenance.RowLimitReached || provenance.ModifiedSince != ""
+}
+
+// merge adds the provenance of the rows of the same table selected by another crawl
+func (provenance *TableProvenance) merge(other TableProvenance) {
+	for _, filter := range other.Filters {
+		if !utils.Contains(provenance.Filters, filter) {
+			provenance.Filters = append(provenance.Filters, filter)
+		}
+	}
+	sort.Strings(provenance.Filters)
+	if other.RowLimit > provenance.RowLimit {
+		provenance.RowLimit = other.RowLimit
+	}
+	provenance.RowLimitReached = provenance.RowLimitReached || other.RowLimitReached
+	if other.ModifiedSince != "" {
+		provenance.ModifiedSince = other.ModifiedSince
+	}
+}
+
+// ExportProvenance collects the provenance of the tables written by all the crawls of an export
+type ExportProvenance struct {
+	tables map[string]*TableProvenance
+}
+
+// NewExportProvenance returns an empty provenance to collect the one of the written tables
+func NewExportProvenance() *ExportProvenance {
+	return &ExportProvenance{tables: make(map[string]*TableProvenance)}
+}
+
+// Table returns the provenance of the table, the zero value for a table not written with a filter, limit or cutoff
+func (export *ExportProvenance) Table(tableName string) TableProvenance {
+	if export == nil || export.tables[tableName] == nil {
+		return TableProvenance{}
+	}
+	return *export.tables[tableName]
+}
+
+// record adds the provenance of the exported tables of the crawl
+func (export *ExportProvenance) record(schemaMetadata map[string]schemareader.Table, data DataDumper) {
+	if export == nil {
+		return
+	}
+	for tableName, provenance := range data.Provenance {
+		if table, ok := schemaMetadata[tableName]; !ok || !table.Export {
+			continue
+		}
+		if _, ok := export.tables[tableName]; !ok {
+			export.tables[tableName] = &TableProvenance{}
+		}
+		export.tables[tableName].merge(provenance)
+	}
+}
@@ -0,0 +1,252 @@
+package dumper
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/sqlUtil"
+)
+
+// referenceIdMap holds the target ids of the rows referenced by a foreign key column, by their source id
+type referenceIdMap struct {
+	ids map[string]string
+	// the source ids missing from the map, resolved with a sub query instead
+	misses int
+}
+
+// referenceIdMaps holds the maps registered with RegisterReferenceIdMap per table and column
+var referenceIdMaps = make(map[string]map[string]*referenceIdMap)
+
+// RegisterReferenceIdMap sets the target ids written instead of the source ids of the foreign key column of the
+// table, nil to remove it. The ids missing from the map are resolved with a sub query on the target as usual.
+func RegisterReferenceIdMap(tableName string, columnName string, ids map[string]string) {
+	if ids == nil {
+		delete(referenceIdMaps[tableName], columnName)
+		return
+	}
+	if _, ok := referenceIdMaps[tableName]; !ok {
+		referenceIdMaps[tableName] = make(map[string]*referenceIdMap)
+	}
+	referenceIdMaps[tableName][columnName] = &referenceIdMap{ids: ids}
+}
+
+// ReferenceIdMapMisses returns the number of source ids missing from the map of each registered foreign key column,
+// as table.column, for the columns with missing ids
+func ReferenceIdMapMisses() map[string]int {
+	result := make(map[string]int)
+	for tableName, columns := range referenceIdMaps {
+		for columnName, idMap := range columns {
+			if idMap.misses > 0 {
+				result[tableName+"."+columnName] = idMap.misses
+			}
+		}
+	}
+	return result
+}
+
+// mapReferenceId writes the target id of the row referenced by the single column reference from the registered map.
+// It returns false if there is no map for the reference or if the source id is missing from it.
+func mapReferenceId(table schemareader.Table, reference schemareader.Reference, row []sqlUtil.RowDataStructure) bool {
+	if len(reference.ColumnMapping) != 1 {
+		return false
+	}
+	column := reference.LocalColumns()[0]
+	idMap, ok := referenceIdMaps[table.Name][column]
+	if !ok {
+		return false
+	}
+	value := row[table.ColumnIndexes[column]].Value
+	if value == nil {
+		return true
+	}
+	targetId, ok := idMap.ids[fmt.Sprintf("%s", value)]
+	if !ok {
+		idMap.misses++
+		log.Debug().Msgf("Source id %s of %s.%s is not in the map of %s: resolving it on the target",
+			value, table.Name, column, reference.TableName)
+		return false
+	}
+	row[table.ColumnIndexes[column]].Value = targetId
+	return true
+}
+
+// ReferenceIdMaps builds the maps of the source ids to the target ids of the referenced tables by matching their rows
+// on the unique index used for the references, once per table and index. The referenced columns of the index are
+// matched with the maps of the tables they reference.
+type ReferenceIdMaps struct {
+	target *sql.DB
+	maps   map[string]map[string]string
+}
+
+// NewReferenceIdMaps returns the maps of the ids of the target database rows
+func NewReferenceIdMaps(target *sql.DB) *ReferenceIdMaps {
+	return &ReferenceIdMaps{target: target, maps: make(map[string]map[string]string)}
+}
+
+// Apply registers the maps of the ids for the given foreign key columns, as table.column, instead of writing a sub query
+// per row to find the referenced rows on the target. The references of the tables not in the schema are ignored.
+// It fails if the reference is unknown or has several columns, or if the rows of the referenced table can't be matched.
+func (maps *ReferenceIdMaps) Apply(source *sql.DB, schemaMetadata map[string]schemareader.Table, references []string) error {
+	for _, tableColumn := range references {
+		parts := strings.SplitN(tableColumn, ".", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("invalid reference %q: expected table.column", tableColumn)
+		}
+		table, ok := schemaMetadata[strings.ToLower(parts[0])]
+		if !ok {
+			continue
+		}
+		reference := table.GetFirstReferenceFromColumn(parts[1])
+		if reference.TableName == "" {
+			return fmt.Errorf("table %s has no foreign key on column %s", table.Name, parts[1])
+		}
+		if len(reference.ColumnMapping) != 1 {
+			return fmt.Errorf("foreign key of %s.%s has several columns: only single column references are mapped", table.Name, parts[1])
+		}
+		ids, err := maps.build(source, schemaMetadata, reference.TableName, reference.UniqueIndexName, make(map[string]bool))
+		if err != nil {
+			return fmt.Errorf("mapping the ids of %s referenced by %s.%s: %w", reference.TableName, table.Name, parts[1], err)
+		}
+		log.Info().Msgf("Mapped %d ids of %s referenced by %s.%s", len(ids), reference.TableName, table.Name, parts[1])
+		RegisterReferenceIdMap(table.Name, parts[1], ids)
+	}
+	return nil
+}
+
+// build returns the map of the ids of the table, matching the rows on the given index, the main one if empty
+func (maps *ReferenceIdMaps) build(source *sql.DB, schemaMetadata map[string]schemareader.Table, tableName string,
+	indexName string, building map[string]bool) (map[string]string, error) {
+	table, ok := schemaMetadata[tableName]
+	if !ok {
+		return nil, fmt.Errorf("table %s is not in the schema", tableName)
+	}
+	if indexName == "" {
+		indexName = table.MainUniqueIndexName
+	}
+	key := tableName + "," + indexName
+	if ids, ok := maps.maps[key]; ok {
+		return ids, nil
+	}
+	if building[key] {
+		return nil, fmt.Errorf("the unique index %s of %s references itself", indexName, tableName)
+	}
+	building[key] = true
+
+	index, ok := table.UniqueIndexes[indexName]
+	if !ok || len(table.PKColumns) != 1 {
+		return nil, fmt.Errorf("table %s has no single column primary key and unique index to match its rows", tableName)
+	}
+	if index.Predicate != "" {
+		return nil, fmt.Errorf("unique index %s of %s is partial: it doesn't match the rows outside of %s", indexName, tableName, index.Predicate)
+	}
+	var pkColumn string
+	for column := range table.PKColumns {
+		pkColumn = column
+	}
+	// the referenced columns of the index hold source ids, matched with the target ones through their own maps
+	columnMaps := make([]map[string]string, len(index.Columns))
+	for i, column := range index.Columns {
+		reference := table.GetFirstReferenceFromColumn(column)
+		if reference.TableName == "" || len(reference.ColumnMapping) != 1 {
+			continue
+		}
+		ids, err := maps.build(source, schemaMetadata, reference.TableName, reference.UniqueIndexName, building)
+		if err != nil {
+			return nil, err
+		}
+		columnMaps[i] = ids
+	}
+
+	query := formatReferenceIdMapQuery(table, pkColumn, index)
+	sourceRows, err := readReferenceIdRows(source, query)
+	if err != nil {
+		return nil, fmt.Errorf("reading the rows of %s on the source: %w", tableName, err)
+	}
+	targetRows, err := readReferenceIdRows(maps.target, query)
+	if err != nil {
+		return nil, fmt.Errorf("reading the rows of %s on the target: %w", tableName, err)
+	}
+
+	targetIds := make(map[string]string, len(targetRows))
+	ambiguous := make(map[string]bool)
+	for _, row := range targetRows {
+		rowKey, _ := formatReferenceIdKey(row[1:], nil)
+		if _, ok := targetIds[rowKey]; ok {
+			ambiguous[rowKey] = true
+		}
+		targetIds[rowKey] = row[0].String
+	}
+	ids := make(map[string]string, len(sourceRows))
+	for _, row := range sourceRows {
+		rowKey, ok := formatReferenceIdKey(row[1:], columnMaps)
+		if !ok || ambiguous[rowKey] {
+			continue
+		}
+		if targetId, ok := targetIds[rowKey]; ok {
+			ids[row[0].String] = targetId
+		}
+	}
+	maps.maps[key] = ids
+	delete(building, key)
+	return ids, nil
+}
+
+// formatReferenceIdMapQuery returns the query reading the primary key and the index columns of all the rows as text
+func formatReferenceIdMapQuery(table schemareader.Table, pkColumn string, index schemareader.UniqueIndex) string {
+	columns := []string{quoteIdentifier(pkColumn) + "::text"}
+	for _, column := range index.Columns {
+		columns = append(columns, quoteIdentifier(column)+"::text")
+	}
+	return fmt.Sprintf("SELECT %s FROM %s;", strings.Join(columns, ", "), quoteIdentifier(table.Name))
+}
+
+func readReferenceIdRows(db *sql.DB, query string) ([][]sql.NullString, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := make([][]sql.NullString, 0)
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		result = append(result, values)
+	}
+	return result, rows.Err()
+}
+
+// formatReferenceIdKey returns the values of the index columns as a single key, with the source ids of the
+// referenced columns replaced by their target ids. It returns false if a referenced source id has no target id.
+func formatReferenceIdKey(values []sql.NullString, columnMaps []map[string]string) (string, bool) {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		if !value.Valid {
+			// NULL values are matched with each other, like the rows of the virtual index
+			parts[i] = "N"
+			continue
+		}
+		text := value.String
+		if columnMaps != nil && columnMaps[i] != nil {
+			targetId, ok := columnMaps[i][text]
+			if !ok {
+				return "", false
+			}
+			text = targetId
+		}
+		parts[i] = "V" + text
+	}
+	return strings.Join(parts, "\x00"), true
+}
@@ -0,0 +1,122 @@
+package dumper
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/sqlUtil"
+	"github.com/uyuni-project/inter-server-sync/tests"
+)
+
+func referenceIdMapSchema() map[string]schemareader.Table {
+	return map[string]schemareader.Table{
+		"rhnpackagename": {
+			Name:                "rhnpackagename",
+			Columns:             []string{"id", "name"},
+			ColumnIndexes:       map[string]int{"id": 0, "name": 1},
+			PKColumns:           map[string]bool{"id": true},
+			MainUniqueIndexName: "rhn_pn_name_uq",
+			UniqueIndexes:       map[string]schemareader.UniqueIndex{"rhn_pn_name_uq": {Name: "rhn_pn_name_uq", Columns: []string{"name"}}},
+		},
+		"rhnpackage": {
+			Name:                "rhnpackage",
+			Columns:             []string{"id", "name_id", "org_id"},
+			ColumnIndexes:       map[string]int{"id": 0, "name_id": 1, "org_id": 2},
+			PKColumns:           map[string]bool{"id": true},
+			MainUniqueIndexName: schemareader.VirtualIndexName,
+			UniqueIndexes: map[string]schemareader.UniqueIndex{
+				schemareader.VirtualIndexName: {Name: schemareader.VirtualIndexName, Columns: []string{"name_id", "org_id"}},
+			},
+			References: []schemareader.Reference{{TableName: "rhnpackagename", ColumnMapping: map[string]string{"name_id": "id"}}},
+		},
+		"rhnchannelpackage": {
+			Name:          "rhnchannelpackage",
+			Export:        true,
+			Columns:       []string{"channel_id", "package_id"},
+			ColumnIndexes: map[string]int{"channel_id": 0, "package_id": 1},
+			References:    []schemareader.Reference{{TableName: "rhnpackage", ColumnMapping: map[string]string{"package_id": "id"}}},
+		},
+	}
+}
+
+func TestReferenceIdMapsMatchNaturalKeys(t *testing.T) {
+	// 01 Arrange
+	source := tests.CreateDataRepository()
+	target := tests.CreateDataRepository()
+	namesQuery := "SELECT id::text, name::text FROM rhnpackagename;"
+	packagesQuery := "SELECT id::text, name_id::text, org_id::text FROM rhnpackage;"
+	source.ExpectWithRecords(namesQuery, sqlmock.NewRows([]string{"id", "name"}).AddRow("1", "vim").AddRow("2", "emacs"))
+	target.ExpectWithRecords(namesQuery, sqlmock.NewRows([]string{"id", "name"}).AddRow("10", "vim").AddRow("20", "emacs"))
+	source.ExpectWithRecords(packagesQuery, sqlmock.NewRows([]string{"id", "name_id", "org_id"}).
+		AddRow("100", "1", nil).AddRow("101", "2", nil).AddRow("102", "3", nil))
+	target.ExpectWithRecords(packagesQuery, sqlmock.NewRows([]string{"id", "name_id", "org_id"}).
+		AddRow("500", "10", nil).AddRow("501", "20", "1"))
+	schema := referenceIdMapSchema()
+	defer RegisterReferenceIdMap("rhnchannelpackage", "package_id", nil)
+
+	// 02 Act
+	err := NewReferenceIdMaps(target.DB).Apply(source.DB, schema, []string{"rhnchannelpackage.package_id"})
+
+	// 03 Assert
+	if err != nil {
+		t.Fatalf("Unexpected error mapping the ids: %s", err)
+	}
+	expected := map[string]string{"100": "500"}
+	if ids := referenceIdMaps["rhnchannelpackage"]["package_id"].ids; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("Expected the ids %v, got %v", expected, ids)
+	}
+	row := []sqlUtil.RowDataStructure{
+		{ColumnName: "channel_id", ColumnType: "NUMERIC", Value: "1"},
+		{ColumnName: "package_id", ColumnType: "NUMERIC", Value: []byte("100")},
+	}
+	row = SubstituteForeignKey(nil, schema["rhnchannelpackage"], schema, row)
+	if row[1].Value != "500" || row[1].ColumnType != "NUMERIC" {
+		t.Errorf("The source id should be replaced by the target one, got %v", row[1])
+	}
+	if err := source.ExpectationsWereMet(); err != nil {
+		t.Errorf("Source rows were not read. Error message: %s", err)
+	}
+	if err := target.ExpectationsWereMet(); err != nil {
+		t.Errorf("Target rows were not read. Error message: %s", err)
+	}
+}
+
+func TestReferenceIdMapReportsMissingIds(t *testing.T) {
+	// 01 Arrange
+	schema := referenceIdMapSchema()
+	RegisterReferenceIdMap("rhnchannelpackage", "package_id", map[string]string{"100": "500"})
+	defer RegisterReferenceIdMap("rhnchannelpackage", "package_id", nil)
+	row := []sqlUtil.RowDataStructure{
+		{ColumnName: "channel_id", ColumnType: "NUMERIC", Value: "1"},
+		{ColumnName: "package_id", ColumnType: "NUMERIC", Value: "101"},
+	}
+
+	// 02 Act
+	mapped := mapReferenceId(schema["rhnchannelpackage"], schema["rhnchannelpackage"].References[0], row)
+
+	// 03 Assert
+	if mapped || row[1].Value != "101" {
+		t.Errorf("A missing id should be left to the sub query, got %v", row[1])
+	}
+	if misses := ReferenceIdMapMisses(); !reflect.DeepEqual(misses, map[string]int{"rhnchannelpackage.package_id": 1}) {
+		t.Errorf("The missing id should be reported, got %v", misses)
+	}
+}
+
+func TestReferenceIdMapsRefuseCompositeReferences(t *testing.T) {
+	// 01 Arrange
+	schema := referenceIdMapSchema()
+	table := schema["rhnchannelpackage"]
+	table.References = []schemareader.Reference{{TableName: "rhnpackage", ColumnMapping: map[string]string{"package_id": "id", "channel_id": "org_id"}}}
+	schema["rhnchannelpackage"] = table
+
+	// 02 Act
+	err := NewReferenceIdMaps(nil).Apply(nil, schema, []string{"rhnchannelpackage.package_id"})
+
+	// 03 Assert
+	if err == nil {
+		t.Errorf("Composite references should not be mapped")
+	}
+}
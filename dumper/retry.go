@@ -0,0 +1,25 @@
+package dumper
+
+import (
+	"io"
+	"regexp"
+	"strings"
+)
+
+// verboseErrorsStatement makes psql print the SQLSTATE code of the errors
+const verboseErrorsStatement = "\\set VERBOSITY verbose\n"
+
+// transactionConflictError matches the errors of psql for a deadlock (40P01) or a serialization failure (40001)
+var transactionConflictError = regexp.MustCompile(`ERROR:\s+(40001|40P01):`)
+
+// NewVerboseErrorsReader returns the statements of the dump with psql reporting the SQLSTATE code of the errors,
+// needed to find out if the import failed on a conflict with a concurrent transaction
+func NewVerboseErrorsReader(reader io.Reader) io.Reader {
+	return io.MultiReader(strings.NewReader(verboseErrorsStatement), reader)
+}
+
+// IsTransactionConflict tells if the errors in the psql output of a failed import, with their SQLSTATE code, report a deadlock
+// or a serialization failure: the transaction was rolled back and can be run again.
+func IsTransactionConflict(output []byte) bool {
+	return transactionConflictError.Match(output)
+}
@@ -0,0 +1,38 @@
+package dumper
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestVerboseErrorsReader(t *testing.T) {
+	// 01 Arrange
+	dump := "BEGIN;\nCOMMIT;\n"
+
+	// 02 Act
+	result, err := io.ReadAll(NewVerboseErrorsReader(strings.NewReader(dump)))
+
+	// 03 Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if string(result) != "\\set VERBOSITY verbose\nBEGIN;\nCOMMIT;\n" {
+		t.Errorf("Unexpected statements:\n%s", result)
+	}
+}
+
+func TestIsTransactionConflict(t *testing.T) {
+	cases := map[string]bool{
+		"psql:<stdin>:12: ERROR:  40P01: deadlock detected\nDETAIL:  Process 1 waits for ShareLock on transaction 2\n": true,
+		"psql:<stdin>:3: ERROR:  40001: could not serialize access due to concurrent update\n":                         true,
+		"psql:<stdin>:7: ERROR:  23505: duplicate key value violates unique constraint \"rhn_channel_label_uq\"\n":     false,
+		"psql:<stdin>:7: ERROR:  deadlock detected\n":                                                                  false,
+		"": false,
+	}
+	for output, expected := range cases {
+		if IsTransactionConflict([]byte(output)) != expected {
+			t.Errorf("Expected %v for %q", expected, output)
+		}
+	}
+}
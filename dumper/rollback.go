@@ -0,0 +1,99 @@
+package dumper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+)
+
+// deferConstraintsStatement makes the foreign keys checked at the end of the transaction.
+// It only applies to the constraints declared DEFERRABLE.
+const deferConstraintsStatement = "SET CONSTRAINTS ALL DEFERRED;\n"
+
+// lineReplacingReader rewrites the lines of the dump with its replace function
+type lineReplacingReader struct {
+	reader  *bufio.Reader
+	replace func(line []byte) []byte
+	pending []byte
+	err     error
+}
+
+// NewRollbackReader returns the statements of the dump with its transaction rolled back instead of committed.
+// Running them checks the whole import against the target database without changing it.
+func NewRollbackReader(reader io.Reader) io.Reader {
+	return &lineReplacingReader{reader: bufio.NewReaderSize(reader, 32768), replace: func(line []byte) []byte {
+		if bytes.Equal(bytes.TrimSpace(line), []byte("COMMIT;")) {
+			return []byte("ROLLBACK;\n")
+		}
+		return line
+	}}
+}
+
+// NewDeferredConstraintsReader returns the statements of the dump with the deferrable constraints
+// only checked when committing its transaction. The foreign keys are still resolved when each row is written:
+// it only tolerates the rows already on the target temporarily breaking a cycle of references while updated.
+func NewDeferredConstraintsReader(reader io.Reader) io.Reader {
+	return &lineReplacingReader{reader: bufio.NewReaderSize(reader, 32768), replace: func(line []byte) []byte {
+		if bytes.Equal(bytes.TrimSpace(line), []byte("BEGIN;")) {
+			return append(append([]byte{}, line...), deferConstraintsStatement...)
+		}
+		return line
+	}}
+}
+
+func (r *lineReplacingReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		line, err := r.reader.ReadBytes('\n')
+		r.pending = r.replace(line)
+		r.err = err
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// CancellableReader returns the statements of the dump until its context is cancelled, then a ROLLBACK of the
+// transaction instead of the remaining statements. The statement being run when the context is cancelled completes.
+type CancellableReader struct {
+	ctx        context.Context
+	reader     *bufio.Reader
+	pending    []byte
+	err        error
+	committed  bool
+	rolledBack bool
+}
+
+// NewCancellableReader returns the statements of the dump rolled back when the context is cancelled before its COMMIT
+func NewCancellableReader(ctx context.Context, reader io.Reader) *CancellableReader {
+	return &CancellableReader{ctx: ctx, reader: bufio.NewReaderSize(reader, 32768)}
+}
+
+// RolledBack tells if the context was cancelled before the COMMIT was read: the transaction was then rolled back
+func (r *CancellableReader) RolledBack() bool {
+	return r.rolledBack
+}
+
+func (r *CancellableReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if !r.committed && r.ctx.Err() != nil {
+			r.pending = []byte("ROLLBACK;\n")
+			r.err = io.EOF
+			r.rolledBack = true
+			break
+		}
+		line, err := r.reader.ReadBytes('\n')
+		r.committed = r.committed || bytes.Equal(bytes.TrimSpace(line), []byte("COMMIT;"))
+		r.pending = line
+		r.err = err
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
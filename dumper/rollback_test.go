@@ -0,0 +1,104 @@
+package dumper
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRollbackReader(t *testing.T) {
+	// 01 Arrange
+	dump := "BEGIN;\n" +
+		"INSERT INTO rhnchannel (id, label)\tVALUES (1,'COMMIT;') ON CONFLICT (label) DO UPDATE SET label = excluded.label;\n" +
+		"COMMIT;\n"
+
+	// 02 Act
+	result, err := io.ReadAll(NewRollbackReader(strings.NewReader(dump)))
+
+	// 03 Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := "BEGIN;\n" +
+		"INSERT INTO rhnchannel (id, label)\tVALUES (1,'COMMIT;') ON CONFLICT (label) DO UPDATE SET label = excluded.label;\n" +
+		"ROLLBACK;\n"
+	if string(result) != expected {
+		t.Errorf("Unexpected statements:\n%s", result)
+	}
+}
+
+func TestDeferredConstraintsReader(t *testing.T) {
+	// 01 Arrange
+	dump := "BEGIN;\n" +
+		"INSERT INTO rhnchannel (id, label)\tVALUES (1,'BEGIN;') ON CONFLICT (label) DO UPDATE SET label = excluded.label;\n" +
+		"COMMIT;\n"
+
+	// 02 Act
+	result, err := io.ReadAll(NewRollbackReader(NewDeferredConstraintsReader(strings.NewReader(dump))))
+
+	// 03 Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := "BEGIN;\n" +
+		"SET CONSTRAINTS ALL DEFERRED;\n" +
+		"INSERT INTO rhnchannel (id, label)\tVALUES (1,'BEGIN;') ON CONFLICT (label) DO UPDATE SET label = excluded.label;\n" +
+		"ROLLBACK;\n"
+	if string(result) != expected {
+		t.Errorf("Unexpected statements:\n%s", result)
+	}
+}
+
+func TestCancellableReaderRollsBackMidImport(t *testing.T) {
+	// 01 Arrange
+	dump := "BEGIN;\n" +
+		"INSERT INTO rhnchannel (id, label)\tVALUES (1,'a') ON CONFLICT (label) DO UPDATE SET label = excluded.label;\n" +
+		"INSERT INTO rhnchannel (id, label)\tVALUES (2,'b') ON CONFLICT (label) DO UPDATE SET label = excluded.label;\n" +
+		"COMMIT;\n"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reader := NewCancellableReader(ctx, strings.NewReader(dump))
+	lines := bufio.NewReader(reader)
+
+	// 02 Act
+	begin, _ := lines.ReadString('\n')
+	insert, _ := lines.ReadString('\n')
+	cancel()
+	rest, err := io.ReadAll(lines)
+
+	// 03 Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if begin != "BEGIN;\n" || !strings.Contains(insert, "VALUES (1,'a')") {
+		t.Errorf("The statements before the cancellation should be run, got %q %q", begin, insert)
+	}
+	if string(rest) != "ROLLBACK;\n" {
+		t.Errorf("The remaining statements should be replaced by a rollback, got %q", rest)
+	}
+	if !reader.RolledBack() {
+		t.Errorf("The cancelled import should be reported as rolled back")
+	}
+}
+
+func TestCancellableReaderAfterCommit(t *testing.T) {
+	// 01 Arrange
+	dump := "BEGIN;\nINSERT INTO rhnchannel (id, label)\tVALUES (1,'a');\nCOMMIT;\n"
+	ctx, cancel := context.WithCancel(context.Background())
+	reader := NewCancellableReader(ctx, strings.NewReader(dump))
+
+	// 02 Act
+	result, err := io.ReadAll(reader)
+	cancel()
+	_, _ = reader.Read(make([]byte, 1))
+
+	// 03 Assert
+	if err != nil || string(result) != dump {
+		t.Errorf("The statements should be unchanged without cancellation, got %q %v", result, err)
+	}
+	if reader.RolledBack() {
+		t.Errorf("A committed import can't be rolled back")
+	}
+}
@@ -0,0 +1,54 @@
+package dumper
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/sqlUtil"
+)
+
+// serverSpecificColumns are never part of a row checksum since they differ between servers for the same data
+var serverSpecificColumns = map[string]bool{
+	"created":  true,
+	"modified": true,
+}
+
+// RowChecksum computes the checksum of the business columns of a row with its keys already substituted.
+// Primary key, unexported and timestamp columns are skipped and the foreign keys are expressed with the
+// natural key subqueries, so the same data gives the same checksum on any server.
+// The checksum is the hex encoded SHA-256 of the "column=value\n" lines, in the table column order,
+// where value is formatted as in the generated SQL.
+func RowChecksum(table schemareader.Table, row []sqlUtil.RowDataStructure) string {
+	hash := sha256.New()
+	for _, column := range row {
+		if table.PKColumns[column.ColumnName] || table.UnexportColumns[column.ColumnName] ||
+			serverSpecificColumns[column.ColumnName] {
+			continue
+		}
+		hash.Write([]byte(fmt.Sprintf("%s=%s\n", column.ColumnName, formatField(column))))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// formatRowNaturalKey returns the main unique index values of the row, as used in the generated SQL
+func formatRowNaturalKey(table schemareader.Table, row []sqlUtil.RowDataStructure) string {
+	keyValues := make([]string, 0)
+	for _, indexColumn := range table.UniqueIndexes[table.MainUniqueIndexName].Columns {
+		for _, column := range row {
+			if strings.Compare(indexColumn, column.ColumnName) == 0 {
+				keyValues = append(keyValues, formatField(column))
+				break
+			}
+		}
+	}
+	return strings.Join(keyValues, ",")
+}
+
+// writeRowChecksum writes the checksum of the row, its values already substituted by substituteRow for its statement
+func writeRowChecksum(writer *bufio.Writer, values []sqlUtil.RowDataStructure, table schemareader.Table) {
+	writer.WriteString(fmt.Sprintf("%s\t%s\t%s\n", table.Name, formatRowNaturalKey(table, values), RowChecksum(table, values)))
+}
@@ -0,0 +1,89 @@
+package dumper
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/sqlUtil"
+	"github.com/uyuni-project/inter-server-sync/tests"
+)
+
+func TestRowChecksumIgnoresServerSpecificColumns(t *testing.T) {
+	// 01 Arrange
+	table := schemareader.Table{Name: "rhnpackagename", PKColumns: map[string]bool{"id": true}}
+	newRow := func(id string, name string, modified string) []sqlUtil.RowDataStructure {
+		return []sqlUtil.RowDataStructure{
+			{ColumnName: "id", ColumnType: "NUMERIC", Value: id},
+			{ColumnName: "name", ColumnType: "VARCHAR", Value: name},
+			{ColumnName: "modified", ColumnType: "VARCHAR", Value: modified},
+		}
+	}
+
+	// 02 Act
+	checksum := RowChecksum(table, newRow("1", "vim", "2022-01-01"))
+	otherServerChecksum := RowChecksum(table, newRow("42", "vim", "2023-01-01"))
+	changedChecksum := RowChecksum(table, newRow("1", "emacs", "2022-01-01"))
+
+	// 03 Assert
+	if checksum != otherServerChecksum {
+		t.Errorf("Checksum should not depend on id and timestamps")
+	}
+	if checksum == changedChecksum {
+		t.Errorf("Checksum should change with the business columns")
+	}
+}
+
+func TestWriteRowChecksumReusesSubstitutedRow(t *testing.T) {
+	// 01 Arrange
+	repo := tests.CreateDataRepository()
+	parent := schemareader.Table{
+		Name:                "rhnchannel",
+		Export:              true,
+		Columns:             []string{"id", "label"},
+		ColumnIndexes:       map[string]int{"id": 0, "label": 1},
+		PKColumns:           map[string]bool{"id": true},
+		MainUniqueIndexName: "rhn_channel_label_uq",
+		UniqueIndexes: map[string]schemareader.UniqueIndex{
+			"rhn_channel_label_uq": {Name: "rhn_channel_label_uq", Columns: []string{"label"}},
+		},
+	}
+	child := schemareader.Table{
+		Name:                "rhnchannelcomps",
+		Export:              true,
+		Columns:             []string{"channel_id", "relative_filename"},
+		ColumnIndexes:       map[string]int{"channel_id": 0, "relative_filename": 1},
+		PKColumns:           map[string]bool{},
+		MainUniqueIndexName: "rhn_channelcomps_uq",
+		UniqueIndexes: map[string]schemareader.UniqueIndex{
+			"rhn_channelcomps_uq": {Name: "rhn_channelcomps_uq", Columns: []string{"channel_id", "relative_filename"}},
+		},
+		References: []schemareader.Reference{{TableName: "rhnchannel", ColumnMapping: map[string]string{"channel_id": "id"}}},
+	}
+	schema := map[string]schemareader.Table{"rhnchannel": parent, "rhnchannelcomps": child}
+	row := []sqlUtil.RowDataStructure{
+		{ColumnName: "channel_id", ColumnType: "NUMERIC", Value: "42"},
+		{ColumnName: "relative_filename", ColumnType: "VARCHAR", Value: "comps.xml"},
+	}
+	// a reference not found isn't cached: a second substitution of the row would run the query again
+	repo.ExpectWithRecords("SELECT id, label FROM rhnchannel WHERE id = $1;", sqlmock.NewRows(parent.Columns), "42")
+	var checksums bytes.Buffer
+	checksumWriter := bufio.NewWriter(&checksums)
+
+	// 02 Act
+	writeRowsInsertStatements(repo.DB, repo.Writer, schema, child, [][]sqlUtil.RowDataStructure{row}, nil,
+		PrintSqlOptions{RowChecksumWriter: checksumWriter})
+	checksumWriter.Flush()
+
+	// 03 Assert
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("The references of the row should be looked up once. Error message: %s", err)
+	}
+	expected := fmt.Sprintf("rhnchannelcomps\t42,'comps.xml'\t%s\n", RowChecksum(child, row))
+	if checksums.String() != expected {
+		t.Errorf("Unexpected checksum line %q, expected %q", checksums.String(), expected)
+	}
+}
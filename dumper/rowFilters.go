@@ -0,0 +1,107 @@
+package dumper
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/sqlUtil"
+)
+
+// ApplyRowFilters only exports the rows of the tables matching the given conditions, as table=condition, the
+// conditions of a table being ANDed. Contrary to the row limits, the rows referenced by the exported rows are filtered
+// too: an exported row referencing a filtered out row breaks its foreign key on the target, which is reported by
+// the crawl. The conditions of the tables not in the schema are ignored with a warning.
+func ApplyRowFilters(schemaMetadata map[string]schemareader.Table, filters []string) error {
+	for _, filter := range filters {
+		parts := strings.SplitN(filter, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return fmt.Errorf("invalid row filter %q: expected table=condition", filter)
+		}
+		table, ok := schemaMetadata[strings.ToLower(strings.TrimSpace(parts[0]))]
+		if !ok {
+			log.Warn().Msgf("The row filter %q is ignored: table %s is not in the schema read", filter, strings.TrimSpace(parts[0]))
+			continue
+		}
+		condition := fmt.Sprintf("(%s)", strings.TrimSpace(parts[1]))
+		if table.RowFilter != "" {
+			condition = table.RowFilter + " AND " + condition
+		}
+		table.RowFilter = condition
+		schemaMetadata[table.Name] = table
+	}
+	return nil
+}
+
+// formatRowFilter returns the condition set by ApplyRowFilters, if any, to add to the conditions selecting the rows
+func formatRowFilter(table schemareader.Table) []string {
+	if table.RowFilter == "" {
+		return nil
+	}
+	return []string{table.RowFilter}
+}
+
+// addRowFilter returns the WHERE clause with the condition set by ApplyRowFilters added, if any
+func addRowFilter(whereClause string, table schemareader.Table) string {
+	if table.RowFilter == "" {
+		return whereClause
+	}
+	condition := strings.TrimSpace(whereClause)
+	if condition == "" {
+		return "WHERE " + table.RowFilter
+	}
+	if len(condition) > len("WHERE ") && strings.EqualFold(condition[:len("WHERE ")], "WHERE ") {
+		condition = condition[len("WHERE "):]
+	}
+	return fmt.Sprintf("WHERE (%s) AND %s", condition, table.RowFilter)
+}
+
+// filteredReference is a foreign key of the exported rows of a table to the rows of a table filtered out
+type filteredReference struct {
+	tableName       string
+	columns         string
+	referencedTable string
+}
+
+// filteredReferences counts the rows referencing rows filtered out by ApplyRowFilters, per foreign key
+type filteredReferences map[filteredReference]int
+
+// add counts the row if the row it references, which the crawl didn't find, only exists without the row filter
+// of the referenced table. The conditions and parameters match the referenced row.
+func (filtered filteredReferences) add(db *sql.DB, table schemareader.Table, foreignTable schemareader.Table,
+	reference schemareader.Reference, conditions []string, parameters []interface{}) {
+	if foreignTable.RowFilter == "" {
+		return
+	}
+	for _, value := range parameters {
+		if value == nil {
+			return
+		}
+	}
+	sql := fmt.Sprintf(`SELECT 1 FROM %s WHERE %s;`, quoteIdentifier(foreignTable.Name), strings.Join(conditions, " and "))
+	if len(sqlUtil.ExecuteQueryWithResults(db, sql, parameters...)) == 0 {
+		return
+	}
+	columns := reference.LocalColumns()
+	sort.Strings(columns)
+	filtered[filteredReference{tableName: table.Name, columns: strings.Join(columns, ", "), referencedTable: foreignTable.Name}]++
+}
+
+// report warns about the foreign keys broken by the row filters
+func (filtered filteredReferences) report() {
+	references := make([]filteredReference, 0, len(filtered))
+	for reference := range filtered {
+		references = append(references, reference)
+	}
+	sort.Slice(references, func(i, j int) bool {
+		return fmt.Sprint(references[i]) < fmt.Sprint(references[j])
+	})
+	for _, reference := range references {
+		log.Warn().Msgf("%d exported rows of %s reference with %s rows of %s excluded by its row filter: "+
+			"their foreign key will be broken on the target, filter them out too",
+			filtered[reference], reference.tableName, reference.columns, reference.referencedTable)
+	}
+}
@@ -0,0 +1,97 @@
+package dumper
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/uyuni-project/inter-server-sync/sqlUtil"
+	"github.com/uyuni-project/inter-server-sync/tests"
+)
+
+func TestApplyRowFilters(t *testing.T) {
+	// 01 Arrange
+	schemaMetadata := orphansTestSchema()
+
+	// 02 Act
+	err := ApplyRowFilters(schemaMetadata, []string{"rhnerrata=advisory_status <> 'retracted'", "RHNERRATA=org_id IS NULL", "missing=id = 1"})
+
+	// 03 Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := "(advisory_status <> 'retracted') AND (org_id IS NULL)"
+	if filter := schemaMetadata["rhnerrata"].RowFilter; filter != expected {
+		t.Errorf("Expected the filter %s, got %s", expected, filter)
+	}
+	if where := addRowFilter(" where org_id is null", schemaMetadata["rhnerrata"]); where != "WHERE (org_id is null) AND "+expected {
+		t.Errorf("The filter should be added to the WHERE clause, got %s", where)
+	}
+	for _, filter := range []string{"rhnerrata", "rhnerrata= ", "=id = 1"} {
+		if err := ApplyRowFilters(schemaMetadata, []string{filter}); err == nil {
+			t.Errorf("Invalid filter %q should be rejected", filter)
+		}
+	}
+}
+
+func TestRowFilterReportsBrokenReferences(t *testing.T) {
+	// 01 Arrange
+	repo := tests.CreateDataRepository()
+	schemaMetadata := orphansTestSchema()
+	if err := ApplyRowFilters(schemaMetadata, []string{"rhnerrata=advisory_status <> 'retracted'"}); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	repo.ExpectWithRecords("SELECT id FROM rhnerrata WHERE id = $1 and (advisory_status <> 'retracted');",
+		sqlmock.NewRows([]string{"id"}), "2")
+	repo.ExpectWithRecords("SELECT 1 FROM rhnerrata WHERE id = $1;", sqlmock.NewRows([]string{"?column?"}).AddRow(1), "2")
+	repo.ExpectWithRecords("SELECT id FROM rhnchannel WHERE id = $1;", sqlmock.NewRows([]string{"id"}).AddRow("1"), "1")
+	row := processItem{tableName: "rhnchannelerrata", path: []string{"rhnchannelerrata"}, row: []sqlUtil.RowDataStructure{
+		{ColumnName: "channel_id", ColumnType: "NUMERIC", Value: "1"},
+		{ColumnName: "errata_id", ColumnType: "NUMERIC", Value: "2"},
+	}}
+	filtered := make(filteredReferences)
+
+	// 02 Act
+	items := followReferencesFrom(repo.DB, schemaMetadata, schemaMetadata["rhnchannelerrata"], row, "", filtered)
+
+	// 03 Assert
+	if len(items) != 1 || items[0].tableName != "rhnchannel" {
+		t.Errorf("Only the channel should be followed, got %v", items)
+	}
+	expected := filteredReferences{{tableName: "rhnchannelerrata", columns: "errata_id", referencedTable: "rhnerrata"}: 1}
+	if !reflect.DeepEqual(filtered, expected) {
+		t.Errorf("The reference to the filtered out errata should be reported, got %v", filtered)
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRowFiltersAndLimitsWarnAboutMissingTables(t *testing.T) {
+	// 01 Arrange
+	schemaMetadata := orphansTestSchema()
+	var output bytes.Buffer
+	logger := log.Logger
+	log.Logger = zerolog.New(&output)
+	defer func() { log.Logger = logger }()
+
+	// 02 Act
+	filterErr := ApplyRowFilters(schemaMetadata, []string{"rhnerata=org_id IS NULL"})
+	limitErr := ApplyRowLimits(schemaMetadata, map[string]int{"rhnchanelpackage": 10})
+
+	// 03 Assert
+	if filterErr != nil || limitErr != nil {
+		t.Fatalf("Unexpected errors: %v %v", filterErr, limitErr)
+	}
+	logged := output.String()
+	if !strings.Contains(logged, `"level":"warn"`) || !strings.Contains(logged, `The row filter \"rhnerata=org_id IS NULL\" is ignored`) {
+		t.Errorf("The filter of the missing table should be reported, got %s", logged)
+	}
+	if !strings.Contains(logged, "The row limit of table rhnchanelpackage is ignored") {
+		t.Errorf("The limit of the missing table should be reported, got %s", logged)
+	}
+}
@@ -0,0 +1,160 @@
+package dumper
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/sqlUtil"
+	"github.com/uyuni-project/inter-server-sync/utils"
+)
+
+// getSelfReferences returns the references of a table pointing to the table itself, like rhnchannel.parent_channel
+func getSelfReferences(table schemareader.Table) []schemareader.Reference {
+	result := make([]schemareader.Reference, 0)
+	for _, reference := range table.References {
+		if strings.Compare(reference.TableName, table.Name) == 0 {
+			result = append(result, reference)
+		}
+	}
+	return result
+}
+
+func formatRowReferenceKey(table schemareader.Table, row []sqlUtil.RowDataStructure, columns []string) (string, bool) {
+	values := make([]string, 0)
+	for _, column := range columns {
+		value := row[table.ColumnIndexes[column]].Value
+		if value == nil {
+			return "", false
+		}
+		values = append(values, fmt.Sprintf("%v", value))
+	}
+	return strings.Join(values, "$$"), true
+}
+
+// selfBackReference is the reference of a row to a parent row written after it, in a cycle of self references
+type selfBackReference struct {
+	row       []sqlUtil.RowDataStructure
+	reference schemareader.Reference
+}
+
+// orderRowsBySelfReference sorts the rows of a self referencing table so that the parent rows
+// come before their children: the natural key subquery of a child can only find a parent already inserted.
+// The rows of a cycle can't all come after their parents: the returned back references are the references to the
+// parent rows written after their child, to be set once all the rows are inserted.
+func orderRowsBySelfReference(table schemareader.Table, rows [][]sqlUtil.RowDataStructure) ([][]sqlUtil.RowDataStructure, []selfBackReference) {
+	selfReferences := getSelfReferences(table)
+	if len(selfReferences) == 0 || len(rows) < 2 {
+		return rows, nil
+	}
+
+	// index the exported rows by the referenced columns of each self reference
+	localColumns := make([][]string, len(selfReferences))
+	rowsIndex := make([]map[string]int, len(selfReferences))
+	for i, reference := range selfReferences {
+		localColumns[i] = reference.LocalColumns()
+		referencedColumns := reference.ForeignColumns()
+		rowsIndex[i] = make(map[string]int)
+		for rowNumber, row := range rows {
+			if key, ok := formatRowReferenceKey(table, row, referencedColumns); ok {
+				rowsIndex[i][key] = rowNumber
+			}
+		}
+	}
+
+	type parentRow struct {
+		rowNumber int
+		reference int
+	}
+	parents := make([][]parentRow, len(rows))
+	for rowNumber, row := range rows {
+		for i := range selfReferences {
+			key, ok := formatRowReferenceKey(table, row, localColumns[i])
+			if !ok {
+				continue
+			}
+			if parent, found := rowsIndex[i][key]; found && parent != rowNumber {
+				parents[rowNumber] = append(parents[rowNumber], parentRow{rowNumber: parent, reference: i})
+			}
+		}
+	}
+
+	const (
+		notVisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(rows))
+	backReferences := make([]selfBackReference, 0)
+	result := make([][]sqlUtil.RowDataStructure, 0, len(rows))
+	var visit func(rowNumber int)
+	visit = func(rowNumber int) {
+		state[rowNumber] = visiting
+		for _, parent := range parents[rowNumber] {
+			switch state[parent.rowNumber] {
+			case notVisited:
+				visit(parent.rowNumber)
+			case visiting:
+				backReferences = append(backReferences, selfBackReference{row: rows[rowNumber], reference: selfReferences[parent.reference]})
+			}
+		}
+		state[rowNumber] = visited
+		result = append(result, rows[rowNumber])
+	}
+	for rowNumber := range rows {
+		if state[rowNumber] == notVisited {
+			visit(rowNumber)
+		}
+	}
+	return result, backReferences
+}
+
+// formatSelfBackReferenceUpdate returns the UPDATE setting the back reference once its parent row is inserted:
+// the row was inserted with NULL, the subquery resolving the reference finding no parent row yet
+func formatSelfBackReferenceUpdate(db *sql.DB, table schemareader.Table, schemaMetadata map[string]schemareader.Table,
+	backReference selfBackReference) (string, error) {
+	if len(table.UniqueIndexes[table.MainUniqueIndexName].Columns) == 0 {
+		return "", fmt.Errorf("rows of %s can't be matched to set their cyclic references", table.Name)
+	}
+	localColumns := backReference.reference.LocalColumns()
+	for _, column := range localColumns {
+		if definition, ok := table.ColumnDefinitions[column]; ok && !definition.IsNullable {
+			return "", fmt.Errorf("rows of %s can't be inserted before the rows they reference with the NOT NULL column %s", table.Name, column)
+		}
+	}
+	values := substituteRow(db, table, transformRow(table, backReference.row), schemaMetadata)
+	assignments := make([]string, 0)
+	conditions := make([]string, 0)
+	for _, value := range values {
+		if utils.Contains(localColumns, value.ColumnName) {
+			assignments = append(assignments, fmt.Sprintf("%s = %s", quoteIdentifier(value.ColumnName), formatField(value)))
+		}
+	}
+	for _, indexColumn := range table.UniqueIndexes[table.MainUniqueIndexName].Columns {
+		for _, value := range values {
+			if indexColumn != value.ColumnName {
+				continue
+			}
+			// the row was inserted without its back reference
+			if value.Value == nil || utils.Contains(localColumns, value.ColumnName) {
+				conditions = append(conditions, fmt.Sprintf("%s IS NULL", quoteIdentifier(value.ColumnName)))
+			} else {
+				conditions = append(conditions, fmt.Sprintf("%s = %s", quoteIdentifier(value.ColumnName), formatField(value)))
+			}
+		}
+	}
+	return fmt.Sprintf("UPDATE %s SET %s WHERE %s;", QuoteTableName(table.Name), strings.Join(assignments, ", "),
+		strings.Join(conditions, " AND ")), nil
+}
+
+// formatOrderByClause returns the ORDER BY clause sorting the rows of the table by their primary key or main unique
+// index columns, so two exports of the same data write the rows in the same order.
+// It is empty if the table has no key to sort on.
+func formatOrderByClause(table schemareader.Table) string {
+	keyColumns := getOrderKeyColumns(table)
+	if len(keyColumns) == 0 {
+		return ""
+	}
+	return " ORDER BY " + strings.Join(quoteIdentifiers(keyColumns), ", ")
+}
@@ -0,0 +1,161 @@
+package dumper
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/sqlUtil"
+	"github.com/uyuni-project/inter-server-sync/tests"
+)
+
+func createHierarchicalTable() schemareader.Table {
+	return schemareader.Table{
+		Name:          "node",
+		Export:        true,
+		Columns:       []string{"id", "parent_id"},
+		ColumnIndexes: map[string]int{"id": 0, "parent_id": 1},
+		PKColumns:     map[string]bool{"id": true},
+		References: []schemareader.Reference{
+			{TableName: "node", ColumnMapping: map[string]string{"parent_id": "id"}},
+		},
+	}
+}
+
+func createHierarchicalRow(id interface{}, parentId interface{}) []sqlUtil.RowDataStructure {
+	return []sqlUtil.RowDataStructure{
+		{ColumnName: "id", ColumnType: "NUMERIC", Value: id},
+		{ColumnName: "parent_id", ColumnType: "NUMERIC", Value: parentId},
+	}
+}
+
+func rowIds(rows [][]sqlUtil.RowDataStructure) []interface{} {
+	result := make([]interface{}, 0)
+	for _, row := range rows {
+		result = append(result, row[0].Value)
+	}
+	return result
+}
+
+func TestOrderRowsBySelfReference(t *testing.T) {
+	// 01 Arrange
+	table := createHierarchicalTable()
+	rows := [][]sqlUtil.RowDataStructure{
+		createHierarchicalRow(int64(4), int64(3)),
+		createHierarchicalRow(int64(3), int64(1)),
+		createHierarchicalRow(int64(2), int64(1)),
+		createHierarchicalRow(int64(1), nil),
+		// the parent of this row is not exported
+		createHierarchicalRow(int64(5), int64(10)),
+	}
+
+	// 02 Act
+	result, backReferences := orderRowsBySelfReference(table, rows)
+
+	// 03 Assert
+	if len(backReferences) > 0 {
+		t.Errorf("The hierarchy should not be detected as cyclic")
+	}
+	expected := []interface{}{int64(1), int64(3), int64(4), int64(2), int64(5)}
+	if !reflect.DeepEqual(rowIds(result), expected) {
+		t.Errorf("Rows are not ordered parents first: expected %v, got %v", expected, rowIds(result))
+	}
+}
+
+func TestOrderRowsBySelfReferenceCyclic(t *testing.T) {
+	// 01 Arrange
+	table := createHierarchicalTable()
+	rows := [][]sqlUtil.RowDataStructure{
+		createHierarchicalRow(int64(1), int64(2)),
+		createHierarchicalRow(int64(2), int64(1)),
+	}
+
+	// 02 Act
+	result, backReferences := orderRowsBySelfReference(table, rows)
+
+	// 03 Assert
+	if !reflect.DeepEqual(rowIds(result), []interface{}{int64(2), int64(1)}) {
+		t.Errorf("All the rows should be kept, got %v", rowIds(result))
+	}
+	// the first row written references the second one
+	if len(backReferences) != 1 || backReferences[0].row[0].Value != int64(2) ||
+		!reflect.DeepEqual(backReferences[0].reference.LocalColumns(), []string{"parent_id"}) {
+		t.Errorf("The reference to the row written after should be returned, got %v", backReferences)
+	}
+}
+
+func TestFormatSelfBackReferenceUpdate(t *testing.T) {
+	// 01 Arrange
+	repo := tests.CreateDataRepository()
+	t.Cleanup(func() { cache = make(map[string]string) })
+	table := schemareader.Table{
+		Name:          "node",
+		Export:        true,
+		Columns:       []string{"id", "label", "parent_id"},
+		ColumnIndexes: map[string]int{"id": 0, "label": 1, "parent_id": 2},
+		ColumnDefinitions: map[string]schemareader.Column{
+			"parent_id": {Name: "parent_id", IsNullable: true},
+		},
+		PKColumns:           map[string]bool{"id": true},
+		MainUniqueIndexName: "node_label_uq",
+		UniqueIndexes: map[string]schemareader.UniqueIndex{
+			"node_label_uq": {Name: "node_label_uq", Columns: []string{"label"}},
+		},
+		References: []schemareader.Reference{
+			{TableName: "node", ColumnMapping: map[string]string{"parent_id": "id"}},
+		},
+	}
+	schema := map[string]schemareader.Table{"node": table}
+	row := []sqlUtil.RowDataStructure{
+		{ColumnName: "id", ColumnType: "NUMERIC", Value: int64(2)},
+		{ColumnName: "label", ColumnType: "VARCHAR", Value: "b"},
+		{ColumnName: "parent_id", ColumnType: "NUMERIC", Value: int64(1)},
+	}
+	repo.ExpectWithRecords("SELECT id, label, parent_id FROM node WHERE id = $1;",
+		sqlmock.NewRows(table.Columns).AddRow(int64(1), "a", int64(2)), int64(1))
+	notNullTable := table
+	notNullTable.ColumnDefinitions = map[string]schemareader.Column{"parent_id": {Name: "parent_id", IsNullable: false}}
+
+	// 02 Act
+	update, err := formatSelfBackReferenceUpdate(repo.DB, table, schema, selfBackReference{row: row, reference: table.References[0]})
+	_, notNullErr := formatSelfBackReferenceUpdate(repo.DB, notNullTable, schema, selfBackReference{row: row, reference: table.References[0]})
+
+	// 03 Assert
+	expected := "UPDATE node SET parent_id = (SELECT id FROM node WHERE label = 'a' LIMIT 1) WHERE label = 'b';"
+	if err != nil || update != expected {
+		t.Errorf("Expected %s, got %s %v", expected, update, err)
+	}
+	if notNullErr == nil {
+		t.Errorf("A NOT NULL back reference can't be inserted before its parent")
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("The reference should be resolved. Error message: %s", err)
+	}
+}
+
+func TestFormatOrderByClause(t *testing.T) {
+	// 01 Arrange
+	pkTable := schemareader.Table{Name: "pk", Columns: []string{"label", "id", "order"},
+		PKColumns: map[string]bool{"id": true, "order": true}}
+	uniqueTable := schemareader.Table{Name: "uq", Columns: []string{"channel_id", "package_id"},
+		UniqueIndexes:       map[string]schemareader.UniqueIndex{"uq_idx": {Name: "uq_idx", Columns: []string{"package_id", "channel_id"}}},
+		MainUniqueIndexName: "uq_idx"}
+	keylessTable := schemareader.Table{Name: "keyless", Columns: []string{"value"}}
+
+	// 02 Act
+	pkClause := formatOrderByClause(pkTable)
+	uniqueClause := formatOrderByClause(uniqueTable)
+	keylessClause := formatOrderByClause(keylessTable)
+
+	// 03 Assert
+	if pkClause != ` ORDER BY id, "order"` {
+		t.Errorf("Rows should be sorted by the primary key columns, got %q", pkClause)
+	}
+	if uniqueClause != " ORDER BY package_id, channel_id" {
+		t.Errorf("Rows should be sorted by the main unique index columns, got %q", uniqueClause)
+	}
+	if keylessClause != "" {
+		t.Errorf("Rows without key should not be sorted, got %q", keylessClause)
+	}
+}
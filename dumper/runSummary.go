@@ -0,0 +1,148 @@
+package dumper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RunSummary is the machine readable outcome of an export or import, written as a single JSON object at the end
+// of the run for the schedulers to tell if the sync succeeded without parsing the logs
+type RunSummary struct {
+	mutex   sync.Mutex
+	written bool
+
+	Command string `json:"command"`
+	// DryRun marks an import rolled back at the end: nothing was imported
+	DryRun    bool      `json:"dry_run,omitempty"`
+	Success   bool      `json:"success"`
+	Error     string    `json:"error,omitempty"`
+	StartTime time.Time `json:"start_time"`
+	Duration  float64   `json:"duration_seconds"`
+	Warnings  int       `json:"warnings"`
+	Errors    int       `json:"errors"`
+	// the checksum of the whole dump recorded in the manifest, empty if the run didn't get to the manifest
+	ManifestChecksum string            `json:"manifest_checksum,omitempty"`
+	Tables           []RunSummaryTable `json:"tables"`
+	// the distinct rows of each table exported and found on the target, only counted by import --verifyImport
+	Imported []RunSummaryImportedTable `json:"imported,omitempty"`
+}
+
+// RunSummaryTable is the number of rows of a table exported or imported by the run, as recorded in the manifest
+type RunSummaryTable struct {
+	Name    string `json:"name"`
+	Rows    int    `json:"rows"`
+	Partial bool   `json:"partial,omitempty"`
+}
+
+// RunSummaryImportedTable is the number of distinct rows of a table exported and found on the target after the import
+type RunSummaryImportedTable struct {
+	Name     string `json:"name"`
+	Exported int    `json:"exported"`
+	Found    int    `json:"found"`
+}
+
+// NewRunSummary returns the summary of a run of the command starting now
+func NewRunSummary(command string) *RunSummary {
+	return &RunSummary{Command: command, StartTime: time.Now(), Tables: make([]RunSummaryTable, 0)}
+}
+
+// AddWarning counts a warning logged by the run
+func (summary *RunSummary) AddWarning() {
+	summary.mutex.Lock()
+	defer summary.mutex.Unlock()
+	summary.Warnings++
+}
+
+// AddError counts an error logged by the run, the ones stopping it included
+func (summary *RunSummary) AddError() {
+	summary.mutex.Lock()
+	defer summary.mutex.Unlock()
+	summary.Errors++
+}
+
+// SetManifest sets the tables and the dump checksum of the summary from the entries of the manifest of the run
+func (summary *RunSummary) SetManifest(entries []ManifestEntry) {
+	summary.mutex.Lock()
+	defer summary.mutex.Unlock()
+	summary.Tables = make([]RunSummaryTable, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Name == ManifestDumpEntry {
+			summary.ManifestChecksum = entry.Checksum
+			continue
+		}
+		summary.Tables = append(summary.Tables, RunSummaryTable{Name: entry.Name, Rows: entry.Rows, Partial: entry.Provenance.Partial()})
+	}
+}
+
+// SetDryRun marks the summary of an import rolled back at the end
+func (summary *RunSummary) SetDryRun() {
+	summary.mutex.Lock()
+	defer summary.mutex.Unlock()
+	summary.DryRun = true
+}
+
+// SetImportedRows sets the rows of the tables found on the target from the counts of CountImportedRows
+func (summary *RunSummary) SetImportedRows(counts map[string]ImportedRows) {
+	summary.mutex.Lock()
+	defer summary.mutex.Unlock()
+	summary.Imported = make([]RunSummaryImportedTable, 0, len(counts))
+	for tableName, count := range counts {
+		summary.Imported = append(summary.Imported, RunSummaryImportedTable{Name: tableName, Exported: count.Exported, Found: count.Found})
+	}
+	sort.Slice(summary.Imported, func(i, j int) bool {
+		return summary.Imported[i].Name < summary.Imported[j].Name
+	})
+}
+
+// Write writes the summary of the finished run to the writer, failed with the error if not nil. A summary is only
+// written once: the run stopped by an error doesn't write it again on its way out.
+func (summary *RunSummary) Write(writer io.Writer, runErr error) error {
+	data, err := summary.finish(runErr)
+	if err != nil || data == nil {
+		return err
+	}
+	if _, err := writer.Write(data); err != nil {
+		return fmt.Errorf("writing the run summary: %w", err)
+	}
+	return nil
+}
+
+// WriteFile writes the summary of the finished run like Write, to the file of the path or to the standard output for -
+func (summary *RunSummary) WriteFile(path string, runErr error) error {
+	if path == "-" {
+		return summary.Write(os.Stdout, runErr)
+	}
+	data, err := summary.finish(runErr)
+	if err != nil || data == nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("writing the run summary: %w", err)
+	}
+	return nil
+}
+
+// finish completes the summary with the outcome of the run and returns its JSON line, nil if already written
+func (summary *RunSummary) finish(runErr error) ([]byte, error) {
+	summary.mutex.Lock()
+	defer summary.mutex.Unlock()
+	if summary.written {
+		return nil, nil
+	}
+	summary.written = true
+	summary.Success = runErr == nil
+	if runErr != nil {
+		summary.Error = runErr.Error()
+	}
+	summary.Duration = time.Since(summary.StartTime).Seconds()
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return nil, fmt.Errorf("encoding the run summary: %w", err)
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,111 @@
+package dumper
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRunSummaryWrite(t *testing.T) {
+	// 01 Arrange
+	summary := NewRunSummary("export")
+	summary.AddWarning()
+	summary.SetManifest([]ManifestEntry{
+		{Name: ManifestDumpEntry, Rows: 12, Checksum: "abc"},
+		{Name: "rhnchannel", Rows: 2, Checksum: "def"},
+		{Name: "rhnerrata", Rows: 5, Checksum: "ghi", Provenance: TableProvenance{RowLimit: 5, RowLimitReached: true}},
+	})
+	var buffer bytes.Buffer
+
+	// 02 Act
+	err := summary.Write(&buffer, nil)
+
+	// 03 Assert
+	if err != nil {
+		t.Fatalf("Unexpected error writing the summary: %s", err)
+	}
+	if bytes.Count(buffer.Bytes(), []byte("\n")) != 1 {
+		t.Errorf("The summary should be a single JSON line, got %s", buffer.String())
+	}
+	var written map[string]interface{}
+	if err := json.Unmarshal(buffer.Bytes(), &written); err != nil {
+		t.Fatalf("The summary should be a JSON object: %s", err)
+	}
+	if written["command"] != "export" || written["success"] != true || written["warnings"] != 1.0 ||
+		written["errors"] != 0.0 || written["manifest_checksum"] != "abc" || written["error"] != nil {
+		t.Errorf("Unexpected summary %v", written)
+	}
+	if _, ok := written["dry_run"]; ok {
+		t.Errorf("Only the dry runs should be marked, got %v", written)
+	}
+	if _, ok := written["imported"]; ok {
+		t.Errorf("Only the verified imports should have the imported rows, got %v", written)
+	}
+	if _, ok := written["duration_seconds"]; !ok {
+		t.Errorf("The summary should have the duration, got %v", written)
+	}
+	expected := []interface{}{
+		map[string]interface{}{"name": "rhnchannel", "rows": 2.0},
+		map[string]interface{}{"name": "rhnerrata", "rows": 5.0, "partial": true},
+	}
+	if !reflect.DeepEqual(written["tables"], expected) {
+		t.Errorf("Unexpected tables %v", written["tables"])
+	}
+}
+
+func TestRunSummaryWriteOnce(t *testing.T) {
+	// 01 Arrange
+	summary := NewRunSummary("import")
+	var buffer bytes.Buffer
+
+	// 02 Act
+	firstErr := summary.Write(&buffer, errors.New("Error running the SQL script"))
+	secondErr := summary.Write(&buffer, nil)
+
+	// 03 Assert
+	if firstErr != nil || secondErr != nil {
+		t.Fatalf("Unexpected errors writing the summary: %v %v", firstErr, secondErr)
+	}
+	var written RunSummary
+	if err := json.Unmarshal(buffer.Bytes(), &written); err != nil {
+		t.Fatalf("The summary should be written once: %s", buffer.String())
+	}
+	if written.Success || written.Error != "Error running the SQL script" || len(written.Tables) != 0 {
+		t.Errorf("The failed run should be summarized, got %s", buffer.String())
+	}
+}
+
+func TestRunSummaryWriteDryRunImportedRows(t *testing.T) {
+	// 01 Arrange
+	summary := NewRunSummary("import")
+	summary.SetDryRun()
+	summary.SetImportedRows(map[string]ImportedRows{
+		"rhnpackage": {Exported: 3, Found: 2},
+		"rhnchannel": {Exported: 1, Found: 1},
+	})
+	var buffer bytes.Buffer
+
+	// 02 Act
+	err := summary.Write(&buffer, nil)
+
+	// 03 Assert
+	if err != nil {
+		t.Fatalf("Unexpected error writing the summary: %s", err)
+	}
+	var written map[string]interface{}
+	if err := json.Unmarshal(buffer.Bytes(), &written); err != nil {
+		t.Fatalf("The summary should be a JSON object: %s", err)
+	}
+	if written["dry_run"] != true {
+		t.Errorf("The dry run should be marked, got %v", written)
+	}
+	expected := []interface{}{
+		map[string]interface{}{"name": "rhnchannel", "exported": 1.0, "found": 1.0},
+		map[string]interface{}{"name": "rhnpackage", "exported": 3.0, "found": 2.0},
+	}
+	if !reflect.DeepEqual(written["imported"], expected) {
+		t.Errorf("Unexpected imported rows %v", written["imported"])
+	}
+}
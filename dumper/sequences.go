@@ -0,0 +1,35 @@
+package dumper
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+
+	"github.com/lib/pq"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+)
+
+// PrintSequenceValues writes the statements moving the primary key sequences of the exported tables to their value
+// on the source, so the ids generated on the target continue from there.
+// A sequence already further on the target is never moved back.
+func PrintSequenceValues(writer *bufio.Writer, schemaMetadata map[string]schemareader.Table) {
+	values := make(map[string]int64)
+	for _, table := range schemaMetadata {
+		if !table.Export || table.PKSequence == "" || table.PKSequenceValue == 0 {
+			continue
+		}
+		if table.PKSequenceValue > values[table.PKSequence] {
+			values[table.PKSequence] = table.PKSequenceValue
+		}
+	}
+	sequences := make([]string, 0, len(values))
+	for sequence := range values {
+		sequences = append(sequences, sequence)
+	}
+	sort.Strings(sequences)
+	for _, sequence := range sequences {
+		quotedSequence := pq.QuoteLiteral(qualifySequenceName(sequence))
+		writer.WriteString(fmt.Sprintf("SELECT setval(%s, GREATEST(%d, pg_sequence_last_value(%s)));\n",
+			quotedSequence, values[sequence], quotedSequence))
+	}
+}
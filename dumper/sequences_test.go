@@ -0,0 +1,31 @@
+package dumper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/tests"
+)
+
+func TestPrintSequenceValues(t *testing.T) {
+	// 01 Arrange
+	repo := tests.CreateDataRepository()
+	schema := map[string]schemareader.Table{
+		"rhnpackage":     {Name: "rhnpackage", Export: true, PKSequence: "RHN_PACKAGE_ID_SEQ", PKSequenceValue: 300},
+		"rhnchannel":     {Name: "rhnchannel", Export: true, PKSequence: "rhn_channel_id_seq", PKSequenceValue: 12},
+		"rhnchannelarch": {Name: "rhnchannelarch", Export: false, PKSequence: "rhn_channel_arch_id_seq", PKSequenceValue: 5},
+		"rhnerrata":      {Name: "rhnerrata", Export: true, PKSequence: "rhn_errata_id_seq"},
+	}
+
+	// 02 Act
+	PrintSequenceValues(repo.Writer, schema)
+
+	// 03 Assert
+	expected := "SELECT setval('RHN_PACKAGE_ID_SEQ', GREATEST(300, pg_sequence_last_value('RHN_PACKAGE_ID_SEQ')));\n" +
+		"SELECT setval('rhn_channel_id_seq', GREATEST(12, pg_sequence_last_value('rhn_channel_id_seq')));\n"
+	result := strings.Join(repo.GetWriterBuffer(), "")
+	if result != expected {
+		t.Errorf("Expected %s, but got %s", expected, result)
+	}
+}
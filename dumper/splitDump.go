@@ -0,0 +1,127 @@
+package dumper
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// SplitStatementsFile names the files of a split dump holding the statements not changing the rows of a table,
+// like the channel cache updates
+const SplitStatementsFile = "statements.sql"
+
+// tableCommentRegexp matches the comments of the table stats, kept in the file of their table
+var tableCommentRegexp = regexp.MustCompile(`^-- table ([^\s:]+): `)
+
+// splitFile is a file of a split dump being written
+type splitFile struct {
+	file   *os.File
+	writer *bufio.Writer
+}
+
+// close flushes and closes the file
+func (file *splitFile) close() error {
+	if err := file.writer.Flush(); err != nil {
+		file.file.Close()
+		return fmt.Errorf("writing the split dump file %s: %w", file.file.Name(), err)
+	}
+	if err := file.file.Close(); err != nil {
+		return fmt.Errorf("closing the split dump file %s: %w", file.file.Name(), err)
+	}
+	return nil
+}
+
+// SplitDump writes the lines of the dump in the directory, in one file per run of consecutive statements of the same
+// table, and returns the names of the files in the order to import them: the order of the dump, which follows the
+// references between the rows. The other statements, like the channel cache updates, are written in their own files
+// where they are in the dump. The files are named after their position and table, like 0002_rhnchannel.sql.
+// The BEGIN and COMMIT of the dump transaction are not written: the files are imported in a single transaction.
+func SplitDump(reader io.Reader, dir string) ([]string, error) {
+	result := make([]string, 0)
+	var current *splitFile
+	// the file name of the table of the current file, without its position
+	currentName := ""
+	write := func(tableName string, line string) error {
+		name := SplitStatementsFile
+		if tableName != "" {
+			name = splitTableFileName(tableName)
+		}
+		if current == nil || name != currentName {
+			if current != nil {
+				err := current.close()
+				current = nil
+				if err != nil {
+					return err
+				}
+			}
+			fileName := fmt.Sprintf("%04d_%s", len(result)+1, name)
+			osFile, err := os.Create(filepath.Join(dir, fileName))
+			if err != nil {
+				return fmt.Errorf("creating the split dump file: %w", err)
+			}
+			current = &splitFile{file: osFile, writer: bufio.NewWriter(osFile)}
+			currentName = name
+			result = append(result, fileName)
+		}
+		_, err := current.writer.WriteString(line + "\n")
+		return err
+	}
+	closeCurrent := func() error {
+		if current == nil {
+			return nil
+		}
+		err := current.close()
+		current = nil
+		return err
+	}
+
+	// the table of the COPY block being read, if any
+	copyTable := ""
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		tableName, _ := statementTable(line)
+		switch {
+		case copyTable != "":
+			tableName = copyTable
+			if line == copyEndOfData {
+				copyTable = ""
+			}
+		case line == "BEGIN;" || line == "COMMIT;":
+			continue
+		case tableName != "":
+		case strings.HasPrefix(line, "COPY "):
+			copyTable = leadingIdentifier(line[len("COPY "):])
+			tableName = copyTable
+		default:
+			if match := tableCommentRegexp.FindStringSubmatch(line); match != nil {
+				tableName = match[1]
+			}
+		}
+		if err := write(tableName, line); err != nil {
+			closeCurrent()
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		closeCurrent()
+		return nil, fmt.Errorf("reading the dump: %w", err)
+	}
+	if err := closeCurrent(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// splitTableFileName returns the name of the file of the table, as written by quoteIdentifier, in a split dump
+func splitTableFileName(tableName string) string {
+	if strings.HasPrefix(tableName, `"`) {
+		tableName = strings.ReplaceAll(strings.Trim(tableName, `"`), `""`, `"`)
+	}
+	return tableName + ".sql"
+}
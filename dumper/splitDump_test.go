@@ -0,0 +1,63 @@
+package dumper
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitDump(t *testing.T) {
+	// 01 Arrange
+	dir := t.TempDir()
+	dump := strings.Join([]string{
+		"BEGIN;",
+		"DELETE FROM rhnchannelpackage WHERE channel_id = 1;",
+		"-- table rhnchannel: 1 rows",
+		"INSERT INTO rhnchannel (id, label)\tVALUES (1,'sles') ON CONFLICT (label) DO UPDATE SET label = excluded.label;",
+		"SET CONSTRAINTS ALL DEFERRED;",
+		"COPY rhnpackagechangelogdata (name) FROM stdin;",
+		"INSERT INTO rhnchannel",
+		`\.`,
+		"INSERT INTO rhnchannelpackage (channel_id, package_id)\tVALUES (1,2);",
+		"select rhn_channel.update_needed_cache((select id from rhnchannel where label ='sles'));",
+		"COMMIT;",
+	}, "\n")
+
+	// 02 Act
+	fileNames, err := SplitDump(strings.NewReader(dump), dir)
+
+	// 03 Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	// the statements keep the order of the dump: the rows of rhnchannelpackage are deleted before inserting the
+	// channel and inserted after it, the SET statement stays between the rows it was written between
+	expectedNames := []string{"0001_rhnchannelpackage.sql", "0002_rhnchannel.sql", "0003_statements.sql",
+		"0004_rhnpackagechangelogdata.sql", "0005_rhnchannelpackage.sql", "0006_statements.sql"}
+	if !reflect.DeepEqual(fileNames, expectedNames) {
+		t.Errorf("Expected files %v, got %v", expectedNames, fileNames)
+	}
+	expectedContents := map[string]string{
+		"0001_rhnchannelpackage.sql":       "DELETE FROM rhnchannelpackage WHERE channel_id = 1;\n",
+		"0002_rhnchannel.sql":              "-- table rhnchannel: 1 rows\nINSERT INTO rhnchannel (id, label)\tVALUES (1,'sles') ON CONFLICT (label) DO UPDATE SET label = excluded.label;\n",
+		"0003_statements.sql":              "SET CONSTRAINTS ALL DEFERRED;\n",
+		"0004_rhnpackagechangelogdata.sql": "COPY rhnpackagechangelogdata (name) FROM stdin;\nINSERT INTO rhnchannel\n\\.\n",
+		"0005_rhnchannelpackage.sql":       "INSERT INTO rhnchannelpackage (channel_id, package_id)\tVALUES (1,2);\n",
+		"0006_statements.sql":              "select rhn_channel.update_needed_cache((select id from rhnchannel where label ='sles'));\n",
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != len(expectedContents) {
+		t.Errorf("Expected %d files, got %v (%v)", len(expectedContents), entries, err)
+	}
+	for fileName, expected := range expectedContents {
+		content, err := os.ReadFile(filepath.Join(dir, fileName))
+		if err != nil {
+			t.Fatalf("Unexpected error reading %s: %s", fileName, err)
+		}
+		if string(content) != expected {
+			t.Errorf("Unexpected content of %s:\n%s", fileName, content)
+		}
+	}
+}
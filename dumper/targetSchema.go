@@ -0,0 +1,29 @@
+package dumper
+
+import "strings"
+
+// TargetSchema is the schema of the tables on the target database. When set, the table names of the statements
+// written for the import are qualified with it, for a target whose schema is named differently from the source one.
+var TargetSchema = ""
+
+// QuoteTableName returns the table name as it has to be written in the statements run on the target,
+// qualified with TargetSchema if set
+func QuoteTableName(name string) string {
+	if TargetSchema == "" {
+		return quoteIdentifier(name)
+	}
+	return quoteIdentifier(TargetSchema) + "." + quoteIdentifier(name)
+}
+
+// qualifySequenceName returns the sequence name as it has to be passed to the sequence functions run on the target,
+// qualified with TargetSchema if set. The sequence functions fold the unquoted names to lower case, like the ones
+// hard-coded in upper case for some tables: they are lowered before being quoted with the schema.
+func qualifySequenceName(sequence string) string {
+	if TargetSchema == "" {
+		return sequence
+	}
+	if !strings.Contains(sequence, `"`) {
+		sequence = strings.ToLower(sequence)
+	}
+	return QuoteTableName(sequence)
+}
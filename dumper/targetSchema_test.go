@@ -0,0 +1,100 @@
+package dumper
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/sqlUtil"
+)
+
+func TestTargetSchemaQualifiesTableNames(t *testing.T) {
+	// 01 Arrange
+	TargetSchema = "Sync Target"
+	defer func() { TargetSchema = "" }()
+	table := schemareader.Table{
+		Name:                "rhnchannel",
+		Export:              true,
+		Columns:             []string{"id", "label"},
+		ColumnIndexes:       map[string]int{"id": 0, "label": 1},
+		PKColumns:           map[string]bool{"id": true},
+		MainUniqueIndexName: "rhn_channel_label_uk",
+		UniqueIndexes: map[string]schemareader.UniqueIndex{
+			"rhn_channel_label_uk": {Name: "rhn_channel_label_uk", Columns: []string{"label"}},
+		},
+	}
+	schema := map[string]schemareader.Table{"rhnchannel": table}
+	rows := [][]sqlUtil.RowDataStructure{{
+		{ColumnName: "id", ColumnType: "NUMERIC", Value: "1"},
+		{ColumnName: "label", ColumnType: "VARCHAR", Value: "channel"},
+	}}
+	var buffer bytes.Buffer
+	writer := bufio.NewWriter(&buffer)
+
+	// 02 Act
+	writeRowsInsertStatements(nil, writer, schema, table, rows, nil, PrintSqlOptions{})
+	writer.Flush()
+	replaced := formatReplaceByLabel(table, rows[0])
+
+	// 03 Assert
+	expected := `INSERT INTO "Sync Target".rhnchannel (id, label)` + "\tVALUES (1,'channel') ON CONFLICT (label) DO UPDATE SET label = excluded.label;\n"
+	if buffer.String() != expected {
+		t.Errorf("The inserted table should be qualified with the target schema, got:\n%s", buffer.String())
+	}
+	if !strings.HasPrefix(replaced, `INSERT INTO "Sync Target".rhnchannel `) || !strings.Contains(replaced, `SELECT 1 FROM "Sync Target".rhnchannel WHERE`) {
+		t.Errorf("The rows replaced by label should be qualified with the target schema, got %s", replaced)
+	}
+	if header := formatCopyHeader(table); header != `COPY "Sync Target".rhnchannel (id, label) FROM stdin;` {
+		t.Errorf("The COPY block should be qualified with the target schema, got %s", header)
+	}
+	dump := "-- table rhnchannel: 1 rows\n" + buffer.String() + "-- table rhnchannel: 1 rows exported in 1ms\n"
+	if discrepancies := ValidateDump(strings.NewReader(dump)); len(discrepancies) > 0 {
+		t.Errorf("The qualified rows should be validated, got %v", discrepancies)
+	}
+	manifest, err := ComputeManifest(strings.NewReader(dump))
+	if err != nil || len(manifest) != 2 || manifest[1].Name != "rhnchannel" || manifest[1].Rows != 1 {
+		t.Errorf("The manifest should name the table without its schema, got %v %v", manifest, err)
+	}
+}
+
+func TestLeadingIdentifierSkipsSchema(t *testing.T) {
+	cases := map[string]string{
+		"rhnchannel (id)":                  "rhnchannel",
+		`target.rhnchannel (id)`:           "rhnchannel",
+		`"Sync Target"."order" (id)`:       `"order"`,
+		`"a.b"."c""d"` + "\tVALUES (1)":    `"c""d"`,
+		`"Sync Target".rhnchannel SET a=1`: "rhnchannel",
+	}
+	for text, expected := range cases {
+		if identifier := leadingIdentifier(text); identifier != expected {
+			t.Errorf("Unexpected table of %s: %s", text, identifier)
+		}
+	}
+}
+
+func TestTargetSchemaLowersUnquotedSequenceNames(t *testing.T) {
+	// 01 Arrange
+	TargetSchema = "tgt"
+	defer func() { TargetSchema = "" }()
+	table := schemareader.Table{Name: "rhnpackage", Export: true, PKColumns: map[string]bool{"id": true},
+		PKSequence: "RHN_PACKAGE_ID_SEQ", PKSequenceValue: 300}
+	row := []sqlUtil.RowDataStructure{{ColumnName: "id", ColumnType: "NUMERIC", Value: "1"}}
+	var buffer bytes.Buffer
+	writer := bufio.NewWriter(&buffer)
+
+	// 02 Act
+	substituted := substitutePrimaryKey(table, row)
+	PrintSequenceValues(writer, map[string]schemareader.Table{"rhnpackage": table})
+	writer.Flush()
+
+	// 03 Assert
+	if substituted[0].Value != "SELECT nextval('tgt.rhn_package_id_seq')" {
+		t.Errorf("The inserted id should use the lower case qualified sequence, got %s", substituted[0].Value)
+	}
+	expected := "SELECT setval('tgt.rhn_package_id_seq', GREATEST(300, pg_sequence_last_value('tgt.rhn_package_id_seq')));\n"
+	if buffer.String() != expected {
+		t.Errorf("The sequence value should use the lower case qualified sequence, got %s", buffer.String())
+	}
+}
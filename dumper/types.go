@@ -25,19 +25,70 @@ type TableDump struct {
 type DataDumper struct {
 	TableData map[string]TableDump
 	Paths     map[string]bool
+	// Provenance tells how the rows of each crawled table were selected
+	Provenance map[string]TableProvenance
+}
+
+// CrawlerStart is a table and the filter selecting its rows to start crawling from
+type CrawlerStart struct {
+	Table       schemareader.Table
+	QueryFilter string
 }
 
 type processItem struct {
 	tableName string
 	row       []sqlUtil.RowDataStructure
 	path      []string
+	// the row references the row it was reached from
+	child bool
+	// the row it was reached from, nil for a starting row
+	parent *processItem
+}
+
+// Strategies to export tables which can only be matched by their sequence id
+const (
+	// IdOnlyInsert inserts the rows without any conflict check, re-importing creates duplicates
+	IdOnlyInsert = "insert-only"
+	// IdOnlyRemap matches the rows on the target using all their exported columns
+	IdOnlyRemap = "remap-by-content"
+	// IdOnlySkip doesn't export the rows
+	IdOnlySkip = "skip"
+)
+
+// Pagination defines how to split the export of a full table in pages and statements
+type Pagination struct {
+	// PageSize is the maximum number of rows read at once, 0 to disable pagination
+	PageSize int
+	// InsertBatchSize is the maximum number of rows inserted by each INSERT statement, 1 or less for one per row
+	InsertBatchSize int
 }
 
 type PrintSqlOptions struct {
-	TablesToClean            []string
-	CleanWhereClause         string
+	TablesToClean []string
+	// CleanWhereClause returns the WHERE clause selecting the rows to clean, with the table names written by quoteTable:
+	// the rows are selected on the source and on the target
+	CleanWhereClause         func(quoteTable func(string) string) string
 	OnlyIfParentExistsTables []string
 	PostOrderCallback        Callback
+	// RowChecksumWriter receives the checksum of each exported row when set
+	RowChecksumWriter *bufio.Writer
+	// TableStats adds SQL comments with the row count and export duration of each table
+	TableStats bool
+	// RowKeys adds SQL comments with the keys of the planned and written rows of each table to the table stats,
+	// for ValidateDump to check them
+	RowKeys bool
+	// Undo collects the statements reversing the exported rows when set
+	Undo *UndoScript
+	// Cleanup collects the statements removing the exported rows from the target when set
+	Cleanup *CleanupScript
+	// Verification records the written rows to count them on the target after the import when set
+	Verification *ImportVerification
+	// AssociationDelta skips the rows of its table already exported previously when set
+	AssociationDelta *AssociationDelta
+	// InsertBatchSize is the maximum number of rows of a table inserted by a single statement, 0 or 1 for one per row
+	InsertBatchSize int
+	// Provenance collects how the rows of the written tables were selected when set
+	Provenance *ExportProvenance
 }
 
 type Callback func(db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table, table schemareader.Table, data DataDumper)
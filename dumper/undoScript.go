@@ -0,0 +1,88 @@
+package dumper
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/sqlUtil"
+	"github.com/uyuni-project/inter-server-sync/utils"
+)
+
+// UndoScript collects the statements reversing the rows inserted by an import.
+// Only the rows inserted when missing on the target can be removed by their natural key:
+// the undo is only clean when the target had none of these rows before the import.
+type UndoScript struct {
+	statements     []string
+	warnedTables   map[string]bool
+	notUndoneNames []string
+}
+
+func NewUndoScript() *UndoScript {
+	return &UndoScript{statements: make([]string, 0), warnedTables: make(map[string]bool), notUndoneNames: make([]string, 0)}
+}
+
+// isInsertOnly tells if the rows of the table are only inserted when missing and never updated
+func isInsertOnly(table schemareader.Table, onlyIfParentExistsTables []string) bool {
+	if table.ReplaceByLabel {
+		return false
+	}
+	return strings.Compare(table.MainUniqueIndexName, schemareader.VirtualIndexName) == 0 ||
+		utils.Contains(onlyIfParentExistsTables, table.Name)
+}
+
+func (undo *UndoScript) addRow(db *sql.DB, row []sqlUtil.RowDataStructure, table schemareader.Table,
+	schemaMetadata map[string]schemareader.Table, onlyIfParentExistsTables []string) {
+	if !isInsertOnly(table, onlyIfParentExistsTables) {
+		if !undo.warnedTables[table.Name] {
+			log.Warn().Msgf("Rows of %s are updated on the target: they cannot be undone", table.Name)
+			undo.warnedTables[table.Name] = true
+			undo.notUndoneNames = append(undo.notUndoneNames, table.Name)
+		}
+		return
+	}
+	undo.statements = append(undo.statements, formatDeleteByMainUniqueIndex(db, row, table, schemaMetadata))
+}
+
+// formatDeleteByMainUniqueIndex returns the statement deleting the row on the target, matched by its main unique index
+// with the references resolved to the target rows
+func formatDeleteByMainUniqueIndex(db *sql.DB, row []sqlUtil.RowDataStructure, table schemareader.Table,
+	schemaMetadata map[string]schemareader.Table) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE %s;", QuoteTableName(table.Name),
+		formatMainUniqueIndexCondition(db, row, table, schemaMetadata))
+}
+
+// formatMainUniqueIndexCondition returns the condition matching the row on the target by its main unique index,
+// with the references resolved to the target rows
+func formatMainUniqueIndexCondition(db *sql.DB, row []sqlUtil.RowDataStructure, table schemareader.Table,
+	schemaMetadata map[string]schemareader.Table) string {
+	values := filterRowData(substituteKeys(db, table, row, schemaMetadata), table)
+	whereClauseList := make([]string, 0)
+	for _, indexColumn := range table.UniqueIndexes[table.MainUniqueIndexName].Columns {
+		for _, value := range values {
+			if strings.Compare(indexColumn, value.ColumnName) == 0 {
+				if value.Value == nil {
+					whereClauseList = append(whereClauseList, fmt.Sprintf("%s IS NULL", quoteIdentifier(value.ColumnName)))
+				} else {
+					whereClauseList = append(whereClauseList, fmt.Sprintf("%s = %s", quoteIdentifier(value.ColumnName), formatField(value)))
+				}
+			}
+		}
+	}
+	return strings.Join(whereClauseList, " AND ")
+}
+
+// Write writes the undo statements in the reverse order of the export, children first
+func (undo *UndoScript) Write(writer *bufio.Writer) {
+	writer.WriteString("BEGIN;\n")
+	if len(undo.notUndoneNames) > 0 {
+		writer.WriteString(fmt.Sprintf("-- updated rows cannot be undone in tables: %s\n", strings.Join(undo.notUndoneNames, ", ")))
+	}
+	for i := len(undo.statements) - 1; i >= 0; i-- {
+		writer.WriteString(undo.statements[i] + "\n")
+	}
+	writer.WriteString("COMMIT;\n")
+}
@@ -0,0 +1,56 @@
+package dumper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/tests"
+)
+
+func TestUndoScriptDeletesChildrenFirst(t *testing.T) {
+	// 01 Arrange
+	graph := TablesGraph{
+		"root": []string{"v51", "v52"},
+		"v51":  []string{},
+		"v52":  []string{},
+	}
+	root := "root"
+	undo := NewUndoScript()
+	testCase := createTestCase(graph, root, PrintSqlOptions{Undo: undo})
+	// v52 is upserted by its label, it cannot be undone
+	upserted := testCase.schemaMetadata["v52"]
+	upserted.MainUniqueIndexName = "v52_label_uq"
+	upserted.UniqueIndexes = map[string]schemareader.UniqueIndex{"v52_label_uq": {Name: "v52_label_uq", Columns: []string{"id"}}}
+	testCase.schemaMetadata["v52"] = upserted
+
+	testCase.repo.Expect("SELECT id FROM v51 WHERE (id) IN (('0001')) ORDER BY id;", testCase.schemaMetadata["v51"].Columns, 1)
+	testCase.repo.Expect("SELECT id FROM v52 WHERE (id) IN (('0001')) ORDER BY id;", testCase.schemaMetadata["v52"].Columns, 1)
+	testCase.repo.Expect("SELECT id, v51_fk_id, v52_fk_id FROM root WHERE (id) IN (('0001')) ORDER BY id;", testCase.schemaMetadata["root"].Columns, 1)
+	testCase.repo.Expect("SELECT id FROM v51 WHERE id = $1;", testCase.schemaMetadata["v51"].Columns, 1)
+	testCase.repo.Expect("SELECT id FROM v52 WHERE id = $1;", testCase.schemaMetadata["v52"].Columns, 1)
+
+	// 02 Act
+	orderedTables := getTablesExportOrder(testCase.schemaMetadata, testCase.startingTable, testCase.processedTables, testCase.path)
+	exportTablesData(testCase.repo.DB, testCase.repo.Writer, testCase.schemaMetadata, orderedTables,
+		testCase.dumper, testCase.options)
+	undoRepo := tests.CreateDataRepository()
+	undo.Write(undoRepo.Writer)
+	undoLines := strings.Split(strings.Join(undoRepo.GetWriterBuffer(), ""), "\n")
+
+	// 03 Assert
+	expected := []string{
+		"BEGIN;",
+		"-- updated rows cannot be undone in tables: v52",
+		"DELETE FROM root WHERE id = '0001';",
+		"DELETE FROM v51 WHERE id = '0001';",
+		"COMMIT;",
+		"",
+	}
+	if strings.Join(undoLines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected undo script: expected %v, got %v", expected, undoLines)
+	}
+	if err := testCase.repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("Some rows were not exported. Error message: %s", err)
+	}
+}
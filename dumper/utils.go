@@ -5,9 +5,63 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+
+	"github.com/lib/pq"
 )
 
+var plainIdentifierRegexp = regexp.MustCompile(`^[a-z_][a-z0-9_$]*$`)
+
+// reservedKeywords are the PostgreSQL keywords which can't be used as table or column names unquoted
+var reservedKeywords = map[string]bool{
+	"all": true, "analyse": true, "analyze": true, "and": true, "any": true, "array": true, "as": true, "asc": true,
+	"asymmetric": true, "authorization": true, "binary": true, "both": true, "case": true, "cast": true, "check": true,
+	"collate": true, "collation": true, "column": true, "concurrently": true, "constraint": true, "create": true,
+	"cross": true, "current_catalog": true, "current_date": true, "current_role": true, "current_schema": true,
+	"current_time": true, "current_timestamp": true, "current_user": true, "default": true, "deferrable": true,
+	"desc": true, "distinct": true, "do": true, "else": true, "end": true, "except": true, "false": true, "fetch": true,
+	"for": true, "foreign": true, "freeze": true, "from": true, "full": true, "grant": true, "group": true, "having": true,
+	"ilike": true, "in": true, "initially": true, "inner": true, "intersect": true, "into": true, "is": true,
+	"isnull": true, "join": true, "lateral": true, "leading": true, "left": true, "like": true, "limit": true,
+	"localtime": true, "localtimestamp": true, "natural": true, "not": true, "notnull": true, "null": true,
+	"offset": true, "on": true, "only": true, "or": true, "order": true, "outer": true, "overlaps": true, "placing": true,
+	"primary": true, "references": true, "returning": true, "right": true, "select": true, "session_user": true,
+	"similar": true, "some": true, "symmetric": true, "system_user": true, "table": true, "tablesample": true,
+	"then": true, "to": true, "trailing": true, "true": true, "union": true, "unique": true, "user": true, "using": true,
+	"variadic": true, "verbose": true, "when": true, "where": true, "window": true, "with": true,
+}
+
+// quoteIdentifier returns the table or column name as it has to be written in SQL.
+// Lowercase names which are not reserved keywords are kept as is to keep the generated SQL readable.
+func quoteIdentifier(name string) string {
+	if plainIdentifierRegexp.MatchString(name) && !reservedKeywords[name] {
+		return name
+	}
+	return pq.QuoteIdentifier(name)
+}
+
+// quoteIdentifiers returns the names quoted with quoteIdentifier
+func quoteIdentifiers(names []string) []string {
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		result = append(result, quoteIdentifier(name))
+	}
+	return result
+}
+
+// lineBreakEscaper escapes a string value in an E'...' literal
+var lineBreakEscaper = strings.NewReplacer(`\`, `\\`, `'`, `''`, "\n", `\n`, "\r", `\r`)
+
+// quoteLiteral returns the value as a SQL string literal, kept on a single line since the dump is processed line
+// by line: the line breaks, frequent in the errata descriptions, are escaped in an E'...' literal.
+func quoteLiteral(value string) string {
+	if !strings.ContainsAny(value, "\n\r") {
+		return pq.QuoteLiteral(value)
+	}
+	return "E'" + lineBreakEscaper.Replace(value) + "'"
+}
+
 func Copy(src, dst string) (int64, error) {
 	sourceFileStat, err := os.Stat(src)
 	if err != nil {
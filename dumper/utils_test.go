@@ -41,7 +41,7 @@ func createMetaDataGraph(graph TablesGraph) (MetaDataGraph, DataDumper) {
 				PKColumns:           map[string]bool{"id": true},
 				ColumnIndexes:       map[string]int{"id": 0},
 				MainUniqueIndexName: indexName,
-				UniqueIndexes:       map[string]schemareader.UniqueIndex{indexName: {indexName, []string{"id"}}},
+				UniqueIndexes:       map[string]schemareader.UniqueIndex{indexName: {Name: indexName, Columns: []string{"id"}}},
 				References:          []schemareader.Reference{},
 				ReferencedBy:        []schemareader.Reference{},
 			}
@@ -0,0 +1,62 @@
+package dumper
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/sqlUtil"
+)
+
+// ValueTransform rewrites an exported value for the target environment, like a server specific path or hostname.
+// The value is the one read from the source database, nil for NULL, and the result is written in its place:
+// it has to keep the Go type of the value to be formatted for the column type.
+type ValueTransform func(value interface{}) (interface{}, error)
+
+// valueTransforms holds the functions registered with RegisterValueTransform per table and column
+var valueTransforms = make(map[string]map[string]ValueTransform)
+
+// RegisterValueTransform sets the function transforming the exported values of the column of the table,
+// nil to remove it. The written rows, their checksums, undo, cleanup and import verification all use the transformed
+// values: the rows referencing a row with a transformed unique column still match it by its source values.
+func RegisterValueTransform(tableName string, columnName string, transform ValueTransform) {
+	if transform == nil {
+		delete(valueTransforms[tableName], columnName)
+		return
+	}
+	if _, ok := valueTransforms[tableName]; !ok {
+		valueTransforms[tableName] = make(map[string]ValueTransform)
+	}
+	valueTransforms[tableName][columnName] = transform
+}
+
+// applyValueTransforms returns a copy of the row with the registered transforms of the table applied
+func applyValueTransforms(table schemareader.Table, row []sqlUtil.RowDataStructure) ([]sqlUtil.RowDataStructure, error) {
+	transforms := valueTransforms[table.Name]
+	if len(transforms) == 0 {
+		return row, nil
+	}
+	result := make([]sqlUtil.RowDataStructure, len(row))
+	copy(result, row)
+	for i, value := range result {
+		transform, ok := transforms[value.ColumnName]
+		if !ok {
+			continue
+		}
+		transformed, err := transform(value.Value)
+		if err != nil {
+			return nil, fmt.Errorf("transforming the value of %s.%s: %w", table.Name, value.ColumnName, err)
+		}
+		result[i].Value = transformed
+	}
+	return result, nil
+}
+
+// transformRow is applyValueTransforms stopping the export when a value can't be transformed
+func transformRow(table schemareader.Table, row []sqlUtil.RowDataStructure) []sqlUtil.RowDataStructure {
+	values, err := applyValueTransforms(table, row)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Unable to transform the exported row")
+	}
+	return values
+}
@@ -0,0 +1,140 @@
+package dumper
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/sqlUtil"
+)
+
+func TestValueTransformRewritesExportedValues(t *testing.T) {
+	// 01 Arrange
+	table := schemareader.Table{
+		Name:          "rhnchannel",
+		Columns:       []string{"id", "url"},
+		ColumnIndexes: map[string]int{"id": 0, "url": 1},
+		CopyRows:      true,
+	}
+	row := []sqlUtil.RowDataStructure{
+		{ColumnName: "id", ColumnType: "NUMERIC", Value: "1"},
+		{ColumnName: "url", ColumnType: "VARCHAR", Value: "https://source.example.com/repo"},
+	}
+	RegisterValueTransform("rhnchannel", "url", func(value interface{}) (interface{}, error) {
+		return strings.Replace(fmt.Sprintf("%s", value), "source.example.com", "target.example.com", 1), nil
+	})
+	defer RegisterValueTransform("rhnchannel", "url", nil)
+
+	// 02 Act
+	line := generateRowLine(nil, row, table, map[string]schemareader.Table{}, nil)
+
+	// 03 Assert
+	if line != "1\thttps://target.example.com/repo" {
+		t.Errorf("Unexpected transformed row: %s", line)
+	}
+	if row[1].Value != "https://source.example.com/repo" {
+		t.Errorf("The source row should not be changed, got %v", row[1].Value)
+	}
+}
+
+func TestValueTransformRewritesInsertedValues(t *testing.T) {
+	// 01 Arrange
+	table := schemareader.Table{
+		Name:                "rhnchannel",
+		Export:              true,
+		Columns:             []string{"id", "url"},
+		ColumnIndexes:       map[string]int{"id": 0, "url": 1},
+		PKColumns:           map[string]bool{"id": true},
+		UniqueIndexes:       map[string]schemareader.UniqueIndex{"rhn_channel_url_uq": {Name: "rhn_channel_url_uq", Columns: []string{"url"}}},
+		MainUniqueIndexName: "rhn_channel_url_uq",
+	}
+	schema := map[string]schemareader.Table{"rhnchannel": table}
+	row := []sqlUtil.RowDataStructure{
+		{ColumnName: "id", ColumnType: "NUMERIC", Value: "1"},
+		{ColumnName: "url", ColumnType: "VARCHAR", Value: "https://source.example.com/repo"},
+	}
+	RegisterValueTransform("rhnchannel", "url", func(value interface{}) (interface{}, error) {
+		return strings.Replace(fmt.Sprintf("%s", value), "source.example.com", "target.example.com", 1), nil
+	})
+	defer RegisterValueTransform("rhnchannel", "url", nil)
+
+	// 02 Act
+	// the rows of the cleaned tables are inserted again with this statement
+	statement := generateRowInsertStatement(nil, row, table, schema, []string{})
+	line := generateRowLine(nil, row, table, schema, nil)
+
+	// 03 Assert
+	for _, written := range []string{statement, line} {
+		if !strings.Contains(written, "'https://target.example.com/repo'") || strings.Contains(written, "source.example.com") {
+			t.Errorf("Unexpected transformed row: %s", written)
+		}
+	}
+}
+
+func TestValueTransformReportsErrors(t *testing.T) {
+	// 01 Arrange
+	table := schemareader.Table{Name: "rhnchannel"}
+	row := []sqlUtil.RowDataStructure{{ColumnName: "url", ColumnType: "VARCHAR", Value: nil}}
+	RegisterValueTransform("rhnchannel", "url", func(value interface{}) (interface{}, error) {
+		return nil, fmt.Errorf("no url")
+	})
+	defer RegisterValueTransform("rhnchannel", "url", nil)
+
+	// 02 Act
+	_, err := applyValueTransforms(table, row)
+
+	// 03 Assert
+	if err == nil || !strings.Contains(err.Error(), "rhnchannel.url") {
+		t.Errorf("The error should name the transformed column, got %v", err)
+	}
+}
+
+func TestValueTransformMatchesWrittenRowsOnTarget(t *testing.T) {
+	// 01 Arrange
+	table := schemareader.Table{
+		Name:                "rhnchannel",
+		Export:              true,
+		Columns:             []string{"id", "url"},
+		ColumnIndexes:       map[string]int{"id": 0, "url": 1},
+		PKColumns:           map[string]bool{"id": true},
+		UniqueIndexes:       map[string]schemareader.UniqueIndex{"rhn_channel_url_uq": {Name: "rhn_channel_url_uq", Columns: []string{"url"}}},
+		MainUniqueIndexName: "rhn_channel_url_uq",
+	}
+	schema := map[string]schemareader.Table{"rhnchannel": table}
+	rows := [][]sqlUtil.RowDataStructure{{
+		{ColumnName: "id", ColumnType: "NUMERIC", Value: "1"},
+		{ColumnName: "url", ColumnType: "VARCHAR", Value: "https://source.example.com/repo"},
+	}}
+	RegisterValueTransform("rhnchannel", "url", func(value interface{}) (interface{}, error) {
+		return strings.Replace(fmt.Sprintf("%s", value), "source.example.com", "target.example.com", 1), nil
+	})
+	defer RegisterValueTransform("rhnchannel", "url", nil)
+	var dump, verification, undo bytes.Buffer
+	dumpWriter := bufio.NewWriter(&dump)
+	verificationWriter := bufio.NewWriter(&verification)
+	undoScript := NewUndoScript()
+	options := PrintSqlOptions{
+		// the rows only inserted when missing can be undone
+		OnlyIfParentExistsTables: []string{"rhnchannel"},
+		Undo:                     undoScript,
+		Verification:             NewImportVerification(verificationWriter),
+	}
+
+	// 02 Act
+	writeRowsInsertStatements(nil, dumpWriter, schema, table, rows, nil, options)
+	dumpWriter.Flush()
+	verificationWriter.Flush()
+	undoWriter := bufio.NewWriter(&undo)
+	undoScript.Write(undoWriter)
+	undoWriter.Flush()
+
+	// 03 Assert
+	for _, written := range []string{dump.String(), verification.String(), undo.String()} {
+		if !strings.Contains(written, "'https://target.example.com/repo'") || strings.Contains(written, "source.example.com") {
+			t.Errorf("The row should be matched by its transformed value, got %s", written)
+		}
+	}
+}
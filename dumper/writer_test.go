@@ -6,6 +6,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/uyuni-project/inter-server-sync/schemareader"
 	"github.com/uyuni-project/inter-server-sync/sqlUtil"
 	"github.com/uyuni-project/inter-server-sync/tests"
@@ -42,15 +43,15 @@ func TestPrintAllTableData(t *testing.T) {
 	testCase := createTestCase(graph, root, PrintSqlOptions{})
 
 	// the data repository expect these statements in the exact same order
-	testCase.repo.Expect("SELECT id, v05_fk_id FROM v04 ;", testCase.schemaMetadata["v04"].Columns, 1)
+	testCase.repo.Expect("SELECT id, v05_fk_id FROM v04 ORDER BY id;", testCase.schemaMetadata["v04"].Columns, 1)
 	testCase.repo.Expect("SELECT id, v04_fk_id FROM v05 WHERE id = $1;", testCase.schemaMetadata["v05"].Columns, 1)
-	testCase.repo.Expect("SELECT id, v04_fk_id FROM v05 ;", testCase.schemaMetadata["v05"].Columns, 1)
+	testCase.repo.Expect("SELECT id, v04_fk_id FROM v05 ORDER BY id;", testCase.schemaMetadata["v05"].Columns, 1)
 	testCase.repo.Expect("SELECT id, v05_fk_id FROM v04 WHERE id = $1;", testCase.schemaMetadata["v04"].Columns, 1)
-	testCase.repo.Expect("SELECT id, v05_fk_id FROM v01 ;", testCase.schemaMetadata["v01"].Columns, 1)
-	testCase.repo.Expect("SELECT id, v04_fk_id FROM v03 ;", testCase.schemaMetadata["v03"].Columns, 1)
-	testCase.repo.Expect("SELECT id, v03_fk_id FROM v02 ;", testCase.schemaMetadata["v02"].Columns, 1)
+	testCase.repo.Expect("SELECT id, v05_fk_id FROM v01 ORDER BY id;", testCase.schemaMetadata["v01"].Columns, 1)
+	testCase.repo.Expect("SELECT id, v04_fk_id FROM v03 ORDER BY id;", testCase.schemaMetadata["v03"].Columns, 1)
+	testCase.repo.Expect("SELECT id, v03_fk_id FROM v02 ORDER BY id;", testCase.schemaMetadata["v02"].Columns, 1)
 	testCase.repo.Expect("SELECT id, v04_fk_id FROM v03 WHERE id = $1;", testCase.schemaMetadata["v03"].Columns, 1)
-	testCase.repo.Expect("SELECT id, v01_fk_id, v02_fk_id FROM root ;", testCase.schemaMetadata["root"].Columns, 1)
+	testCase.repo.Expect("SELECT id, v01_fk_id, v02_fk_id FROM root ORDER BY id;", testCase.schemaMetadata["root"].Columns, 1)
 	testCase.repo.Expect("SELECT id, v05_fk_id FROM v01 WHERE id = $1;", testCase.schemaMetadata["v01"].Columns, 1)
 	testCase.repo.Expect("SELECT id, v03_fk_id FROM v02 WHERE id = $1;", testCase.schemaMetadata["v02"].Columns, 1)
 
@@ -64,6 +65,8 @@ func TestPrintAllTableData(t *testing.T) {
 		testCase.processedTables,
 		testCase.path,
 		testCase.onlyIfParentExistsTables,
+		Pagination{},
+		&tableProgress{},
 	)
 
 	// 03 Assert
@@ -107,30 +110,30 @@ func TestPrintCleanTables(t *testing.T) {
 		PrintSqlOptions{TablesToClean: keys},
 	)
 
-	testCase.repo.Expect("SELECT * FROM root WHERE (id) IN (SELECT root.id FROM root  );", testCase.schemaMetadata["root"].Columns, 1)
+	testCase.repo.Expect("SELECT id, v11_fk_id, v12_fk_id FROM root WHERE (id) IN (SELECT root.id FROM root  );", testCase.schemaMetadata["root"].Columns, 1)
 	testCase.repo.Expect("SELECT id, v15_fk_id, v16_fk_id FROM v11 WHERE id = $1;", testCase.schemaMetadata["v11"].Columns, 1)
 	testCase.repo.Expect("SELECT id, v13_fk_id FROM v12 WHERE id = $1;", testCase.schemaMetadata["v12"].Columns, 1)
-	testCase.repo.Expect("SELECT * FROM v11 WHERE (id) IN (SELECT v11.id FROM v11  "+
+	testCase.repo.Expect("SELECT id, v15_fk_id, v16_fk_id FROM v11 WHERE (id) IN (SELECT v11.id FROM v11  "+
 		"INNER JOIN root on root.v11_fk_id = v11.id );", testCase.schemaMetadata["v11"].Columns, 1)
 	testCase.repo.Expect("SELECT id, v14_fk_id FROM v15 WHERE id = $1;", testCase.schemaMetadata["v15"].Columns, 1)
 	testCase.repo.Expect("SELECT id FROM v16 WHERE id = $1;", testCase.schemaMetadata["v16"].Columns, 1)
-	testCase.repo.Expect("SELECT * FROM v15 WHERE (id) IN (SELECT v15.id FROM v15  "+
+	testCase.repo.Expect("SELECT id, v14_fk_id FROM v15 WHERE (id) IN (SELECT v15.id FROM v15  "+
 		"INNER JOIN v11 on v11.v15_fk_id = v15.id "+
 		"INNER JOIN root on root.v11_fk_id = v11.id );", testCase.schemaMetadata["v15"].Columns, 1)
 	testCase.repo.Expect("SELECT id, v15_fk_id, v16_fk_id FROM v14 WHERE id = $1;", testCase.schemaMetadata["v14"].Columns, 1)
-	testCase.repo.Expect("SELECT * FROM v14 WHERE (id) IN (SELECT v14.id FROM v14  "+
+	testCase.repo.Expect("SELECT id, v15_fk_id, v16_fk_id FROM v14 WHERE (id) IN (SELECT v14.id FROM v14  "+
 		"INNER JOIN v15 on v15.v14_fk_id = v14.id "+
 		"INNER JOIN v11 on v11.v15_fk_id = v15.id "+
 		"INNER JOIN root on root.v11_fk_id = v11.id );", testCase.schemaMetadata["v14"].Columns, 1)
-	testCase.repo.Expect("SELECT * FROM v16 WHERE (id) IN (SELECT v16.id FROM v16  "+
+	testCase.repo.Expect("SELECT id FROM v16 WHERE (id) IN (SELECT v16.id FROM v16  "+
 		"INNER JOIN v14 on v14.v16_fk_id = v16.id "+
 		"INNER JOIN v15 on v15.v14_fk_id = v14.id "+
 		"INNER JOIN v11 on v11.v15_fk_id = v15.id "+
 		"INNER JOIN root on root.v11_fk_id = v11.id );", testCase.schemaMetadata["v16"].Columns, 1)
-	testCase.repo.Expect("SELECT * FROM v12 WHERE (id) IN (SELECT v12.id FROM v12  "+
+	testCase.repo.Expect("SELECT id, v13_fk_id FROM v12 WHERE (id) IN (SELECT v12.id FROM v12  "+
 		"INNER JOIN root on root.v12_fk_id = v12.id );", testCase.schemaMetadata["v12"].Columns, 1)
 	testCase.repo.Expect("SELECT id, v14_fk_id FROM v13 WHERE id = $1;", testCase.schemaMetadata["v13"].Columns, 1)
-	testCase.repo.Expect("SELECT * FROM v13 WHERE (id) IN (SELECT v13.id FROM v13  "+
+	testCase.repo.Expect("SELECT id, v14_fk_id FROM v13 WHERE (id) IN (SELECT v13.id FROM v13  "+
 		"INNER JOIN v12 on v12.v13_fk_id = v13.id "+
 		"INNER JOIN root on root.v12_fk_id = v12.id );", testCase.schemaMetadata["v13"].Columns, 1)
 
@@ -261,17 +264,17 @@ func TestPrintTableData(t *testing.T) {
 	testCase := createTestCase(graph, root, PrintSqlOptions{PostOrderCallback: createCallback()})
 
 	// the data repository expect these statements in the exact same order
-	testCase.repo.Expect("SELECT id FROM v26 WHERE (id) IN (('0001'));", testCase.schemaMetadata["v26"].Columns, 1)
-	testCase.repo.Expect("SELECT id, v25_fk_id, v26_fk_id FROM v24 WHERE (id) IN (('0001'));", testCase.schemaMetadata["v24"].Columns, 1)
+	testCase.repo.Expect("SELECT id FROM v26 WHERE (id) IN (('0001')) ORDER BY id;", testCase.schemaMetadata["v26"].Columns, 1)
+	testCase.repo.Expect("SELECT id, v25_fk_id, v26_fk_id FROM v24 WHERE (id) IN (('0001')) ORDER BY id;", testCase.schemaMetadata["v24"].Columns, 1)
 	testCase.repo.Expect("SELECT id, v24_fk_id FROM v25 WHERE id = $1;", testCase.schemaMetadata["v25"].Columns, 1)
 	testCase.repo.Expect("SELECT id FROM v26 WHERE id = $1;", testCase.schemaMetadata["v26"].Columns, 1)
-	testCase.repo.Expect("SELECT id, v24_fk_id FROM v25 WHERE (id) IN (('0001'));", testCase.schemaMetadata["v25"].Columns, 1)
+	testCase.repo.Expect("SELECT id, v24_fk_id FROM v25 WHERE (id) IN (('0001')) ORDER BY id;", testCase.schemaMetadata["v25"].Columns, 1)
 	testCase.repo.Expect("SELECT id, v25_fk_id, v26_fk_id FROM v24 WHERE id = $1;", testCase.schemaMetadata["v24"].Columns, 1)
-	testCase.repo.Expect("SELECT id, v25_fk_id, v26_fk_id FROM v21 WHERE (id) IN (('0001'));", testCase.schemaMetadata["v21"].Columns, 1)
-	testCase.repo.Expect("SELECT id, v24_fk_id FROM v23 WHERE (id) IN (('0001'));", testCase.schemaMetadata["v23"].Columns, 1)
-	testCase.repo.Expect("SELECT id, v23_fk_id FROM v22 WHERE (id) IN (('0001'));", testCase.schemaMetadata["v22"].Columns, 1)
+	testCase.repo.Expect("SELECT id, v25_fk_id, v26_fk_id FROM v21 WHERE (id) IN (('0001')) ORDER BY id;", testCase.schemaMetadata["v21"].Columns, 1)
+	testCase.repo.Expect("SELECT id, v24_fk_id FROM v23 WHERE (id) IN (('0001')) ORDER BY id;", testCase.schemaMetadata["v23"].Columns, 1)
+	testCase.repo.Expect("SELECT id, v23_fk_id FROM v22 WHERE (id) IN (('0001')) ORDER BY id;", testCase.schemaMetadata["v22"].Columns, 1)
 	testCase.repo.Expect("SELECT id, v24_fk_id FROM v23 WHERE id = $1;", testCase.schemaMetadata["v23"].Columns, 1)
-	testCase.repo.Expect("SELECT id, v21_fk_id, v22_fk_id FROM root WHERE (id) IN (('0001'));", testCase.schemaMetadata["root"].Columns, 1)
+	testCase.repo.Expect("SELECT id, v21_fk_id, v22_fk_id FROM root WHERE (id) IN (('0001')) ORDER BY id;", testCase.schemaMetadata["root"].Columns, 1)
 	testCase.repo.Expect("SELECT id, v25_fk_id, v26_fk_id FROM v21 WHERE id = $1;", testCase.schemaMetadata["v21"].Columns, 1)
 	testCase.repo.Expect("SELECT id, v23_fk_id FROM v22 WHERE id = $1;", testCase.schemaMetadata["v22"].Columns, 1)
 
@@ -318,6 +321,35 @@ func TestFormatOnConflict(t *testing.T) {
 	}
 }
 
+func TestFormatConflictTarget(t *testing.T) {
+	// 01 Arrange
+	withIndex := schemareader.Table{
+		Name:                "rhnchannel",
+		Columns:             []string{"id", "label", "name"},
+		PKColumns:           map[string]bool{"id": true},
+		MainUniqueIndexName: "rhn_channel_label_uq",
+		UniqueIndexes: map[string]schemareader.UniqueIndex{
+			"rhn_channel_label_uq": {Name: "rhn_channel_label_uq", Columns: []string{"label"}}},
+	}
+	withoutIndex := schemareader.Table{
+		Name:      "rhnchannelpackage",
+		Columns:   []string{"package_id", "channel_id", "created"},
+		PKColumns: map[string]bool{"channel_id": true, "package_id": true},
+	}
+
+	// 02 Act
+	indexTarget := formatOnConflict(nil, withIndex)
+	pkTarget := formatOnConflict(nil, withoutIndex)
+
+	// 03 Assert
+	if indexTarget != "(label) DO UPDATE SET label = excluded.label,name = excluded.name" {
+		t.Errorf("Conflict target should be the main unique index, got %s", indexTarget)
+	}
+	if pkTarget != "(package_id, channel_id) DO UPDATE SET created = excluded.created" {
+		t.Errorf("Conflict target should be the primary key without main unique index, got %s", pkTarget)
+	}
+}
+
 func TestFormatOnConflictRhnConfigInfo(t *testing.T) {
 	// 01 Arrange
 	table := schemareader.Table{Name: "rhnconfiginfo"}
@@ -421,3 +453,782 @@ func createTestCase(graph TablesGraph, root string, options PrintSqlOptions) wri
 		options,
 	}
 }
+
+func TestApplyIdOnlyStrategy(t *testing.T) {
+	// 01 Arrange
+	newSchema := func() map[string]schemareader.Table {
+		return map[string]schemareader.Table{
+			"idonly": {
+				Name:          "idonly",
+				Export:        true,
+				Columns:       []string{"id", "name", "created"},
+				ColumnIndexes: map[string]int{"id": 0, "name": 1, "created": 2},
+				PKColumns:     map[string]bool{"id": true},
+				PKSequence:    "idonly_id_seq",
+				UniqueIndexes: map[string]schemareader.UniqueIndex{},
+				IdOnly:        true,
+			},
+		}
+	}
+	row := []sqlUtil.RowDataStructure{
+		{ColumnName: "id", ColumnType: "NUMERIC", Value: "1"},
+		{ColumnName: "name", ColumnType: "VARCHAR", Value: "foo"},
+		{ColumnName: "created", ColumnType: "VARCHAR", Value: "bar"},
+	}
+
+	// 02 Act
+	errUnknown := ApplyIdOnlyStrategy(newSchema(), "duplicate")
+	defaultSchema := newSchema()
+	errDefault := ApplyIdOnlyStrategy(defaultSchema, "")
+	insertSchema := newSchema()
+	errInsert := ApplyIdOnlyStrategy(insertSchema, IdOnlyInsert)
+	remapSchema := newSchema()
+	errRemap := ApplyIdOnlyStrategy(remapSchema, IdOnlyRemap)
+	skipSchema := newSchema()
+	errSkip := ApplyIdOnlyStrategy(skipSchema, IdOnlySkip)
+
+	// 03 Assert
+	if errUnknown == nil || !strings.Contains(errUnknown.Error(), "idonly") {
+		t.Errorf("Unknown strategy should be reported with the table name, got %v", errUnknown)
+	}
+	if errDefault != nil || errInsert != nil || errRemap != nil || errSkip != nil {
+		t.Errorf("Valid strategies should not fail")
+	}
+	insert := generateRowInsertStatement(nil, row, insertSchema["idonly"], insertSchema, []string{})
+	expectedInsert := "INSERT INTO idonly (id, name, created)\tVALUES ((SELECT nextval('idonly_id_seq'))," +
+		"'foo','bar');"
+	if insert != expectedInsert {
+		t.Errorf(fmt.Sprintf("Expected %s, but got %s", expectedInsert, insert))
+	}
+	// without a strategy the rows are inserted without conflict check instead of failing the export
+	if defaultInsert := generateRowInsertStatement(nil, row, defaultSchema["idonly"], defaultSchema, []string{}); defaultInsert != expectedInsert {
+		t.Errorf(fmt.Sprintf("Expected %s without strategy, but got %s", expectedInsert, defaultInsert))
+	}
+	remapColumns := remapSchema["idonly"].UniqueIndexes[remapSchema["idonly"].MainUniqueIndexName].Columns
+	if !reflect.DeepEqual(remapColumns, []string{"name", "created"}) {
+		t.Errorf("Remapped table should be matched by its content columns, got %v", remapColumns)
+	}
+	if skipSchema["idonly"].Export {
+		t.Errorf("Skipped table should not be exported")
+	}
+}
+
+func TestExportAllTableDataWithNullableKeyReadAtOnce(t *testing.T) {
+	// 01 Arrange
+	repo := tests.CreateDataRepository()
+	table := schemareader.Table{
+		Name:          "paged",
+		Export:        true,
+		Columns:       []string{"label", "org_id"},
+		ColumnIndexes: map[string]int{"label": 0, "org_id": 1},
+		ColumnDefinitions: map[string]schemareader.Column{
+			"label":  {Name: "label", IsNullable: false},
+			"org_id": {Name: "org_id", IsNullable: true},
+		},
+		PKColumns:           map[string]bool{},
+		MainUniqueIndexName: "paged_uq",
+		UniqueIndexes: map[string]schemareader.UniqueIndex{
+			"paged_uq": {Name: "paged_uq", Columns: []string{"label", "org_id"}},
+		},
+	}
+	schemaMetadata := map[string]schemareader.Table{"paged": table}
+	columns := []string{"label", "org_id"}
+	// the rows sharing a NULL org_id are not ordered: a page boundary between them would skip rows
+	repo.ExpectWithRecords("SELECT label, org_id FROM paged  ORDER BY label, org_id;",
+		sqlmock.NewRows(columns).AddRow("a", "1").AddRow("a", nil).AddRow("a", nil).AddRow("c", "1").AddRow("c", nil))
+
+	// 02 Act
+	exportAllTableData(repo.DB, repo.Writer, schemaMetadata, table,
+		func(table schemareader.Table) string { return "" }, []string{}, Pagination{PageSize: 2})
+	writtenBuffer := strings.Join(repo.GetWriterBuffer(), "")
+
+	// 03 Assert
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("The table should be read at once. Error message: %s", err)
+	}
+	if inserts := strings.Split(strings.TrimSpace(writtenBuffer), "\n"); len(inserts) != 5 {
+		t.Errorf("Expected 5 rows, got %d rows: %s", len(inserts), writtenBuffer)
+	}
+}
+
+func TestExportAllTableDataWithNotNullKeyPages(t *testing.T) {
+	// 01 Arrange
+	repo := tests.CreateDataRepository()
+	table := schemareader.Table{
+		Name:          "paged",
+		Export:        true,
+		Columns:       []string{"label", "org_id", "name"},
+		ColumnIndexes: map[string]int{"label": 0, "org_id": 1, "name": 2},
+		ColumnDefinitions: map[string]schemareader.Column{
+			"label":  {Name: "label", IsNullable: false},
+			"org_id": {Name: "org_id", IsNullable: true},
+			"name":   {Name: "name", IsNullable: false},
+		},
+		PKColumns:           map[string]bool{},
+		MainUniqueIndexName: "paged_uq",
+		UniqueIndexes: map[string]schemareader.UniqueIndex{
+			"paged_uq":      {Name: "paged_uq", Columns: []string{"label", "org_id"}},
+			"paged_name_uq": {Name: "paged_name_uq", Columns: []string{"name"}},
+		},
+	}
+	schemaMetadata := map[string]schemareader.Table{"paged": table}
+	columns := []string{"label", "org_id", "name"}
+	// the pages follow the unique index without nullable column rather than the main one
+	orderBy := " ORDER BY name ASC LIMIT 2;"
+	repo.ExpectWithRecords("SELECT label, org_id, name FROM paged "+orderBy,
+		sqlmock.NewRows(columns).AddRow("a", "1", "n1").AddRow("a", nil, "n2"))
+	repo.ExpectWithRecords("SELECT label, org_id, name FROM paged WHERE (name > 'n2')"+orderBy,
+		sqlmock.NewRows(columns).AddRow("a", nil, "n3"))
+
+	// 02 Act
+	exportAllTableData(repo.DB, repo.Writer, schemaMetadata, table,
+		func(table schemareader.Table) string { return "" }, []string{}, Pagination{PageSize: 2})
+	writtenBuffer := strings.Join(repo.GetWriterBuffer(), "")
+
+	// 03 Assert
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("Pages were not read as expected. Error message: %s", err)
+	}
+	if inserts := strings.Split(strings.TrimSpace(writtenBuffer), "\n"); len(inserts) != 3 {
+		t.Errorf("Expected 3 rows, got %d rows: %s", len(inserts), writtenBuffer)
+	}
+}
+
+func TestExportAllTableDataInBatches(t *testing.T) {
+	// 01 Arrange
+	repo := tests.CreateDataRepository()
+	table := schemareader.Table{
+		Name:          "paged",
+		Export:        true,
+		Columns:       []string{"label", "name"},
+		ColumnIndexes: map[string]int{"label": 0, "name": 1},
+		ColumnDefinitions: map[string]schemareader.Column{
+			"label": {Name: "label", IsNullable: false},
+			"name":  {Name: "name", IsNullable: false},
+		},
+		PKColumns:           map[string]bool{},
+		MainUniqueIndexName: "paged_name_uq",
+		UniqueIndexes: map[string]schemareader.UniqueIndex{
+			"paged_name_uq": {Name: "paged_name_uq", Columns: []string{"name"}},
+		},
+	}
+	schemaMetadata := map[string]schemareader.Table{"paged": table}
+	columns := []string{"label", "name"}
+	orderBy := " ORDER BY name ASC LIMIT 2;"
+	repo.ExpectWithRecords("SELECT label, name FROM paged "+orderBy,
+		sqlmock.NewRows(columns).AddRow("a", "n1").AddRow("a", "n2"))
+	repo.ExpectWithRecords("SELECT label, name FROM paged WHERE (name > 'n2')"+orderBy,
+		sqlmock.NewRows(columns).AddRow("b", "n3"))
+
+	// 02 Act
+	exportAllTableData(repo.DB, repo.Writer, schemaMetadata, table,
+		func(table schemareader.Table) string { return "" }, []string{}, Pagination{PageSize: 2, InsertBatchSize: 3})
+	writtenBuffer := strings.Join(repo.GetWriterBuffer(), "")
+
+	// 03 Assert
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("Pages were not read as expected. Error message: %s", err)
+	}
+	// the batch spans the pages
+	expected := "INSERT INTO paged (label, name)\tVALUES ('a','n1'),('a','n2'),('b','n3') ON CONFLICT (name) " +
+		"DO UPDATE SET label = excluded.label,name = excluded.name;\n"
+	if writtenBuffer != expected {
+		t.Errorf("Expected %s, but got %s", expected, writtenBuffer)
+	}
+}
+
+func TestFormatKeysetClause(t *testing.T) {
+	// 01 Arrange
+	table := schemareader.Table{ColumnIndexes: map[string]int{"label": 0, "name": 1}}
+	lastRow := []sqlUtil.RowDataStructure{
+		{ColumnName: "label", Value: "a"},
+		{ColumnName: "name", Value: "b"},
+	}
+	expected := "(label > 'a') OR (label = 'a' AND name > 'b')"
+
+	// 02 Act
+	result := formatKeysetClause(table, []string{"label", "name"}, lastRow)
+
+	// 03 Assert
+	if result != expected {
+		t.Errorf(fmt.Sprintf("Expected %s, but got %s", expected, result))
+	}
+}
+
+func TestPrintTableDataWithAssumedPresentParent(t *testing.T) {
+	// 01 Arrange
+	graph := TablesGraph{
+		"root": []string{"v41"},
+		"v41":  []string{},
+	}
+	root := "root"
+	testCase := createTestCase(graph, root, PrintSqlOptions{})
+	// the parent is known to be on the target: it is not exported
+	parent := testCase.schemaMetadata["v41"]
+	parent.Export = false
+	testCase.schemaMetadata["v41"] = parent
+
+	testCase.repo.Expect("SELECT id, v41_fk_id FROM root WHERE (id) IN (('0001')) ORDER BY id;", testCase.schemaMetadata["root"].Columns, 1)
+	testCase.repo.Expect("SELECT id FROM v41 WHERE id = $1;", testCase.schemaMetadata["v41"].Columns, 1)
+
+	// 02 Act
+	orderedTables := getTablesExportOrder(testCase.schemaMetadata, testCase.startingTable, testCase.processedTables, testCase.path)
+	exportTablesData(testCase.repo.DB, testCase.repo.Writer, testCase.schemaMetadata, orderedTables,
+		testCase.dumper, testCase.options)
+	writtenBuffer := strings.Join(testCase.repo.GetWriterBuffer(), "")
+
+	// 03 Assert
+	if len(orderedTables) != 1 || orderedTables[0].Name != root {
+		t.Errorf("Only the child table should be exported, got %v", orderedTables)
+	}
+	if err := testCase.repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unexpected export of the parent. Error message: %s", err)
+	}
+	// the child references the parent by its natural key on the target
+	if !strings.Contains(writtenBuffer, "(SELECT id FROM v41 WHERE id = '0001' LIMIT 1)") {
+		t.Errorf("The child should reference the assumed present parent, got %s", writtenBuffer)
+	}
+}
+
+func TestPrintTableDataWithTableStats(t *testing.T) {
+	// 01 Arrange
+	graph := TablesGraph{
+		"root": []string{},
+	}
+	root := "root"
+	testCase := createTestCase(graph, root, PrintSqlOptions{TableStats: true})
+	testCase.startingTable.CheckConstraints = []schemareader.CheckConstraint{{Name: "root_id_ck", Definition: "CHECK ((id > 0))"}}
+	testCase.dumper.TableData[root] = TableDump{
+		TableName: root,
+		KeyMap:    map[string]bool{"'0001'": true},
+		Keys:      []TableKey{{Key: []RowKey{{"id", "'0001'"}}}},
+	}
+	testCase.repo.Expect("SELECT id FROM root WHERE (id) IN (('0001')) ORDER BY id;", testCase.schemaMetadata["root"].Columns, 1)
+
+	// 02 Act
+	exportTablesData(testCase.repo.DB, testCase.repo.Writer, testCase.schemaMetadata,
+		[]schemareader.Table{testCase.startingTable}, testCase.dumper, testCase.options)
+	lines := strings.Split(strings.Join(testCase.repo.GetWriterBuffer(), ""), "\n")
+
+	// 03 Assert
+	if len(lines) < 4 {
+		t.Fatalf("Expected the table section with its comments, got %v", lines)
+	}
+	if lines[0] != "-- table root: 1 rows" {
+		t.Errorf("Unexpected table header: %s", lines[0])
+	}
+	if lines[1] != "-- table root: check constraint root_id_ck CHECK ((id > 0))" {
+		t.Errorf("Unexpected check constraint: %s", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], "INSERT INTO root") {
+		t.Errorf("Unexpected table data: %s", lines[2])
+	}
+	if !strings.HasPrefix(lines[3], "-- table root: 1 rows exported in ") {
+		t.Errorf("Unexpected table footer: %s", lines[3])
+	}
+}
+
+func TestPrintTableDataWithRowKeys(t *testing.T) {
+	// 01 Arrange
+	graph := TablesGraph{
+		"root": []string{},
+	}
+	root := "root"
+	testCase := createTestCase(graph, root, PrintSqlOptions{TableStats: true, RowKeys: true})
+	testCase.dumper.TableData[root] = TableDump{
+		TableName: root,
+		KeyMap:    map[string]bool{"'0001'": true, "'0002'": true},
+		Keys:      []TableKey{{Key: []RowKey{{"id", "'0001'"}}}, {Key: []RowKey{{"id", "'0002'"}}}},
+	}
+	// the second planned row was removed from the source since it was crawled
+	testCase.repo.Expect("SELECT id FROM root WHERE (id) IN (('0001'),('0002')) ORDER BY id;", testCase.schemaMetadata["root"].Columns, 1)
+
+	// 02 Act
+	exportTablesData(testCase.repo.DB, testCase.repo.Writer, testCase.schemaMetadata,
+		[]schemareader.Table{testCase.startingTable}, testCase.dumper, testCase.options)
+	dump := strings.Join(testCase.repo.GetWriterBuffer(), "")
+	discrepancies := ValidateDump(strings.NewReader(dump))
+
+	// 03 Assert
+	for _, comment := range []string{"-- table root: planned key id='0001'\n", "-- table root: planned key id='0002'\n",
+		"-- table root: written key id='0001'\n"} {
+		if !strings.Contains(dump, comment) {
+			t.Errorf("Expected the key comment %s, got %s", comment, dump)
+		}
+	}
+	expected := []string{
+		"table root: 2 rows planned, 1 rows written",
+		"table root: planned key id='0002' missing",
+	}
+	if !reflect.DeepEqual(discrepancies, expected) {
+		t.Errorf("Unexpected discrepancies: expected %v, got %v", expected, discrepancies)
+	}
+}
+
+func TestApplyReplaceByLabel(t *testing.T) {
+	// 01 Arrange
+	schema := map[string]schemareader.Table{
+		"rhnchecksumtype": {
+			Name:                "rhnchecksumtype",
+			Export:              true,
+			Columns:             []string{"id", "label", "description"},
+			ColumnIndexes:       map[string]int{"id": 0, "label": 1, "description": 2},
+			PKColumns:           map[string]bool{"id": true},
+			PKSequence:          "rhn_checksum_id_seq",
+			MainUniqueIndexName: "rhn_checksumtype_l_uq",
+			UniqueIndexes: map[string]schemareader.UniqueIndex{
+				"rhn_checksumtype_l_uq": {Name: "rhn_checksumtype_l_uq", Columns: []string{"label"}}},
+		},
+		"nolabel": {
+			Name:          "nolabel",
+			Export:        true,
+			Columns:       []string{"id", "name"},
+			ColumnIndexes: map[string]int{"id": 0, "name": 1},
+		},
+	}
+	row := []sqlUtil.RowDataStructure{
+		{ColumnName: "id", ColumnType: "NUMERIC", Value: "12"},
+		{ColumnName: "label", ColumnType: "VARCHAR", Value: "sha256"},
+		{ColumnName: "description", ColumnType: "VARCHAR", Value: "SHA-256"},
+	}
+
+	// 02 Act
+	err := ApplyReplaceByLabel(schema, []string{"rhnChecksumType"})
+	errNoLabel := ApplyReplaceByLabel(schema, []string{"nolabel"})
+	statement := generateRowInsertStatement(nil, row, schema["rhnchecksumtype"], schema, []string{})
+
+	// 03 Assert
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if errNoLabel == nil {
+		t.Errorf("Tables without label column should be rejected")
+	}
+	// an existing row keeps its target id: the update doesn't touch it and the insert is skipped,
+	// so importing twice still leaves the original id in place
+	expected := "UPDATE rhnchecksumtype SET description = 'SHA-256' WHERE label = 'sha256'; " +
+		"INSERT INTO rhnchecksumtype (id, label, description)\tSELECT (SELECT nextval('rhn_checksum_id_seq')),'sha256','SHA-256' " +
+		"WHERE NOT EXISTS (SELECT 1 FROM rhnchecksumtype WHERE label = 'sha256');"
+	if statement != expected {
+		t.Errorf("Expected %s, but got %s", expected, statement)
+	}
+}
+
+func TestApplyDictionaryTables(t *testing.T) {
+	// 01 Arrange
+	repo := tests.CreateDataRepository()
+	schema := map[string]schemareader.Table{
+		"rhnpackagearch": {
+			Name:                "rhnpackagearch",
+			Export:              true,
+			Columns:             []string{"id", "label", "name"},
+			ColumnIndexes:       map[string]int{"id": 0, "label": 1, "name": 2},
+			PKColumns:           map[string]bool{"id": true},
+			MainUniqueIndexName: "rhn_parch_name_uq",
+			UniqueIndexes: map[string]schemareader.UniqueIndex{
+				"rhn_parch_label_uq": {Name: "rhn_parch_label_uq", Columns: []string{"label"}},
+				"rhn_parch_name_uq":  {Name: "rhn_parch_name_uq", Columns: []string{"name"}}},
+			ReferencedBy: []schemareader.Reference{{TableName: "rhnpackage", ColumnMapping: map[string]string{"package_arch_id": "id"}}},
+		},
+		"rhnarchtype": {
+			Name:          "rhnarchtype",
+			Export:        true,
+			Columns:       []string{"id", "label"},
+			ColumnIndexes: map[string]int{"id": 0, "label": 1},
+			PKColumns:     map[string]bool{"id": true},
+			IdOnly:        true,
+		},
+		"rhnpackage": {
+			Name:          "rhnpackage",
+			Export:        true,
+			Columns:       []string{"id", "package_arch_id"},
+			ColumnIndexes: map[string]int{"id": 0, "package_arch_id": 1},
+			PKColumns:     map[string]bool{"id": true},
+			References:    []schemareader.Reference{{TableName: "rhnpackagearch", ColumnMapping: map[string]string{"package_arch_id": "id"}}},
+		},
+	}
+	repo.ExpectWithRecords("SELECT id, label, name FROM rhnpackagearch WHERE id = $1;",
+		sqlmock.NewRows([]string{"id", "label", "name"}).AddRow("120", "x86_64", "AMD64"), "120")
+	row := []sqlUtil.RowDataStructure{
+		{ColumnName: "id", ColumnType: "NUMERIC", Value: "1"},
+		{ColumnName: "package_arch_id", ColumnType: "NUMERIC", Value: "120"},
+	}
+
+	// 02 Act
+	err := ApplyDictionaryTables(schema, []string{"rhnPackageArch", "rhnarchtype", "missing"})
+	errNoLabel := ApplyDictionaryTables(schema, []string{"rhnpackage"})
+	values := SubstituteForeignKey(repo.DB, schema["rhnpackage"], schema, row)
+
+	// 03 Assert
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if errNoLabel == nil {
+		t.Errorf("Tables without label column should be rejected")
+	}
+	if !schema["rhnpackagearch"].IsDictionary || schema["rhnpackagearch"].MainUniqueIndexName != "rhn_parch_label_uq" {
+		t.Errorf("rhnpackagearch rows should be matched by the label index, got %s", schema["rhnpackagearch"].MainUniqueIndexName)
+	}
+	archType := schema["rhnarchtype"]
+	if archType.IdOnly || archType.MainUniqueIndexName != schemareader.VirtualIndexName ||
+		!reflect.DeepEqual(archType.UniqueIndexes[schemareader.VirtualIndexName].Columns, []string{"label"}) {
+		t.Errorf("rhnarchtype rows should be matched by a virtual label index")
+	}
+	expected := "SELECT id FROM rhnpackagearch WHERE label = 'x86_64' LIMIT 1"
+	if values[1].Value != expected || values[1].ColumnType != "SQL" {
+		t.Errorf("Expected %s, but got %s", expected, values[1].Value)
+	}
+}
+
+func TestSubstituteForeignKeyWithReferenceIndex(t *testing.T) {
+	// 01 Arrange
+	repo := tests.CreateDataRepository()
+	schema := map[string]schemareader.Table{
+		"suseproducts": {
+			Name:                "suseproducts",
+			Export:              true,
+			Columns:             []string{"id", "product_id", "name"},
+			ColumnIndexes:       map[string]int{"id": 0, "product_id": 1, "name": 2},
+			PKColumns:           map[string]bool{"id": true},
+			MainUniqueIndexName: "suseproducts_name_uq",
+			UniqueIndexes: map[string]schemareader.UniqueIndex{
+				"suseproducts_name_uq": {Name: "suseproducts_name_uq", Columns: []string{"name"}},
+				"suseproducts_pid_uq":  {Name: "suseproducts_pid_uq", Columns: []string{"product_id"}}},
+		},
+		"suseproductchannel": {
+			Name:          "suseproductchannel",
+			Export:        true,
+			Columns:       []string{"id", "product_id"},
+			ColumnIndexes: map[string]int{"id": 0, "product_id": 1},
+			PKColumns:     map[string]bool{"id": true},
+			References: []schemareader.Reference{{TableName: "suseproducts", ColumnMapping: map[string]string{"product_id": "id"},
+				UniqueIndexName: "suseproducts_pid_uq"}},
+		},
+	}
+	repo.ExpectWithRecords("SELECT id, product_id, name FROM suseproducts WHERE id = $1;",
+		sqlmock.NewRows([]string{"id", "product_id", "name"}).AddRow("12", "1234", "SLES"), "12")
+	row := []sqlUtil.RowDataStructure{
+		{ColumnName: "id", ColumnType: "NUMERIC", Value: "1"},
+		{ColumnName: "product_id", ColumnType: "NUMERIC", Value: "12"},
+	}
+
+	// 02 Act
+	values := SubstituteForeignKey(repo.DB, schema["suseproductchannel"], schema, row)
+
+	// 03 Assert
+	expected := "SELECT id FROM suseproducts WHERE product_id = '1234' LIMIT 1"
+	if values[1].Value != expected || values[1].ColumnType != "SQL" {
+		t.Errorf("Expected %s, but got %s", expected, values[1].Value)
+	}
+}
+
+func TestApplyExtraDictionaryTables(t *testing.T) {
+	// 01 Arrange
+	repo := tests.CreateDataRepository()
+	schema := map[string]schemareader.Table{
+		"rhnpackagekeytype": {
+			Name:          "rhnpackagekeytype",
+			Export:        true,
+			Columns:       []string{"id", "label"},
+			ColumnIndexes: map[string]int{"id": 0, "label": 1},
+			PKColumns:     map[string]bool{"id": true},
+			IdOnly:        true,
+			ReferencedBy:  []schemareader.Reference{{TableName: "rhnpackagekey", ColumnMapping: map[string]string{"key_type_id": "id"}}},
+		},
+		"rhnpackagekey": {
+			Name:          "rhnpackagekey",
+			Export:        true,
+			Columns:       []string{"id", "key_type_id"},
+			ColumnIndexes: map[string]int{"id": 0, "key_type_id": 1},
+			PKColumns:     map[string]bool{"id": true},
+			References:    []schemareader.Reference{{TableName: "rhnpackagekeytype", ColumnMapping: map[string]string{"key_type_id": "id"}}},
+		},
+	}
+	repo.ExpectWithRecords("SELECT id, label FROM rhnpackagekeytype WHERE id = $1;",
+		sqlmock.NewRows([]string{"id", "label"}).AddRow("3", "gpg"), "3")
+	row := []sqlUtil.RowDataStructure{
+		{ColumnName: "id", ColumnType: "NUMERIC", Value: "1"},
+		{ColumnName: "key_type_id", ColumnType: "NUMERIC", Value: "3"},
+	}
+
+	// 02 Act
+	tableNames := ExtendDictionaryTables(DefaultDictionaryTables, []string{"rhnPackageKeyType", "rhnarchtype"})
+	err := ApplyDictionaryTables(schema, tableNames)
+	values := SubstituteForeignKey(repo.DB, schema["rhnpackagekey"], schema, row)
+
+	// 03 Assert
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	expectedNames := append(append([]string{}, DefaultDictionaryTables...), "rhnpackagekeytype")
+	if !reflect.DeepEqual(tableNames, expectedNames) {
+		t.Errorf("Expected dictionary tables %v, got %v", expectedNames, tableNames)
+	}
+	if !schema["rhnpackagekeytype"].IsDictionary {
+		t.Errorf("rhnpackagekeytype should be a dictionary table")
+	}
+	expected := "SELECT id FROM rhnpackagekeytype WHERE label = 'gpg' LIMIT 1"
+	if values[1].Value != expected || values[1].ColumnType != "SQL" {
+		t.Errorf("Expected %s, but got %s", expected, values[1].Value)
+	}
+}
+
+func TestGenerateChannelClonedInsertStatement(t *testing.T) {
+	// 01 Arrange
+	repo := tests.CreateDataRepository()
+	channel := schemareader.Table{
+		Name:                "rhnchannel",
+		Export:              true,
+		Columns:             []string{"id", "label"},
+		ColumnIndexes:       map[string]int{"id": 0, "label": 1},
+		PKColumns:           map[string]bool{"id": true},
+		MainUniqueIndexName: "rhn_channel_label_uq",
+		UniqueIndexes: map[string]schemareader.UniqueIndex{
+			"rhn_channel_label_uq": {Name: "rhn_channel_label_uq", Columns: []string{"label"}}},
+	}
+	cloned := schemareader.Table{
+		Name:                "rhnchannelcloned",
+		Export:              true,
+		Columns:             []string{"original_id", "id"},
+		ColumnIndexes:       map[string]int{"original_id": 0, "id": 1},
+		PKColumns:           map[string]bool{"original_id": true, "id": true},
+		MainUniqueIndexName: "rhn_channelclone_oid_cid_uq",
+		UniqueIndexes: map[string]schemareader.UniqueIndex{
+			"rhn_channelclone_oid_cid_uq": {Name: "rhn_channelclone_oid_cid_uq", Columns: []string{"original_id", "id"}}},
+		References: []schemareader.Reference{
+			{TableName: "rhnchannel", ColumnMapping: map[string]string{"original_id": "id"}},
+			{TableName: "rhnchannel", ColumnMapping: map[string]string{"id": "id"}},
+		},
+	}
+	schema := map[string]schemareader.Table{"rhnchannel": channel, "rhnchannelcloned": cloned}
+	row := []sqlUtil.RowDataStructure{
+		{ColumnName: "original_id", ColumnType: "NUMERIC", Value: int64(101)},
+		{ColumnName: "id", ColumnType: "NUMERIC", Value: int64(102)},
+	}
+	repo.ExpectWithRecords("SELECT id, label FROM rhnchannel WHERE id = $1;",
+		sqlmock.NewRows([]string{"id", "label"}).AddRow(int64(101), "sles15-sp4-pool"), int64(101))
+	repo.ExpectWithRecords("SELECT id, label FROM rhnchannel WHERE id = $1;",
+		sqlmock.NewRows([]string{"id", "label"}).AddRow(int64(102), "dev-sles15-sp4-pool"), int64(102))
+
+	// 02 Act
+	statement := generateRowInsertStatement(repo.DB, row, cloned, schema, []string{"rhnchannelcloned"})
+
+	// 03 Assert
+	original := "(SELECT id FROM rhnchannel WHERE label = 'sles15-sp4-pool' LIMIT 1)"
+	clone := "(SELECT id FROM rhnchannel WHERE label = 'dev-sles15-sp4-pool' LIMIT 1)"
+	expected := "INSERT INTO rhnchannelcloned (original_id, id)\tSELECT " + original + "," + clone +
+		" WHERE NOT EXISTS (SELECT 1 FROM rhnchannelcloned WHERE  original_id = " + original + " AND  id = " + clone + ")" +
+		" AND EXISTS " + original + " AND EXISTS " + clone + ";"
+	if statement != expected {
+		t.Errorf("Expected %s, but got %s", expected, statement)
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("Clone ends were not resolved. Error message: %s", err)
+	}
+}
+
+func TestSkipSecondaryUniqueConflicts(t *testing.T) {
+	// 01 Arrange
+	schema := map[string]schemareader.Table{
+		"rhnproductname": {
+			Name:                "rhnproductname",
+			Export:              true,
+			Columns:             []string{"id", "label", "name"},
+			ColumnIndexes:       map[string]int{"id": 0, "label": 1, "name": 2},
+			PKColumns:           map[string]bool{"id": true},
+			MainUniqueIndexName: "rhn_productname_label_uq",
+			UniqueIndexes: map[string]schemareader.UniqueIndex{
+				"rhn_productname_label_uq": {Name: "rhn_productname_label_uq", Columns: []string{"label"}},
+				"rhn_productname_name_uq":  {Name: "rhn_productname_name_uq", Columns: []string{"name"}},
+			},
+		},
+	}
+	row := func(name interface{}) []sqlUtil.RowDataStructure {
+		return []sqlUtil.RowDataStructure{
+			{ColumnName: "id", ColumnType: "NUMERIC", Value: "1"},
+			{ColumnName: "label", ColumnType: "VARCHAR", Value: "sles"},
+			{ColumnName: "name", ColumnType: "VARCHAR", Value: name},
+		}
+	}
+	table := schema["rhnproductname"]
+	withoutCheck := generateRowInsertStatement(nil, row("SLES"), table, schema, []string{})
+
+	// 02 Act
+	ApplySkipSecondaryUniqueConflicts(schema)
+	table = schema["rhnproductname"]
+	withCheck := generateRowInsertStatement(nil, row("SLES"), table, schema, []string{})
+	withNull := generateRowInsertStatement(nil, row(nil), table, schema, []string{})
+
+	// 03 Assert
+	if !reflect.DeepEqual(table.SecondaryUniqueIndexes(), []string{"rhn_productname_name_uq"}) {
+		t.Errorf("Unexpected secondary indexes: %v", table.SecondaryUniqueIndexes())
+	}
+	onConflict := " ON CONFLICT (label) DO UPDATE SET label = excluded.label,name = excluded.name;"
+	if withoutCheck != "INSERT INTO rhnproductname (id, label, name)\tVALUES (1,'sles','SLES')"+onConflict {
+		t.Errorf("Secondary indexes should not be checked by default, got %s", withoutCheck)
+	}
+	expected := "INSERT INTO rhnproductname (id, label, name)\tSELECT 1,'sles','SLES' " +
+		"WHERE NOT EXISTS (SELECT 1 FROM rhnproductname WHERE name = 'SLES' AND NOT (label = 'sles'))" + onConflict
+	if withCheck != expected {
+		t.Errorf("Expected %s, but got %s", expected, withCheck)
+	}
+	// NULL values never conflict
+	if withNull != "INSERT INTO rhnproductname (id, label, name)\tVALUES (1,'sles',null)"+onConflict {
+		t.Errorf("Secondary index with NULL value should not be checked, got %s", withNull)
+	}
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	// 01 Arrange
+	cases := map[string]string{
+		"rhnchannel": "rhnchannel",
+		"order":      `"order"`,
+		"RhnChannel": `"RhnChannel"`,
+		"my table":   `"my table"`,
+		`a"b`:        `"a""b"`,
+	}
+
+	for name, expected := range cases {
+		// 02 Act
+		result := quoteIdentifier(name)
+
+		// 03 Assert
+		if result != expected {
+			t.Errorf("Expected %s to be written %s, but got %s", name, expected, result)
+		}
+	}
+}
+
+func TestGenerateQuotedInsertStatement(t *testing.T) {
+	// 01 Arrange
+	schema := map[string]schemareader.Table{
+		"order": {
+			Name:                "order",
+			Export:              true,
+			Columns:             []string{"id", "user", "Label"},
+			ColumnIndexes:       map[string]int{"id": 0, "user": 1, "Label": 2},
+			PKColumns:           map[string]bool{"id": true},
+			MainUniqueIndexName: "order_label_uq",
+			UniqueIndexes: map[string]schemareader.UniqueIndex{
+				"order_label_uq": {Name: "order_label_uq", Columns: []string{"Label"}}},
+		},
+	}
+	row := []sqlUtil.RowDataStructure{
+		{ColumnName: "id", ColumnType: "NUMERIC", Value: "1"},
+		{ColumnName: "user", ColumnType: "VARCHAR", Value: "admin"},
+		{ColumnName: "Label", ColumnType: "VARCHAR", Value: "first"},
+	}
+
+	// 02 Act
+	statement := generateRowInsertStatement(nil, row, schema["order"], schema, []string{})
+
+	// 03 Assert
+	expected := `INSERT INTO "order" (id, "user", "Label")` + "\tVALUES (1,'admin','first') " +
+		`ON CONFLICT ("Label") DO UPDATE SET "user" = excluded."user","Label" = excluded."Label";`
+	if statement != expected {
+		t.Errorf("Expected %s, but got %s", expected, statement)
+	}
+}
+
+func TestExportAllTableDataKeepsNullsAndEmptyStrings(t *testing.T) {
+	// 01 Arrange
+	repo := tests.CreateDataRepository()
+	table := schemareader.Table{
+		Name:                "described",
+		Export:              true,
+		Columns:             []string{"id", "label", "description"},
+		ColumnIndexes:       map[string]int{"id": 0, "label": 1, "description": 2},
+		ColumnDefinitions:   map[string]schemareader.Column{"description": {Name: "description", DataType: "text", IsNullable: true}},
+		PKColumns:           map[string]bool{"id": true},
+		MainUniqueIndexName: "described_label_uq",
+		UniqueIndexes: map[string]schemareader.UniqueIndex{
+			"described_label_uq": {Name: "described_label_uq", Columns: []string{"label"}},
+		},
+	}
+	schemaMetadata := map[string]schemareader.Table{"described": table}
+	rows := func() *sqlmock.Rows {
+		return sqlmock.NewRows(table.Columns).AddRow("1", "null", nil).AddRow("2", "empty", "")
+	}
+	repo.ExpectWithRecords("SELECT id, label, description FROM described  ORDER BY id;", rows())
+	copyTable := table
+	copyTable.CopyRows = true
+	repo.ExpectWithRecords("SELECT id, label, description FROM described  ORDER BY id;", rows())
+	noFilter := func(table schemareader.Table) string { return "" }
+
+	// 02 Act
+	exportAllTableData(repo.DB, repo.Writer, schemaMetadata, table, noFilter, []string{}, Pagination{})
+	exportAllTableData(repo.DB, repo.Writer, schemaMetadata, copyTable, noFilter, []string{}, Pagination{})
+	lines := strings.Split(strings.TrimSpace(strings.Join(repo.GetWriterBuffer(), "")), "\n")
+
+	// 03 Assert
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("Rows were not read as expected. Error message: %s", err)
+	}
+	if len(lines) != 6 {
+		t.Fatalf("Expected 2 INSERT and 2 COPY rows, got: %v", lines)
+	}
+	if !strings.Contains(lines[0], "VALUES ('1','null',null)") {
+		t.Errorf("NULL value should be written as null, got %s", lines[0])
+	}
+	if !strings.Contains(lines[1], "VALUES ('2','empty','')") {
+		t.Errorf("Empty string should be written as '', got %s", lines[1])
+	}
+	if lines[3] != "1\tnull\t\\N" {
+		t.Errorf("NULL value should be written as \\N in a COPY, got %q", lines[3])
+	}
+	if lines[4] != "2\tempty\t" {
+		t.Errorf("Empty string should be written as an empty COPY field, got %q", lines[4])
+	}
+}
+
+func TestFormatFieldEscapesStrings(t *testing.T) {
+	// 01 Arrange
+	values := map[string]string{
+		"it's fixed":                    `'it''s fixed'`,
+		`C:\path`:                       ` E'C:\\path'`,
+		"line 1\nline 2\r\nCOMMIT;":     `E'line 1\nline 2\r\nCOMMIT;'`,
+		"it's a\\b\nc":                  `E'it''s a\\b\nc'`,
+		"$$; DROP TABLE rhnchannel; $$": `'$$; DROP TABLE rhnchannel; $$'`,
+	}
+
+	for value, expected := range values {
+		// 02 Act
+		result := formatField(sqlUtil.RowDataStructure{ColumnName: "description", ColumnType: "TEXT", Value: value})
+
+		// 03 Assert
+		if result != expected {
+			t.Errorf("Expected %s for %q, but got %s", expected, value, result)
+		}
+		if strings.ContainsAny(result, "\n\r") {
+			t.Errorf("Value %q should be written on a single line, got %s", value, result)
+		}
+	}
+}
+
+func TestFormatFieldArrayAndJson(t *testing.T) {
+	// 01 Arrange
+	values := []struct {
+		column   sqlUtil.RowDataStructure
+		expected string
+	}{
+		// the values are scanned as bytes in the PostgreSQL text format
+		{sqlUtil.RowDataStructure{ColumnName: "tags", ColumnType: "_TEXT", Value: []byte(`{a,"b c","it's"}`)},
+			`'{a,"b c","it''s"}'::text[]`},
+		{sqlUtil.RowDataStructure{ColumnName: "tags", ColumnType: "_TEXT", Value: []byte(`{}`)}, `'{}'::text[]`},
+		{sqlUtil.RowDataStructure{ColumnName: "ids", ColumnType: "_INT4", Value: []byte(`{1,2}`)}, `'{1,2}'::int4[]`},
+		{sqlUtil.RowDataStructure{ColumnName: "data", ColumnType: "JSONB", Value: []byte(`{"name": "it's", "list": [1, 2]}`)},
+			`'{"name": "it''s", "list": [1, 2]}'::jsonb`},
+		{sqlUtil.RowDataStructure{ColumnName: "data", ColumnType: "JSON", Value: []byte("{\n}")}, `E'{\n}'::json`},
+		{sqlUtil.RowDataStructure{ColumnName: "data", ColumnType: "JSONB", Value: nil}, "null"},
+	}
+
+	for _, value := range values {
+		// 02 Act
+		result := formatField(value.column)
+
+		// 03 Assert
+		if result != value.expected {
+			t.Errorf("Expected %s for %s %v, but got %s", value.expected, value.column.ColumnType, value.column.Value, result)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package entityDumper
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ArchiveExtension is the extension of the archive bundling an export directory
+const ArchiveExtension = ".tar.gz"
+
+// WriteArchive bundles the files of the export directory, with the SQL statements, the manifest and the version,
+// in a gzip compressed tarball next to the directory and returns its path.
+// The paths in the archive are relative to the directory.
+func WriteArchive(dir string) (string, error) {
+	archivePath := filepath.Clean(dir) + ArchiveExtension
+	file, err := os.Create(archivePath)
+	if err != nil {
+		return "", fmt.Errorf("creating the archive: %w", err)
+	}
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil || name == "." {
+			return err
+		}
+		if !info.Mode().IsRegular() && !info.IsDir() {
+			return fmt.Errorf("%s is not a regular file", path)
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(name)
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		source, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer source.Close()
+		_, err = io.Copy(tarWriter, source)
+		return err
+	})
+	if err == nil {
+		err = tarWriter.Close()
+	}
+	if err == nil {
+		err = gzipWriter.Close()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(archivePath)
+		return "", fmt.Errorf("writing the archive: %w", err)
+	}
+	return archivePath, nil
+}
+
+// ExtractArchive extracts an archive written by WriteArchive in the directory, created if missing.
+// Existing files are never overwritten and the entries outside of the directory are refused.
+func ExtractArchive(archivePath string, dir string) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("opening the archive: %w", err)
+	}
+	defer file.Close()
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("reading the archive: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating the import directory: %w", err)
+	}
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading the archive: %w", err)
+		}
+		name := filepath.Clean(filepath.FromSlash(header.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("invalid path in the archive: %s", header.Name)
+		}
+		if name == "." {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return fmt.Errorf("extracting %s: %w", header.Name, err)
+			}
+		case tar.TypeReg:
+			if err := extractArchiveFile(tarReader, path, os.FileMode(header.Mode).Perm()); err != nil {
+				return fmt.Errorf("extracting %s: %w", header.Name, err)
+			}
+		default:
+			return fmt.Errorf("unexpected entry in the archive, only files and directories are extracted: %s", header.Name)
+		}
+	}
+}
+
+// extractArchiveFile writes the content of the current entry of the archive to a new file
+func extractArchiveFile(reader io.Reader, path string, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, reader); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
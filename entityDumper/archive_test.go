@@ -0,0 +1,88 @@
+package entityDumper
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestArchiveRoundTrip(t *testing.T) {
+
+	// 01 Arrange
+	dir := filepath.Join(t.TempDir(), "export")
+	files := map[string]string{
+		"version.txt":            "product_name = Uyuni\nversion = 2022.10\n",
+		manifestFileName:         "sql_statements\t3\tabc\n",
+		"tables/order.txt":       "rhnchannel.sql\n",
+		"tables/rhnchannel.sql":  "INSERT INTO rhnchannel (id)\tVALUES (1);\n",
+		"packages/1/a/pkg/a.rpm": "rpm",
+		"exportedAdvisories.txt": "SUSE-2022-1\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+	}
+	importDir := filepath.Join(t.TempDir(), "import")
+
+	// 02 Act
+	archivePath, err := WriteArchive(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error writing the archive: %s", err)
+	}
+	err = ExtractArchive(archivePath, importDir)
+
+	// 03 Assert
+	if err != nil {
+		t.Fatalf("Unexpected error extracting the archive: %s", err)
+	}
+	if archivePath != dir+ArchiveExtension {
+		t.Errorf("Archive should be next to the directory, got %s", archivePath)
+	}
+	for name, expected := range files {
+		content, err := os.ReadFile(filepath.Join(importDir, filepath.FromSlash(name)))
+		if err != nil || string(content) != expected {
+			t.Errorf("Unexpected content of %s: %q, %v", name, content, err)
+		}
+	}
+	if err := ExtractArchive(archivePath, importDir); err == nil {
+		t.Errorf("Existing files should not be overwritten")
+	}
+}
+
+func TestExtractArchiveRefusesOutsidePaths(t *testing.T) {
+
+	// 01 Arrange
+	dir := t.TempDir()
+	archivePath := filepath.Join(dir, "export.tar.gz")
+	file, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+	content := "INSERT INTO rhnchannel (id)\tVALUES (1);\n"
+	tarWriter.WriteHeader(&tar.Header{Name: "../sql_statements.sql", Mode: 0600, Size: int64(len(content)), Typeflag: tar.TypeReg})
+	tarWriter.Write([]byte(content))
+	tarWriter.Close()
+	gzipWriter.Close()
+	file.Close()
+
+	// 02 Act
+	err = ExtractArchive(archivePath, filepath.Join(dir, "import"))
+
+	// 03 Assert
+	if err == nil || !strings.Contains(err.Error(), "invalid path") {
+		t.Errorf("Entries outside of the directory should be refused, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sql_statements.sql")); !os.IsNotExist(err) {
+		t.Errorf("Entry outside of the directory should not be extracted")
+	}
+}
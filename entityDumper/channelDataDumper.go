@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
 
+	"github.com/lib/pq"
 	"github.com/rs/zerolog/log"
 	"github.com/uyuni-project/inter-server-sync/dumper"
 	"github.com/uyuni-project/inter-server-sync/dumper/packageDumper"
@@ -125,6 +127,16 @@ var childChannelSql = "select label from rhnchannel " +
 var singleChannelSql = "select label from rhnchannel " +
 	"where label = $1"
 
+var singleChannelFamilySql = "select label from rhnchannelfamily " +
+	"where label = $1"
+
+// base channels are sorted first so they are processed before their children
+var channelFamilyMembersSql = "select c.label from rhnchannel c " +
+	"join rhnchannelfamilymembers cfm on cfm.channel_id = c.id " +
+	"join rhnchannelfamily cf on cf.id = cfm.channel_family_id " +
+	"where cf.label = $1 " +
+	"order by c.parent_channel nulls first, c.label"
+
 func loadChannelsToProcess(db *sql.DB, options DumperOptions) []string {
 	channels := channelsProcess{make(map[string]bool), make([]string, 0)}
 	for _, singleChannel := range options.ChannelLabels {
@@ -154,11 +166,72 @@ func loadChannelsToProcess(db *sql.DB, options DumperOptions) []string {
 
 		}
 	}
-	return channels.channels
+
+	for _, family := range options.ChannelFamilyLabels {
+		dbFamily := sqlUtil.ExecuteQueryWithResults(db, singleChannelFamilySql, family)
+		if len(dbFamily) == 0 {
+			log.Fatal().Msgf("Channel family not found: %s", family)
+		}
+		familyChannels := sqlUtil.ExecuteQueryWithResults(db, channelFamilyMembersSql, family)
+		for _, fChannel := range familyChannels {
+			fLabel := fmt.Sprintf("%v", fChannel[0].Value)
+			if _, okF := channels.channelsMap[fLabel]; !okF {
+				channels.addChannelLabel(fLabel)
+			}
+		}
+	}
+	return orderChannelsByDependencies(db, channels.channels)
+}
+
+// a channel depends on its parent and on the channel it was cloned from
+var channelDependenciesSql = "select c.label, p.label from rhnchannel c " +
+	"join rhnchannel p on p.id = c.parent_channel " +
+	"union " +
+	"select c.label, o.label from rhnchannelcloned cc " +
+	"join rhnchannel c on c.id = cc.id " +
+	"join rhnchannel o on o.id = cc.original_id"
+
+// orderChannelsByDependencies moves the parent and original channels before their children and clones
+// when they are exported together: the clone link is only imported if the original channel exists on the target.
+func orderChannelsByDependencies(db *sql.DB, channels []string) []string {
+	if len(channels) < 2 {
+		return channels
+	}
+	toProcess := make(map[string]bool)
+	for _, channel := range channels {
+		toProcess[channel] = true
+	}
+	dependencies := make(map[string][]string)
+	for _, row := range sqlUtil.ExecuteQueryWithResults(db, channelDependenciesSql) {
+		label := fmt.Sprintf("%v", row[0].Value)
+		dependency := fmt.Sprintf("%v", row[1].Value)
+		if toProcess[label] && toProcess[dependency] {
+			dependencies[label] = append(dependencies[label], dependency)
+		}
+	}
+
+	result := make([]string, 0)
+	visited := make(map[string]bool)
+	var visit func(channel string)
+	visit = func(channel string) {
+		if visited[channel] {
+			return
+		}
+		visited[channel] = true
+		for _, dependency := range dependencies[channel] {
+			visit(dependency)
+		}
+		result = append(result, channel)
+	}
+	for _, channel := range channels {
+		visit(channel)
+	}
+	return result
 }
 
-func processAndInsertProducts(db *sql.DB, writer *bufio.Writer) {
-	schemaMetadata := schemareader.ReadTablesSchema(db, ProductsTableNames())
+func processAndInsertProducts(db *sql.DB, writer *bufio.Writer, options DumperOptions) {
+	schemaMetadata := readTablesSchema(db, "products", ProductsTableNames(), options)
+	prepareSchemaMetadata(db, schemaMetadata, options)
 	startingTables := []schemareader.Table{schemaMetadata["suseproducts"]}
 
 	var whereFilterClause = func(table schemareader.Table) string {
@@ -169,19 +242,48 @@ func processAndInsertProducts(db *sql.DB, writer *bufio.Writer) {
 		return filterOrg
 	}
 
-	dumper.DumpAllTablesData(db, writer, schemaMetadata, startingTables, whereFilterClause, onlyIfParentExistsTables)
+	pagination := dumper.Pagination{PageSize: options.PageSize, InsertBatchSize: options.InsertBatchSize}
+	dumper.DumpAllTablesData(db, writer, schemaMetadata, startingTables, whereFilterClause, onlyIfParentExistsTables, pagination)
+	writeSequenceValues(db, writer, schemaMetadata, options)
 	writer.WriteString("-- end of product tables")
 	writer.WriteString("\n")
 	log.Debug().Msg("products export done")
 }
 
+// readChannelTablesSchema reads the schema of the software channel tables, or of the tables given with --tables.
+// The tables the export starts from are required in the list given by the user.
+func readChannelTablesSchema(db *sql.DB, options DumperOptions, startTables ...string) map[string]schemareader.Table {
+	if len(options.Tables) == 0 {
+		return readTablesSchema(db, "channels", SoftwareChannelTableNames(), options)
+	}
+	tables, err := schemareader.ReadTablesFromList(db, options.Tables)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Unable to read the tables to export")
+	}
+	schemaMetadata := make(map[string]schemareader.Table, len(tables))
+	for _, table := range tables {
+		schemaMetadata[table.Name] = table
+	}
+	for _, tableName := range startTables {
+		if _, ok := schemaMetadata[tableName]; !ok {
+			log.Fatal().Msgf("The tables to export must contain %s", tableName)
+		}
+	}
+	return schemaMetadata
+}
+
 func processAndInsertChannels(db *sql.DB, writer *bufio.Writer, options DumperOptions) {
 
 	channels := loadChannelsToProcess(db, options)
 	log.Info().Msg(fmt.Sprintf("%d channels to process", len(channels)))
 
-	schemaMetadata := schemareader.ReadTablesSchema(db, SoftwareChannelTableNames())
+	schemaMetadata := readChannelTablesSchema(db, options, "rhnchannel")
 	log.Debug().Msg("channel schema metadata loaded")
+	prepareSchemaMetadata(db, schemaMetadata, options)
+	// read before the row checksums of this export may overwrite the previous ones
+	if options.ErrataDeltaFrom != "" {
+		options.errataDelta = loadErrataDelta(options)
+	}
 
 	fileChannels, err := os.Create(options.GetOutputFolderAbsPath() + "/exportedChannels.txt")
 	if err != nil {
@@ -192,20 +294,46 @@ func processAndInsertChannels(db *sql.DB, writer *bufio.Writer, options DumperOp
 	bufferWriterChannels := bufio.NewWriter(fileChannels)
 	defer bufferWriterChannels.Flush()
 
+	var bufferWriterChecksums *bufio.Writer
+	if options.RowChecksums {
+		fileChecksums, err := os.Create(options.GetOutputFolderAbsPath() + "/row_checksums.txt")
+		if err != nil {
+			log.Panic().Err(err).Msg("error creating row checksums file")
+		}
+		defer fileChecksums.Close()
+		bufferWriterChecksums = bufio.NewWriter(fileChecksums)
+		defer bufferWriterChecksums.Flush()
+	}
+
 	count := 0
 	for _, channelLabel := range channels {
 		count++
 		log.Info().Msg(fmt.Sprintf("Processing channel [%d/%d] %s", count, len(channels), channelLabel))
-		processChannel(db, writer, channelLabel, schemaMetadata, options)
+		processChannel(db, writer, channelLabel, schemaMetadata, options, bufferWriterChecksums)
 		writer.Flush()
 		bufferWriterChannels.WriteString(fmt.Sprintf("%s\n", channelLabel))
 	}
+	writeSequenceValues(db, writer, schemaMetadata, options)
+}
+
+// loadErrataDelta reads the channel errata of the previous export to only export the changes
+func loadErrataDelta(options DumperOptions) *dumper.AssociationDelta {
+	file, err := os.Open(path.Join(utils.GetAbsPath(options.ErrataDeltaFrom), "row_checksums.txt"))
+	if err != nil {
+		log.Fatal().Err(err).Msg("The previous export must be done with --rowChecksums to compute the errata delta")
+	}
+	defer file.Close()
+	delta, err := dumper.LoadAssociationDelta(file, "rhnchannelerrata", options.ErrataDeltaDeletes)
+	if err != nil {
+		log.Panic().Err(err).Msg("error reading the previous row checksums")
+	}
+	return delta
 }
 
 func processChannel(db *sql.DB, writer *bufio.Writer, channelLabel string,
-	schemaMetadata map[string]schemareader.Table, options DumperOptions) {
-	whereFilter := fmt.Sprintf("label = '%s'", channelLabel)
-	tableData := dumper.DataCrawler(db, schemaMetadata, schemaMetadata["rhnchannel"], whereFilter, options.StartingDate)
+	schemaMetadata map[string]schemareader.Table, options DumperOptions, checksumWriter *bufio.Writer) {
+	whereFilter := fmt.Sprintf("label = %s", pq.QuoteLiteral(channelLabel))
+	tableData := dumper.DataCrawler(db, schemaMetadata, schemaMetadata["rhnchannel"], whereFilter, options.StartingDate, options.dependencyTrace)
 
 	if log.Debug().Enabled() {
 		totalRows := 0
@@ -215,11 +343,24 @@ func processChannel(db *sql.DB, writer *bufio.Writer, channelLabel string,
 		log.Debug().Msgf("finished table data crawler. Total database rows to export: %d", totalRows)
 	}
 
-	cleanWhereClause := fmt.Sprintf(`WHERE rhnchannel.id = (SELECT id FROM rhnchannel WHERE label = '%s')`, channelLabel)
-	printOptions := dumper.PrintSqlOptions{
-		TablesToClean:            tablesToClean,
-		CleanWhereClause:         cleanWhereClause,
-		OnlyIfParentExistsTables: onlyIfParentExistsTables}
+	cleanWhereClause := labelCleanWhereClause("rhnchannel", channelLabel)
+	channelTablesToClean := tablesToClean
+	if options.errataDelta != nil {
+		// the delta only writes the changed channel errata instead of cleaning and rewriting them all
+		channelTablesToClean = make([]string, 0)
+		for _, tableName := range tablesToClean {
+			if tableName != options.errataDelta.TableName {
+				channelTablesToClean = append(channelTablesToClean, tableName)
+			}
+		}
+		options.errataDelta.SetLabelScope("rhnchannel", channelLabel)
+	}
+	printOptions := printSqlOptions(options)
+	printOptions.TablesToClean = channelTablesToClean
+	printOptions.CleanWhereClause = cleanWhereClause
+	printOptions.OnlyIfParentExistsTables = onlyIfParentExistsTables
+	printOptions.RowChecksumWriter = checksumWriter
+	printOptions.AssociationDelta = options.errataDelta
 
 	dumper.PrintTableDataOrdered(db, writer, schemaMetadata, schemaMetadata["rhnchannel"],
 		tableData, printOptions)
@@ -237,22 +378,23 @@ func processChannel(db *sql.DB, writer *bufio.Writer, channelLabel string,
 
 func generateCacheCalculation(channelLabel string, writer *bufio.Writer) {
 	// need to update channel modify since it's use to run repo metadata generation
-	updateChannelModifyDate := fmt.Sprintf("update rhnchannel set modified = current_timestamp where label = '%s';", channelLabel)
+	channelTable := dumper.QuoteTableName("rhnchannel")
+	updateChannelModifyDate := fmt.Sprintf("update %s set modified = current_timestamp where label = %s;", channelTable, pq.QuoteLiteral(channelLabel))
 	writer.WriteString(updateChannelModifyDate + "\n")
 
 	// force system updates packages/patches for system using the channel
-	serverErrataCache := fmt.Sprintf("select rhn_channel.update_needed_cache((select id from rhnchannel where label ='%s'));", channelLabel)
+	serverErrataCache := fmt.Sprintf("select rhn_channel.update_needed_cache((select id from %s where label = %s));", channelTable, pq.QuoteLiteral(channelLabel))
 	writer.WriteString(serverErrataCache + "\n")
 
 	// refreshes the package newest page
-	channelNewPackages := fmt.Sprintf("select rhn_channel.refresh_newest_package((select id from rhnchannel where label ='%s'), 'inter-server-sync');", channelLabel)
+	channelNewPackages := fmt.Sprintf("select rhn_channel.refresh_newest_package((select id from %s where label = %s), 'inter-server-sync');", channelTable, pq.QuoteLiteral(channelLabel))
 	writer.WriteString(channelNewPackages + "\n")
 
 	// generates the repository metadata on disk
 	repoMetadata := fmt.Sprintf(`
-		INSERT INTO rhnRepoRegenQueue
+		INSERT INTO %s
 		(id, channel_label, client, reason, force, bypass_filters, next_action, created, modified)
-		VALUES (null, '%s', 'inter server sync v2', 'channel sync', 'N', 'N', current_timestamp, current_timestamp, current_timestamp);
-	`, channelLabel)
+		VALUES (null, %s, 'inter server sync v2', 'channel sync', 'N', 'N', current_timestamp, current_timestamp, current_timestamp);
+	`, dumper.QuoteTableName("rhnreporegenqueue"), pq.QuoteLiteral(channelLabel))
 	writer.WriteString(repoMetadata + "\n")
 }
@@ -0,0 +1,244 @@
+package entityDumper
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/uyuni-project/inter-server-sync/dumper"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/tests"
+)
+
+func TestLoadChannelsToProcessWithFamily(t *testing.T) {
+
+	// Arrange
+	repo := tests.CreateDataRepository()
+	options := DumperOptions{
+		ChannelLabels:       []string{"sles15-sp4-updates"},
+		ChannelFamilyLabels: []string{"SLE-M-T"},
+	}
+	repo.ExpectWithRecords(singleChannelSql,
+		sqlmock.NewRows([]string{"label"}).AddRow("sles15-sp4-updates"), "sles15-sp4-updates")
+	repo.ExpectWithRecords(singleChannelFamilySql,
+		sqlmock.NewRows([]string{"label"}).AddRow("SLE-M-T"), "SLE-M-T")
+	repo.ExpectWithRecords(channelFamilyMembersSql,
+		sqlmock.NewRows([]string{"label"}).
+			AddRow("sles15-sp4-pool").
+			AddRow("sles15-sp4-updates").
+			AddRow("sle-manager-tools15-pool"),
+		"SLE-M-T")
+	repo.ExpectWithRecords(channelDependenciesSql,
+		sqlmock.NewRows([]string{"label", "label"}).AddRow("sles15-sp4-updates", "sles15-sp4-pool"))
+
+	// Act
+	channels := loadChannelsToProcess(repo.DB, options)
+
+	// Assert
+	// channels already selected by label are not processed twice and parents come first
+	expected := []string{"sles15-sp4-pool", "sles15-sp4-updates", "sle-manager-tools15-pool"}
+	if !reflect.DeepEqual(channels, expected) {
+		t.Errorf("Channels do not match: expected %v, got %v", expected, channels)
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("Some channels were not loaded. Error message: %s", err)
+	}
+}
+
+func TestLoadChannelsToProcessWithFamilyParentOutside(t *testing.T) {
+
+	// Arrange
+	repo := tests.CreateDataRepository()
+	options := DumperOptions{
+		ChannelFamilyLabels: []string{"SLE-M-T"},
+	}
+	repo.ExpectWithRecords(singleChannelFamilySql,
+		sqlmock.NewRows([]string{"label"}).AddRow("SLE-M-T"), "SLE-M-T")
+	repo.ExpectWithRecords(channelFamilyMembersSql,
+		sqlmock.NewRows([]string{"label"}).
+			AddRow("sle-manager-tools15-pool").
+			AddRow("sle-manager-tools15-updates-sp4"),
+		"SLE-M-T")
+	repo.ExpectWithRecords(channelDependenciesSql,
+		sqlmock.NewRows([]string{"label", "label"}).
+			AddRow("sle-manager-tools15-updates-sp4", "sles15-sp4-pool").
+			AddRow("sles15-sp4-updates", "sles15-sp4-pool"))
+
+	// Act
+	channels := loadChannelsToProcess(repo.DB, options)
+
+	// Assert
+	// the parent outside the family is not processed: only its row is exported, reached from its child channel
+	expected := []string{"sle-manager-tools15-pool", "sle-manager-tools15-updates-sp4"}
+	if !reflect.DeepEqual(channels, expected) {
+		t.Errorf("Channels do not match: expected %v, got %v", expected, channels)
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("Some channels were not loaded. Error message: %s", err)
+	}
+}
+
+func TestLoadChannelsToProcessWithFamilyAndChildren(t *testing.T) {
+
+	// Arrange
+	repo := tests.CreateDataRepository()
+	options := DumperOptions{
+		ChannelWithChildrenLabels: []string{"sles15-sp4-pool"},
+		ChannelFamilyLabels:       []string{"SLE-M-T"},
+	}
+	repo.ExpectWithRecords(singleChannelSql,
+		sqlmock.NewRows([]string{"label"}).AddRow("sles15-sp4-pool"), "sles15-sp4-pool")
+	repo.ExpectWithRecords(childChannelSql,
+		sqlmock.NewRows([]string{"label"}).
+			AddRow("sles15-sp4-updates").
+			AddRow("sle-manager-tools15-updates-sp4"),
+		"sles15-sp4-pool")
+	repo.ExpectWithRecords(singleChannelFamilySql,
+		sqlmock.NewRows([]string{"label"}).AddRow("SLE-M-T"), "SLE-M-T")
+	// the family member listed first is the child of the listed parent
+	repo.ExpectWithRecords(channelFamilyMembersSql,
+		sqlmock.NewRows([]string{"label"}).
+			AddRow("sle-manager-tools15-updates-sp4").
+			AddRow("sle-manager-tools15-pool"),
+		"SLE-M-T")
+	repo.ExpectWithRecords(channelDependenciesSql,
+		sqlmock.NewRows([]string{"label", "label"}).
+			AddRow("sles15-sp4-updates", "sles15-sp4-pool").
+			AddRow("sle-manager-tools15-updates-sp4", "sles15-sp4-pool"))
+
+	// Act
+	channels := loadChannelsToProcess(repo.DB, options)
+
+	// Assert
+	// the children of the listed parent are processed once, after their parent, with the other family members
+	expected := []string{"sles15-sp4-pool", "sles15-sp4-updates", "sle-manager-tools15-updates-sp4", "sle-manager-tools15-pool"}
+	if !reflect.DeepEqual(channels, expected) {
+		t.Errorf("Channels do not match: expected %v, got %v", expected, channels)
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("Some channels were not loaded. Error message: %s", err)
+	}
+}
+
+func TestLoadChannelsToProcessWithClone(t *testing.T) {
+
+	// Arrange
+	repo := tests.CreateDataRepository()
+	options := DumperOptions{
+		ChannelLabels: []string{"dev-sles15-sp4-updates", "sles15-sp4-pool", "sles15-sp4-updates"},
+	}
+	for _, label := range options.ChannelLabels {
+		repo.ExpectWithRecords(singleChannelSql, sqlmock.NewRows([]string{"label"}).AddRow(label), label)
+	}
+	repo.ExpectWithRecords(channelDependenciesSql,
+		sqlmock.NewRows([]string{"label", "label"}).
+			AddRow("dev-sles15-sp4-updates", "sles15-sp4-pool").
+			AddRow("sles15-sp4-updates", "sles15-sp4-pool").
+			AddRow("dev-sles15-sp4-updates", "sles15-sp4-updates").
+			// the original of this clone is not exported
+			AddRow("sles15-sp4-pool", "sles15-sp3-pool"))
+
+	// Act
+	channels := loadChannelsToProcess(repo.DB, options)
+
+	// Assert
+	// the original channel is exported before its clone for the clone link to be imported
+	expected := []string{"sles15-sp4-pool", "sles15-sp4-updates", "dev-sles15-sp4-updates"}
+	if !reflect.DeepEqual(channels, expected) {
+		t.Errorf("Channels do not match: expected %v, got %v", expected, channels)
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("Some channels were not loaded. Error message: %s", err)
+	}
+}
+
+func TestChannelDumpQualifiesTableNames(t *testing.T) {
+
+	// Arrange
+	dumper.TargetSchema = "target"
+	t.Cleanup(func() { dumper.TargetSchema = "" })
+	channel := schemareader.Table{
+		Name:                "rhnchannel",
+		Export:              true,
+		Columns:             []string{"id", "label"},
+		ColumnIndexes:       map[string]int{"id": 0, "label": 1},
+		PKColumns:           map[string]bool{"id": true},
+		PKSequence:          "rhn_channel_id_seq",
+		MainUniqueIndexName: "rhn_channel_label_uk",
+		UniqueIndexes: map[string]schemareader.UniqueIndex{
+			"rhn_channel_label_uk": {Name: "rhn_channel_label_uk", Columns: []string{"label"}},
+		},
+		ReferencedBy: []schemareader.Reference{{TableName: "rhndistchannelmap", ColumnMapping: map[string]string{"channel_id": "id"}}},
+	}
+	distMap := schemareader.Table{
+		Name:                "rhndistchannelmap",
+		Export:              true,
+		Columns:             []string{"id", "channel_id", "release"},
+		ColumnIndexes:       map[string]int{"id": 0, "channel_id": 1, "release": 2},
+		PKColumns:           map[string]bool{"id": true},
+		PKSequence:          "rhn_dist_channel_map_id_seq",
+		MainUniqueIndexName: "rhn_dist_channel_map_uq",
+		UniqueIndexes: map[string]schemareader.UniqueIndex{
+			"rhn_dist_channel_map_uq": {Name: "rhn_dist_channel_map_uq", Columns: []string{"channel_id", "release"}},
+		},
+		References: []schemareader.Reference{{TableName: "rhnchannel", ColumnMapping: map[string]string{"channel_id": "id"}}},
+	}
+	schema := map[string]schemareader.Table{"rhnchannel": channel, "rhndistchannelmap": distMap}
+	data := dumper.DataDumper{TableData: map[string]dumper.TableDump{
+		"rhnchannel":        {TableName: "rhnchannel", Keys: []dumper.TableKey{{Key: []dumper.RowKey{{Column: "id", Value: "1"}}}}},
+		"rhndistchannelmap": {TableName: "rhndistchannelmap", Keys: []dumper.TableKey{{Key: []dumper.RowKey{{Column: "id", Value: "2"}}}}},
+	}}
+	repo := tests.CreateDataRepository()
+	repo.ExpectWithRecords("SELECT id, channel_id, release FROM rhndistchannelmap WHERE (channel_id,release) IN "+
+		"(SELECT rhndistchannelmap.channel_id, rhndistchannelmap.release FROM rhndistchannelmap  "+
+		"INNER JOIN rhnchannel on rhnchannel.id = rhndistchannelmap.channel_id "+
+		"WHERE rhnchannel.id = (SELECT id FROM rhnchannel WHERE label = 'channel'));",
+		sqlmock.NewRows(distMap.Columns))
+	repo.ExpectWithRecords("SELECT id, label FROM rhnchannel WHERE (id) IN ((1)) ORDER BY id;",
+		sqlmock.NewRows(channel.Columns).AddRow(1, "channel"))
+	repo.ExpectWithRecords("SELECT id, channel_id, release FROM rhndistchannelmap WHERE (id) IN ((2)) ORDER BY id;",
+		sqlmock.NewRows(distMap.Columns).AddRow(2, 1, "15.4"))
+	repo.ExpectWithRecords("SELECT id, label FROM rhnchannel WHERE id = $1;",
+		sqlmock.NewRows(channel.Columns).AddRow(1, "channel"), 1)
+	options := dumper.PrintSqlOptions{TablesToClean: tablesToClean, CleanWhereClause: labelCleanWhereClause("rhnchannel", "channel")}
+
+	// Act
+	dumper.PrintTableDataOrdered(repo.DB, repo.Writer, schema, channel, data, options)
+	generateCacheCalculation("channel", repo.Writer)
+
+	// Assert
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Fatalf("The channel rows were not read. Error message: %s", err)
+	}
+	dump := strings.Join(repo.GetWriterBuffer(), "")
+	tableNames := regexp.MustCompile(`(?i)\b(?:FROM|INTO|JOIN|UPDATE)\s+([\w."]+)`).FindAllStringSubmatch(dump, -1)
+	sequenceNames := regexp.MustCompile(`nextval\('([^']+)'\)`).FindAllStringSubmatch(dump, -1)
+	if len(tableNames) == 0 || len(sequenceNames) != 2 {
+		t.Fatalf("The dump should have the channel statements, got:\n%s", dump)
+	}
+	for _, name := range append(tableNames, sequenceNames...) {
+		// the conflict clause updates the inserted row
+		if !strings.HasPrefix(name[1], "target.") && !strings.EqualFold(name[1], "SET") {
+			t.Errorf("%s should be qualified with the target schema in:\n%s", name[1], dump)
+		}
+	}
+}
+
+func TestGenerateCacheCalculationQuotesLabel(t *testing.T) {
+	// Arrange
+	repo := tests.CreateDataRepository()
+
+	// Act
+	generateCacheCalculation("o'brien-channel", repo.Writer)
+
+	// Assert
+	dump := strings.Join(repo.GetWriterBuffer(), "")
+	if strings.Contains(dump, "'o'brien-channel'") {
+		t.Errorf("The channel label should be quoted, got:\n%s", dump)
+	}
+	if count := strings.Count(dump, "'o''brien-channel'"); count != 4 {
+		t.Errorf("Expected the quoted channel label in the 4 statements, got %d in:\n%s", count, dump)
+	}
+}
@@ -0,0 +1,74 @@
+package entityDumper
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ImportCheckpointFile lists the files of the split dump already committed by an import with checkpoints
+const ImportCheckpointFile = "import_checkpoint.txt"
+
+// SplitDumpFiles returns the files of the split dump of the directory in their import order.
+// The SQL statements are split first if the export was not made with --splitTables.
+func SplitDumpFiles(dir string) ([]string, error) {
+	order, err := os.ReadFile(filepath.Join(dir, SplitDumpDir, splitDumpOrderFile))
+	fileNames := strings.Fields(string(order))
+	if os.IsNotExist(err) {
+		fileNames, err = writeSplitDump(dir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading the split dump: %w", err)
+	}
+	return fileNames, nil
+}
+
+// OpenSplitDumpFile reads a file of the split dump of the directory in its own transaction
+func OpenSplitDumpFile(dir string, fileName string) (io.ReadCloser, error) {
+	return openSplitSqlStatements(filepath.Join(dir, SplitDumpDir), []byte(fileName))
+}
+
+// ReadImportCheckpoint returns the files of the split dump committed by a previous import of the directory,
+// none if no checkpoint was recorded
+func ReadImportCheckpoint(dir string) (map[string]bool, error) {
+	result := make(map[string]bool)
+	file, err := os.Open(filepath.Join(dir, ImportCheckpointFile))
+	if os.IsNotExist(err) {
+		return result, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening the import checkpoint: %w", err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			result[line] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading the import checkpoint: %w", err)
+	}
+	return result, nil
+}
+
+// RecordImportCheckpoint adds the file of the split dump to the checkpoint once its transaction is committed
+func RecordImportCheckpoint(dir string, fileName string) error {
+	file, err := os.OpenFile(filepath.Join(dir, ImportCheckpointFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("opening the import checkpoint: %w", err)
+	}
+	if _, err := file.WriteString(fileName + "\n"); err != nil {
+		file.Close()
+		return fmt.Errorf("writing the import checkpoint: %w", err)
+	}
+	// the checkpoint has to survive a crash right after the commit
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("writing the import checkpoint: %w", err)
+	}
+	return file.Close()
+}
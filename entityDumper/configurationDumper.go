@@ -7,6 +7,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/lib/pq"
 	"github.com/rs/zerolog/log"
 	"github.com/uyuni-project/inter-server-sync/dumper"
 	"github.com/uyuni-project/inter-server-sync/schemareader"
@@ -45,8 +46,9 @@ func processConfigs(db *sql.DB, writer *bufio.Writer, options DumperOptions) {
 
 	configs := loadConfigsToProcess(db, options)
 	log.Info().Msg(fmt.Sprintf("%d configuration channels to process", len(configs)))
-	schemaMetadata := schemareader.ReadTablesSchema(db, ConfigTableNames())
+	schemaMetadata := readTablesSchema(db, "configs", ConfigTableNames(), options)
 	log.Debug().Msg("channel schema metadata loaded")
+	prepareSchemaMetadata(db, schemaMetadata, options)
 	configLabels, err := os.Create(options.GetOutputFolderAbsPath() + "/exportedConfigs.txt")
 	if err != nil {
 		log.Panic().Err(err).Msg("error creating exportedConfigChannel file")
@@ -63,22 +65,22 @@ func processConfigs(db *sql.DB, writer *bufio.Writer, options DumperOptions) {
 		writer.Flush()
 		bufferWriterChannels.WriteString(fmt.Sprintf("%s\n", l))
 	}
+	writeSequenceValues(db, writer, schemaMetadata, options)
 
 }
 
 func processConfigChannel(db *sql.DB, writer *bufio.Writer, channelLabel string,
 	schemaMetadata map[string]schemareader.Table, options DumperOptions) {
-	whereFilter := fmt.Sprintf("label = '%s'", channelLabel)
-	tableData := dumper.DataCrawler(db, schemaMetadata, schemaMetadata["rhnconfigchannel"], whereFilter, options.StartingDate)
+	whereFilter := fmt.Sprintf("label = %s", pq.QuoteLiteral(channelLabel))
+	tableData := dumper.DataCrawler(db, schemaMetadata, schemaMetadata["rhnconfigchannel"], whereFilter, options.StartingDate, options.dependencyTrace)
 	log.Debug().Msg("finished table data crawler")
 
-	cleanWhereClause := fmt.Sprintf(`WHERE rhnconfigchannel.id = (SELECT id FROM rhnconfigchannel WHERE label = '%s')`, channelLabel)
-	printOptions := dumper.PrintSqlOptions{
-		TablesToClean:            tablesToClean,
-		CleanWhereClause:         cleanWhereClause,
-		OnlyIfParentExistsTables: onlyIfParentExistsTables,
-		PostOrderCallback:        createPostOrderCallback(),
-	}
+	cleanWhereClause := labelCleanWhereClause("rhnconfigchannel", channelLabel)
+	printOptions := printSqlOptions(options)
+	printOptions.TablesToClean = tablesToClean
+	printOptions.CleanWhereClause = cleanWhereClause
+	printOptions.OnlyIfParentExistsTables = onlyIfParentExistsTables
+	printOptions.PostOrderCallback = createPostOrderCallback()
 
 	dumper.PrintTableDataOrdered(db, writer, schemaMetadata, schemaMetadata["rhnconfigchannel"],
 		tableData, printOptions)
@@ -127,6 +129,7 @@ func genUpdateForReference(value []sqlUtil.RowDataStructure) string {
 			configChannelId = field.Value
 		}
 	}
-	updateString = fmt.Sprintf("update rhnconfigfile set latest_config_revision_id = (%s) where config_file_name_id = (%s) and config_channel_id = (%s);", latestConfigRevisionId, configFileNameId, configChannelId)
+	updateString = fmt.Sprintf("update %s set latest_config_revision_id = (%s) where config_file_name_id = (%s) and config_channel_id = (%s);",
+		dumper.QuoteTableName("rhnconfigfile"), latestConfigRevisionId, configFileNameId, configChannelId)
 	return updateString
 }
@@ -3,12 +3,30 @@ package entityDumper
 import (
 	"bufio"
 	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
+	"github.com/lib/pq"
 	"github.com/rs/zerolog/log"
+	"github.com/uyuni-project/inter-server-sync/dumper"
 	"github.com/uyuni-project/inter-server-sync/schemareader"
 )
 
+// SplitDumpDir is the directory of the export holding the SQL statements split in files of consecutive statements of a table
+const SplitDumpDir = "tables"
+
+const splitDumpOrderFile = "order.txt"
+
+// DependencyTraceFile holds the reason each crawled row is exported, written with --dependencyTrace
+const DependencyTraceFile = "dependency_trace.txt"
+
 func DumpAllEntities(options DumperOptions) {
 	var outputFolderAbs = options.GetOutputFolderAbsPath()
 	validateExportFolder(outputFolderAbs)
@@ -25,13 +43,63 @@ func DumpAllEntities(options DumperOptions) {
 	bufferWriter := bufio.NewWriterSize(gzipFile, 32768)
 	defer bufferWriter.Flush()
 
+	if options.UndoScript {
+		options.undoScript = dumper.NewUndoScript()
+	}
+	if options.CleanupScript {
+		options.cleanupScript = dumper.NewCleanupScript()
+	}
+	var verificationGzip *gzip.Writer
+	var verificationWriter *bufio.Writer
+	if options.ImportVerification {
+		verificationFile, err := os.OpenFile(filepath.Join(outputFolderAbs, ImportVerificationFile), os.O_WRONLY|os.O_CREATE, 0600)
+		if err != nil {
+			log.Panic().Err(err).Msg("error creating import verification file")
+		}
+		defer verificationFile.Close()
+		verificationGzip = gzip.NewWriter(verificationFile)
+		defer verificationGzip.Close()
+		verificationWriter = bufio.NewWriterSize(verificationGzip, 32768)
+		defer verificationWriter.Flush()
+		options.importVerification = dumper.NewImportVerification(verificationWriter)
+	}
+	if options.DependencyTrace {
+		traceFile, err := os.OpenFile(filepath.Join(outputFolderAbs, DependencyTraceFile), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			log.Panic().Err(err).Msg("error creating dependency trace file")
+		}
+		defer traceFile.Close()
+		traceWriter := bufio.NewWriterSize(traceFile, 32768)
+		defer traceWriter.Flush()
+		options.dependencyTrace = dumper.NewDependencyTrace(traceWriter)
+	}
+
 	db := schemareader.GetDBconnection(options.ServerConfig)
 	defer db.Close()
+	if options.Snapshot {
+		snapshot, err := schemareader.OpenSnapshot(context.Background(), db, schemareader.GetConnectionString(options.ServerConfig))
+		if err != nil {
+			log.Fatal().Err(err).Msg("Unable to open a snapshot of the database")
+		}
+		defer snapshot.Close()
+		db = snapshot.DB
+	}
+	if len(options.ReferenceIdMaps) > 0 {
+		targetDb, err := sql.Open("postgres", options.TargetDatabaseURL)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Unable to connect to the target database")
+		}
+		defer targetDb.Close()
+		options.referenceIdMaps = dumper.NewReferenceIdMaps(targetDb)
+	}
 	bufferWriter.WriteString("BEGIN;\n")
-	if len(options.ChannelLabels) > 0 || len(options.ChannelWithChildrenLabels) > 0 {
-		processAndInsertProducts(db, bufferWriter)
+	if len(options.ChannelLabels) > 0 || len(options.ChannelWithChildrenLabels) > 0 || len(options.ChannelFamilyLabels) > 0 {
+		processAndInsertProducts(db, bufferWriter, options)
 		processAndInsertChannels(db, bufferWriter, options)
 	}
+	if len(options.Advisories) > 0 {
+		processAdvisories(db, bufferWriter, options)
+	}
 	if len(options.ConfigLabels) > 0 {
 		processConfigs(db, bufferWriter, options)
 	}
@@ -41,4 +109,464 @@ func DumpAllEntities(options DumperOptions) {
 	}
 
 	bufferWriter.WriteString("COMMIT;\n")
+	closeSqlFile(bufferWriter, gzipFile)
+	if verificationWriter != nil {
+		closeSqlFile(verificationWriter, verificationGzip)
+	}
+
+	reportReferenceIdMapMisses()
+
+	if options.undoScript != nil {
+		writeUndoScript(outputFolderAbs, options.undoScript)
+	}
+	if options.cleanupScript != nil {
+		writeCleanupScript(outputFolderAbs, options.cleanupScript)
+	}
+}
+
+// ValidateDump checks the generated dump contains the rows planned for each table, by key, without duplicated row
+func ValidateDump(options DumperOptions) {
+	file, err := os.Open(options.GetOutputFolderAbsPath() + "/sql_statements.sql.gz")
+	if err != nil {
+		log.Panic().Err(err).Msg("error opening sql file")
+	}
+	defer file.Close()
+
+	gzipFile, err := gzip.NewReader(file)
+	if err != nil {
+		log.Panic().Err(err).Msg("error reading sql file")
+	}
+	defer gzipFile.Close()
+
+	discrepancies := dumper.ValidateDump(gzipFile)
+	for _, discrepancy := range discrepancies {
+		log.Error().Msg(discrepancy)
+	}
+	if len(discrepancies) > 0 {
+		log.Fatal().Msgf("The generated dump doesn't match the rows of the export plan: %d discrepancies", len(discrepancies))
+	}
+	log.Info().Msg("The generated dump matches the rows of the export plan")
+}
+
+// gzipFileReader closes the compressed file with its decompressing reader
+type gzipFileReader struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (r gzipFileReader) Close() error {
+	r.Reader.Close()
+	return r.file.Close()
+}
+
+// splitFilesReader reads the files of a split dump in a single transaction
+type splitFilesReader struct {
+	io.Reader
+	files []*os.File
+}
+
+func (r splitFilesReader) Close() error {
+	var firstErr error
+	for _, file := range r.files {
+		if err := file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// SplitSqlStatements replaces sql_statements.sql.gz by one file per run of statements of a table in the tables directory.
+// The order to import them is written in tables/order.txt.
+func SplitSqlStatements(options DumperOptions) {
+	fileNames, err := writeSplitDump(options.GetOutputFolderAbsPath())
+	if err != nil {
+		log.Panic().Err(err).Msg("error splitting sql file")
+	}
+	if err := os.Remove(filepath.Join(options.GetOutputFolderAbsPath(), "sql_statements.sql.gz")); err != nil {
+		log.Panic().Err(err).Msg("error removing sql file")
+	}
+	log.Info().Msgf("SQL statements split in %d files of %s", len(fileNames), filepath.Join(options.GetOutputFolderAbsPath(), SplitDumpDir))
+}
+
+// writeSplitDump writes the SQL statements of the directory in one file per run of statements of a table in its tables directory
+// and returns the names of the files in their import order.
+// The order file is written last: a directory without it is the leftover of an interrupted split and is overwritten.
+func writeSplitDump(dir string) ([]string, error) {
+	splitDir := filepath.Join(dir, SplitDumpDir)
+	if err := os.MkdirAll(splitDir, 0755); err != nil {
+		return nil, fmt.Errorf("creating the split dump directory: %w", err)
+	}
+	statements, err := OpenSqlStatements(dir)
+	if err != nil {
+		return nil, err
+	}
+	fileNames, err := dumper.SplitDump(statements, splitDir)
+	statements.Close()
+	if err != nil {
+		return nil, err
+	}
+	order := strings.Join(fileNames, "\n") + "\n"
+	if err := os.WriteFile(filepath.Join(splitDir, splitDumpOrderFile), []byte(order), 0600); err != nil {
+		return nil, fmt.Errorf("writing the split dump order: %w", err)
+	}
+	return fileNames, nil
+}
+
+// openSplitSqlStatements reads the files of a split dump in the order of its order file, in a single transaction
+func openSplitSqlStatements(splitDir string, order []byte) (io.ReadCloser, error) {
+	result := splitFilesReader{files: make([]*os.File, 0)}
+	readers := []io.Reader{strings.NewReader("BEGIN;\n")}
+	for _, fileName := range strings.Fields(string(order)) {
+		file, err := os.Open(filepath.Join(splitDir, filepath.Base(fileName)))
+		if err != nil {
+			result.Close()
+			return nil, fmt.Errorf("opening the split dump: %w", err)
+		}
+		result.files = append(result.files, file)
+		readers = append(readers, file)
+	}
+	result.Reader = io.MultiReader(append(readers, strings.NewReader("COMMIT;\n"))...)
+	return result, nil
+}
+
+// OpenSqlStatements opens the SQL statements of the export directory: the files of a split dump listed in
+// tables/order.txt or, without them, sql_statements.sql.gz decompressed or sql_statements.sql
+func OpenSqlStatements(dir string) (io.ReadCloser, error) {
+	splitDir := filepath.Join(dir, SplitDumpDir)
+	order, err := os.ReadFile(filepath.Join(splitDir, splitDumpOrderFile))
+	if err == nil {
+		return openSplitSqlStatements(splitDir, order)
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("reading the split dump order: %w", err)
+	}
+
+	file, err := os.Open(filepath.Join(dir, "sql_statements.sql.gz"))
+	if err == nil {
+		gzipFile, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("reading the compressed dump: %w", err)
+		}
+		return gzipFileReader{Reader: gzipFile, file: file}, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("opening the dump: %w", err)
+	}
+	file, err = os.Open(filepath.Join(dir, "sql_statements.sql"))
+	if err != nil {
+		return nil, fmt.Errorf("opening the dump: %w", err)
+	}
+	return file, nil
+}
+
+func writeUndoScript(outputFolderAbs string, undo *dumper.UndoScript) {
+	file, err := os.OpenFile(outputFolderAbs+"/undo_statements.sql.gz", os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		log.Panic().Err(err).Msg("error creating undo sql file")
+	}
+	defer file.Close()
+
+	gzipFile := gzip.NewWriter(file)
+	defer gzipFile.Close()
+
+	bufferWriter := bufio.NewWriterSize(gzipFile, 32768)
+	defer bufferWriter.Flush()
+	undo.Write(bufferWriter)
+	closeSqlFile(bufferWriter, gzipFile)
+}
+
+func writeCleanupScript(outputFolderAbs string, cleanup *dumper.CleanupScript) {
+	file, err := os.OpenFile(outputFolderAbs+"/cleanup_statements.sql.gz", os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		log.Panic().Err(err).Msg("error creating cleanup sql file")
+	}
+	defer file.Close()
+
+	gzipFile := gzip.NewWriter(file)
+	defer gzipFile.Close()
+
+	bufferWriter := bufio.NewWriterSize(gzipFile, 32768)
+	defer bufferWriter.Flush()
+	cleanup.Write(bufferWriter)
+	closeSqlFile(bufferWriter, gzipFile)
+}
+
+// closeSqlFile flushes the buffered statements and writes the gzip trailer.
+// The deferred calls only cover the interrupted exports: their errors would go unnoticed
+// while a missing trailer makes the whole file unreadable.
+func closeSqlFile(bufferWriter *bufio.Writer, gzipFile *gzip.Writer) {
+	if err := bufferWriter.Flush(); err != nil {
+		log.Panic().Err(err).Msg("error writing sql file")
+	}
+	if err := gzipFile.Close(); err != nil {
+		log.Panic().Err(err).Msg("error closing sql file")
+	}
+}
+
+// readTablesSchema reads the schema of the tables, or loads it from the cache directory if the schema didn't change.
+// The name identifies the set of tables in the cache.
+func readTablesSchema(db *sql.DB, name string, tableNames []string, options DumperOptions) map[string]schemareader.Table {
+	if options.SchemaCacheDir == "" {
+		schemaMetadata, err := schemareader.ReadTablesSchema(db, tableNames)
+		if err != nil {
+			log.Panic().Err(err).Msg("error reading the database schema")
+		}
+		return schemaMetadata
+	}
+
+	fingerprint, err := schemareader.ReadSchemaFingerprint(db)
+	if err != nil {
+		log.Panic().Err(err).Msg("error reading the database schema fingerprint")
+	}
+	cacheKey := schemareader.SchemaCacheKey(fingerprint, tableNames)
+	cachePath := filepath.Join(options.SchemaCacheDir, name+"_schema.json")
+	schemaMetadata, err := schemareader.LoadSchemaCache(cachePath, cacheKey)
+	if err == nil {
+		log.Debug().Msgf("%s schema loaded from %s", name, cachePath)
+		return schemaMetadata
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		log.Info().Err(err).Msg("Ignoring the schema cache")
+	}
+
+	schemaMetadata, err = schemareader.ReadTablesSchema(db, tableNames)
+	if err != nil {
+		log.Panic().Err(err).Msg("error reading the database schema")
+	}
+	if err := schemareader.WriteSchemaCache(schemaMetadata, cacheKey, cachePath); err != nil {
+		log.Warn().Err(err).Msg("Unable to write the schema cache")
+	}
+	return schemaMetadata
+}
+
+// prepareSchemaMetadata adapts the schema read from the database to the export options and privileges
+func prepareSchemaMetadata(db *sql.DB, schemaMetadata map[string]schemareader.Table, options DumperOptions) {
+	if err := schemareader.ApplyColumnPrivileges(db, schemaMetadata); err != nil {
+		log.Fatal().Err(err).Msg("Unable to export the columns of the schema")
+	}
+	if err := schemareader.ApplyColumnFilters(schemaMetadata, options.IncludeColumns, options.ExcludeColumns); err != nil {
+		log.Fatal().Err(err).Msg("Unable to filter the exported columns")
+	}
+	if err := schemareader.ApplyDefaultColumns(schemaMetadata, options.DefaultColumns); err != nil {
+		log.Fatal().Err(err).Msg("Unable to leave the columns to their default on the target")
+	}
+	applyAssumePresentTables(schemaMetadata, options)
+	applyExcludeTables(schemaMetadata, options)
+	if options.TableStats {
+		if err := schemareader.ApplyCheckConstraints(db, schemaMetadata); err != nil {
+			log.Panic().Err(err).Msg("error reading the check constraints")
+		}
+	}
+	if err := dumper.ApplyDictionaryTables(schemaMetadata, options.DictionaryTables); err != nil {
+		log.Fatal().Err(err).Msg("Unable to match the dictionary tables by label")
+	}
+	if err := schemareader.ApplyMainIndexColumns(schemaMetadata, options.MainIndexColumns); err != nil {
+		log.Fatal().Err(err).Msg("Unable to choose the main unique indexes")
+	}
+	if err := schemareader.ApplyReferenceIndexes(schemaMetadata, options.ReferenceIndexes); err != nil {
+		log.Fatal().Err(err).Msg("Unable to choose the unique indexes of the references")
+	}
+	applyIdOnlyStrategy(schemaMetadata, options)
+	if options.referenceIdMaps != nil {
+		if err := options.referenceIdMaps.Apply(db, schemaMetadata, options.ReferenceIdMaps); err != nil {
+			log.Fatal().Err(err).Msg("Unable to map the referenced ids")
+		}
+	}
+	if err := dumper.ApplyCopyTables(schemaMetadata, options.CopyTables); err != nil {
+		log.Fatal().Err(err).Msg("Unable to write the rows with COPY")
+	}
+	applyModifiedSince(schemaMetadata, options)
+	if err := dumper.ApplyRowLimits(schemaMetadata, options.RowLimits); err != nil {
+		log.Fatal().Err(err).Msg("Unable to limit the exported rows")
+	}
+	if err := dumper.ApplyRowFilters(schemaMetadata, options.RowFilters); err != nil {
+		log.Fatal().Err(err).Msg("Unable to filter the exported rows")
+	}
+	if err := dumper.ApplyReplaceByLabel(schemaMetadata, options.ReplaceByLabelTables); err != nil {
+		log.Fatal().Err(err).Msg("Unable to replace rows by label")
+	}
+	applySecondaryUniqueIndexes(schemaMetadata, options)
+	applyOrphanCheck(db, schemaMetadata, options)
+	reportForeignKeyCycles(schemaMetadata)
+	schemareader.ReportInvalidReferences(schemaMetadata)
+	schemareader.ReportIncompleteMainUniqueIndexes(schemaMetadata)
+}
+
+// printSqlOptions returns the print options shared by all the exported entities.
+// The dumpers set the options specific to their tables on the result.
+func printSqlOptions(options DumperOptions) dumper.PrintSqlOptions {
+	return dumper.PrintSqlOptions{
+		TableStats:      options.TableStats,
+		RowKeys:         options.RowKeys,
+		Undo:            options.undoScript,
+		Cleanup:         options.cleanupScript,
+		Verification:    options.importVerification,
+		InsertBatchSize: options.InsertBatchSize,
+		Provenance:      options.Provenance,
+	}
+}
+
+// writeSequenceValues writes the statements setting the primary key sequences of the exported tables if requested.
+// The values are read after the rows to cover all the exported ids.
+func writeSequenceValues(db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table, options DumperOptions) {
+	if !options.SequenceValues {
+		return
+	}
+	if err := schemareader.ApplySequenceValues(db, schemaMetadata); err != nil {
+		log.Panic().Err(err).Msg("error reading the sequence values")
+	}
+	dumper.PrintSequenceValues(writer, schemaMetadata)
+}
+
+// labelCleanWhereClause returns the clean WHERE clause selecting the rows reached from the row of the table with the label
+func labelCleanWhereClause(tableName string, label string) func(quoteTable func(string) string) string {
+	return func(quoteTable func(string) string) string {
+		return fmt.Sprintf(`WHERE %s.id = (SELECT id FROM %s WHERE label = %s)`, tableName, quoteTable(tableName), pq.QuoteLiteral(label))
+	}
+}
+
+// reportForeignKeyCycles warns about the exported tables referencing each other:
+// their rows can't all be inserted before the rows referencing them without deferring the constraints
+func reportForeignKeyCycles(schemaMetadata map[string]schemareader.Table) {
+	exportedTables := make(map[string]schemareader.Table)
+	for name, table := range schemaMetadata {
+		if table.Export {
+			exportedTables[name] = table
+		}
+	}
+	for _, cycle := range schemareader.DetectCycles(exportedTables) {
+		log.Warn().Msgf("Foreign keys cycle between tables %s -> %s: the import needs deferred constraints",
+			strings.Join(cycle, " -> "), cycle[0])
+		for _, reference := range schemareader.NonDeferrableCycleReferences(exportedTables, cycle) {
+			log.Warn().Msgf("Foreign key %s is not deferrable: import --deferConstraints can't defer it", reference)
+		}
+	}
+}
+
+// reportReferenceIdMapMisses warns about the referenced ids missing from the maps of the target ids:
+// the rows referencing them were written with a sub query finding the referenced row on the target instead
+func reportReferenceIdMapMisses() {
+	misses := dumper.ReferenceIdMapMisses()
+	references := make([]string, 0, len(misses))
+	for reference := range misses {
+		references = append(references, reference)
+	}
+	sort.Strings(references)
+	for _, reference := range references {
+		log.Warn().Msgf("%d ids referenced by %s are not on the target yet: they are resolved with a sub query", misses[reference], reference)
+	}
+}
+
+// applySecondaryUniqueIndexes reports the unique indexes the import can violate since rows are not matched on them
+func applySecondaryUniqueIndexes(schemaMetadata map[string]schemareader.Table, options DumperOptions) {
+	for _, table := range schemaMetadata {
+		if !table.Export {
+			continue
+		}
+		if secondaryIndexes := table.SecondaryUniqueIndexes(); len(secondaryIndexes) > 0 && !options.SkipSecondaryConflicts {
+			log.Warn().Msgf("Rows of %s are matched by %s: the import fails if they conflict with %s on the target",
+				table.Name, table.MainUniqueIndexName, strings.Join(secondaryIndexes, ", "))
+		}
+	}
+	if options.SkipSecondaryConflicts {
+		dumper.ApplySkipSecondaryUniqueConflicts(schemaMetadata)
+	}
+}
+
+// applyIdOnlyStrategy reports the tables only matched by id and prepares them for the chosen export strategy
+func applyIdOnlyStrategy(schemaMetadata map[string]schemareader.Table, options DumperOptions) {
+	idOnlyTables := schemareader.IdOnlyTables(schemaMetadata)
+	if len(idOnlyTables) == 0 {
+		return
+	}
+	if options.IdOnlyStrategy == "" {
+		log.Warn().Msgf("Tables only matched by their id are inserted without conflict check, importing them again duplicates their rows: %s. "+
+			"Use --idOnlyStrategy to choose between %s, %s or %s", strings.Join(idOnlyTables, ", "),
+			dumper.IdOnlyInsert, dumper.IdOnlyRemap, dumper.IdOnlySkip)
+	} else {
+		log.Warn().Msgf("Tables only matched by their id (strategy: '%s'): %s", options.IdOnlyStrategy, strings.Join(idOnlyTables, ", "))
+	}
+	if err := dumper.ApplyIdOnlyStrategy(schemaMetadata, options.IdOnlyStrategy); err != nil {
+		log.Fatal().Err(err).Msgf("Use --idOnlyStrategy to choose between %s, %s or %s",
+			dumper.IdOnlyInsert, dumper.IdOnlyRemap, dumper.IdOnlySkip)
+	}
+}
+
+// applyModifiedSince reports the tables only exporting the rows modified since the date of the incremental export
+func applyModifiedSince(schemaMetadata map[string]schemareader.Table, options DumperOptions) {
+	if options.ModifiedSince == "" {
+		return
+	}
+	filteredTables := dumper.ApplyModifiedSince(schemaMetadata, options.ModifiedSince)
+	if len(filteredTables) > 0 {
+		log.Info().Msgf("Only the rows modified since %s are exported from tables: %s",
+			options.ModifiedSince, strings.Join(filteredTables, ", "))
+	}
+}
+
+// applyOrphanCheck reports the rows of the exported tables referencing missing rows on the source,
+// and skips them from the export if requested
+func applyOrphanCheck(db *sql.DB, schemaMetadata map[string]schemareader.Table, options DumperOptions) {
+	if !options.CheckOrphans && !options.SkipOrphans {
+		return
+	}
+	orphans, err := dumper.FindOrphanRows(db, schemaMetadata)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Unable to check the orphan rows")
+	}
+	for _, orphan := range orphans {
+		log.Warn().Msgf("%d rows of %s reference missing rows of %s with columns %s", orphan.Count, orphan.TableName,
+			orphan.Reference.TableName, strings.Join(orphan.Reference.LocalColumns(), ", "))
+	}
+	if len(orphans) == 0 {
+		log.Info().Msg("No orphan rows found in the exported tables")
+	} else if options.SkipOrphans {
+		dumper.ApplySkipOrphans(schemaMetadata, orphans)
+		log.Info().Msg("The orphan rows are not exported")
+	} else {
+		log.Warn().Msg("The orphan rows will fail the import if exported, use --skipOrphans to skip them")
+	}
+}
+
+// applyExcludeTables stops exporting the tables excluded by the user.
+// The exported tables referencing them are reported: their rows may reference rows missing on the target.
+func applyExcludeTables(schemaMetadata map[string]schemareader.Table, options DumperOptions) {
+	excluded := make(map[string]bool)
+	for _, tableName := range options.ExcludeTables {
+		table, ok := schemaMetadata[strings.ToLower(tableName)]
+		if !ok {
+			continue
+		}
+		log.Info().Msgf("Table %s is excluded from the export", table.Name)
+		table.Export = false
+		schemaMetadata[table.Name] = table
+		excluded[table.Name] = true
+	}
+	for _, table := range schemaMetadata {
+		if !table.Export {
+			continue
+		}
+		for _, reference := range table.References {
+			if excluded[reference.TableName] {
+				log.Warn().Str("table", table.Name).Str("referenced_table", reference.TableName).
+					Msgf("Table %s references the excluded table %s: its rows will have dangling references if the target misses the referenced rows",
+						table.Name, reference.TableName)
+			}
+		}
+	}
+}
+
+// applyAssumePresentTables stops exporting the tables the user knows to be on the target already.
+// Their rows are still referenced by natural key in the exported data, trusting the target to have them.
+func applyAssumePresentTables(schemaMetadata map[string]schemareader.Table, options DumperOptions) {
+	for _, tableName := range options.AssumePresentTables {
+		table, ok := schemaMetadata[strings.ToLower(tableName)]
+		if !ok {
+			continue
+		}
+		log.Info().Msgf("Table %s is assumed to be present on the target and is not exported", table.Name)
+		table.Export = false
+		schemaMetadata[table.Name] = table
+	}
 }
@@ -0,0 +1,141 @@
+package entityDumper
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+)
+
+func TestOpenSplitSqlStatements(t *testing.T) {
+
+	// Arrange
+	dir := t.TempDir()
+	splitDir := filepath.Join(dir, SplitDumpDir)
+	files := map[string]string{
+		"order.txt":             "rhnchannel.sql\nrhnchannelpackage.sql\n",
+		"rhnchannel.sql":        "INSERT INTO rhnchannel (id)\tVALUES (1);\n",
+		"rhnchannelpackage.sql": "INSERT INTO rhnchannelpackage (channel_id)\tVALUES (1);\n",
+	}
+	if err := os.Mkdir(splitDir, 0755); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(splitDir, name), []byte(content), 0600); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+	}
+
+	// Act
+	statements, err := OpenSqlStatements(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error opening the statements: %s", err)
+	}
+	content, err := io.ReadAll(statements)
+	statements.Close()
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error reading the statements: %s", err)
+	}
+	expected := "BEGIN;\n" +
+		"INSERT INTO rhnchannel (id)\tVALUES (1);\n" +
+		"INSERT INTO rhnchannelpackage (channel_id)\tVALUES (1);\n" +
+		"COMMIT;\n"
+	if string(content) != expected {
+		t.Errorf("Unexpected statements:\n%s", content)
+	}
+}
+
+func TestApplyExcludeTables(t *testing.T) {
+
+	// Arrange
+	schemaMetadata := map[string]schemareader.Table{
+		"rhnchannel": {Name: "rhnchannel", Export: true},
+		"rhnpackage": {Name: "rhnpackage", Export: true},
+		"rhnchannelpackage": {Name: "rhnchannelpackage", Export: true, References: []schemareader.Reference{
+			{TableName: "rhnchannel", ColumnMapping: map[string]string{"channel_id": "id"}},
+			{TableName: "rhnpackage", ColumnMapping: map[string]string{"package_id": "id"}},
+		}},
+	}
+
+	// Act
+	applyExcludeTables(schemaMetadata, DumperOptions{ExcludeTables: []string{"RHNPACKAGE", "missing"}})
+
+	// Assert
+	if schemaMetadata["rhnpackage"].Export {
+		t.Errorf("Excluded table rhnpackage should not be exported")
+	}
+	if !schemaMetadata["rhnchannel"].Export || !schemaMetadata["rhnchannelpackage"].Export {
+		t.Errorf("Tables not excluded should still be exported")
+	}
+	if _, ok := schemaMetadata["missing"]; ok {
+		t.Errorf("Excluded tables missing from the schema should not be added")
+	}
+}
+
+func TestImportCheckpoint(t *testing.T) {
+
+	// Arrange
+	dir := t.TempDir()
+	splitDir := filepath.Join(dir, SplitDumpDir)
+	files := map[string]string{
+		"order.txt":           "0001_rhnchannel.sql\n0002_statements.sql\n",
+		"0001_rhnchannel.sql": "INSERT INTO rhnchannel (id)\tVALUES (1);\n",
+		"0002_statements.sql": "SELECT rhn_channel.refresh_newest_package(1, 'inter-server-sync');\n",
+	}
+	if err := os.Mkdir(splitDir, 0755); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(splitDir, name), []byte(content), 0600); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+	}
+
+	// Act
+	fileNames, err := SplitDumpFiles(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error listing the files: %s", err)
+	}
+	statements, err := OpenSplitDumpFile(dir, fileNames[0])
+	if err != nil {
+		t.Fatalf("Unexpected error opening the file: %s", err)
+	}
+	content, err := io.ReadAll(statements)
+	statements.Close()
+	if err != nil {
+		t.Fatalf("Unexpected error reading the file: %s", err)
+	}
+	emptyCheckpoint, err := ReadImportCheckpoint(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error reading the missing checkpoint: %s", err)
+	}
+	if err := RecordImportCheckpoint(dir, fileNames[0]); err != nil {
+		t.Fatalf("Unexpected error recording the checkpoint: %s", err)
+	}
+	checkpoint, err := ReadImportCheckpoint(dir)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error reading the checkpoint: %s", err)
+	}
+	if !reflect.DeepEqual(fileNames, []string{"0001_rhnchannel.sql", "0002_statements.sql"}) {
+		t.Errorf("The files should be imported in their order, got %v", fileNames)
+	}
+	expected := "BEGIN;\n" +
+		"INSERT INTO rhnchannel (id)\tVALUES (1);\n" +
+		"COMMIT;\n"
+	if string(content) != expected {
+		t.Errorf("Unexpected statements:\n%s", content)
+	}
+	if len(emptyCheckpoint) != 0 {
+		t.Errorf("No file should be imported without checkpoint, got %v", emptyCheckpoint)
+	}
+	if !reflect.DeepEqual(checkpoint, map[string]bool{"0001_rhnchannel.sql": true}) {
+		t.Errorf("Unexpected checkpoint: %v", checkpoint)
+	}
+}
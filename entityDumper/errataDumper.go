@@ -0,0 +1,98 @@
+package entityDumper
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+	"github.com/uyuni-project/inter-server-sync/dumper"
+	"github.com/uyuni-project/inter-server-sync/dumper/packageDumper"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/sqlUtil"
+)
+
+var singleAdvisorySql = "select advisory_name from rhnerrata " +
+	"where advisory_name = $1"
+
+var advisoryChannelsSql = "select distinct c.label from rhnchannel c " +
+	"join rhnchannelerrata ce on ce.channel_id = c.id " +
+	"join rhnerrata e on e.id = ce.errata_id " +
+	"where e.advisory_name = any($1) " +
+	"order by c.label"
+
+// advisoryCrawlerStarts returns the rows the export of the advisories starts from: the errata,
+// their links to their channels and the links of their packages to these channels
+func advisoryCrawlerStarts(schemaMetadata map[string]schemareader.Table, advisories []string) []dumper.CrawlerStart {
+	quotedAdvisories := make([]string, 0, len(advisories))
+	for _, advisory := range advisories {
+		quotedAdvisories = append(quotedAdvisories, pq.QuoteLiteral(advisory))
+	}
+	advisoryFilter := fmt.Sprintf("advisory_name IN (%s)", strings.Join(quotedAdvisories, ", "))
+	return []dumper.CrawlerStart{
+		{Table: schemaMetadata["rhnerrata"], QueryFilter: advisoryFilter},
+		{Table: schemaMetadata["rhnchannelerrata"],
+			QueryFilter: fmt.Sprintf("errata_id IN (SELECT id FROM rhnerrata WHERE %s)", advisoryFilter)},
+		{Table: schemaMetadata["rhnchannelpackage"],
+			QueryFilter: fmt.Sprintf("(channel_id, package_id) IN (SELECT ce.channel_id, ep.package_id FROM rhnchannelerrata ce "+
+				"JOIN rhnerratapackage ep ON ep.errata_id = ce.errata_id "+
+				"JOIN rhnerrata e ON e.id = ce.errata_id WHERE e.%s)", advisoryFilter)},
+	}
+}
+
+// advisorySchemaMetadata returns the schema to crawl the advisories with: the rows referencing the channels
+// are not followed, so only the channel rows are exported and not the whole channel content
+func advisorySchemaMetadata(schemaMetadata map[string]schemareader.Table) map[string]schemareader.Table {
+	result := make(map[string]schemareader.Table, len(schemaMetadata))
+	for name, table := range schemaMetadata {
+		result[name] = table
+	}
+	channel := result["rhnchannel"]
+	channel.ReferencedBy = make([]schemareader.Reference, 0)
+	result["rhnchannel"] = channel
+	return result
+}
+
+// processAdvisories exports the given advisories with their packages and the channels they belong to.
+// Nothing is cleaned on the target: the other errata and packages of the channels are kept.
+func processAdvisories(db *sql.DB, writer *bufio.Writer, options DumperOptions) {
+	for _, advisory := range options.Advisories {
+		if len(sqlUtil.ExecuteQueryWithResults(db, singleAdvisorySql, advisory)) == 0 {
+			log.Fatal().Msgf("Advisory not found: %s", advisory)
+		}
+	}
+	log.Info().Msgf("%d advisories to process", len(options.Advisories))
+
+	schemaMetadata := readChannelTablesSchema(db, options, "rhnchannel", "rhnerrata", "rhnchannelerrata", "rhnchannelpackage")
+	prepareSchemaMetadata(db, schemaMetadata, options)
+
+	tableData := dumper.DataCrawlerFrom(db, advisorySchemaMetadata(schemaMetadata),
+		advisoryCrawlerStarts(schemaMetadata, options.Advisories), options.StartingDate, options.dependencyTrace)
+
+	printOptions := printSqlOptions(options)
+	printOptions.OnlyIfParentExistsTables = onlyIfParentExistsTables
+	dumper.PrintTableDataOrdered(db, writer, schemaMetadata, schemaMetadata["rhnchannel"], tableData, printOptions)
+
+	fileAdvisories, err := os.Create(options.GetOutputFolderAbsPath() + "/exportedAdvisories.txt")
+	if err != nil {
+		log.Panic().Err(err).Msg("error creating exported advisories file")
+	}
+	defer fileAdvisories.Close()
+	for _, advisory := range options.Advisories {
+		fileAdvisories.WriteString(advisory + "\n")
+	}
+
+	for _, row := range sqlUtil.ExecuteQueryWithResults(db, advisoryChannelsSql, pq.Array(options.Advisories)) {
+		generateCacheCalculation(fmt.Sprintf("%v", row[0].Value), writer)
+	}
+	writeSequenceValues(db, writer, schemaMetadata, options)
+
+	if !options.MetadataOnly {
+		log.Debug().Msg("dumping all package files")
+		packageDumper.DumpPackageFiles(db, schemaMetadata, tableData, options.GetOutputFolderAbsPath())
+	}
+	log.Debug().Msg("advisories export finished")
+}
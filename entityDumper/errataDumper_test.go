@@ -0,0 +1,67 @@
+package entityDumper
+
+import (
+	"testing"
+
+	"github.com/uyuni-project/inter-server-sync/dumper"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/tests"
+)
+
+func TestAdvisoryCrawlDoesNotExportTheChannelContent(t *testing.T) {
+
+	// Arrange
+	repo := tests.CreateDataRepository()
+	reference := func(tableName string, column string) schemareader.Reference {
+		return schemareader.Reference{TableName: tableName, ColumnMapping: map[string]string{column: "id"}}
+	}
+	linkTable := func(name string, columns ...string) schemareader.Table {
+		return schemareader.Table{Name: name, Export: true, Columns: columns,
+			ColumnIndexes: map[string]int{columns[0]: 0, columns[1]: 1},
+			PKColumns:     map[string]bool{columns[0]: true, columns[1]: true}}
+	}
+	idTable := func(name string, referencedBy ...schemareader.Reference) schemareader.Table {
+		return schemareader.Table{Name: name, Export: true, Columns: []string{"id"},
+			ColumnIndexes: map[string]int{"id": 0}, PKColumns: map[string]bool{"id": true}, ReferencedBy: referencedBy}
+	}
+	channelErrata := linkTable("rhnchannelerrata", "channel_id", "errata_id")
+	channelErrata.References = []schemareader.Reference{reference("rhnchannel", "channel_id"), reference("rhnerrata", "errata_id")}
+	channelPackage := linkTable("rhnchannelpackage", "channel_id", "package_id")
+	channelPackage.References = []schemareader.Reference{reference("rhnchannel", "channel_id"), reference("rhnpackage", "package_id")}
+	schemaMetadata := map[string]schemareader.Table{
+		"rhnerrata":         idTable("rhnerrata", reference("rhnchannelerrata", "errata_id")),
+		"rhnchannel":        idTable("rhnchannel", reference("rhnchannelerrata", "channel_id"), reference("rhnchannelpackage", "channel_id")),
+		"rhnpackage":        idTable("rhnpackage"),
+		"rhnchannelerrata":  channelErrata,
+		"rhnchannelpackage": channelPackage,
+	}
+
+	advisoryFilter := "advisory_name IN ('SUSE-2021-1234')"
+	repo.Expect("SELECT id FROM rhnerrata WHERE "+advisoryFilter+" ORDER BY id ;", []string{"id"}, 1)
+	repo.Expect("SELECT channel_id, errata_id FROM rhnchannelerrata WHERE errata_id IN (SELECT id FROM rhnerrata WHERE "+advisoryFilter+") ORDER BY channel_id, errata_id ;",
+		channelErrata.Columns, 1)
+	repo.Expect("SELECT channel_id, package_id FROM rhnchannelpackage WHERE (channel_id, package_id) IN "+
+		"(SELECT ce.channel_id, ep.package_id FROM rhnchannelerrata ce JOIN rhnerratapackage ep ON ep.errata_id = ce.errata_id "+
+		"JOIN rhnerrata e ON e.id = ce.errata_id WHERE e."+advisoryFilter+") ORDER BY channel_id, package_id ;", channelPackage.Columns, 1)
+	repo.Expect("SELECT id FROM rhnchannel WHERE id = $1 ORDER BY id;", []string{"id"}, 1, "0001")
+	repo.Expect("SELECT id FROM rhnpackage WHERE id = $1 ORDER BY id;", []string{"id"}, 1, "0001")
+	repo.Expect("SELECT id FROM rhnchannel WHERE id = $1 ORDER BY id;", []string{"id"}, 1, "0001")
+	repo.Expect("SELECT id FROM rhnerrata WHERE id = $1 ORDER BY id;", []string{"id"}, 1, "0001")
+
+	// Act
+	data := dumper.DataCrawlerFrom(repo.DB, advisorySchemaMetadata(schemaMetadata),
+		advisoryCrawlerStarts(schemaMetadata, []string{"SUSE-2021-1234"}), "", nil)
+
+	// Assert
+	for _, tableName := range []string{"rhnerrata", "rhnchannelerrata", "rhnchannelpackage", "rhnchannel", "rhnpackage"} {
+		if len(data.TableData[tableName].Keys) != 1 {
+			t.Errorf("Expected one row of %s, got %d", tableName, len(data.TableData[tableName].Keys))
+		}
+	}
+	if len(schemaMetadata["rhnchannel"].ReferencedBy) != 2 {
+		t.Errorf("The schema of the channel tables should not be changed")
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
@@ -100,9 +100,9 @@ func dumpImageStores(db *sql.DB, writer *bufio.Writer, schemaMetadata map[string
 		for _, store := range stores {
 			log.Trace().Msgf("Exporting store id %s", store[0].Value)
 			whereClause := fmt.Sprintf("id = '%s'", store[0].Value)
-			tableProfilesData := dumper.DataCrawler(db, schemaMetadata, schemaMetadata["suseimagestore"], whereClause, options.StartingDate)
+			tableProfilesData := dumper.DataCrawler(db, schemaMetadata, schemaMetadata["suseimagestore"], whereClause, options.StartingDate, options.dependencyTrace)
 
-			dumper.PrintTableDataOrdered(db, writer, schemaMetadata, schemaMetadata["suseimagestore"], tableProfilesData, dumper.PrintSqlOptions{})
+			dumper.PrintTableDataOrdered(db, writer, schemaMetadata, schemaMetadata["suseimagestore"], tableProfilesData, printSqlOptions(options))
 		}
 	}
 	// Mark tables as exported so they are not transitively exported by profiles
@@ -130,9 +130,9 @@ func dumpOSImageTables(db *sql.DB, writer *bufio.Writer, schemaMetadata map[stri
 		for _, profile := range profiles {
 			log.Trace().Msgf("Exporting profile id %s", profile[0].Value)
 			whereClause := fmt.Sprintf("profile_id = '%s'", profile[0].Value)
-			tableProfilesData := dumper.DataCrawler(db, schemaMetadata, schemaMetadata["susekiwiprofile"], whereClause, options.StartingDate)
+			tableProfilesData := dumper.DataCrawler(db, schemaMetadata, schemaMetadata["susekiwiprofile"], whereClause, options.StartingDate, options.dependencyTrace)
 
-			dumper.PrintTableDataOrdered(db, writer, schemaMetadata, schemaMetadata["susekiwiprofile"], tableProfilesData, dumper.PrintSqlOptions{})
+			dumper.PrintTableDataOrdered(db, writer, schemaMetadata, schemaMetadata["susekiwiprofile"], tableProfilesData, printSqlOptions(options))
 		}
 		// Mark tables as exported so they are not transitively exported by images
 		markAsExported(schemaMetadata, []string{"suseimageprofile"})
@@ -159,8 +159,8 @@ func dumpOSImageTables(db *sql.DB, writer *bufio.Writer, schemaMetadata map[stri
 		for _, image := range images {
 			log.Trace().Msgf("Exporting image id %s", image[0].Value)
 			whereClause := fmt.Sprintf("id = '%s'", image[0].Value)
-			tableImageData := dumper.DataCrawler(db, schemaMetadata, schemaMetadata["suseimageinfo"], whereClause, options.StartingDate)
-			dumper.PrintTableDataOrdered(db, writer, schemaMetadata, schemaMetadata["suseimageinfo"], tableImageData, dumper.PrintSqlOptions{})
+			tableImageData := dumper.DataCrawler(db, schemaMetadata, schemaMetadata["suseimageinfo"], whereClause, options.StartingDate, options.dependencyTrace)
+			dumper.PrintTableDataOrdered(db, writer, schemaMetadata, schemaMetadata["suseimageinfo"], tableImageData, printSqlOptions(options))
 			// Check if pillars are already in database
 			if _, ok := tableImageData.TableData["susesaltpillar"]; ok && !options.MetadataOnly {
 				// pillars in database, files must be as well
@@ -206,9 +206,9 @@ func dumpContainerImageTables(db *sql.DB, writer *bufio.Writer, schemaMetadata m
 		for _, profile := range profiles {
 			log.Trace().Msgf("Exporting profile id %s", profile[0].Value)
 			whereClause := fmt.Sprintf("profile_id = '%s'", profile[0].Value)
-			tableProfilesData := dumper.DataCrawler(db, schemaMetadata, schemaMetadata["susedockerfileprofile"], whereClause, options.StartingDate)
+			tableProfilesData := dumper.DataCrawler(db, schemaMetadata, schemaMetadata["susedockerfileprofile"], whereClause, options.StartingDate, options.dependencyTrace)
 
-			dumper.PrintTableDataOrdered(db, writer, schemaMetadata, schemaMetadata["susedockerfileprofile"], tableProfilesData, dumper.PrintSqlOptions{})
+			dumper.PrintTableDataOrdered(db, writer, schemaMetadata, schemaMetadata["susedockerfileprofile"], tableProfilesData, printSqlOptions(options))
 		}
 		markAsExported(schemaMetadata, []string{"suseimageprofile"})
 	} else {
@@ -230,8 +230,8 @@ func dumpContainerImageTables(db *sql.DB, writer *bufio.Writer, schemaMetadata m
 		for _, image := range images {
 			log.Trace().Msgf("Exporting image id %s", image[0].Value)
 			whereClause := fmt.Sprintf("id = '%s'", image[0].Value)
-			tableImageData := dumper.DataCrawler(db, schemaMetadata, schemaMetadata["suseimageinfo"], whereClause, options.StartingDate)
-			dumper.PrintTableDataOrdered(db, writer, schemaMetadata, schemaMetadata["suseimageinfo"], tableImageData, dumper.PrintSqlOptions{})
+			tableImageData := dumper.DataCrawler(db, schemaMetadata, schemaMetadata["suseimageinfo"], whereClause, options.StartingDate, options.dependencyTrace)
+			dumper.PrintTableDataOrdered(db, writer, schemaMetadata, schemaMetadata["suseimageinfo"], tableImageData, printSqlOptions(options))
 		}
 	}
 
@@ -245,7 +245,8 @@ func dumpImageData(db *sql.DB, writer *bufio.Writer, options DumperOptions) {
 
 	// export DB data about images
 	log.Trace().Msg("Loading table schema")
-	schemaMetadata := schemareader.ReadTablesSchema(db, imagesTableNames)
+	schemaMetadata := readTablesSchema(db, "images", imagesTableNames, options)
+	prepareSchemaMetadata(db, schemaMetadata, options)
 
 	if options.OSImages {
 		var outputFolderImagesAbs = filepath.Join(outputFolderAbs, "images")
@@ -266,4 +267,5 @@ func dumpImageData(db *sql.DB, writer *bufio.Writer, options DumperOptions) {
 		dumpImageStores(db, writer, schemaMetadata, options, "registry")
 		dumpContainerImageTables(db, writer, schemaMetadata, options)
 	}
+	writeSequenceValues(db, writer, schemaMetadata, options)
 }
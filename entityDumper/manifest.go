@@ -0,0 +1,115 @@
+package entityDumper
+
+import (
+	"compress/gzip"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog/log"
+	"github.com/uyuni-project/inter-server-sync/dumper"
+)
+
+const manifestFileName = "manifest.txt"
+
+// ImportVerificationFile holds the conditions matching the exported rows on the target, written with --importVerification
+const ImportVerificationFile = "import_verification.txt.gz"
+
+// WriteManifest writes the number of rows and the checksum of each table of the generated dump,
+// for the import to check the dump was transferred intact, with the provenance of the tables collected by the export
+func WriteManifest(options DumperOptions) {
+	entries, err := computeDumpManifest(options.GetOutputFolderAbsPath())
+	if err != nil {
+		log.Panic().Err(err).Msg("error computing the dump manifest")
+	}
+	dumper.AddManifestProvenance(entries, options.Provenance)
+
+	file, err := os.Create(filepath.Join(options.GetOutputFolderAbsPath(), manifestFileName))
+	if err != nil {
+		log.Panic().Err(err).Msg("error creating manifest file")
+	}
+	defer file.Close()
+	if err := dumper.WriteManifest(file, entries); err != nil {
+		log.Panic().Err(err).Msg("error writing manifest file")
+	}
+}
+
+// VerifyManifest compares the dump of the import directory with the manifest written by the export.
+// It returns the found differences.
+func VerifyManifest(absImportDir string) ([]string, error) {
+	file, err := os.Open(filepath.Join(absImportDir, manifestFileName))
+	if err != nil {
+		return nil, fmt.Errorf("opening the manifest: %w", err)
+	}
+	defer file.Close()
+	expected, err := dumper.ReadManifest(file)
+	if err != nil {
+		return nil, err
+	}
+
+	actual, err := computeDumpManifest(absImportDir)
+	if err != nil {
+		return nil, err
+	}
+	return dumper.CompareManifests(expected, actual), nil
+}
+
+// ReadManifest returns the entries of the manifest of the directory, written by the export
+func ReadManifest(absDir string) ([]dumper.ManifestEntry, error) {
+	file, err := os.Open(filepath.Join(absDir, manifestFileName))
+	if err != nil {
+		return nil, fmt.Errorf("opening the manifest: %w", err)
+	}
+	defer file.Close()
+	return dumper.ReadManifest(file)
+}
+
+// ReadPartialTables returns the tables of the manifest of the import directory whose rows may not all have been
+// exported, because of a row limit or a date cutoff. An import directory without manifest has none.
+func ReadPartialTables(absImportDir string) ([]string, error) {
+	file, err := os.Open(filepath.Join(absImportDir, manifestFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening the manifest: %w", err)
+	}
+	defer file.Close()
+	entries, err := dumper.ReadManifest(file)
+	if err != nil {
+		return nil, err
+	}
+	return dumper.PartialTables(entries), nil
+}
+
+// VerifyImportedRows counts the distinct rows of the import verification of the directory found in the database after
+// the import. It returns the counts per table and the tables without all their rows found, like the ones with rows
+// which failed to be inserted or were skipped on the target.
+func VerifyImportedRows(db *sql.DB, absImportDir string) (map[string]dumper.ImportedRows, []string, error) {
+	verificationFile, err := os.Open(filepath.Join(absImportDir, ImportVerificationFile))
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening the import verification, the export has to be done with --importVerification: %w", err)
+	}
+	defer verificationFile.Close()
+	verification, err := gzip.NewReader(verificationFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading the import verification: %w", err)
+	}
+	counts, err := dumper.CountImportedRows(db, verification)
+	if err != nil {
+		return nil, nil, err
+	}
+	return counts, dumper.CompareImportedRows(counts), nil
+}
+
+// computeDumpManifest computes the manifest of the dump of the directory, compressed or not
+func computeDumpManifest(dir string) ([]dumper.ManifestEntry, error) {
+	statements, err := OpenSqlStatements(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer statements.Close()
+	return dumper.ComputeManifest(statements)
+}
@@ -1,6 +1,7 @@
 package entityDumper
 
 import (
+	"github.com/uyuni-project/inter-server-sync/dumper"
 	"github.com/uyuni-project/inter-server-sync/utils"
 )
 
@@ -9,6 +10,8 @@ type DumperOptions struct {
 	ChannelLabels             []string
 	ConfigLabels              []string
 	ChannelWithChildrenLabels []string
+	ChannelFamilyLabels       []string
+	Advisories                []string
 	OutputFolder              string
 	outputFolderAbsPath       string
 	MetadataOnly              bool
@@ -16,6 +19,47 @@ type DumperOptions struct {
 	Containers                bool
 	OSImages                  bool
 	Orgs                      []uint
+	IdOnlyStrategy            string
+	RowChecksums              bool
+	PageSize                  int
+	Tables                    []string
+	ExcludeTables             []string
+	IncludeColumns            []string
+	ExcludeColumns            []string
+	DefaultColumns            []string
+	AssumePresentTables       []string
+	TableStats                bool
+	RowKeys                   bool
+	ReplaceByLabelTables      []string
+	DictionaryTables          []string
+	MainIndexColumns          map[string]string
+	ReferenceIndexes          map[string]string
+	ReferenceIdMaps           []string
+	TargetDatabaseURL         string
+	CopyTables                []string
+	UndoScript                bool
+	CleanupScript             bool
+	ImportVerification        bool
+	SkipSecondaryConflicts    bool
+	ErrataDeltaFrom           string
+	ErrataDeltaDeletes        bool
+	SchemaCacheDir            string
+	SequenceValues            bool
+	ModifiedSince             string
+	RowLimits                 map[string]int
+	RowFilters                []string
+	CheckOrphans              bool
+	SkipOrphans               bool
+	Snapshot                  bool
+	DependencyTrace           bool
+	InsertBatchSize           int
+	Provenance                *dumper.ExportProvenance
+	errataDelta               *dumper.AssociationDelta
+	undoScript                *dumper.UndoScript
+	cleanupScript             *dumper.CleanupScript
+	importVerification        *dumper.ImportVerification
+	dependencyTrace           *dumper.DependencyTrace
+	referenceIdMaps           *dumper.ReferenceIdMaps
 }
 
 func (opt *DumperOptions) GetOutputFolderAbsPath() string {
@@ -0,0 +1,210 @@
+package schemareader
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// schemaBatch holds the columns and references of several tables read at once
+// to avoid one round-trip per table and per constraint.
+type schemaBatch struct {
+	requested    map[string]bool
+	columns      map[string][]Column
+	references   map[string][]Reference
+	referencedBy map[string][]Reference
+}
+
+func (batch *schemaBatch) contains(tableName string) bool {
+	return batch != nil && batch.requested[tableName]
+}
+
+// checkTablesExist returns an error listing all the requested tables without any readable column,
+// instead of reading them as tables without columns. With ContinueOnTableErrors they are skipped instead.
+func (batch *schemaBatch) checkTablesExist(ctx context.Context, schema string, skipped *TableErrors) error {
+	missing := batch.missingTables()
+	if len(missing) == 0 {
+		return nil
+	}
+	notSkipped := make([]string, 0, len(missing))
+	for _, tableName := range missing {
+		if !skipped.skipTable(ctx, tableName, fmt.Errorf("missing from the %s schema", schema)) {
+			notSkipped = append(notSkipped, tableName)
+		}
+	}
+	if len(notSkipped) == 0 {
+		return nil
+	}
+	return fmt.Errorf("tables missing from the %s schema: %s", schema, strings.Join(notSkipped, ", "))
+}
+
+// missingTables returns the sorted requested tables without any readable column
+func (batch *schemaBatch) missingTables() []string {
+	missing := make([]string, 0)
+	for tableName := range batch.requested {
+		if len(batch.columns[tableName]) == 0 {
+			missing = append(missing, tableName)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+func readSchemaBatch(ctx context.Context, db *sql.DB, schema string, tableNames []string) (*schemaBatch, error) {
+	batch := &schemaBatch{
+		requested:    make(map[string]bool),
+		columns:      make(map[string][]Column),
+		references:   make(map[string][]Reference),
+		referencedBy: make(map[string][]Reference),
+	}
+	for _, tableName := range tableNames {
+		batch.requested[tableName] = true
+	}
+	if err := readBatchColumnNames(ctx, db, schema, tableNames, batch); err != nil {
+		return nil, err
+	}
+	if err := checkBatchInheritance(ctx, db, schema, tableNames); err != nil {
+		return nil, err
+	}
+	if err := readBatchReferences(ctx, db, schema, tableNames, batch); err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+func readBatchColumnNames(ctx context.Context, db *sql.DB, schema string, tableNames []string, batch *schemaBatch) error {
+	sql := ReadBatchColumnNames
+
+	rows, cancel, err := queryContext(ctx, db, sql, pq.Array(tableNames), schema)
+	if err != nil {
+		return fmt.Errorf("reading columns for %v with %q: %w", tableNames, sql, err)
+	}
+	defer cancel()
+	defer rows.Close()
+
+	for rows.Next() {
+		var tableName string
+		var column Column
+		err := rows.Scan(&tableName, &column.Name, &column.DataType, &column.IsNullable, &column.ColumnDefault)
+		if err != nil {
+			return fmt.Errorf("reading columns for %v: %w", tableNames, err)
+		}
+		batch.columns[tableName] = append(batch.columns[tableName], column)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("reading columns for %v: %w", tableNames, err)
+	}
+	return nil
+}
+
+// checkBatchInheritance returns an error listing the partitioned tables and the tables with inheritance.
+// Their rows are spread over the parent and child tables and the keys and indexes of the parent don't apply
+// to the children: exporting them would silently give a wrong or empty picture.
+func checkBatchInheritance(ctx context.Context, db *sql.DB, schema string, tableNames []string) error {
+	sql := `SELECT c.relname, EXISTS (SELECT 1 FROM pg_partitioned_table p WHERE p.partrelid = c.oid)
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $2 AND c.relname = ANY($1)
+			AND (EXISTS (SELECT 1 FROM pg_partitioned_table p WHERE p.partrelid = c.oid)
+				OR EXISTS (SELECT 1 FROM pg_inherits i WHERE i.inhrelid = c.oid OR i.inhparent = c.oid))
+		ORDER BY c.relname;`
+
+	rows, cancel, err := queryContext(ctx, db, sql, pq.Array(tableNames), schema)
+	if err != nil {
+		return fmt.Errorf("reading inheritance for %v with %q: %w", tableNames, sql, err)
+	}
+	defer cancel()
+	defer rows.Close()
+
+	unsupported := make([]string, 0)
+	for rows.Next() {
+		var tableName string
+		var partitioned bool
+		if err := rows.Scan(&tableName, &partitioned); err != nil {
+			return fmt.Errorf("reading inheritance for %v: %w", tableNames, err)
+		}
+		if partitioned {
+			unsupported = append(unsupported, tableName+" (partitioned)")
+		} else {
+			unsupported = append(unsupported, tableName+" (inheritance)")
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("reading inheritance for %v: %w", tableNames, err)
+	}
+	if len(unsupported) > 0 {
+		return fmt.Errorf("partitioned and inherited tables are not supported for export: %s", strings.Join(unsupported, ", "))
+	}
+	return nil
+}
+
+// readBatchReferences reads the foreign keys from and to the tables, with their columns paired by constraint position
+func readBatchReferences(ctx context.Context, db *sql.DB, schema string, tableNames []string, batch *schemaBatch) error {
+	sql := `SELECT c.conname, cl.relname, fcl.relname, a.attname, af.attname, c.condeferrable
+		FROM pg_constraint c
+		JOIN pg_class cl ON cl.oid = c.conrelid
+		JOIN pg_class fcl ON fcl.oid = c.confrelid
+		JOIN pg_namespace n ON n.oid = c.connamespace
+		CROSS JOIN LATERAL unnest(c.conkey, c.confkey) AS k(attnum, foreign_attnum)
+		JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = k.attnum
+		JOIN pg_attribute af ON af.attrelid = c.confrelid AND af.attnum = k.foreign_attnum
+		WHERE c.contype = 'f' AND n.nspname = $2
+			AND (cl.relname = ANY($1) OR fcl.relname = ANY($1))
+		ORDER BY c.conname;`
+
+	rows, cancel, err := queryContext(ctx, db, sql, pq.Array(tableNames), schema)
+	if err != nil {
+		return fmt.Errorf("reading foreign keys for %v with %q: %w", tableNames, sql, err)
+	}
+	defer cancel()
+	defer rows.Close()
+
+	type constraintKey struct {
+		name      string
+		tableName string
+	}
+	constraints := make([]constraintKey, 0)
+	foreignTables := make(map[constraintKey]string)
+	columnMappings := make(map[constraintKey]map[string]string)
+	deferrables := make(map[constraintKey]bool)
+	for rows.Next() {
+		var constraintName, tableName, foreignTableName, columnName, foreignColumnName string
+		var deferrable bool
+		err := rows.Scan(&constraintName, &tableName, &foreignTableName, &columnName, &foreignColumnName, &deferrable)
+		if err != nil {
+			return fmt.Errorf("reading foreign keys for %v: %w", tableNames, err)
+		}
+		key := constraintKey{constraintName, tableName}
+		if _, ok := columnMappings[key]; !ok {
+			constraints = append(constraints, key)
+			foreignTables[key] = foreignTableName
+			columnMappings[key] = make(map[string]string)
+			deferrables[key] = deferrable
+		}
+		columnMappings[key][columnName] = foreignColumnName
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("reading foreign keys for %v: %w", tableNames, err)
+	}
+
+	for _, key := range constraints {
+		foreignTableName := foreignTables[key]
+		if batch.requested[key.tableName] {
+			batch.references[key.tableName] = append(batch.references[key.tableName],
+				Reference{TableName: foreignTableName, ColumnMapping: columnMappings[key], Deferrable: deferrables[key]})
+		}
+		if batch.requested[foreignTableName] {
+			columnMapping := make(map[string]string)
+			for column, foreignColumn := range columnMappings[key] {
+				columnMapping[column] = foreignColumn
+			}
+			batch.referencedBy[foreignTableName] = append(batch.referencedBy[foreignTableName],
+				Reference{TableName: key.tableName, ColumnMapping: columnMapping, Deferrable: deferrables[key]})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package schemareader
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/uyuni-project/inter-server-sync/tests"
+)
+
+// seedSchema expects the queries reading a schema of tables each referencing the previous ones: the table i has an id
+// primary key, a unique name and a column referencing each of the references tables before it
+func seedSchema(repo *tests.DataRepository, tables int, references int) []string {
+	tableNames := make([]string, tables)
+	for i := range tableNames {
+		tableNames[i] = fmt.Sprintf("table%04d", i)
+	}
+	columns := batchColumnRows()
+	foreignKeys := sqlmock.NewRows([]string{"conname", "relname", "relname", "attname", "attname", "condeferrable"})
+	for i, tableName := range tableNames {
+		columns.AddRow(tableName, "id", "numeric", false, "").AddRow(tableName, "name", "character varying", false, "")
+		for j := 1; j <= references && j <= i; j++ {
+			referenced := tableNames[i-j]
+			column := referenced + "_id"
+			columns.AddRow(tableName, column, "numeric", true, "")
+			foreignKeys.AddRow(tableName+"_"+column+"_fk", tableName, referenced, column, "id", false)
+		}
+	}
+	repo.ExpectWithRecords(ReadBatchColumnNames, columns, pq.Array(tableNames), DefaultSchemaName)
+	repo.ExpectWithRecords(ReadBatchInheritance, inheritanceRows(), pq.Array(tableNames), DefaultSchemaName)
+	repo.ExpectWithRecords(ReadBatchReferences, foreignKeys, pq.Array(tableNames), DefaultSchemaName)
+	for _, tableName := range tableNames {
+		repo.ExpectWithRecords(ReadIndexes,
+			indexRows().AddRow(tableName+"_pk", true, "{id}", "").AddRow(tableName+"_name_uq", false, "{name}", ""),
+			tableName, DefaultSchemaName)
+		repo.ExpectWithRecords(ReadPkSequence, sequenceRows().AddRow(tableName+"_id_seq", "id"), tableName, DefaultSchemaName)
+	}
+	return tableNames
+}
+
+// TestReadTablesSchemaQueryCount checks the schema is read with a constant number of queries for the whole batch
+// and per table, whatever the number of references between the tables
+func TestReadTablesSchemaQueryCount(t *testing.T) {
+	for _, references := range []int{0, 1, 4} {
+		// Arrange
+		repo := tests.CreateDataRepository()
+		tableNames := seedSchema(repo, 20, references)
+		stats := &QueryStats{}
+		SetQueryHook(stats.Record)
+
+		// Act
+		tables, err := ReadTablesSchema(repo.DB, tableNames)
+		SetQueryHook(nil)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Unexpected error reading the schema: %s", err)
+		}
+		if len(tables) != len(tableNames) || len(tables["table0019"].References) != references {
+			t.Errorf("Schema with %d references per table was not read: got %v", references, tables["table0019"])
+		}
+		if expected := 3 + 2*len(tableNames); stats.Queries() != expected {
+			t.Errorf("Expected %d queries with %d references per table, got %d", expected, references, stats.Queries())
+		}
+		if err := repo.ExpectationsWereMet(); err != nil {
+			t.Errorf("Schema was not read. Error message: %s", err)
+		}
+	}
+}
+
+// BenchmarkReadTablesSchema measures reading seeded schemas of a growing number of tables and references.
+// The mocked database answers at once, so the time is the cost of the reader itself, and the queries are
+// expected in order, so the tables are read by a single worker. The queries/table metric shows the queries
+// added by each table.
+func BenchmarkReadTablesSchema(b *testing.B) {
+	for _, tables := range []int{10, 100, 1000} {
+		for _, references := range []int{0, 1, 4} {
+			b.Run(fmt.Sprintf("tables=%d/references=%d", tables, references), func(b *testing.B) {
+				stats := &QueryStats{}
+				SetQueryHook(stats.Record)
+				defer SetQueryHook(nil)
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					b.StopTimer()
+					repo := tests.CreateDataRepository()
+					tableNames := seedSchema(repo, tables, references)
+					b.StartTimer()
+
+					if _, err := ReadTablesSchema(repo.DB, tableNames); err != nil {
+						b.Fatalf("Unexpected error reading the schema: %s", err)
+					}
+
+					b.StopTimer()
+					if err := repo.ExpectationsWereMet(); err != nil {
+						b.Fatalf("Schema was not read. Error message: %s", err)
+					}
+					repo.DB.Close()
+					b.StartTimer()
+				}
+				b.ReportMetric(float64(stats.Queries())/float64(b.N), "queries/op")
+				b.ReportMetric(float64(stats.Queries())/float64(b.N*tables), "queries/table")
+			})
+		}
+	}
+}
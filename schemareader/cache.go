@@ -0,0 +1,91 @@
+package schemareader
+
+import (
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// schemaCacheVersion is the format of the cached tables, to increase when the Table fields change
+// for the caches written by previous versions not to be reused
+const schemaCacheVersion = 1
+
+// schemaCache is the content of a schema cache file
+type schemaCache struct {
+	Fingerprint string
+	Tables      map[string]Table
+}
+
+// ReadSchemaFingerprint identifies the current schema by its version and a hash of its columns,
+// so a cache written before a migration is not reused
+func ReadSchemaFingerprint(db *sql.DB) (string, error) {
+	return ReadSchemaFingerprintInSchema(db, DefaultSchemaName)
+}
+
+// ReadSchemaFingerprintInSchema is ReadSchemaFingerprint hashing the columns of the given database schema, public if empty
+func ReadSchemaFingerprintInSchema(db *sql.DB, schema string) (string, error) {
+	if schema == "" {
+		schema = DefaultSchemaName
+	}
+	version, err := ReadSchemaVersion(db)
+	if err != nil {
+		return "", err
+	}
+	// the type modifiers are part of the cached columns: a longer varchar changes the fingerprint
+	sql := `SELECT md5(string_agg(c.table_name || '.' || c.column_name || ':' || format_type(a.atttypid, a.atttypmod), ','
+			ORDER BY c.table_name, c.ordinal_position))
+		FROM information_schema.columns c
+		JOIN pg_namespace n ON n.nspname = c.table_schema
+		JOIN pg_class cl ON cl.relnamespace = n.oid AND cl.relname = c.table_name
+		JOIN pg_attribute a ON a.attrelid = cl.oid AND a.attname = c.column_name
+		WHERE c.table_schema = $1;`
+	hash, err := readString(context.Background(), db, sql, schema)
+	if err != nil {
+		return "", fmt.Errorf("reading the schema hash: %w", err)
+	}
+	return version + ":" + hash, nil
+}
+
+// SchemaCacheKey identifies the cache of the tables read from the schema of the fingerprint: the cache is only reused
+// for the same tables of the same schema, written in the current format
+func SchemaCacheKey(fingerprint string, tableNames []string) string {
+	sortedNames := append([]string{}, tableNames...)
+	sort.Strings(sortedNames)
+	hash := md5.Sum([]byte(strings.Join(sortedNames, ",")))
+	return fmt.Sprintf("v%d:%s:%s", schemaCacheVersion, fingerprint, hex.EncodeToString(hash[:]))
+}
+
+// WriteSchemaCache saves the tables read from the schema identified by the cache key
+func WriteSchemaCache(tables map[string]Table, key string, path string) error {
+	data, err := json.Marshal(schemaCache{Fingerprint: key, Tables: tables})
+	if err != nil {
+		return fmt.Errorf("encoding the schema cache: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0640); err != nil {
+		return fmt.Errorf("writing the schema cache %s: %w", path, err)
+	}
+	return nil
+}
+
+// LoadSchemaCache reads the tables saved in the cache file.
+// An error is returned if the cache was written for other tables or schema than the ones identified by the cache key.
+func LoadSchemaCache(path string, key string) (map[string]Table, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading the schema cache %s: %w", path, err)
+	}
+	var cache schemaCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, fmt.Errorf("decoding the schema cache %s: %w", path, err)
+	}
+	if cache.Fingerprint != key {
+		return nil, fmt.Errorf("schema cache %s is stale: written for %s, expected %s", path, cache.Fingerprint, key)
+	}
+	return cache.Tables, nil
+}
@@ -0,0 +1,98 @@
+package schemareader
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/uyuni-project/inter-server-sync/tests"
+)
+
+func TestSchemaCache(t *testing.T) {
+
+	// Arrange
+	tables := map[string]Table{
+		"child": {
+			Name:                "child",
+			Export:              true,
+			Columns:             []string{"id", "label", "parent_id"},
+			ColumnIndexes:       map[string]int{"id": 0, "label": 1, "parent_id": 2},
+			PKColumns:           map[string]bool{"id": true},
+			PKSequence:          "child_id_seq",
+			UniqueIndexes:       map[string]UniqueIndex{"child_label_uq": {Name: "child_label_uq", Columns: []string{"label"}}},
+			MainUniqueIndexName: "child_label_uq",
+			References:          []Reference{{TableName: "parent", ColumnMapping: map[string]string{"parent_id": "id"}}},
+			ReferencedBy:        []Reference{},
+		},
+	}
+	path := filepath.Join(t.TempDir(), "schema.json")
+
+	// Act
+	err := WriteSchemaCache(tables, "susemanager-schema-4.3:abc", path)
+	if err != nil {
+		t.Fatalf("Unexpected error writing the cache: %s", err)
+	}
+	loaded, err := LoadSchemaCache(path, "susemanager-schema-4.3:abc")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error loading the cache: %s", err)
+	}
+	if !reflect.DeepEqual(loaded, tables) {
+		t.Errorf("Cached tables do not match: expected %v, got %v", tables, loaded)
+	}
+	if _, err := LoadSchemaCache(path, "susemanager-schema-4.3:def"); err == nil {
+		t.Errorf("Cache of another schema should be rejected")
+	}
+}
+
+func TestSchemaCacheKey(t *testing.T) {
+
+	// Arrange
+	fingerprint := "susemanager-schema-4.3:abc"
+
+	// Act
+	key := SchemaCacheKey(fingerprint, []string{"rhnchannel", "rhnerrata"})
+
+	// Assert
+	if SchemaCacheKey(fingerprint, []string{"rhnerrata", "rhnchannel"}) != key {
+		t.Errorf("The order of the tables should not change the cache key")
+	}
+	if SchemaCacheKey(fingerprint, []string{"rhnchannel", "rhnerrata", "rhnpackage"}) == key {
+		t.Errorf("Other tables should change the cache key")
+	}
+	if SchemaCacheKey("susemanager-schema-4.3:def", []string{"rhnchannel", "rhnerrata"}) == key {
+		t.Errorf("Another schema should change the cache key")
+	}
+	if !strings.HasPrefix(key, fmt.Sprintf("v%d:", schemaCacheVersion)) {
+		t.Errorf("The cache key should have the cache format version, got %s", key)
+	}
+}
+
+func TestReadSchemaFingerprintInSchema(t *testing.T) {
+
+	// Arrange
+	repo := tests.CreateDataRepository()
+	repo.ExpectWithRecords(`SELECT to_regclass('rhnversioninfo')::text;`, sqlmock.NewRows([]string{"to_regclass"}).AddRow(nil))
+	repo.ExpectWithRecords(`SELECT md5(string_agg(c.table_name || '.' || c.column_name || ':' || format_type(a.atttypid, a.atttypmod), ','
+			ORDER BY c.table_name, c.ordinal_position))
+		FROM information_schema.columns c
+		JOIN pg_namespace n ON n.nspname = c.table_schema
+		JOIN pg_class cl ON cl.relnamespace = n.oid AND cl.relname = c.table_name
+		JOIN pg_attribute a ON a.attrelid = cl.oid AND a.attname = c.column_name
+		WHERE c.table_schema = $1;`, sqlmock.NewRows([]string{"md5"}).AddRow("abc"), "tenant1")
+
+	// Act
+	fingerprint, err := ReadSchemaFingerprintInSchema(repo.DB, "tenant1")
+
+	// Assert
+	if err != nil || fingerprint != ":abc" {
+		t.Errorf("Unexpected fingerprint %q: %v", fingerprint, err)
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("Schema name was not used in the queries. Error message: %s", err)
+	}
+}
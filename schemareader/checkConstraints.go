@@ -0,0 +1,68 @@
+package schemareader
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/lib/pq"
+)
+
+// CheckConstraint is a check constraint of a table the rows have to satisfy on the target
+type CheckConstraint struct {
+	Name string
+	// the constraint definition, like CHECK (rank >= 0)
+	Definition string
+}
+
+// ApplyCheckConstraints reads the check constraints of the exported tables.
+// They are only read on demand since the export doesn't need them, only the diagnostics of a failing import do.
+func ApplyCheckConstraints(db *sql.DB, tables map[string]Table) error {
+	return ApplyCheckConstraintsInSchema(db, DefaultSchemaName, tables)
+}
+
+// ApplyCheckConstraintsInSchema is ApplyCheckConstraints for the tables of the given database schema, public if empty
+func ApplyCheckConstraintsInSchema(db *sql.DB, schema string, tables map[string]Table) error {
+	if schema == "" {
+		schema = DefaultSchemaName
+	}
+	tableNames := make([]string, 0)
+	for name, table := range tables {
+		if table.Export {
+			tableNames = append(tableNames, name)
+		}
+	}
+	if len(tableNames) == 0 {
+		return nil
+	}
+	sort.Strings(tableNames)
+
+	query := `SELECT cl.relname, c.conname, pg_get_constraintdef(c.oid)
+		FROM pg_constraint c
+		JOIN pg_class cl ON cl.oid = c.conrelid
+		JOIN pg_namespace n ON n.oid = cl.relnamespace
+		WHERE c.contype = 'c' AND cl.relname = ANY($1) AND n.nspname = $2
+		ORDER BY cl.relname, c.conname;`
+	rows, cancel, err := queryContext(context.Background(), db, query, pq.Array(tableNames), schema)
+	if err != nil {
+		return fmt.Errorf("reading check constraints: executing %q: %w", query, err)
+	}
+	defer cancel()
+	defer rows.Close()
+
+	for rows.Next() {
+		var tableName string
+		var constraint CheckConstraint
+		if err := rows.Scan(&tableName, &constraint.Name, &constraint.Definition); err != nil {
+			return fmt.Errorf("reading check constraints: extracting row of %q: %w", query, err)
+		}
+		table := tables[tableName]
+		table.CheckConstraints = append(table.CheckConstraints, constraint)
+		tables[tableName] = table
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("reading check constraints: iterating rows of %q: %w", query, err)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package schemareader
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/uyuni-project/inter-server-sync/tests"
+)
+
+func TestApplyCheckConstraints(t *testing.T) {
+
+	// Arrange
+	repo := tests.CreateDataRepository()
+	tables := map[string]Table{
+		"rhnerrataseverity": {Name: "rhnerrataseverity", Export: true},
+		"rhnchannel":        {Name: "rhnchannel", Export: true},
+		"rhnchannelarch":    {Name: "rhnchannelarch", Export: false},
+	}
+	repo.ExpectWithRecords(ReadCheckConstraints,
+		sqlmock.NewRows([]string{"relname", "conname", "pg_get_constraintdef"}).
+			AddRow("rhnerrataseverity", "rhn_err_sev_rank_ck", "CHECK ((rank >= 0))"),
+		pq.Array([]string{"rhnchannel", "rhnerrataseverity"}), DefaultSchemaName)
+
+	// Act
+	err := ApplyCheckConstraints(repo.DB, tables)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error reading the check constraints: %s", err)
+	}
+	expected := []CheckConstraint{{Name: "rhn_err_sev_rank_ck", Definition: "CHECK ((rank >= 0))"}}
+	if !reflect.DeepEqual(tables["rhnerrataseverity"].CheckConstraints, expected) {
+		t.Errorf("Expected %v, got %v", expected, tables["rhnerrataseverity"].CheckConstraints)
+	}
+	if len(tables["rhnchannel"].CheckConstraints) != 0 {
+		t.Errorf("Unexpected check constraints: %v", tables["rhnchannel"].CheckConstraints)
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("Only the constraints of the exported tables should be read. Error message: %s", err)
+	}
+}
@@ -0,0 +1,162 @@
+package schemareader
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// parseTableColumns groups table.column names by table
+func parseTableColumns(tableColumns []string) (map[string][]string, error) {
+	result := make(map[string][]string)
+	for _, tableColumn := range tableColumns {
+		parts := strings.SplitN(tableColumn, ".", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid column %q: expected table.column", tableColumn)
+		}
+		tableName := strings.ToLower(parts[0])
+		result[tableName] = append(result[tableName], parts[1])
+	}
+	return result, nil
+}
+
+// ApplyColumnFilters removes columns from the export of the tables, given as table.column names: the excluded columns
+// and, for the tables with included columns, all the columns not included. The removed columns get their default value
+// on the target, so it fails if one of them is required: a key or reference column, or a not null column without default.
+// The columns of the tables not in the schema are ignored.
+func ApplyColumnFilters(tables map[string]Table, includeColumns []string, excludeColumns []string) error {
+	included, err := parseTableColumns(includeColumns)
+	if err != nil {
+		return err
+	}
+	excluded, err := parseTableColumns(excludeColumns)
+	if err != nil {
+		return err
+	}
+
+	removed := make(map[string]map[string]bool)
+	rejected := make([]string, 0)
+	for tableName, columns := range excluded {
+		table, ok := tables[tableName]
+		if !ok {
+			continue
+		}
+		removed[tableName] = make(map[string]bool)
+		for _, column := range columns {
+			if _, ok := table.ColumnIndexes[column]; !ok {
+				rejected = append(rejected, fmt.Sprintf("%s.%s (unknown column)", tableName, column))
+				continue
+			}
+			removed[tableName][column] = true
+		}
+	}
+	for tableName, columns := range included {
+		table, ok := tables[tableName]
+		if !ok {
+			continue
+		}
+		kept := make(map[string]bool)
+		for _, column := range columns {
+			if _, ok := table.ColumnIndexes[column]; !ok {
+				rejected = append(rejected, fmt.Sprintf("%s.%s (unknown column)", tableName, column))
+				continue
+			}
+			kept[column] = true
+		}
+		if removed[tableName] == nil {
+			removed[tableName] = make(map[string]bool)
+		}
+		for _, column := range table.Columns {
+			if !kept[column] {
+				removed[tableName][column] = true
+			}
+		}
+	}
+
+	tableNames := make([]string, 0, len(removed))
+	for tableName := range removed {
+		tableNames = append(tableNames, tableName)
+	}
+	sort.Strings(tableNames)
+	for _, tableName := range tableNames {
+		table := tables[tableName]
+		// the columns are checked on the full table, before any of them is removed
+		columns := make([]string, 0, len(removed[tableName]))
+		for _, column := range table.Columns {
+			if !removed[tableName][column] {
+				continue
+			}
+			qualifiedName := fmt.Sprintf("%s.%s", tableName, column)
+			definition := table.ColumnDefinitions[column]
+			switch {
+			case isKeyColumn(table, column):
+				rejected = append(rejected, qualifiedName+" (key or reference)")
+			case !definition.IsNullable && definition.ColumnDefault == "":
+				rejected = append(rejected, qualifiedName+" (not null without default)")
+			default:
+				columns = append(columns, column)
+			}
+		}
+		for _, column := range columns {
+			logger().Info().Str("table", tableName).Str("column", column).
+				Msgf("Column %s.%s is not exported: it gets its default value on the target", tableName, column)
+			table = removeColumn(table, column)
+		}
+		tables[tableName] = table
+	}
+	if len(rejected) > 0 {
+		return fmt.Errorf("columns can't be left out of the export: %s", strings.Join(rejected, ", "))
+	}
+	return nil
+}
+
+// ApplyDefaultColumns removes columns with a default expression from the export of the tables, given as table.column
+// names, so that the target evaluates its own default instead of copying the source value, like a creation timestamp
+// set with now(). Existing target rows keep their value as the column isn't updated either.
+// It fails if a column has no default or is a key or reference column. The columns of the tables not in the schema are ignored.
+func ApplyDefaultColumns(tables map[string]Table, defaultColumns []string) error {
+	columnsByTable, err := parseTableColumns(defaultColumns)
+	if err != nil {
+		return err
+	}
+
+	tableNames := make([]string, 0, len(columnsByTable))
+	for tableName := range columnsByTable {
+		tableNames = append(tableNames, tableName)
+	}
+	sort.Strings(tableNames)
+	rejected := make([]string, 0)
+	for _, tableName := range tableNames {
+		table, ok := tables[tableName]
+		if !ok {
+			continue
+		}
+		columns := make([]string, 0)
+		for _, column := range columnsByTable[tableName] {
+			qualifiedName := fmt.Sprintf("%s.%s", tableName, column)
+			if _, ok := table.ColumnIndexes[column]; !ok {
+				rejected = append(rejected, qualifiedName+" (unknown column)")
+				continue
+			}
+			switch {
+			case table.ColumnDefinitions[column].ColumnDefault == "":
+				rejected = append(rejected, qualifiedName+" (no default)")
+			case isKeyColumn(table, column):
+				rejected = append(rejected, qualifiedName+" (key or reference)")
+			default:
+				columns = append(columns, column)
+			}
+		}
+		for _, column := range columns {
+			logger().Info().Str("table", tableName).Str("column", column).
+				Msgf("Column %s.%s is not exported: the target applies its default %s", tableName, column,
+					table.ColumnDefinitions[column].ColumnDefault)
+			table = removeColumn(table, column)
+		}
+		tables[tableName] = table
+	}
+	if len(rejected) > 0 {
+		return fmt.Errorf("columns can't be left to their default on the target: %s", strings.Join(rejected, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package schemareader
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func columnFilterTables() map[string]Table {
+	return map[string]Table{
+		"rhnpackage": {
+			Name:    "rhnpackage",
+			Columns: []string{"id", "name_id", "build_host", "vendor", "payload_size", "created"},
+			ColumnDefinitions: map[string]Column{
+				"id":           {Name: "id", DataType: "numeric"},
+				"name_id":      {Name: "name_id", DataType: "numeric"},
+				"build_host":   {Name: "build_host", DataType: "character varying", IsNullable: true},
+				"vendor":       {Name: "vendor", DataType: "character varying"},
+				"payload_size": {Name: "payload_size", DataType: "numeric", ColumnDefault: "0"},
+				"created":      {Name: "created", DataType: "timestamp with time zone", ColumnDefault: "now()"},
+			},
+			ColumnIndexes: map[string]int{"id": 0, "name_id": 1, "build_host": 2, "vendor": 3, "payload_size": 4, "created": 5},
+			PKColumns:     map[string]bool{"id": true},
+			References:    []Reference{{TableName: "rhnpackagename", ColumnMapping: map[string]string{"name_id": "id"}}},
+		},
+	}
+}
+
+func TestApplyExcludeColumns(t *testing.T) {
+	// Arrange
+	tables := columnFilterTables()
+
+	// Act
+	err := ApplyColumnFilters(tables, nil, []string{"RHNPACKAGE.build_host", "rhnpackage.payload_size", "missing.column"})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	table := tables["rhnpackage"]
+	if !reflect.DeepEqual(table.Columns, []string{"id", "name_id", "vendor", "created"}) {
+		t.Errorf("Unexpected columns: %v", table.Columns)
+	}
+	if !reflect.DeepEqual(table.ColumnIndexes, map[string]int{"id": 0, "name_id": 1, "vendor": 2, "created": 3}) {
+		t.Errorf("Unexpected column indexes: %v", table.ColumnIndexes)
+	}
+	if _, ok := table.ColumnDefinitions["build_host"]; ok {
+		t.Errorf("Excluded column definition should be removed")
+	}
+}
+
+func TestApplyIncludeColumns(t *testing.T) {
+	// Arrange
+	tables := columnFilterTables()
+
+	// Act
+	err := ApplyColumnFilters(tables, []string{"rhnpackage.id", "rhnpackage.name_id", "rhnpackage.vendor"}, nil)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(tables["rhnpackage"].Columns, []string{"id", "name_id", "vendor"}) {
+		t.Errorf("Unexpected columns: %v", tables["rhnpackage"].Columns)
+	}
+}
+
+func TestApplyColumnFiltersRequiredColumns(t *testing.T) {
+	// Arrange
+	tables := columnFilterTables()
+
+	// Act
+	err := ApplyColumnFilters(tables, nil, []string{"rhnpackage.vendor", "rhnpackage.name_id", "rhnpackage.build_host"})
+
+	// Assert
+	if err == nil {
+		t.Fatalf("Required columns should not be excluded")
+	}
+	for _, expected := range []string{"rhnpackage.vendor (not null without default)", "rhnpackage.name_id (key or reference)"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Error should contain %q, got %s", expected, err)
+		}
+	}
+	if err := ApplyColumnFilters(tables, nil, []string{"rhnpackage.unknown"}); err == nil || !strings.Contains(err.Error(), "unknown column") {
+		t.Errorf("Unknown column should be reported, got %v", err)
+	}
+	if err := ApplyColumnFilters(tables, nil, []string{"build_host"}); err == nil {
+		t.Errorf("Column without table should be rejected")
+	}
+}
+
+func TestApplyDefaultColumns(t *testing.T) {
+	// Arrange
+	tables := columnFilterTables()
+	copied := columnFilterTables()
+
+	// Act
+	err := ApplyDefaultColumns(tables, []string{"rhnpackage.created", "missing.created"})
+	copiedErr := ApplyDefaultColumns(copied, nil)
+
+	// Assert
+	if err != nil || copiedErr != nil {
+		t.Fatalf("Unexpected error: %v %v", err, copiedErr)
+	}
+	table := tables["rhnpackage"]
+	if !reflect.DeepEqual(table.Columns, []string{"id", "name_id", "build_host", "vendor", "payload_size"}) {
+		t.Errorf("The now() column should be left to the target default, got %v", table.Columns)
+	}
+	if _, ok := table.ColumnDefinitions["created"]; ok {
+		t.Errorf("Default column definition should be removed")
+	}
+	if index, ok := copied["rhnpackage"].ColumnIndexes["created"]; !ok || index != 5 {
+		t.Errorf("The now() column should be copied when not listed, got %v", copied["rhnpackage"].ColumnIndexes)
+	}
+}
+
+func TestApplyDefaultColumnsRequiresDefault(t *testing.T) {
+	// Arrange
+	tables := columnFilterTables()
+
+	// Act
+	err := ApplyDefaultColumns(tables, []string{"rhnpackage.build_host", "rhnpackage.unknown", "rhnpackage.created"})
+
+	// Assert
+	if err == nil {
+		t.Fatalf("Columns without default should be rejected")
+	}
+	for _, expected := range []string{"rhnpackage.build_host (no default)", "rhnpackage.unknown (unknown column)"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Error should contain %q, got %s", expected, err)
+		}
+	}
+	table := columnFilterTables()["rhnpackage"]
+	table.ColumnDefinitions["id"] = Column{Name: "id", DataType: "numeric", ColumnDefault: "nextval('rhn_package_id_seq'::regclass)"}
+	tables = map[string]Table{"rhnpackage": table}
+	if err := ApplyDefaultColumns(tables, []string{"rhnpackage.id"}); err == nil || !strings.Contains(err.Error(), "key or reference") {
+		t.Errorf("Key column should not be left to its default, got %v", err)
+	}
+}
@@ -3,69 +3,78 @@ package schemareader
 const (
 	ReadTableNames = `SELECT table_name
 		FROM information_schema.tables
-		WHERE table_schema = 'public'
+		WHERE table_schema = $1
 			AND table_type = 'BASE TABLE';`
 
-	ReadColumnNames = `SELECT column_name
-		FROM information_schema.columns
-		WHERE table_schema = 'public' AND table_name = $1
-		ORDER BY ordinal_position;`
-
-	ReadPkColumnNames = `SELECT a.attname
-		FROM pg_index i
-		JOIN pg_attribute a ON a.attrelid = i.indrelid
-			AND a.attnum = ANY(i.indkey)
-		WHERE  i.indrelid = $1::regclass
-		AND    i.indisprimary;`
+	ReadColumnNames = `SELECT c.column_name,
+			CASE WHEN c.data_type = 'USER-DEFINED' THEN c.data_type ELSE format_type(a.atttypid, a.atttypmod) END,
+			c.is_nullable = 'YES', coalesce(c.column_default, '')
+		FROM information_schema.columns c
+		JOIN pg_namespace n ON n.nspname = c.table_schema
+		JOIN pg_class cl ON cl.relnamespace = n.oid AND cl.relname = c.table_name
+		JOIN pg_attribute a ON a.attrelid = cl.oid AND a.attname = c.column_name
+		WHERE c.table_schema = $2 AND c.table_name = $1
+		ORDER BY c.ordinal_position;`
 
-	ReadUniqueIndexNames = `SELECT DISTINCT indexrelid::regclass
+	ReadIndexes = `SELECT ic.relname::text, i.indisprimary, array_agg(DISTINCT a.attname::text ORDER BY a.attname::text),
+			coalesce(pg_get_expr(i.indpred, i.indrelid), '')
 		FROM pg_index i
+		JOIN pg_class ic ON ic.oid = i.indexrelid
 		JOIN pg_attribute a ON a.attrelid = i.indrelid
 			AND a.attnum = ANY(i.indkey)
-		WHERE i.indrelid = $1::regclass
-		AND i.indisunique AND NOT i.indisprimary;`
-
-	ReadIndexColumns = `SELECT DISTINCT a.attname
-		FROM pg_index i
-		JOIN pg_attribute a ON a.attrelid = i.indrelid
-			AND a.attnum = ANY(i.indkey)
-		WHERE indexrelid::regclass = $1::regclass;`
+		WHERE i.indrelid = (quote_ident($2) || '.' || quote_ident($1))::regclass
+		AND (i.indisprimary OR i.indisunique)
+		GROUP BY ic.relname, i.indrelid, i.indisprimary, i.indpred
+		ORDER BY 1;`
 
 	ReadReferenceConstraintNames = `SELECT DISTINCT tc.constraint_name
 		FROM information_schema.table_constraints AS tc
 			JOIN information_schema.constraint_column_usage AS ccu ON ccu.constraint_name = tc.constraint_name
 				AND ccu.table_schema = tc.table_schema
-		WHERE tc.constraint_type = 'FOREIGN KEY' AND tc.table_name = $1;`
+		WHERE tc.constraint_type = 'FOREIGN KEY' AND tc.table_name = $1 AND tc.table_schema = $2;`
 
 	ReadReferencedByConstraintNames = `SELECT DISTINCT tc.constraint_name
 		FROM information_schema.table_constraints AS tc
 			JOIN information_schema.constraint_column_usage AS ccu ON ccu.constraint_name = tc.constraint_name
 				AND ccu.table_schema = tc.table_schema
-		WHERE tc.constraint_type = 'FOREIGN KEY' AND ccu.table_name = $1;`
+		WHERE tc.constraint_type = 'FOREIGN KEY' AND ccu.table_name = $1 AND tc.table_schema = $2;`
 
 	ReadReferencedTable = `SELECT DISTINCT ccu.table_name
 	FROM information_schema.constraint_column_usage AS ccu
-	WHERE ccu.constraint_name = $1;`
+	WHERE ccu.constraint_name = $1 AND ccu.constraint_schema = $2;`
 
 	ReadReferencedByTable = `SELECT DISTINCT table_name
 	FROM information_schema.table_constraints as tc 
-	WHERE tc.constraint_name = $1;`
+	WHERE tc.constraint_name = $1 AND tc.constraint_schema = $2;`
 
-	ReadReferenceConstraints = `SELECT DISTINCT kcu.column_name, ccu.column_name AS foreign_column_name
-		FROM information_schema.table_constraints AS tc
-		JOIN information_schema.key_column_usage AS kcu ON tc.constraint_name = kcu.constraint_name
-			AND tc.table_schema = kcu.table_schema
-			AND tc.table_name = kcu.table_name
-		JOIN information_schema.constraint_column_usage AS ccu ON ccu.constraint_name = tc.constraint_name
-			AND tc.table_schema = ccu.table_schema
-		WHERE tc.constraint_type = 'FOREIGN KEY'
-			AND tc.table_name = $1
-			AND tc.constraint_name = $2;`
+	ReadReferenceConstraints = `SELECT a.attname AS column_name, af.attname AS foreign_column_name, c.condeferrable
+		FROM pg_constraint c
+		CROSS JOIN LATERAL unnest(c.conkey, c.confkey) AS k(attnum, foreign_attnum)
+		JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = k.attnum
+		JOIN pg_attribute af ON af.attrelid = c.confrelid AND af.attnum = k.foreign_attnum
+		WHERE c.contype = 'f'
+			AND c.conrelid = (quote_ident($3) || '.' || quote_ident($1))::regclass
+			AND c.conname = $2;`
 
-	ReadPkSequence = `WITH sequences AS (
-		SELECT sequence_name
+	ReadPkSequence = `WITH owned_sequences AS (
+			SELECT s.relname::text AS sequence_name, a.attname::text AS owner_column
+			FROM
+				pg_constraint c
+				JOIN pg_depend d
+					ON d.refclassid = 'pg_class'::regclass
+					AND d.refobjid = c.conrelid
+					AND d.refobjsubid = ANY(c.conkey)
+					AND d.classid = 'pg_class'::regclass
+					AND d.deptype IN ('a', 'i')
+				JOIN pg_class s ON s.oid = d.objid AND s.relkind = 'S'
+				JOIN pg_attribute a ON a.attrelid = d.refobjid AND a.attnum = d.refobjsubid
+			WHERE c.contype = 'p'
+				AND c.conrelid = (quote_ident($2) || '.' || quote_ident($1))::regclass
+		),
+		sequences AS (
+			SELECT sequence_name
 			FROM information_schema.sequences
-			WHERE sequence_schema = 'public'
+			WHERE sequence_schema = $2
 		),
 		id_constraints AS (
 			SELECT
@@ -76,14 +85,67 @@ const (
 				information_schema.table_constraints AS tc
 				JOIN information_schema.key_column_usage AS kcu
 					ON tc.constraint_name = kcu.constraint_name
-			WHERE tc.constraint_schema = 'public'
+			WHERE tc.constraint_schema = $2
 				AND constraint_type = 'PRIMARY KEY'
 				AND kcu.ordinal_position = 1
 				AND column_name = 'id'
 				AND tc.table_name = $1
-		)
-		SELECT sequence_name
+		),
+		named_sequences AS (
+			SELECT sequence_name::text
 			FROM id_constraints
 			JOIN sequences
-				ON replace(regexp_replace(constraint_name, '(_id)?_pk(ey)?', ''), '_', '') = replace(regexp_replace(sequence_name, '(_id)?_seq', ''), '_', '')`
+				ON replace(regexp_replace(constraint_name, '(_id)?_pk(ey)?', ''), '_', '') = replace(regexp_replace(sequence_name, '(_id)?_seq', ''), '_', '')
+		)
+		SELECT sequence_name, owner_column FROM (
+			SELECT sequence_name, owner_column, 1 AS priority FROM owned_sequences
+			UNION ALL
+			SELECT sequence_name, '' AS owner_column, 2 AS priority FROM named_sequences
+		) AS candidates
+		ORDER BY priority, sequence_name
+		LIMIT 1;`
+
+	ReadUnreadableColumns = `SELECT table_name, column_name, is_nullable = 'YES', column_default IS NOT NULL
+		FROM information_schema.columns
+		WHERE table_schema = $1
+			AND NOT has_column_privilege(quote_ident(table_schema) || '.' || quote_ident(table_name), column_name, 'SELECT');`
+
+	ReadBatchColumnNames = `SELECT c.table_name, c.column_name,
+			CASE WHEN c.data_type = 'USER-DEFINED' THEN c.data_type ELSE format_type(a.atttypid, a.atttypmod) END,
+			c.is_nullable = 'YES', coalesce(c.column_default, '')
+		FROM information_schema.columns c
+		JOIN pg_namespace n ON n.nspname = c.table_schema
+		JOIN pg_class cl ON cl.relnamespace = n.oid AND cl.relname = c.table_name
+		JOIN pg_attribute a ON a.attrelid = cl.oid AND a.attname = c.column_name
+		WHERE c.table_schema = $2 AND c.table_name = ANY($1)
+		ORDER BY c.table_name, c.ordinal_position;`
+
+	ReadBatchInheritance = `SELECT c.relname, EXISTS (SELECT 1 FROM pg_partitioned_table p WHERE p.partrelid = c.oid)
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $2 AND c.relname = ANY($1)
+			AND (EXISTS (SELECT 1 FROM pg_partitioned_table p WHERE p.partrelid = c.oid)
+				OR EXISTS (SELECT 1 FROM pg_inherits i WHERE i.inhrelid = c.oid OR i.inhparent = c.oid))
+		ORDER BY c.relname;`
+
+	ReadBatchReferences = `SELECT c.conname, cl.relname, fcl.relname, a.attname, af.attname, c.condeferrable
+		FROM pg_constraint c
+		JOIN pg_class cl ON cl.oid = c.conrelid
+		JOIN pg_class fcl ON fcl.oid = c.confrelid
+		JOIN pg_namespace n ON n.oid = c.connamespace
+		CROSS JOIN LATERAL unnest(c.conkey, c.confkey) AS k(attnum, foreign_attnum)
+		JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = k.attnum
+		JOIN pg_attribute af ON af.attrelid = c.confrelid AND af.attnum = k.foreign_attnum
+		WHERE c.contype = 'f' AND n.nspname = $2
+			AND (cl.relname = ANY($1) OR fcl.relname = ANY($1))
+		ORDER BY c.conname;`
+
+	ReadSequenceValue = `SELECT pg_sequence_last_value($1::regclass);`
+
+	ReadCheckConstraints = `SELECT cl.relname, c.conname, pg_get_constraintdef(c.oid)
+		FROM pg_constraint c
+		JOIN pg_class cl ON cl.oid = c.conrelid
+		JOIN pg_namespace n ON n.oid = cl.relnamespace
+		WHERE c.contype = 'c' AND cl.relname = ANY($1) AND n.nspname = $2
+		ORDER BY cl.relname, c.conname;`
 )
@@ -0,0 +1,144 @@
+package schemareader
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DetectCycles returns the cycles of foreign keys between the tables, each one as the ordered list of its tables.
+// A table referencing itself directly is not a cycle since its rows are ordered by the export,
+// neither are the references through columns which are not exported.
+func DetectCycles(tables map[string]Table) [][]string {
+	const (
+		unvisited = iota
+		inPath
+		visited
+	)
+	state := make(map[string]int)
+	path := make([]string, 0)
+	cycles := make([][]string, 0)
+
+	var visit func(tableName string)
+	visit = func(tableName string) {
+		state[tableName] = inPath
+		path = append(path, tableName)
+		for _, referencedName := range orderingReferences(tables[tableName], tables) {
+			switch state[referencedName] {
+			case unvisited:
+				visit(referencedName)
+			case inPath:
+				for i, name := range path {
+					if name == referencedName {
+						cycle := make([]string, len(path)-i)
+						copy(cycle, path[i:])
+						cycles = append(cycles, cycle)
+						break
+					}
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[tableName] = visited
+	}
+
+	tableNames := make([]string, 0, len(tables))
+	for name := range tables {
+		tableNames = append(tableNames, name)
+	}
+	sort.Strings(tableNames)
+	for _, name := range tableNames {
+		if state[name] == unvisited {
+			visit(name)
+		}
+	}
+	return cycles
+}
+
+// orderingReferences returns the sorted names of the other tables whose rows have to be inserted before the table ones
+func orderingReferences(table Table, tables map[string]Table) []string {
+	result := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, reference := range table.References {
+		if _, ok := tables[reference.TableName]; !ok || reference.TableName == table.Name || seen[reference.TableName] {
+			continue
+		}
+		exported := false
+		for column := range reference.ColumnMapping {
+			if !table.UnexportColumns[column] {
+				exported = true
+			}
+		}
+		if exported {
+			seen[reference.TableName] = true
+			result = append(result, reference.TableName)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// OrderTablesForInsert sorts the tables so that the referenced tables come before the tables referencing them,
+// the tables without dependencies first, by name.
+// If the references have cycles, the tables of the cycles are appended by name and an error describes a cycle.
+func OrderTablesForInsert(tables map[string]Table) ([]Table, error) {
+	dependencies := make(map[string]int)
+	dependents := make(map[string][]string)
+	ready := make([]string, 0)
+	for name, table := range tables {
+		references := orderingReferences(table, tables)
+		dependencies[name] = len(references)
+		for _, referencedName := range references {
+			dependents[referencedName] = append(dependents[referencedName], name)
+		}
+		if len(references) == 0 {
+			ready = append(ready, name)
+		}
+	}
+
+	result := make([]Table, 0, len(tables))
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		name := ready[0]
+		ready = ready[1:]
+		result = append(result, tables[name])
+		for _, dependent := range dependents[name] {
+			dependencies[dependent]--
+			if dependencies[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+	if len(result) == len(tables) {
+		return result, nil
+	}
+
+	remaining := make([]string, 0)
+	for name, count := range dependencies {
+		if count > 0 {
+			remaining = append(remaining, name)
+		}
+	}
+	sort.Strings(remaining)
+	for _, name := range remaining {
+		result = append(result, tables[name])
+	}
+	cycle := DetectCycles(tables)[0]
+	return result, fmt.Errorf("tables have cyclic references: %s -> %s", strings.Join(cycle, " -> "), cycle[0])
+}
+
+// NonDeferrableCycleReferences describes the foreign keys of the cycle which can't be deferred,
+// preventing the rows of its tables to be inserted in the same transaction with SET CONSTRAINTS ALL DEFERRED
+func NonDeferrableCycleReferences(tables map[string]Table, cycle []string) []string {
+	result := make([]string, 0)
+	for i, tableName := range cycle {
+		referencedName := cycle[(i+1)%len(cycle)]
+		table := tables[tableName]
+		for _, reference := range table.ReferencesTo(referencedName) {
+			if !reference.Deferrable {
+				result = append(result, fmt.Sprintf("%s (%s) -> %s", tableName, strings.Join(reference.LocalColumns(), ", "), referencedName))
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,108 @@
+package schemareader
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetectCycles(t *testing.T) {
+
+	// Arrange
+	reference := func(tableName string, column string) Reference {
+		return Reference{TableName: tableName, ColumnMapping: map[string]string{column: "id"}}
+	}
+	tables := map[string]Table{
+		"a": {Name: "a", References: []Reference{reference("b", "b_id"), reference("a", "parent_id")}},
+		"b": {Name: "b", References: []Reference{reference("c", "c_id")}},
+		"c": {Name: "c", References: []Reference{reference("a", "a_id"), reference("outside", "outside_id")}},
+		"configfile": {Name: "configfile", UnexportColumns: map[string]bool{"latest_revision_id": true},
+			References: []Reference{reference("configrevision", "latest_revision_id")}},
+		"configrevision": {Name: "configrevision", References: []Reference{reference("configfile", "config_file_id")}},
+	}
+
+	// Act
+	cycles := DetectCycles(tables)
+
+	// Assert
+	expected := [][]string{{"a", "b", "c"}}
+	if !reflect.DeepEqual(cycles, expected) {
+		t.Errorf("Cycles do not match: expected %v, got %v", expected, cycles)
+	}
+}
+
+func TestOrderTablesForInsert(t *testing.T) {
+
+	// Arrange
+	reference := func(tableName string) Reference {
+		return Reference{TableName: tableName, ColumnMapping: map[string]string{tableName + "_id": "id"}}
+	}
+	tables := map[string]Table{
+		"rhnchannel":        {Name: "rhnchannel", References: []Reference{reference("rhnchannelarch"), reference("rhnchannel")}},
+		"rhnchannelarch":    {Name: "rhnchannelarch", References: []Reference{reference("rhnarchtype")}},
+		"rhnarchtype":       {Name: "rhnarchtype"},
+		"rhnchannelpackage": {Name: "rhnchannelpackage", References: []Reference{reference("rhnchannel"), reference("rhnpackage")}},
+		"rhnpackage":        {Name: "rhnpackage", References: []Reference{reference("rhnpackagename")}},
+		"rhnpackagename":    {Name: "rhnpackagename"},
+	}
+
+	// Act
+	ordered, err := OrderTablesForInsert(tables)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error ordering the tables: %s", err)
+	}
+	names := make([]string, 0)
+	for _, table := range ordered {
+		names = append(names, table.Name)
+	}
+	expected := []string{"rhnarchtype", "rhnchannelarch", "rhnchannel", "rhnpackagename", "rhnpackage", "rhnchannelpackage"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Tables order does not match: expected %v, got %v", expected, names)
+	}
+}
+
+func TestOrderTablesForInsertWithCycle(t *testing.T) {
+
+	// Arrange
+	reference := func(tableName string) Reference {
+		return Reference{TableName: tableName, ColumnMapping: map[string]string{tableName + "_id": "id"}}
+	}
+	tables := map[string]Table{
+		"a":    {Name: "a", References: []Reference{reference("b"), reference("base")}},
+		"b":    {Name: "b", References: []Reference{reference("a")}},
+		"base": {Name: "base"},
+	}
+
+	// Act
+	ordered, err := OrderTablesForInsert(tables)
+
+	// Assert
+	if err == nil || err.Error() != "tables have cyclic references: a -> b -> a" {
+		t.Errorf("Cycle should be reported, got %v", err)
+	}
+	if len(ordered) != 3 || ordered[0].Name != "base" {
+		t.Errorf("Best effort order should start with the tables without cycle, got %v", ordered)
+	}
+}
+
+func TestNonDeferrableCycleReferences(t *testing.T) {
+
+	// Arrange
+	tables := map[string]Table{
+		"configfile": {Name: "configfile", References: []Reference{
+			{TableName: "configrevision", ColumnMapping: map[string]string{"latest_revision_id": "id"}, Deferrable: true}}},
+		"configrevision": {Name: "configrevision", References: []Reference{
+			{TableName: "configfile", ColumnMapping: map[string]string{"config_file_id": "id"}},
+			{TableName: "configcontent", ColumnMapping: map[string]string{"config_content_id": "id"}}}},
+	}
+
+	// Act
+	references := NonDeferrableCycleReferences(tables, []string{"configfile", "configrevision"})
+
+	// Assert
+	expected := []string{"configrevision (config_file_id) -> configfile"}
+	if !reflect.DeepEqual(references, expected) {
+		t.Errorf("Non deferrable references do not match: expected %v, got %v", expected, references)
+	}
+}
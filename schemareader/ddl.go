@@ -0,0 +1,163 @@
+package schemareader
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// WriteDDL writes the statements creating the tables on an empty database: the sequences generating their primary keys,
+// the tables in the order of their references, their unique indexes and, once all the tables exist, their foreign keys.
+// Only the metadata read by this tool is created: no check constraint, trigger or privilege.
+// The foreign keys to tables missing from the list are not created and are reported in a comment.
+func WriteDDL(tables []Table, w io.Writer) error {
+	statements := make([]string, 0)
+	ordered := orderTablesByReferences(tables)
+	tableNames := make(map[string]bool, len(ordered))
+	for _, table := range ordered {
+		tableNames[table.Name] = true
+	}
+
+	for _, table := range ordered {
+		if table.PKSequence != "" {
+			statements = append(statements, fmt.Sprintf("CREATE SEQUENCE IF NOT EXISTS %s;", pq.QuoteIdentifier(table.PKSequence)))
+		}
+	}
+	for _, table := range ordered {
+		statement, err := formatCreateTable(table)
+		if err != nil {
+			return err
+		}
+		statements = append(statements, statement)
+		for _, name := range sortedIndexNames(table.UniqueIndexes) {
+			if name == VirtualIndexName {
+				continue
+			}
+			statements = append(statements, formatCreateUniqueIndex(table, table.UniqueIndexes[name]))
+		}
+		// the sequence is dropped with its column, like the one of a serial column
+		if table.PKSequence != "" && table.PKSequenceColumn != "" {
+			statements = append(statements, fmt.Sprintf("ALTER SEQUENCE %s OWNED BY %s.%s;", pq.QuoteIdentifier(table.PKSequence),
+				pq.QuoteIdentifier(table.Name), pq.QuoteIdentifier(table.PKSequenceColumn)))
+		}
+	}
+	for _, table := range ordered {
+		for _, reference := range sortedReferences(table.References) {
+			if !tableNames[reference.TableName] {
+				statements = append(statements, fmt.Sprintf("-- foreign key of %s (%s) not created: table %s is not part of the tables",
+					table.Name, strings.Join(reference.LocalColumns(), ", "), reference.TableName))
+				continue
+			}
+			statements = append(statements, formatAddForeignKey(table, reference))
+		}
+	}
+
+	for _, statement := range statements {
+		if _, err := io.WriteString(w, statement+"\n"); err != nil {
+			return fmt.Errorf("writing the DDL: %w", err)
+		}
+	}
+	return nil
+}
+
+// orderTablesByReferences sorts the tables by name, the referenced tables first. The cycles are broken arbitrarily.
+func orderTablesByReferences(tables []Table) []Table {
+	byName := make(map[string]Table, len(tables))
+	names := make([]string, 0, len(tables))
+	for _, table := range tables {
+		byName[table.Name] = table
+		names = append(names, table.Name)
+	}
+	sort.Strings(names)
+
+	result := make([]Table, 0, len(tables))
+	visited := make(map[string]bool, len(tables))
+	var visit func(name string)
+	visit = func(name string) {
+		table, ok := byName[name]
+		if !ok || visited[name] {
+			return
+		}
+		visited[name] = true
+		for _, reference := range sortedReferences(table.References) {
+			visit(reference.TableName)
+		}
+		result = append(result, table)
+	}
+	for _, name := range names {
+		visit(name)
+	}
+	return result
+}
+
+// sortedReferences returns the references sorted by referenced table and columns
+func sortedReferences(references []Reference) []Reference {
+	result := append([]Reference{}, references...)
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].TableName != result[j].TableName {
+			return result[i].TableName < result[j].TableName
+		}
+		return strings.Join(result[i].LocalColumns(), ",") < strings.Join(result[j].LocalColumns(), ",")
+	})
+	return result
+}
+
+func formatCreateTable(table Table) (string, error) {
+	definitions := make([]string, 0, len(table.Columns)+1)
+	pkColumns := make([]string, 0, len(table.PKColumns))
+	for _, name := range table.Columns {
+		column := table.ColumnDefinitions[name]
+		// the user defined types don't exist on an empty database
+		if column.DataType == "" || column.DataType == "USER-DEFINED" {
+			return "", fmt.Errorf("column %s of table %s has a type which can't be created: %q", name, table.Name, column.DataType)
+		}
+		definition := pq.QuoteIdentifier(name) + " " + column.DataType
+		if !column.IsNullable {
+			definition += " NOT NULL"
+		}
+		if column.ColumnDefault != "" {
+			definition += " DEFAULT " + column.ColumnDefault
+		}
+		definitions = append(definitions, definition)
+		if table.PKColumns[name] {
+			pkColumns = append(pkColumns, pq.QuoteIdentifier(name))
+		}
+	}
+	if len(pkColumns) > 0 {
+		definitions = append(definitions, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(pkColumns, ", ")))
+	}
+	return fmt.Sprintf("CREATE TABLE %s (\n\t%s\n);", pq.QuoteIdentifier(table.Name), strings.Join(definitions, ",\n\t")), nil
+}
+
+func formatCreateUniqueIndex(table Table, index UniqueIndex) string {
+	columns := make([]string, 0, len(index.Columns))
+	for _, column := range index.Columns {
+		columns = append(columns, pq.QuoteIdentifier(column))
+	}
+	statement := fmt.Sprintf("CREATE UNIQUE INDEX %s ON %s (%s)", pq.QuoteIdentifier(index.Name), pq.QuoteIdentifier(table.Name),
+		strings.Join(columns, ", "))
+	if index.Predicate != "" {
+		statement += " WHERE " + index.Predicate
+	}
+	return statement + ";"
+}
+
+func formatAddForeignKey(table Table, reference Reference) string {
+	localColumns := make([]string, 0, len(reference.ColumnMapping))
+	for _, column := range reference.LocalColumns() {
+		localColumns = append(localColumns, pq.QuoteIdentifier(column))
+	}
+	foreignColumns := make([]string, 0, len(reference.ColumnMapping))
+	for _, column := range reference.ForeignColumns() {
+		foreignColumns = append(foreignColumns, pq.QuoteIdentifier(column))
+	}
+	statement := fmt.Sprintf("ALTER TABLE %s ADD FOREIGN KEY (%s) REFERENCES %s (%s)", pq.QuoteIdentifier(table.Name),
+		strings.Join(localColumns, ", "), pq.QuoteIdentifier(reference.TableName), strings.Join(foreignColumns, ", "))
+	if reference.Deferrable {
+		statement += " DEFERRABLE"
+	}
+	return statement + ";"
+}
@@ -0,0 +1,93 @@
+package schemareader
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteDDL(t *testing.T) {
+	// Arrange
+	tables := []Table{
+		{
+			Name:    "rhnchannel",
+			Columns: []string{"id", "label", "parent_channel"},
+			ColumnDefinitions: map[string]Column{
+				"id":             {Name: "id", DataType: "numeric", ColumnDefault: "nextval('rhn_channel_id_seq'::regclass)"},
+				"label":          {Name: "label", DataType: "character varying(128)"},
+				"parent_channel": {Name: "parent_channel", DataType: "numeric(12,0)", IsNullable: true},
+			},
+			PKColumns:        map[string]bool{"id": true},
+			PKSequence:       "rhn_channel_id_seq",
+			PKSequenceColumn: "id",
+			UniqueIndexes: map[string]UniqueIndex{
+				"rhn_channel_label_uq": {Name: "rhn_channel_label_uq", Columns: []string{"label"}},
+				VirtualIndexName:       {Name: VirtualIndexName, Columns: []string{"label"}},
+			},
+			References: []Reference{
+				{TableName: "rhnchannel", ColumnMapping: map[string]string{"parent_channel": "id"}},
+				{TableName: "rhnorg", ColumnMapping: map[string]string{"org_id": "id"}},
+			},
+		},
+		{
+			Name:    "rhnchannelpackage",
+			Columns: []string{"channel_id", "package_id"},
+			ColumnDefinitions: map[string]Column{
+				"channel_id": {Name: "channel_id", DataType: "numeric"},
+				"package_id": {Name: "package_id", DataType: "numeric"},
+			},
+			UniqueIndexes: map[string]UniqueIndex{
+				"rhn_cp_cp_uq": {Name: "rhn_cp_cp_uq", Columns: []string{"channel_id", "package_id"}, Predicate: "package_id IS NOT NULL"},
+			},
+			References: []Reference{
+				{TableName: "rhnpackage", ColumnMapping: map[string]string{"package_id": "id"}},
+				{TableName: "rhnchannel", ColumnMapping: map[string]string{"channel_id": "id"}, Deferrable: true},
+			},
+		},
+		{
+			Name:              "rhnpackage",
+			Columns:           []string{"id"},
+			ColumnDefinitions: map[string]Column{"id": {Name: "id", DataType: "numeric"}},
+			PKColumns:         map[string]bool{"id": true},
+		},
+	}
+	var ddl strings.Builder
+
+	// Act
+	err := WriteDDL(tables, &ddl)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := strings.Join([]string{
+		`CREATE SEQUENCE IF NOT EXISTS "rhn_channel_id_seq";`,
+		`CREATE TABLE "rhnchannel" (`,
+		`	"id" numeric NOT NULL DEFAULT nextval('rhn_channel_id_seq'::regclass),`,
+		`	"label" character varying(128) NOT NULL,`,
+		`	"parent_channel" numeric(12,0),`,
+		`	PRIMARY KEY ("id")`,
+		`);`,
+		`CREATE UNIQUE INDEX "rhn_channel_label_uq" ON "rhnchannel" ("label");`,
+		`ALTER SEQUENCE "rhn_channel_id_seq" OWNED BY "rhnchannel"."id";`,
+		`CREATE TABLE "rhnpackage" (`,
+		`	"id" numeric NOT NULL,`,
+		`	PRIMARY KEY ("id")`,
+		`);`,
+		`CREATE TABLE "rhnchannelpackage" (`,
+		`	"channel_id" numeric NOT NULL,`,
+		`	"package_id" numeric NOT NULL`,
+		`);`,
+		`CREATE UNIQUE INDEX "rhn_cp_cp_uq" ON "rhnchannelpackage" ("channel_id", "package_id") WHERE package_id IS NOT NULL;`,
+		`ALTER TABLE "rhnchannel" ADD FOREIGN KEY ("parent_channel") REFERENCES "rhnchannel" ("id");`,
+		`-- foreign key of rhnchannel (org_id) not created: table rhnorg is not part of the tables`,
+		`ALTER TABLE "rhnchannelpackage" ADD FOREIGN KEY ("channel_id") REFERENCES "rhnchannel" ("id") DEFERRABLE;`,
+		`ALTER TABLE "rhnchannelpackage" ADD FOREIGN KEY ("package_id") REFERENCES "rhnpackage" ("id");`,
+		``,
+	}, "\n")
+	if ddl.String() != expected {
+		t.Errorf("Unexpected DDL:\n%s\nexpected:\n%s", ddl.String(), expected)
+	}
+	if err := WriteDDL([]Table{{Name: "t", Columns: []string{"evr"}, ColumnDefinitions: map[string]Column{"evr": {DataType: "USER-DEFINED"}}}}, &ddl); err == nil {
+		t.Errorf("A user defined column should be rejected")
+	}
+}
@@ -0,0 +1,132 @@
+package schemareader
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// MainUniqueIndexReason explains how the rows of the table are matched on the target: why its main unique index was
+// chosen or, without one, what the rows are matched by
+func MainUniqueIndexReason(table Table) string {
+	realIndexes := make(map[string]UniqueIndex)
+	for name, index := range table.UniqueIndexes {
+		if name != VirtualIndexName {
+			realIndexes[name] = index
+		}
+	}
+	chosen, reason := chooseMainUniqueIndex(realIndexes)
+	switch {
+	case table.IsDictionary:
+		return "dictionary table: the rows and the references to them are matched by label"
+	case table.MainUniqueIndexName == "" && table.IdOnly:
+		return fmt.Sprintf("%s: the rows are only matched by their primary key generated by %s", reason, table.PKSequence)
+	case table.MainUniqueIndexName == "":
+		return fmt.Sprintf("%s: the rows are matched by their primary key", reason)
+	case table.MainUniqueIndexName == VirtualIndexName && chosen == "" && len(table.PKColumns) == 0:
+		return "no primary key nor unique index: the rows are matched by all their columns but created and modified"
+	case table.MainUniqueIndexName == chosen:
+		return reason
+	case chosen == "":
+		// no index to name instead of the one of the rule, like for the tables with a primary key and a virtual index
+		return fmt.Sprintf("chose %s by a rule specific to the table: %s", table.MainUniqueIndexName, reason)
+	default:
+		return fmt.Sprintf("chose %s by a rule specific to the table instead of %s", table.MainUniqueIndexName, chosen)
+	}
+}
+
+// formatColumnMapping returns the columns of the reference as sorted column -> foreign column pairs
+func formatColumnMapping(reference Reference) string {
+	columns := make([]string, 0, len(reference.ColumnMapping))
+	for column := range reference.ColumnMapping {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	pairs := make([]string, 0, len(columns))
+	for _, column := range columns {
+		pairs = append(pairs, fmt.Sprintf("%s -> %s", column, reference.ColumnMapping[column]))
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// WriteTableDescription writes a human readable description of the table model, as the export sees it:
+// its columns, keys, references and how its rows are matched on the target
+func WriteTableDescription(table Table, w io.Writer) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "Table %s\n", table.Name)
+
+	fmt.Fprintf(out, "\nColumns:\n")
+	for _, column := range table.Columns {
+		definition := table.ColumnDefinitions[column]
+		line := fmt.Sprintf("  %s %s", column, definition.DataType)
+		if !definition.IsNullable {
+			line += " not null"
+		}
+		if definition.ColumnDefault != "" {
+			line += " default " + definition.ColumnDefault
+		}
+		if table.UnexportColumns[column] {
+			line += " (not exported)"
+		}
+		fmt.Fprintln(out, line)
+	}
+
+	pkColumns := make([]string, 0, len(table.PKColumns))
+	for _, column := range table.Columns {
+		if table.PKColumns[column] {
+			pkColumns = append(pkColumns, column)
+		}
+	}
+	if len(pkColumns) > 0 {
+		fmt.Fprintf(out, "\nPrimary key: %s\n", strings.Join(pkColumns, ", "))
+	} else {
+		fmt.Fprintf(out, "\nPrimary key: none\n")
+	}
+	if table.PKSequence != "" && table.PKSequenceColumn != "" {
+		fmt.Fprintf(out, "Primary key sequence: %s owned by %s\n", table.PKSequence, table.PKSequenceColumn)
+	} else if table.PKSequence != "" {
+		fmt.Fprintf(out, "Primary key sequence: %s\n", table.PKSequence)
+	}
+
+	fmt.Fprintf(out, "\nUnique indexes:\n")
+	for _, name := range sortedIndexNames(table.UniqueIndexes) {
+		index := table.UniqueIndexes[name]
+		line := fmt.Sprintf("  %s (%s)", name, strings.Join(index.Columns, ", "))
+		if index.Predicate != "" {
+			line += " WHERE " + index.Predicate
+		}
+		if name == table.MainUniqueIndexName {
+			line += " [main]"
+		}
+		fmt.Fprintln(out, line)
+	}
+	if table.MainUniqueIndexName != "" {
+		fmt.Fprintf(out, "Main unique index: %s\n", table.MainUniqueIndexName)
+	} else {
+		fmt.Fprintf(out, "Main unique index: none\n")
+	}
+	fmt.Fprintf(out, "  %s\n", MainUniqueIndexReason(table))
+
+	fmt.Fprintf(out, "\nReferences:\n")
+	for _, reference := range table.References {
+		line := fmt.Sprintf("  %s (%s)", reference.TableName, formatColumnMapping(reference))
+		if reference.Deferrable {
+			line += " deferrable"
+		}
+		if reference.UniqueIndexName != "" {
+			line += " matched by " + reference.UniqueIndexName
+		}
+		fmt.Fprintln(out, line)
+	}
+	fmt.Fprintf(out, "\nReferenced by:\n")
+	for _, reference := range table.ReferencedBy {
+		line := fmt.Sprintf("  %s (%s)", reference.TableName, formatColumnMapping(reference))
+		if reference.Deferrable {
+			line += " deferrable"
+		}
+		fmt.Fprintln(out, line)
+	}
+	return out.Flush()
+}
@@ -0,0 +1,106 @@
+package schemareader
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteTableDescription(t *testing.T) {
+
+	// Arrange
+	table := Table{
+		Name:    "rhnchannel",
+		Columns: []string{"id", "label", "name", "parent_channel"},
+		ColumnDefinitions: map[string]Column{
+			"id":             {Name: "id", DataType: "numeric"},
+			"label":          {Name: "label", DataType: "character varying"},
+			"name":           {Name: "name", DataType: "character varying"},
+			"parent_channel": {Name: "parent_channel", DataType: "numeric", IsNullable: true},
+		},
+		PKColumns:  map[string]bool{"id": true},
+		PKSequence: "rhn_channel_id_seq",
+		UniqueIndexes: map[string]UniqueIndex{
+			"rhn_channel_label_uq": {Name: "rhn_channel_label_uq", Columns: []string{"label"}},
+			"rhn_channel_name_uq":  {Name: "rhn_channel_name_uq", Columns: []string{"name"}},
+		},
+		MainUniqueIndexName: "rhn_channel_label_uq",
+		References:          []Reference{{TableName: "rhnchannel", ColumnMapping: map[string]string{"parent_channel": "id"}}},
+		ReferencedBy: []Reference{
+			{TableName: "rhnchannel", ColumnMapping: map[string]string{"parent_channel": "id"}},
+			{TableName: "rhnchannelpackage", ColumnMapping: map[string]string{"channel_id": "id"}, Deferrable: true},
+		},
+	}
+	var buffer bytes.Buffer
+
+	// Act
+	err := WriteTableDescription(table, &buffer)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error writing the description: %s", err)
+	}
+	expected := `Table rhnchannel
+
+Columns:
+  id numeric not null
+  label character varying not null
+  name character varying not null
+  parent_channel numeric
+
+Primary key: id
+Primary key sequence: rhn_channel_id_seq
+
+Unique indexes:
+  rhn_channel_label_uq (label) [main]
+  rhn_channel_name_uq (name)
+Main unique index: rhn_channel_label_uq
+  chose rhn_channel_label_uq because it contains 'label'
+
+References:
+  rhnchannel (parent_channel -> id)
+
+Referenced by:
+  rhnchannel (parent_channel -> id)
+  rhnchannelpackage (channel_id -> id) deferrable
+`
+	if buffer.String() != expected {
+		t.Errorf("Description does not match: expected\n%s\ngot\n%s", expected, buffer.String())
+	}
+}
+
+func TestMainUniqueIndexReason(t *testing.T) {
+
+	// Arrange
+	twoIndexes := map[string]UniqueIndex{
+		"rhn_errata_adv_org_uq": {Name: "rhn_errata_adv_org_uq", Columns: []string{"advisory", "org_id"}},
+		"rhn_errata_advname_uq": {Name: "rhn_errata_advname_uq", Columns: []string{"advisory_name", "org_id"}},
+		"rhn_errata_partial_uq": {Name: "rhn_errata_partial_uq", Columns: []string{"advisory", "org_id", "id"}, Predicate: "org_id IS NULL"},
+	}
+	cases := map[string]Table{
+		"chose rhn_errata_adv_org_uq because no index contains 'label', 'name' or 'token' and it has the most columns (2)": {
+			UniqueIndexes: twoIndexes, MainUniqueIndexName: "rhn_errata_adv_org_uq"},
+		"chose rhn_errata_advname_uq by a rule specific to the table instead of rhn_errata_adv_org_uq": {
+			UniqueIndexes: twoIndexes, MainUniqueIndexName: "rhn_errata_advname_uq"},
+		"no unique index without predicate: the rows are only matched by their primary key generated by rhn_id_seq": {
+			PKColumns: map[string]bool{"id": true}, PKSequence: "rhn_id_seq", IdOnly: true},
+		"no primary key nor unique index: the rows are matched by all their columns but created and modified": {
+			UniqueIndexes:       map[string]UniqueIndex{VirtualIndexName: {Name: VirtualIndexName, Columns: []string{"a", "b"}}},
+			MainUniqueIndexName: VirtualIndexName},
+		"chose virtual_main_unique_index by a rule specific to the table: no unique index without predicate": {
+			PKColumns:           map[string]bool{"id": true},
+			UniqueIndexes:       map[string]UniqueIndex{VirtualIndexName: {Name: VirtualIndexName, Columns: []string{"name_id", "evr_id"}}},
+			MainUniqueIndexName: VirtualIndexName},
+		"dictionary table: the rows and the references to them are matched by label": {
+			IsDictionary: true, MainUniqueIndexName: VirtualIndexName},
+	}
+
+	for expected, table := range cases {
+		// Act
+		reason := MainUniqueIndexReason(table)
+
+		// Assert
+		if reason != expected {
+			t.Errorf("Unexpected reason: expected %q, got %q", expected, reason)
+		}
+	}
+}
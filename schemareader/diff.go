@@ -0,0 +1,129 @@
+package schemareader
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// DiffSchemas compares the tables read from the source and target databases.
+// It returns a description of each difference which can make the import fail, sorted by table:
+// missing tables, columns only on one side or with another type, other primary key, unique indexes or references.
+func DiffSchemas(source map[string]Table, target map[string]Table) []string {
+	tableNames := make(map[string]bool)
+	for name := range source {
+		tableNames[name] = true
+	}
+	for name := range target {
+		tableNames[name] = true
+	}
+	sortedNames := make([]string, 0, len(tableNames))
+	for name := range tableNames {
+		sortedNames = append(sortedNames, name)
+	}
+	sort.Strings(sortedNames)
+
+	differences := make([]string, 0)
+	for _, name := range sortedNames {
+		sourceTable, onSource := source[name]
+		targetTable, onTarget := target[name]
+		switch {
+		case !onTarget:
+			differences = append(differences, fmt.Sprintf("table %s: missing on the target", name))
+		case !onSource:
+			differences = append(differences, fmt.Sprintf("table %s: missing on the source", name))
+		default:
+			differences = append(differences, diffTables(sourceTable, targetTable)...)
+		}
+	}
+	return differences
+}
+
+// diffTables compares the definition of a table on the source and the target
+func diffTables(source Table, target Table) []string {
+	differences := make([]string, 0)
+	for _, column := range source.Columns {
+		targetColumn, ok := target.ColumnDefinitions[column]
+		if !ok {
+			differences = append(differences, fmt.Sprintf("table %s: column %s missing on the target", source.Name, column))
+			continue
+		}
+		if sourceType := source.ColumnDefinitions[column].DataType; sourceType != targetColumn.DataType {
+			differences = append(differences, fmt.Sprintf("table %s: column %s is %s on the source and %s on the target",
+				source.Name, column, sourceType, targetColumn.DataType))
+		}
+	}
+	for _, column := range target.Columns {
+		if _, ok := source.ColumnDefinitions[column]; !ok {
+			differences = append(differences, fmt.Sprintf("table %s: column %s missing on the source", source.Name, column))
+		}
+	}
+
+	if sourcePK, targetPK := sortedKeys(source.PKColumns), sortedKeys(target.PKColumns); !reflect.DeepEqual(sourcePK, targetPK) {
+		differences = append(differences, fmt.Sprintf("table %s: primary key is (%s) on the source and (%s) on the target",
+			source.Name, strings.Join(sourcePK, ", "), strings.Join(targetPK, ", ")))
+	}
+
+	differences = append(differences, diffDescriptions(source.Name, "unique index",
+		uniqueIndexDescriptions(source), uniqueIndexDescriptions(target))...)
+	differences = append(differences, diffDescriptions(source.Name, "reference",
+		referenceDescriptions(source), referenceDescriptions(target))...)
+	return differences
+}
+
+// diffDescriptions reports the descriptions only present on one side
+func diffDescriptions(tableName string, kind string, source map[string]bool, target map[string]bool) []string {
+	differences := make([]string, 0)
+	for _, description := range sortedKeys(source) {
+		if !target[description] {
+			differences = append(differences, fmt.Sprintf("table %s: %s %s missing on the target", tableName, kind, description))
+		}
+	}
+	for _, description := range sortedKeys(target) {
+		if !source[description] {
+			differences = append(differences, fmt.Sprintf("table %s: %s %s missing on the source", tableName, kind, description))
+		}
+	}
+	return differences
+}
+
+// uniqueIndexDescriptions describes the unique indexes read from the database by their name, columns and predicate
+func uniqueIndexDescriptions(table Table) map[string]bool {
+	result := make(map[string]bool)
+	for name, index := range table.UniqueIndexes {
+		if name == VirtualIndexName {
+			continue
+		}
+		description := fmt.Sprintf("%s (%s)", name, strings.Join(index.Columns, ", "))
+		if index.Predicate != "" {
+			description = fmt.Sprintf("%s WHERE %s", description, index.Predicate)
+		}
+		result[description] = true
+	}
+	return result
+}
+
+// referenceDescriptions describes the references by their table and column mapping
+func referenceDescriptions(table Table) map[string]bool {
+	result := make(map[string]bool)
+	for _, reference := range table.References {
+		mapping := make([]string, 0, len(reference.ColumnMapping))
+		for column, foreignColumn := range reference.ColumnMapping {
+			mapping = append(mapping, fmt.Sprintf("%s = %s", column, foreignColumn))
+		}
+		sort.Strings(mapping)
+		result[fmt.Sprintf("to %s (%s)", reference.TableName, strings.Join(mapping, ", "))] = true
+	}
+	return result
+}
+
+// sortedKeys returns the keys of the set in lexicographic order
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
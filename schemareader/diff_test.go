@@ -0,0 +1,62 @@
+package schemareader
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffSchemas(t *testing.T) {
+
+	// Arrange
+	channel := func(extraColumn string, labelType string) Table {
+		table := Table{
+			Name:    "rhnchannel",
+			Columns: []string{"id", "label", extraColumn},
+			ColumnDefinitions: map[string]Column{
+				"id":        {Name: "id", DataType: "numeric"},
+				"label":     {Name: "label", DataType: labelType},
+				extraColumn: {Name: extraColumn, DataType: "numeric"},
+			},
+			PKColumns: map[string]bool{"id": true},
+			UniqueIndexes: map[string]UniqueIndex{
+				"rhn_channel_label_uq": {Name: "rhn_channel_label_uq", Columns: []string{"label"}},
+				VirtualIndexName:       {Name: VirtualIndexName, Columns: []string{"label", extraColumn}},
+			},
+			References: []Reference{{TableName: "rhnchannelarch", ColumnMapping: map[string]string{"channel_arch_id": "id"}}},
+		}
+		return table
+	}
+	source := map[string]Table{
+		"rhnchannel":     channel("channel_arch_id", "character varying"),
+		"rhnchannelarch": {Name: "rhnchannelarch"},
+		"rhnerrata":      {Name: "rhnerrata"},
+	}
+	targetChannel := channel("org_id", "text")
+	targetChannel.References = append(targetChannel.References,
+		Reference{TableName: "web_customer", ColumnMapping: map[string]string{"org_id": "id"}})
+	target := map[string]Table{
+		"rhnchannel":     targetChannel,
+		"rhnchannelarch": {Name: "rhnchannelarch"},
+		"web_customer":   {Name: "web_customer"},
+	}
+
+	// Act
+	differences := DiffSchemas(source, target)
+	identical := DiffSchemas(source, source)
+
+	// Assert
+	expected := []string{
+		"table rhnchannel: column label is character varying on the source and text on the target",
+		"table rhnchannel: column channel_arch_id missing on the target",
+		"table rhnchannel: column org_id missing on the source",
+		"table rhnchannel: reference to web_customer (org_id = id) missing on the source",
+		"table rhnerrata: missing on the target",
+		"table web_customer: missing on the source",
+	}
+	if !reflect.DeepEqual(differences, expected) {
+		t.Errorf("Differences do not match: expected\n%v\ngot\n%v", expected, differences)
+	}
+	if len(identical) != 0 {
+		t.Errorf("Identical schemas should have no difference, got %v", identical)
+	}
+}
@@ -2,6 +2,8 @@ package schemareader
 
 import (
 	"fmt"
+	"io"
+	"sort"
 	"strings"
 )
 
@@ -58,3 +60,33 @@ func DumpToGraphviz(tables map[string]Table) {
 
 	fmt.Printf("}")
 }
+
+// WriteDependencyGraph writes a dot digraph of the tables with an edge from each table to the tables it references,
+// labeled with the column mapping. Use:
+// go run . dot --dependencies | dot -Tpng > dependencies.png
+func WriteDependencyGraph(tables map[string]Table, w io.Writer) error {
+	tableNames := make([]string, 0, len(tables))
+	for name := range tables {
+		tableNames = append(tableNames, name)
+	}
+	sort.Strings(tableNames)
+
+	lines := []string{"digraph dependencies {"}
+	for _, name := range tableNames {
+		lines = append(lines, fmt.Sprintf("  \"%s\" [shape=box];", name))
+	}
+	for _, name := range tableNames {
+		for _, reference := range tables[name].References {
+			mapping := make([]string, 0, len(reference.ColumnMapping))
+			for column, foreignColumn := range reference.ColumnMapping {
+				mapping = append(mapping, fmt.Sprintf("%s = %s", column, foreignColumn))
+			}
+			sort.Strings(mapping)
+			lines = append(lines, fmt.Sprintf("  \"%s\" -> \"%s\" [label=\"%s\"];", name, reference.TableName, strings.Join(mapping, "\\n")))
+		}
+	}
+	lines = append(lines, "}")
+
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
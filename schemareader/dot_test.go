@@ -0,0 +1,37 @@
+package schemareader
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteDependencyGraph(t *testing.T) {
+
+	// Arrange
+	tables := map[string]Table{
+		"rhnchannel": {Name: "rhnchannel", References: []Reference{
+			{TableName: "rhnchannel", ColumnMapping: map[string]string{"parent_channel": "id"}},
+			{TableName: "rhnchannelarch", ColumnMapping: map[string]string{"channel_arch_id": "id"}},
+		}},
+		"rhnchannelarch": {Name: "rhnchannelarch"},
+	}
+	var buffer bytes.Buffer
+
+	// Act
+	err := WriteDependencyGraph(tables, &buffer)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error writing the graph: %s", err)
+	}
+	expected := `digraph dependencies {
+  "rhnchannel" [shape=box];
+  "rhnchannelarch" [shape=box];
+  "rhnchannel" -> "rhnchannel" [label="parent_channel = id"];
+  "rhnchannel" -> "rhnchannelarch" [label="channel_arch_id = id"];
+}
+`
+	if buffer.String() != expected {
+		t.Errorf("Graph does not match: expected\n%s\ngot\n%s", expected, buffer.String())
+	}
+}
@@ -0,0 +1,26 @@
+package schemareader
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// DumpSchemaJSON writes the tables as indented JSON, sorted by name, to compare the model read from two servers.
+// The maps, like the primary key columns and the unique indexes, are written with sorted keys.
+func DumpSchemaJSON(tables []Table, w io.Writer) error {
+	sortedTables := make([]Table, len(tables))
+	copy(sortedTables, tables)
+	sort.SliceStable(sortedTables, func(i, j int) bool {
+		return sortedTables[i].Name < sortedTables[j].Name
+	})
+	data, err := json.MarshalIndent(sortedTables, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding the schema: %w", err)
+	}
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("writing the schema: %w", err)
+	}
+	return nil
+}
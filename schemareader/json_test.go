@@ -0,0 +1,44 @@
+package schemareader
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDumpSchemaJSON(t *testing.T) {
+
+	// Arrange
+	tables := []Table{
+		{Name: "rhnchannelarch", PKColumns: map[string]bool{"id": true}},
+		{Name: "rhnchannel", PKColumns: map[string]bool{"id": true, "org_id": true}, PKSequence: "rhn_channel_id_seq",
+			UniqueIndexes: map[string]UniqueIndex{
+				"rhn_channel_name_uq":  {Name: "rhn_channel_name_uq", Columns: []string{"name"}},
+				"rhn_channel_label_uq": {Name: "rhn_channel_label_uq", Columns: []string{"label"}},
+			},
+			MainUniqueIndexName: "rhn_channel_label_uq"},
+	}
+	var first, second bytes.Buffer
+
+	// Act
+	err := DumpSchemaJSON(tables, &first)
+	DumpSchemaJSON([]Table{tables[1], tables[0]}, &second)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error writing the schema: %s", err)
+	}
+	output := first.String()
+	if first.String() != second.String() {
+		t.Errorf("The output should not depend on the tables order")
+	}
+	if strings.Index(output, `"Name": "rhnchannel"`) > strings.Index(output, `"Name": "rhnchannelarch"`) {
+		t.Errorf("Tables should be sorted by name, got %s", output)
+	}
+	if !strings.Contains(output, "\"PKColumns\": {\n      \"id\": true,\n      \"org_id\": true\n    }") {
+		t.Errorf("Primary key columns should be sorted, got %s", output)
+	}
+	if strings.Index(output, `"rhn_channel_label_uq": {`) > strings.Index(output, `"rhn_channel_name_uq": {`) {
+		t.Errorf("Unique indexes should be sorted, got %s", output)
+	}
+}
@@ -0,0 +1,23 @@
+package schemareader
+
+import (
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// packageLogger is the logger set with SetLogger
+var packageLogger *zerolog.Logger
+
+// SetLogger routes the diagnostic events of the package, like the ignored tables and foreign keys,
+// to the given logger instead of the global one. It is meant to be called before reading any schema.
+func SetLogger(logger zerolog.Logger) {
+	packageLogger = &logger
+}
+
+// logger returns the logger set with SetLogger, or the global one
+func logger() *zerolog.Logger {
+	if packageLogger != nil {
+		return packageLogger
+	}
+	return &log.Logger
+}
@@ -0,0 +1,80 @@
+package schemareader
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/rs/zerolog"
+	"github.com/uyuni-project/inter-server-sync/tests"
+)
+
+func TestNullableMainUniqueIndexWarning(t *testing.T) {
+
+	// Arrange
+	var output bytes.Buffer
+	SetLogger(zerolog.New(&output))
+	defer func() { packageLogger = nil }()
+	repo := tests.CreateDataRepository()
+	repo.ExpectWithRecords(ReadColumnNames,
+		sqlmock.NewRows([]string{"column_name", "data_type", "nullable", "column_default"}).
+			AddRow("id", "numeric", false, "").
+			AddRow("advisory", "character varying", false, "").
+			AddRow("org_id", "numeric", true, ""),
+		"rhnerrata", DefaultSchemaName)
+	repo.ExpectWithRecords(ReadIndexes,
+		indexRows().AddRow("rhn_errata_id_pk", true, "{id}", "").AddRow("rhn_errata_adv_org_uq", false, "{advisory,org_id}", ""),
+		"rhnerrata", DefaultSchemaName)
+	repo.ExpectWithRecords(ReadPkSequence, sequenceRows(), "rhnerrata", DefaultSchemaName)
+	repo.ExpectWithRecords(ReadReferenceConstraintNames, sqlmock.NewRows([]string{"constraint_name"}), "rhnerrata", DefaultSchemaName)
+	repo.ExpectWithRecords(ReadReferencedByConstraintNames, sqlmock.NewRows([]string{"constraint_name"}), "rhnerrata", DefaultSchemaName)
+
+	// Act
+	table, _, err := processTable(context.Background(), repo.DB, DefaultSchemaName, "rhnerrata", true, nil)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error processing the table: %s", err)
+	}
+	if table.MainUniqueIndexName != "rhn_errata_adv_org_uq" {
+		t.Errorf("The nullable index should still be the main one, got %s", table.MainUniqueIndexName)
+	}
+	event := output.String()
+	if !strings.Contains(event, `"level":"warn","table":"rhnerrata","index":"rhn_errata_adv_org_uq"`) ||
+		!strings.Contains(event, "has nullable columns org_id:") {
+		t.Errorf("Nullable main unique index should be reported, got %s", event)
+	}
+}
+
+func TestSetLogger(t *testing.T) {
+
+	// Arrange
+	var output bytes.Buffer
+	SetLogger(zerolog.New(&output))
+	defer func() { packageLogger = nil }()
+	tables := map[string]Table{
+		"child": {Name: "child", Columns: []string{"id", "parent_id"},
+			References: []Reference{{TableName: "parent", ColumnMapping: map[string]string{"parent_id": "id"}}}},
+	}
+
+	// Act
+	ReportInvalidReferences(tables)
+	_, err := singleConstraintTable("child", "child_other_fk", []string{})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	events := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %v", events)
+	}
+	if !strings.Contains(events[0], `"table":"child","referenced_table":"parent"`) {
+		t.Errorf("Invalid reference event should have the table fields, got %s", events[0])
+	}
+	if !strings.Contains(events[1], `"table":"child","constraint":"child_other_fk"`) {
+		t.Errorf("Ignored foreign key event should have the table fields, got %s", events[1])
+	}
+}
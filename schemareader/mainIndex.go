@@ -0,0 +1,29 @@
+package schemareader
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ApplyMainIndexColumns overrides the main unique index chosen when reading the schema, for the tables whose natural
+// key is not found by the label, name and token preference: the main index of each given table becomes its unique
+// index on the given column. It fails if the table has no such index or is a dictionary table, matched by label.
+func ApplyMainIndexColumns(tables map[string]Table, columns map[string]string) error {
+	for tableName, column := range columns {
+		table, ok := tables[strings.ToLower(tableName)]
+		if !ok {
+			continue
+		}
+		if table.IsDictionary {
+			return fmt.Errorf("table %s is a dictionary table: its rows are matched by label", table.Name)
+		}
+		indexName := findIndex(fullUniqueIndexes(table.UniqueIndexes), column)
+		if indexName == "" {
+			return fmt.Errorf("table %s has no unique index on column %s", table.Name, column)
+		}
+		table.MainUniqueIndexName = indexName
+		table.IdOnly = false
+		tables[table.Name] = table
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package schemareader
+
+import "testing"
+
+func TestApplyMainIndexColumns(t *testing.T) {
+	// Arrange
+	tables := map[string]Table{
+		"rhnchecksum": {
+			Name: "rhnchecksum",
+			UniqueIndexes: map[string]UniqueIndex{
+				"rhn_checksum_a_uq": {Name: "rhn_checksum_a_uq", Columns: []string{"id", "org_id"}},
+				"rhn_checksum_b_uq": {Name: "rhn_checksum_b_uq", Columns: []string{"checksum", "checksum_type_id"}},
+				"rhn_checksum_p_uq": {Name: "rhn_checksum_p_uq", Columns: []string{"name"}, Predicate: "org_id IS NULL"},
+			},
+			MainUniqueIndexName: "rhn_checksum_a_uq",
+		},
+		"rhnchecksumtype": {Name: "rhnchecksumtype", IsDictionary: true},
+	}
+
+	// Act
+	err := ApplyMainIndexColumns(tables, map[string]string{"RHNCHECKSUM": "checksum", "missing": "label"})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if tables["rhnchecksum"].MainUniqueIndexName != "rhn_checksum_b_uq" {
+		t.Errorf("Unexpected main unique index: %s", tables["rhnchecksum"].MainUniqueIndexName)
+	}
+	if err := ApplyMainIndexColumns(tables, map[string]string{"rhnchecksum": "name"}); err == nil {
+		t.Errorf("A partial index should not be chosen")
+	}
+	if err := ApplyMainIndexColumns(tables, map[string]string{"rhnchecksumtype": "label"}); err == nil {
+		t.Errorf("A dictionary table should keep being matched by label")
+	}
+}
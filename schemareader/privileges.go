@@ -0,0 +1,128 @@
+package schemareader
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+type unreadableColumn struct {
+	tableName  string
+	columnName string
+	nullable   bool
+	hasDefault bool
+}
+
+func readUnreadableColumns(db *sql.DB, schema string) ([]unreadableColumn, error) {
+	sql := ReadUnreadableColumns
+	rows, cancel, err := queryContext(context.Background(), db, sql, schema)
+	if err != nil {
+		return nil, fmt.Errorf("reading column privileges with %q: %w", sql, err)
+	}
+	defer cancel()
+	defer rows.Close()
+
+	result := make([]unreadableColumn, 0)
+	for rows.Next() {
+		var column unreadableColumn
+		err := rows.Scan(&column.tableName, &column.columnName, &column.nullable, &column.hasDefault)
+		if err != nil {
+			return nil, fmt.Errorf("reading column privileges: %w", err)
+		}
+		result = append(result, column)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading column privileges: %w", err)
+	}
+
+	return result, nil
+}
+
+// isKeyColumn tells if the column identifies rows of the table or of the tables linked to it
+func isKeyColumn(table Table, columnName string) bool {
+	if table.PKColumns[columnName] {
+		return true
+	}
+	for _, index := range table.UniqueIndexes {
+		for _, column := range index.Columns {
+			if strings.Compare(column, columnName) == 0 {
+				return true
+			}
+		}
+	}
+	for _, reference := range table.References {
+		if _, ok := reference.ColumnMapping[columnName]; ok {
+			return true
+		}
+	}
+	for _, reference := range table.ReferencedBy {
+		for _, foreignColumn := range reference.ColumnMapping {
+			if strings.Compare(foreignColumn, columnName) == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func removeColumn(table Table, columnName string) Table {
+	columns := make([]string, 0)
+	columnIndexes := make(map[string]int)
+	for _, column := range table.Columns {
+		if strings.Compare(column, columnName) != 0 {
+			columnIndexes[column] = len(columns)
+			columns = append(columns, column)
+		}
+	}
+	table.Columns = columns
+	table.ColumnIndexes = columnIndexes
+	delete(table.ColumnDefinitions, columnName)
+	delete(table.UnexportColumns, columnName)
+	return table
+}
+
+// ApplyColumnPrivileges checks the connecting role can read all the columns of the tables before exporting them.
+// Unreadable columns which can be left to their default value on the target are dropped from the export with a warning.
+// The nullability and default are taken from the source schema, expected to be the same as the target one.
+// An error listing the columns is returned if some of them are required: keys, references or mandatory values.
+func ApplyColumnPrivileges(db *sql.DB, tables map[string]Table) error {
+	return ApplyColumnPrivilegesInSchema(db, DefaultSchemaName, tables)
+}
+
+// ApplyColumnPrivilegesInSchema is ApplyColumnPrivileges for the tables of the given database schema, public if empty
+func ApplyColumnPrivilegesInSchema(db *sql.DB, schema string, tables map[string]Table) error {
+	if schema == "" {
+		schema = DefaultSchemaName
+	}
+	unreadableColumns, err := readUnreadableColumns(db, schema)
+	if err != nil {
+		return err
+	}
+	requiredColumns := make([]string, 0)
+	for _, column := range unreadableColumns {
+		table, ok := tables[column.tableName]
+		if !ok {
+			continue
+		}
+		if _, ok := table.ColumnIndexes[column.columnName]; !ok {
+			continue
+		}
+		qualifiedName := fmt.Sprintf("%s.%s", column.tableName, column.columnName)
+		if isKeyColumn(table, column.columnName) {
+			requiredColumns = append(requiredColumns, qualifiedName+" (key or reference)")
+			continue
+		}
+		if !column.nullable && !column.hasDefault {
+			requiredColumns = append(requiredColumns, qualifiedName+" (not null without default)")
+			continue
+		}
+		logger().Warn().Str("table", column.tableName).Str("column", column.columnName).
+			Msgf("No SELECT privilege on column %s: it is not exported and gets its default value on the target", qualifiedName)
+		tables[column.tableName] = removeColumn(table, column.columnName)
+	}
+	if len(requiredColumns) > 0 {
+		return fmt.Errorf("no SELECT privilege on columns required by the export: %s", strings.Join(requiredColumns, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package schemareader
+
+// ProgressFunc is called after each table is processed, index counting the processed tables out of total
+type ProgressFunc func(tableName string, index, total int)
+
+// progressFunc is the function set with SetProgress
+var progressFunc ProgressFunc
+
+// SetProgress sets the function called after reading the schema of each table, nil to disable it.
+// The tables read to resolve the references are counted in additional rounds, one per level of references.
+// The function is never called concurrently, even with several IntrospectionWorkers.
+func SetProgress(progress ProgressFunc) {
+	progressFunc = progress
+}
+
+// reportProgress calls the function set with SetProgress, if any
+func reportProgress(tableName string, index, total int) {
+	if progressFunc != nil {
+		progressFunc(tableName, index, total)
+	}
+}
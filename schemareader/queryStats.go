@@ -0,0 +1,56 @@
+package schemareader
+
+import (
+	"sync"
+	"time"
+)
+
+// QueryHook is called after each query run to read the schema, with the time the database took to answer it
+type QueryHook func(query string, duration time.Duration)
+
+// queryHook is the function set with SetQueryHook
+var queryHook QueryHook
+
+// SetQueryHook sets the function called after each query run to read the schema, nil to disable it.
+// Each attempt of a retried query is reported.
+// The function is called concurrently when reading the tables with several IntrospectionWorkers.
+func SetQueryHook(hook QueryHook) {
+	queryHook = hook
+}
+
+// reportQuery calls the function set with SetQueryHook, if any
+func reportQuery(query string, duration time.Duration) {
+	if queryHook != nil {
+		queryHook(query, duration)
+	}
+}
+
+// QueryStats counts the queries run to read the schema and their cumulated duration.
+// Its Record method is a QueryHook.
+type QueryStats struct {
+	lock     sync.Mutex
+	queries  int
+	duration time.Duration
+}
+
+// Record adds a query to the stats
+func (stats *QueryStats) Record(query string, duration time.Duration) {
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+	stats.queries++
+	stats.duration += duration
+}
+
+// Queries returns the number of queries recorded
+func (stats *QueryStats) Queries() int {
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+	return stats.queries
+}
+
+// Duration returns the cumulated duration of the queries recorded
+func (stats *QueryStats) Duration() time.Duration {
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+	return stats.duration
+}
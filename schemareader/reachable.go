@@ -0,0 +1,34 @@
+package schemareader
+
+import "sort"
+
+// ReachableTables returns the sorted names of the seed tables and of all the tables they reference, directly or not.
+// The tables referenced but missing from the tables are listed without following their own references.
+func ReachableTables(tables map[string]Table, seeds ...string) []string {
+	reached := make(map[string]bool)
+	queue := make([]string, 0, len(seeds))
+	for _, seed := range seeds {
+		seed = unquoteIdentifier(seed)
+		if !reached[seed] {
+			reached[seed] = true
+			queue = append(queue, seed)
+		}
+	}
+	for len(queue) > 0 {
+		table := tables[queue[0]]
+		queue = queue[1:]
+		for _, reference := range table.References {
+			if !reached[reference.TableName] {
+				reached[reference.TableName] = true
+				queue = append(queue, reference.TableName)
+			}
+		}
+	}
+
+	result := make([]string, 0, len(reached))
+	for name := range reached {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
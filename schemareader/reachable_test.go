@@ -0,0 +1,37 @@
+package schemareader
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReachableTables(t *testing.T) {
+
+	// Arrange
+	reference := func(tableName string) Reference {
+		return Reference{TableName: tableName, ColumnMapping: map[string]string{tableName + "_id": "id"}}
+	}
+	tables := map[string]Table{
+		"rhnchannel":       {Name: "rhnchannel", References: []Reference{reference("rhnchannelarch"), reference("web_customer"), reference("rhnchannel")}},
+		"rhnchannelarch":   {Name: "rhnchannelarch", References: []Reference{reference("rhnarchtype")}},
+		"rhnarchtype":      {Name: "rhnarchtype"},
+		"web_customer":     {Name: "web_customer"},
+		"rhnchannelfamily": {Name: "rhnchannelfamily", References: []Reference{reference("web_customer")}},
+		// the referenced rhnproductname table is missing from the tables
+		"rhnchannelproduct": {Name: "rhnchannelproduct", References: []Reference{reference("rhnproductname")}},
+	}
+
+	// Act
+	reachable := ReachableTables(tables, "rhnChannel")
+	reachableWithProducts := ReachableTables(tables, "rhnchannel", "rhnchannelproduct")
+
+	// Assert
+	expected := []string{"rhnarchtype", "rhnchannel", "rhnchannelarch", "web_customer"}
+	if !reflect.DeepEqual(reachable, expected) {
+		t.Errorf("Reachable tables do not match: expected %v, got %v", expected, reachable)
+	}
+	expected = []string{"rhnarchtype", "rhnchannel", "rhnchannelarch", "rhnchannelproduct", "rhnproductname", "web_customer"}
+	if !reflect.DeepEqual(reachableWithProducts, expected) {
+		t.Errorf("Reachable tables do not match: expected %v, got %v", expected, reachableWithProducts)
+	}
+}
@@ -1,265 +1,272 @@
 package schemareader
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 
-	"github.com/rs/zerolog/log"
+	"github.com/lib/pq"
 )
 
-func readTableNames(db *sql.DB) []string {
-	sql := `SELECT table_name
-		FROM information_schema.tables
-		WHERE table_schema = 'public'
-			AND table_type = 'BASE TABLE';`
-
-	rows, err := db.Query(sql)
+// readStrings runs a query returning a single text column and collects its values
+func readStrings(ctx context.Context, db *sql.DB, query string, args ...interface{}) ([]string, error) {
+	rows, cancel, err := queryContext(ctx, db, query, args...)
 	if err != nil {
-		log.Panic().Err(err).Msg("error executing database query")
+		return nil, fmt.Errorf("executing %q: %w", query, err)
 	}
+	defer cancel()
+	defer rows.Close()
 
 	result := make([]string, 0)
 	for rows.Next() {
-		var tableName string
-		err := rows.Scan(&tableName)
+		var value string
+		err := rows.Scan(&value)
 		if err != nil {
-			log.Panic().Err(err).Msg("error extracting row")
+			return nil, fmt.Errorf("extracting row of %q: %w", query, err)
 		}
-		result = append(result, tableName)
+		result = append(result, value)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating rows of %q: %w", query, err)
 	}
 
-	return result
+	return result, nil
 }
 
-func readColumnNames(db *sql.DB, tableName string) []string {
-	sql := `SELECT column_name
-		FROM information_schema.columns
-		WHERE table_schema = 'public' AND table_name = $1
-		ORDER BY ordinal_position;`
-
-	rows, err := db.Query(sql, tableName)
-	if err != nil {
-		log.Panic().Err(err).Msg("error accessing the database")
+// readString runs a query returning a single text column and returns the first value, or an empty string
+func readString(ctx context.Context, db *sql.DB, query string, args ...interface{}) (string, error) {
+	values, err := readStrings(ctx, db, query, args...)
+	if err != nil || len(values) == 0 {
+		return "", err
 	}
-	defer rows.Close()
-
-	result := make([]string, 0)
-	for rows.Next() {
-		var columnName string
-		err := rows.Scan(&columnName)
-		if err != nil {
-			log.Panic().Err(err).Msg("error extracting row")
-		}
-		result = append(result, columnName)
-	}
-
-	return result
+	return values[0], nil
 }
 
-func readPKColumnNames(db *sql.DB, tableName string) []string {
-	// https://wiki.postgresql.org/wiki/Retrieve_primary_key_columns
-	sql := `SELECT a.attname
-		FROM pg_index i
-		JOIN pg_attribute a ON a.attrelid = i.indrelid
-			AND a.attnum = ANY(i.indkey)
-		WHERE  i.indrelid = $1::regclass
-		AND    i.indisprimary;`
+func readTableNames(ctx context.Context, db *sql.DB, schema string) ([]string, error) {
+	sql := `SELECT table_name
+		FROM information_schema.tables
+		WHERE table_schema = $1
+			AND table_type = 'BASE TABLE';`
 
-	rows, err := db.Query(sql, tableName)
+	result, err := readStrings(ctx, db, sql, schema)
 	if err != nil {
-		log.Panic().Err(err).Msg("error executing query")
-	}
-	defer rows.Close()
-
-	result := make([]string, 0)
-	for rows.Next() {
-		var columnName string
-		err := rows.Scan(&columnName)
-		if err != nil {
-			log.Panic().Err(err).Msg("error getting row data")
-		}
-		result = append(result, columnName)
+		return nil, fmt.Errorf("reading table names: %w", err)
 	}
-
-	return result
+	return result, nil
 }
 
-func readUniqueIndexNames(db *sql.DB, tableName string) []string {
-	sql := `SELECT DISTINCT indexrelid::regclass
-		FROM pg_index i
-		JOIN pg_attribute a ON a.attrelid = i.indrelid
-			AND a.attnum = ANY(i.indkey)
-		WHERE i.indrelid = $1::regclass
-		AND i.indisunique AND NOT i.indisprimary;`
+func readColumns(ctx context.Context, db *sql.DB, schema string, tableName string) ([]Column, error) {
+	sql := ReadColumnNames
 
-	rows, err := db.Query(sql, tableName)
+	rows, cancel, err := queryContext(ctx, db, sql, tableName, schema)
 	if err != nil {
-		log.Panic().Err(err).Msg("error executing query")
+		return nil, fmt.Errorf("reading columns for %s: executing %q: %w", tableName, sql, err)
 	}
+	defer cancel()
 	defer rows.Close()
 
-	result := make([]string, 0)
+	result := make([]Column, 0)
 	for rows.Next() {
-		var name string
-		err := rows.Scan(&name)
+		var column Column
+		err := rows.Scan(&column.Name, &column.DataType, &column.IsNullable, &column.ColumnDefault)
 		if err != nil {
-			log.Panic().Err(err).Msg("error getting column data")
+			return nil, fmt.Errorf("reading columns for %s: extracting row of %q: %w", tableName, sql, err)
 		}
-		result = append(result, name)
+		result = append(result, column)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading columns for %s: iterating rows of %q: %w", tableName, sql, err)
 	}
 
-	return result
+	return result, nil
 }
 
-func readIndexColumns(db *sql.DB, indexName string) []string {
-	sql := `SELECT DISTINCT a.attname
+// readIndexes reads the primary key columns and the other unique indexes of the table at once
+func readIndexes(ctx context.Context, db *sql.DB, schema string, tableName string) ([]string, map[string]UniqueIndex, error) {
+	// https://wiki.postgresql.org/wiki/Retrieve_primary_key_columns
+	sql := `SELECT ic.relname::text, i.indisprimary, array_agg(DISTINCT a.attname::text ORDER BY a.attname::text),
+			coalesce(pg_get_expr(i.indpred, i.indrelid), '')
 		FROM pg_index i
+		JOIN pg_class ic ON ic.oid = i.indexrelid
 		JOIN pg_attribute a ON a.attrelid = i.indrelid
 			AND a.attnum = ANY(i.indkey)
-		WHERE indexrelid::regclass = $1::regclass;`
+		WHERE i.indrelid = (quote_ident($2) || '.' || quote_ident($1))::regclass
+		AND (i.indisprimary OR i.indisunique)
+		GROUP BY ic.relname, i.indrelid, i.indisprimary, i.indpred
+		ORDER BY 1;`
 
-	rows, err := db.Query(sql, indexName)
+	rows, cancel, err := queryContext(ctx, db, sql, tableName, schema)
 	if err != nil {
-		log.Panic().Err(err).Msg("error executing query")
+		return nil, nil, fmt.Errorf("reading indexes for %s: executing %q: %w", tableName, sql, err)
 	}
+	defer cancel()
 	defer rows.Close()
 
-	result := make([]string, 0)
+	pkColumns := make([]string, 0)
+	indexes := make(map[string]UniqueIndex)
 	for rows.Next() {
 		var name string
-		err := rows.Scan(&name)
+		var primary bool
+		var columns []string
+		var predicate string
+		err := rows.Scan(&name, &primary, pq.Array(&columns), &predicate)
 		if err != nil {
-			log.Panic().Err(err).Msg("error getting column data")
+			return nil, nil, fmt.Errorf("reading indexes for %s: extracting row of %q: %w", tableName, sql, err)
+		}
+		if primary {
+			pkColumns = append(pkColumns, columns...)
+		} else {
+			indexes[name] = UniqueIndex{Name: name, Columns: columns, Predicate: predicate}
 		}
-		result = append(result, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("reading indexes for %s: iterating rows of %q: %w", tableName, sql, err)
 	}
 
-	return result
+	return pkColumns, indexes, nil
 }
 
-func readReferenceConstraintNames(db *sql.DB, tableName string) []string {
+func readReferenceConstraintNames(ctx context.Context, db *sql.DB, schema string, tableName string) ([]string, error) {
 	sql := `SELECT DISTINCT tc.constraint_name
 		FROM information_schema.table_constraints AS tc
 			JOIN information_schema.constraint_column_usage AS ccu ON ccu.constraint_name = tc.constraint_name
 				AND ccu.table_schema = tc.table_schema
-		WHERE tc.constraint_type = 'FOREIGN KEY' AND tc.table_name = $1;`
+		WHERE tc.constraint_type = 'FOREIGN KEY' AND tc.table_name = $1 AND tc.table_schema = $2;`
 
-	rows, err := db.Query(sql, tableName)
+	result, err := readStrings(ctx, db, sql, tableName, schema)
 	if err != nil {
-		log.Panic().Err(err).Msg("error executing query")
+		return nil, fmt.Errorf("reading foreign keys for %s: %w", tableName, err)
 	}
-	defer rows.Close()
-
-	result := make([]string, 0)
-	for rows.Next() {
-		var name string
-		err := rows.Scan(&name)
-		if err != nil {
-			log.Panic().Err(err).Msg("error getting column data")
-		}
-		result = append(result, name)
-	}
-
-	return result
+	return result, nil
 }
 
-func readReferencedByConstraintNames(db *sql.DB, tableName string) []string {
+func readReferencedByConstraintNames(ctx context.Context, db *sql.DB, schema string, tableName string) ([]string, error) {
 	sql := `SELECT DISTINCT tc.constraint_name
 		FROM information_schema.table_constraints AS tc
 			JOIN information_schema.constraint_column_usage AS ccu ON ccu.constraint_name = tc.constraint_name
 				AND ccu.table_schema = tc.table_schema
-		WHERE tc.constraint_type = 'FOREIGN KEY' AND ccu.table_name = $1;`
+		WHERE tc.constraint_type = 'FOREIGN KEY' AND ccu.table_name = $1 AND tc.table_schema = $2;`
 
-	rows, err := db.Query(sql, tableName)
+	result, err := readStrings(ctx, db, sql, tableName, schema)
 	if err != nil {
-		log.Panic().Err(err).Msg("error executing query")
-	}
-	defer rows.Close()
-
-	result := make([]string, 0)
-	for rows.Next() {
-		var name string
-		err := rows.Scan(&name)
-		if err != nil {
-			log.Panic().Err(err).Msg("error getting column data")
-		}
-		result = append(result, name)
+		return nil, fmt.Errorf("reading foreign keys referencing %s: %w", tableName, err)
 	}
-
-	return result
+	return result, nil
 }
 
-func readReferencedTable(db *sql.DB, referenceConstraintName string) string {
+// readReferencedTables returns the tables referenced by the constraint.
+// Constraint names are only unique per table: several tables can be returned for the same name.
+func readReferencedTables(ctx context.Context, db *sql.DB, schema string, referenceConstraintName string) ([]string, error) {
 	sql := `SELECT DISTINCT ccu.table_name
 	FROM information_schema.constraint_column_usage AS ccu
-	WHERE ccu.constraint_name = $1;`
+	WHERE ccu.constraint_name = $1 AND ccu.constraint_schema = $2;`
 
-	rows, err := db.Query(sql, referenceConstraintName)
+	names, err := readStrings(ctx, db, sql, referenceConstraintName, schema)
 	if err != nil {
-		log.Panic().Err(err).Msg("error executing query")
+		return nil, fmt.Errorf("reading table referenced by %s: %w", referenceConstraintName, err)
 	}
-	defer rows.Close()
-
-	var name string
-	rows.Next()
-	rows.Scan(&name)
-
-	return name
+	return names, nil
 }
 
-func readReferencedByTable(db *sql.DB, referenceConstraintName string) string {
+// readReferencedByTables returns the tables having the constraint, several ones if they share its name
+func readReferencedByTables(ctx context.Context, db *sql.DB, schema string, referenceConstraintName string) ([]string, error) {
 	sql := `SELECT DISTINCT table_name
 	FROM information_schema.table_constraints as tc 
-	WHERE tc.constraint_name = $1;`
+	WHERE tc.constraint_name = $1 AND tc.constraint_schema = $2;`
 
-	rows, err := db.Query(sql, referenceConstraintName)
+	names, err := readStrings(ctx, db, sql, referenceConstraintName, schema)
 	if err != nil {
-		log.Panic().Err(err).Msg("error executing query")
+		return nil, fmt.Errorf("reading table of %s: %w", referenceConstraintName, err)
 	}
-	defer rows.Close()
-
-	var name string
-	rows.Next()
-	rows.Scan(&name)
+	return names, nil
+}
 
-	return name
+// singleConstraintTable returns the only table of a constraint, with an error if it can't be decided.
+// An empty name is returned if the table isn't visible, like when the connecting role doesn't own it.
+func singleConstraintTable(tableName string, constraintName string, constraintTables []string) (string, error) {
+	switch len(constraintTables) {
+	case 0:
+		logger().Warn().Str("table", tableName).Str("constraint", constraintName).
+			Msgf("Ignoring foreign key %s of %s: its other table is not visible", constraintName, tableName)
+		return "", nil
+	case 1:
+		return constraintTables[0], nil
+	default:
+		return "", fmt.Errorf("foreign key %s of %s is ambiguous: several tables have a constraint with this name: %s",
+			constraintName, tableName, strings.Join(constraintTables, ", "))
+	}
 }
 
-func readReferenceConstraints(db *sql.DB, tableName string, referenceConstraintName string) map[string]string {
-	sql := `SELECT DISTINCT kcu.column_name, ccu.column_name AS foreign_column_name
-		FROM information_schema.table_constraints AS tc
-		JOIN information_schema.key_column_usage AS kcu ON tc.constraint_name = kcu.constraint_name
-			AND tc.table_schema = kcu.table_schema
-			AND tc.table_name = kcu.table_name
-		JOIN information_schema.constraint_column_usage AS ccu ON ccu.constraint_name = tc.constraint_name
-			AND tc.table_schema = ccu.table_schema
-		WHERE tc.constraint_type = 'FOREIGN KEY'
-			AND tc.table_name = $1
-			AND tc.constraint_name = $2;`
-
-	rows, err := db.Query(sql, tableName, referenceConstraintName)
+// readReferenceConstraints maps the local columns of a foreign key to the referenced ones and tells if it is deferrable.
+// The columns are paired by their position in the constraint, not by their order in the tables,
+// so composite keys are mapped correctly even if listed in a different order than the referenced index.
+func readReferenceConstraints(ctx context.Context, db *sql.DB, schema string, tableName string, referenceConstraintName string) (map[string]string, bool, error) {
+	sql := `SELECT a.attname AS column_name, af.attname AS foreign_column_name, c.condeferrable
+		FROM pg_constraint c
+		CROSS JOIN LATERAL unnest(c.conkey, c.confkey) AS k(attnum, foreign_attnum)
+		JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = k.attnum
+		JOIN pg_attribute af ON af.attrelid = c.confrelid AND af.attnum = k.foreign_attnum
+		WHERE c.contype = 'f'
+			AND c.conrelid = (quote_ident($3) || '.' || quote_ident($1))::regclass
+			AND c.conname = $2;`
+
+	rows, cancel, err := queryContext(ctx, db, sql, tableName, referenceConstraintName, schema)
 	if err != nil {
-		log.Panic().Err(err).Msg("error executing query")
+		return nil, false, fmt.Errorf("reading columns of %s for %s with %q: %w", referenceConstraintName, tableName, sql, err)
 	}
+	defer cancel()
 	defer rows.Close()
 
 	result := make(map[string]string)
+	deferrable := false
 	for rows.Next() {
 		var columnName string
 		var foreignColumnName string
-		err := rows.Scan(&columnName, &foreignColumnName)
+		err := rows.Scan(&columnName, &foreignColumnName, &deferrable)
 		if err != nil {
-			log.Panic().Err(err).Msg("error getting column data")
+			return nil, false, fmt.Errorf("reading columns of %s for %s: %w", referenceConstraintName, tableName, err)
 		}
 		result[columnName] = foreignColumnName
 	}
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("reading columns of %s for %s: %w", referenceConstraintName, tableName, err)
+	}
+	// a reference without columns would silently match nothing
+	if len(result) == 0 {
+		return nil, false, fmt.Errorf("reading columns of %s for %s: no foreign key with this name on the table", referenceConstraintName, tableName)
+	}
+
+	return result, deferrable, nil
+}
 
+// sortedIndexNames returns the index names in lexicographic order for the main index choice to be reproducible
+func sortedIndexNames(indexes map[string]UniqueIndex) []string {
+	names := make([]string, 0, len(indexes))
+	for name := range indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// fullUniqueIndexes returns the unique indexes without predicate
+func fullUniqueIndexes(indexes map[string]UniqueIndex) map[string]UniqueIndex {
+	result := make(map[string]UniqueIndex)
+	for name, index := range indexes {
+		if index.Predicate == "" {
+			result[name] = index
+		}
+	}
 	return result
 }
 
 func findIndex(indexes map[string]UniqueIndex, columnName string) string {
-	for name, index := range indexes {
-		for _, column := range index.Columns {
+	for _, name := range sortedIndexNames(indexes) {
+		for _, column := range indexes[name].Columns {
 			if strings.Compare(column, columnName) == 0 {
 				return name
 			}
@@ -268,11 +275,33 @@ func findIndex(indexes map[string]UniqueIndex, columnName string) string {
 	return ""
 }
 
+// chooseMainUniqueIndex returns the unique index preferred as natural key of a table and the reason of the choice:
+// the only one, else the first one by name on label, name or token, else the one with the most columns.
+// A partial index doesn't identify the rows outside of its predicate and is never chosen.
+func chooseMainUniqueIndex(indexes map[string]UniqueIndex) (string, string) {
+	candidates := fullUniqueIndexes(indexes)
+	indexNames := sortedIndexNames(candidates)
+	switch len(indexNames) {
+	case 0:
+		return "", "no unique index without predicate"
+	case 1:
+		return indexNames[0], fmt.Sprintf("chose %s because it is the only unique index without predicate", indexNames[0])
+	}
+	for _, column := range []string{"label", "name", "token"} {
+		if name := findIndex(candidates, column); name != "" {
+			return name, fmt.Sprintf("chose %s because it contains '%s'", name, column)
+		}
+	}
+	name := findIndexMostColumns(candidates)
+	return name, fmt.Sprintf("chose %s because no index contains 'label', 'name' or 'token' and it has the most columns (%d)",
+		name, len(candidates[name].Columns))
+}
+
 func findIndexMostColumns(indexes map[string]UniqueIndex) string {
 	mostCols := 0
 	result := ""
-	for name, index := range indexes {
-		numCols := len(index.Columns)
+	for _, name := range sortedIndexNames(indexes) {
+		numCols := len(indexes[name].Columns)
 		if numCols > mostCols {
 			result = name
 			mostCols = numCols
@@ -281,11 +310,29 @@ func findIndexMostColumns(indexes map[string]UniqueIndex) string {
 	return result
 }
 
-func readPKSequence(db *sql.DB, tableName string) string {
-	sql := `WITH sequences AS (
-		SELECT sequence_name
+// readPKSequence returns the sequence generating the primary key values of the table, if any, and the column owning it.
+// The sequences owned by a primary key column, like the serial and identity ones, are preferred
+// to the ones only matching the name of an id primary key, which have no owner column.
+func readPKSequence(ctx context.Context, db *sql.DB, schema string, tableName string) (string, string, error) {
+	sql := `WITH owned_sequences AS (
+			SELECT s.relname::text AS sequence_name, a.attname::text AS owner_column
+			FROM
+				pg_constraint c
+				JOIN pg_depend d
+					ON d.refclassid = 'pg_class'::regclass
+					AND d.refobjid = c.conrelid
+					AND d.refobjsubid = ANY(c.conkey)
+					AND d.classid = 'pg_class'::regclass
+					AND d.deptype IN ('a', 'i')
+				JOIN pg_class s ON s.oid = d.objid AND s.relkind = 'S'
+				JOIN pg_attribute a ON a.attrelid = d.refobjid AND a.attnum = d.refobjsubid
+			WHERE c.contype = 'p'
+				AND c.conrelid = (quote_ident($2) || '.' || quote_ident($1))::regclass
+		),
+		sequences AS (
+			SELECT sequence_name
 			FROM information_schema.sequences
-			WHERE sequence_schema = 'public'
+			WHERE sequence_schema = $2
 		),
 		id_constraints AS (
 			SELECT
@@ -296,138 +343,465 @@ func readPKSequence(db *sql.DB, tableName string) string {
 				information_schema.table_constraints AS tc
 				JOIN information_schema.key_column_usage AS kcu
 					ON tc.constraint_name = kcu.constraint_name
-			WHERE tc.constraint_schema = 'public'
+			WHERE tc.constraint_schema = $2
 				AND constraint_type = 'PRIMARY KEY'
 				AND kcu.ordinal_position = 1
 				AND column_name = 'id'
 				AND tc.table_name = $1
-		)
-		SELECT sequence_name
+		),
+		named_sequences AS (
+			SELECT sequence_name::text
 			FROM id_constraints
 			JOIN sequences
-				ON replace(regexp_replace(constraint_name, '(_id)?_pk(ey)?', ''), '_', '') = replace(regexp_replace(sequence_name, '(_id)?_seq', ''), '_', '')`
-
-	rows, err := db.Query(sql, tableName)
+				ON replace(regexp_replace(constraint_name, '(_id)?_pk(ey)?', ''), '_', '') = replace(regexp_replace(sequence_name, '(_id)?_seq', ''), '_', '')
+		)
+		SELECT sequence_name, owner_column FROM (
+			SELECT sequence_name, owner_column, 1 AS priority FROM owned_sequences
+			UNION ALL
+			SELECT sequence_name, '' AS owner_column, 2 AS priority FROM named_sequences
+		) AS candidates
+		ORDER BY priority, sequence_name
+		LIMIT 1;`
+
+	rows, cancel, err := queryContext(ctx, db, sql, tableName, schema)
 	if err != nil {
-		log.Panic().Err(err).Msg("error executing query")
+		return "", "", fmt.Errorf("reading primary key sequence for %s: executing %q: %w", tableName, sql, err)
 	}
+	defer cancel()
 	defer rows.Close()
 
-	var name string
-	rows.Next()
-	rows.Scan(&name)
-
-	return name
+	var name, ownerColumn string
+	if rows.Next() {
+		if err := rows.Scan(&name, &ownerColumn); err != nil {
+			return "", "", fmt.Errorf("reading primary key sequence for %s: %w", tableName, err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", "", fmt.Errorf("reading primary key sequence for %s: %w", tableName, err)
+	}
+	return name, ownerColumn, nil
 }
 
 // ReadTablesSchema inspects the DB and returns a list of tables
-func ReadAllTablesSchema(db *sql.DB) map[string]Table {
-	return ReadTablesSchema(db, readTableNames(db))
+func ReadAllTablesSchema(db *sql.DB) (map[string]Table, error) {
+	return ReadAllTablesSchemaContext(context.Background(), db)
 }
 
-func ReadTablesSchema(db *sql.DB, tableNames []string) map[string]Table {
+// ReadAllTablesSchemaContext is ReadAllTablesSchema stopping when the context is done
+func ReadAllTablesSchemaContext(ctx context.Context, db *sql.DB) (map[string]Table, error) {
+	return ReadAllTablesInSchema(ctx, db, DefaultSchemaName)
+}
 
-	result := make(map[string]Table, 0)
+// ReadAllTablesInSchema reads all the tables of the given database schema, public if empty
+func ReadAllTablesInSchema(ctx context.Context, db *sql.DB, schema string) (map[string]Table, error) {
+	if schema == "" {
+		schema = DefaultSchemaName
+	}
+	tableNames, err := readTableNames(ctx, db, schema)
+	if err != nil {
+		return nil, err
+	}
+	return ReadTablesInSchema(ctx, db, schema, tableNames)
+}
+
+// ReadTablesSchema reads the given tables of the public schema and the tables they reference.
+// All the given tables missing from the schema are listed in the returned error.
+func ReadTablesSchema(db *sql.DB, tableNames []string) (map[string]Table, error) {
+	return ReadTablesSchemaContext(context.Background(), db, tableNames)
+}
+
+// ReadTablesSchemaContext is ReadTablesSchema stopping at the next table when the context is done
+func ReadTablesSchemaContext(ctx context.Context, db *sql.DB, tableNames []string) (map[string]Table, error) {
+	return ReadTablesInSchema(ctx, db, DefaultSchemaName, tableNames)
+}
+
+// ReadTablesInSchema reads the tables of the given database schema, public if empty
+func ReadTablesInSchema(ctx context.Context, db *sql.DB, schema string, tableNames []string) (map[string]Table, error) {
+	result, _, err := readTablesInSchema(ctx, db, schema, tableNames, false)
+	return result, err
+}
+
+// ReadExistingTablesSchema is ReadTablesSchema reading only the requested tables existing in the public schema,
+// for comparing the schemas of databases which don't have the same tables.
+// The sorted names of the missing requested tables are returned with them.
+func ReadExistingTablesSchema(ctx context.Context, db *sql.DB, tableNames []string) (map[string]Table, []string, error) {
+	return readTablesInSchema(ctx, db, DefaultSchemaName, tableNames, true)
+}
+
+// readTablesInSchema reads the tables of the schema and the sorted names of the requested ones missing from it.
+// The missing tables are an error unless allowMissing is set.
+func readTablesInSchema(ctx context.Context, db *sql.DB, schema string, tableNames []string,
+	allowMissing bool) (map[string]Table, []string, error) {
+	if schema == "" {
+		schema = DefaultSchemaName
+	}
+	lowerTableNames := make([]string, 0)
 	for _, tableName := range tableNames {
-		table, err := processTable(db, strings.ToLower(tableName), true)
-		if err {
+		lowerTableNames = append(lowerTableNames, unquoteIdentifier(tableName))
+	}
+	result := make(map[string]Table, 0)
+	skipped := TableErrors{}
+	batch, err := readSchemaBatch(ctx, db, schema, lowerTableNames)
+	if err != nil {
+		return nil, nil, err
+	}
+	missing := batch.missingTables()
+	if !allowMissing {
+		if err := batch.checkTablesExist(ctx, schema, &skipped); err != nil {
+			return nil, nil, err
+		}
+	}
+	tables, ignored, err := processTables(ctx, db, schema, lowerTableNames, true, batch)
+	if err := skipped.collect(err); err != nil {
+		return nil, nil, err
+	}
+	for i, table := range tables {
+		if ignored[i] {
 			continue
 		}
 		result[table.Name] = table
 	}
 
-	//Load all reference tables not loaded yet
-	for _, table := range result {
-		result = processReferenceTables(db, table, result)
+	//Load all reference tables not loaded yet, one batch per level of references
+	for {
+		missingTables := make([]string, 0)
+		missingTablesMap := make(map[string]bool)
+		for _, table := range result {
+			for _, reference := range table.References {
+				_, ok := result[reference.TableName]
+				if !ok && !missingTablesMap[reference.TableName] && !skipped.contains(reference.TableName) {
+					missingTablesMap[reference.TableName] = true
+					missingTables = append(missingTables, reference.TableName)
+				}
+			}
+		}
+		if len(missingTables) == 0 {
+			break
+		}
+		batch, err = readSchemaBatch(ctx, db, schema, missingTables)
+		if err != nil {
+			return nil, nil, err
+		}
+		tables, _, err = processTables(ctx, db, schema, missingTables, false, batch)
+		if err := skipped.collect(err); err != nil {
+			return nil, nil, err
+		}
+		for i, tableName := range missingTables {
+			if !skipped.contains(tableName) {
+				result[tableName] = tables[i]
+			}
+		}
+	}
+
+	return result, missing, skipped.err()
+}
+
+// unquoteIdentifier returns the table name as stored in the catalog: like PostgreSQL does,
+// a name is folded to lowercase unless it is double quoted
+func unquoteIdentifier(name string) string {
+	if len(name) >= 2 && strings.HasPrefix(name, `"`) && strings.HasSuffix(name, `"`) {
+		return strings.ReplaceAll(name[1:len(name)-1], `""`, `"`)
 	}
+	return strings.ToLower(name)
+}
 
-	return result
+// ReadTable reads the schema of a single table of the public schema, with one query per key and constraint.
+// Unlike ReadTablesSchema, the referenced tables are not read: the references only give their names and columns.
+func ReadTable(db *sql.DB, tableName string) (Table, error) {
+	tableName = unquoteIdentifier(tableName)
+	table, ignored, err := processTable(context.Background(), db, DefaultSchemaName, tableName, true, nil)
+	if err != nil {
+		return Table{}, withTableName(tableName, err)
+	}
+	if ignored {
+		return Table{}, fmt.Errorf("table %s doesn't exist", tableName)
+	}
+	return table, nil
 }
 
-func processReferenceTables(db *sql.DB, table Table, currentTables map[string]Table) map[string]Table {
-	for _, reference := range table.References {
-		_, ok := currentTables[reference.TableName]
-		if ok {
+// ReadTablesFromList reads the schema of exactly the given tables of the public schema, in the order of the names.
+// Contrary to ReadTablesSchema the referenced tables are not read: the references to tables outside the list are
+// reported as invalid references.
+// With ContinueOnTableErrors the tables which couldn't be read are left out of the list.
+func ReadTablesFromList(db *sql.DB, names []string) ([]Table, error) {
+	ctx := context.Background()
+	tableNames := make([]string, 0, len(names))
+	for _, name := range names {
+		tableNames = append(tableNames, unquoteIdentifier(name))
+	}
+	skipped := TableErrors{}
+	batch, err := readSchemaBatch(ctx, db, DefaultSchemaName, tableNames)
+	if err != nil {
+		return nil, err
+	}
+	if err := batch.checkTablesExist(ctx, DefaultSchemaName, &skipped); err != nil {
+		return nil, err
+	}
+	tables, ignored, err := processTables(ctx, db, DefaultSchemaName, tableNames, true, batch)
+	if err := skipped.collect(err); err != nil {
+		return nil, err
+	}
+	result := make([]Table, 0, len(tables))
+	tablesMap := make(map[string]Table, len(tables))
+	for i, table := range tables {
+		if skipped.contains(tableNames[i]) {
 			continue
 		}
-		tableProcessed, _ := processTable(db, reference.TableName, false)
-		currentTables[reference.TableName] = tableProcessed
-		currentTables = processReferenceTables(db, tableProcessed, currentTables)
+		if ignored[i] {
+			return nil, fmt.Errorf("table %s doesn't exist", tableNames[i])
+		}
+		result = append(result, table)
+		tablesMap[table.Name] = table
+	}
+	ReportInvalidReferences(tablesMap)
+	return result, skipped.err()
+}
+
+// processTables reads the schema of the tables concurrently with IntrospectionWorkers workers.
+// The tables and their ignored flags are returned in the order of the names.
+// The first error cancels the remaining reads, unless the table can be skipped with ContinueOnTableErrors:
+// the skipped tables are then ignored and returned in a TableErrors error.
+func processTables(ctx context.Context, db *sql.DB, schema string, tableNames []string, exportable bool,
+	batch *schemaBatch) ([]Table, []bool, error) {
+	workers := IntrospectionWorkers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > len(tableNames) {
+		workers = len(tableNames)
 	}
 
-	return currentTables
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	tables := make([]Table, len(tableNames))
+	ignored := make([]bool, len(tableNames))
+	var firstErr error
+	var errOnce sync.Once
+	var skippedLock sync.Mutex
+	skipped := TableErrors{}
+	indexes := make(chan int)
+	var progressLock sync.Mutex
+	processed := 0
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				var err error
+				tables[i], ignored[i], err = processTable(ctx, db, schema, tableNames[i], exportable, batch)
+				err = withTableName(tableNames[i], err)
+				if err != nil {
+					skippedLock.Lock()
+					skip := skipped.skipTable(ctx, tableNames[i], err)
+					skippedLock.Unlock()
+					if skip {
+						logger().Warn().Err(err).Str("table", tableNames[i]).Msgf("Skipping table %s", tableNames[i])
+						ignored[i] = true
+					} else {
+						errOnce.Do(func() { firstErr = err })
+						cancel()
+					}
+				}
+				progressLock.Lock()
+				processed++
+				reportProgress(tableNames[i], processed, len(tableNames))
+				progressLock.Unlock()
+			}
+		}()
+	}
+	for i := range tableNames {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, nil, firstErr
+	}
+	return tables, ignored, skipped.err()
 }
 
-func processTable(db *sql.DB, tableName string, exportable bool) (Table, bool) {
-	columns := readColumnNames(db, tableName)
-	if len(columns) == 0 {
-		log.Info().Msgf("Ignoring nonexisting table %s", tableName)
-		return Table{}, true
+// processTable reads the table schema, using the batch data when the table is part of it.
+// The returned flag tells if the table doesn't exist and was ignored.
+func processTable(ctx context.Context, db *sql.DB, schema string, tableName string, exportable bool, batch *schemaBatch) (Table, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return Table{}, false, fmt.Errorf("reading schema of %s: %w", tableName, err)
+	}
+	var columnDefinitions []Column
+	if batch.contains(tableName) {
+		columnDefinitions = batch.columns[tableName]
+	} else {
+		var err error
+		columnDefinitions, err = readColumns(ctx, db, schema, tableName)
+		if err != nil {
+			return Table{}, false, err
+		}
+	}
+	if len(columnDefinitions) == 0 {
+		logger().Info().Str("table", tableName).Msgf("Ignoring nonexisting table %s", tableName)
+		return Table{}, true, nil
 	}
 
+	columns := make([]string, 0, len(columnDefinitions))
 	columnIndexes := make(map[string]int)
-	for i, columnName := range columns {
-		columnIndexes[columnName] = i
+	columnMap := make(map[string]Column)
+	for i, column := range columnDefinitions {
+		columns = append(columns, column.Name)
+		columnIndexes[column.Name] = i
+		columnMap[column.Name] = column
 	}
 
-	pkColumns := readPKColumnNames(db, tableName)
+	pkColumns, indexes, err := readIndexes(ctx, db, schema, tableName)
+	if err != nil {
+		return Table{}, false, err
+	}
 	pkColumnMap := make(map[string]bool)
 	for _, column := range pkColumns {
 		pkColumnMap[column] = true
 	}
 
-	pkSequence := readPKSequence(db, tableName)
-
-	indexNames := readUniqueIndexNames(db, tableName)
-	indexes := make(map[string]UniqueIndex)
-	for _, indexName := range indexNames {
-		indexColumns := readIndexColumns(db, indexName)
-		indexes[indexName] = UniqueIndex{Name: indexName, Columns: indexColumns}
-	}
-
-	mainUniqueIndexName := ""
-	if len(indexNames) == 1 {
-		mainUniqueIndexName = indexNames[0]
-	} else if len(indexNames) > 1 {
-		mainUniqueIndexName = findIndex(indexes, "label")
-		if len(mainUniqueIndexName) == 0 {
-			mainUniqueIndexName = findIndex(indexes, "name")
-			if len(mainUniqueIndexName) == 0 {
-				mainUniqueIndexName = findIndex(indexes, "token")
-				if len(mainUniqueIndexName) == 0 {
-				        mainUniqueIndexName = findIndexMostColumns(indexes)
-				}
-			}
-		}
+	pkSequence, pkSequenceColumn, err := readPKSequence(ctx, db, schema, tableName)
+	if err != nil {
+		return Table{}, false, err
 	}
 
-	constraintNames := readReferenceConstraintNames(db, tableName)
-	references := make([]Reference, 0)
-	for _, constraintName := range constraintNames {
-		columnMap := readReferenceConstraints(db, tableName, constraintName)
-		referencedTable := readReferencedTable(db, constraintName)
-		references = append(references, Reference{TableName: referencedTable, ColumnMapping: columnMap})
-	}
+	mainUniqueIndexName, _ := chooseMainUniqueIndex(indexes)
 
-	referencedByConstraintNames := readReferencedByConstraintNames(db, tableName)
+	references := make([]Reference, 0)
 	referencedBy := make([]Reference, 0)
-	for _, constraintName := range referencedByConstraintNames {
-		referencedTable := readReferencedByTable(db, constraintName)
-		columnMap := readReferenceConstraints(db, referencedTable, constraintName)
-		referencedBy = append(referencedBy, Reference{TableName: referencedTable, ColumnMapping: columnMap})
+	if batch.contains(tableName) {
+		references = append(references, batch.references[tableName]...)
+		referencedBy = append(referencedBy, batch.referencedBy[tableName]...)
+	} else {
+		constraintNames, err := readReferenceConstraintNames(ctx, db, schema, tableName)
+		if err != nil {
+			return Table{}, false, err
+		}
+		for _, constraintName := range constraintNames {
+			columnMap, deferrable, err := readReferenceConstraints(ctx, db, schema, tableName, constraintName)
+			if err != nil {
+				return Table{}, false, err
+			}
+			referencedTables, err := readReferencedTables(ctx, db, schema, constraintName)
+			if err != nil {
+				return Table{}, false, err
+			}
+			referencedTable, err := singleConstraintTable(tableName, constraintName, referencedTables)
+			if err != nil {
+				return Table{}, false, err
+			}
+			if referencedTable == "" {
+				continue
+			}
+			references = append(references, Reference{TableName: referencedTable, ColumnMapping: columnMap, Deferrable: deferrable})
+		}
+
+		referencedByConstraintNames, err := readReferencedByConstraintNames(ctx, db, schema, tableName)
+		if err != nil {
+			return Table{}, false, err
+		}
+		for _, constraintName := range referencedByConstraintNames {
+			referencedTables, err := readReferencedByTables(ctx, db, schema, constraintName)
+			if err != nil {
+				return Table{}, false, err
+			}
+			referencedTable, err := singleConstraintTable(tableName, constraintName, referencedTables)
+			if err != nil {
+				return Table{}, false, err
+			}
+			if referencedTable == "" {
+				continue
+			}
+			columnMap, deferrable, err := readReferenceConstraints(ctx, db, schema, referencedTable, constraintName)
+			if err != nil {
+				return Table{}, false, err
+			}
+			referencedBy = append(referencedBy, Reference{TableName: referencedTable, ColumnMapping: columnMap, Deferrable: deferrable})
+		}
 	}
 
 	table := Table{
 		Name:                tableName,
 		Export:              exportable,
 		Columns:             columns,
+		ColumnDefinitions:   columnMap,
 		ColumnIndexes:       columnIndexes,
 		PKColumns:           pkColumnMap,
 		PKSequence:          pkSequence,
+		PKSequenceColumn:    pkSequenceColumn,
 		UniqueIndexes:       indexes,
 		MainUniqueIndexName: mainUniqueIndexName,
 		References:          references,
 		ReferencedBy:        referencedBy}
 	table = applyTableFilters(table)
-	return table, false
+	if table.PKSequence != pkSequence {
+		// the sequence set by the filters isn't the one owned by the column
+		table.PKSequenceColumn = ""
+	}
+	if len(table.PKColumns) == 0 && len(table.MainUniqueIndexName) == 0 {
+		table = applyFullRowMatch(table)
+	}
+	table.IdOnly = len(table.PKSequence) > 0 && len(table.MainUniqueIndexName) == 0
+	if columns := nullableMainUniqueIndexColumns(table); len(columns) > 0 {
+		logger().Warn().Str("table", tableName).Str("index", table.MainUniqueIndexName).
+			Msgf("Main unique index %s of %s has nullable columns %s: the rows with NULL values never conflict on the target and may be duplicated",
+				table.MainUniqueIndexName, tableName, strings.Join(columns, ", "))
+	}
+	return table, false, nil
+}
+
+// nullableMainUniqueIndexColumns returns the nullable columns of the main unique index of the table.
+// The virtual index isn't concerned: its rows are matched with IS NULL for the NULL values.
+func nullableMainUniqueIndexColumns(table Table) []string {
+	result := make([]string, 0)
+	if table.MainUniqueIndexName == "" || table.MainUniqueIndexName == VirtualIndexName {
+		return result
+	}
+	for _, column := range table.UniqueIndexes[table.MainUniqueIndexName].Columns {
+		if definition, ok := table.ColumnDefinitions[column]; ok && definition.IsNullable {
+			result = append(result, column)
+		}
+	}
+	return result
+}
+
+// applyFullRowMatch makes the rows of a table without any key, like a pure join table, matched by all their columns.
+// The timestamps are left out since they differ between servers for the same row.
+func applyFullRowMatch(table Table) Table {
+	virtualIndexColumns := make([]string, 0, len(table.Columns))
+	for _, column := range table.Columns {
+		if column != "created" && column != "modified" && !table.UnexportColumns[column] {
+			virtualIndexColumns = append(virtualIndexColumns, column)
+		}
+	}
+	logger().Debug().Str("table", table.Name).Msgf("Table %s has no key: its rows are matched by all their columns", table.Name)
+	table.UniqueIndexes[VirtualIndexName] = UniqueIndex{Name: VirtualIndexName, Columns: virtualIndexColumns}
+	table.MainUniqueIndexName = VirtualIndexName
+	return table
+}
+
+// ReadSchemaVersion returns the version of the schema, or an empty string if the version table doesn't exist
+func ReadSchemaVersion(db *sql.DB) (string, error) {
+	var versionTable sql.NullString
+	err := db.QueryRow(`SELECT to_regclass('rhnversioninfo')::text;`).Scan(&versionTable)
+	if err != nil {
+		return "", fmt.Errorf("looking for the schema version table: %w", err)
+	}
+	if !versionTable.Valid {
+		return "", nil
+	}
+
+	versionSql := `SELECT name || '-' || version || '-' || release
+		FROM rhnversioninfo
+		WHERE label = 'schema';`
+	var version string
+	err = db.QueryRow(versionSql).Scan(&version)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading the schema version: %w", err)
+	}
+	return version, nil
 }
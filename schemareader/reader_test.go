@@ -1,10 +1,19 @@
 package schemareader
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
 	"github.com/uyuni-project/inter-server-sync/tests"
 )
 
@@ -20,6 +29,12 @@ const (
 	IndexColumnName02 = "IndexColumnName02"
 )
 
+func TestMain(m *testing.M) {
+	// the mocked queries are expected in order
+	IntrospectionWorkers = 1
+	os.Exit(m.Run())
+}
+
 func TestProcessTable(t *testing.T) {
 
 	// Arrange
@@ -27,7 +42,7 @@ func TestProcessTable(t *testing.T) {
 	UniqueIndexMostColumnsCase(repo)
 
 	// Act
-	table, _ := processTable(repo.DB, TableName, true)
+	table, _, _ := processTable(context.Background(), repo.DB, DefaultSchemaName, TableName, true, nil)
 
 	// Assert
 	indexesEqual := reflect.DeepEqual(table.MainUniqueIndexName, UniqueIndexName03)
@@ -36,49 +51,951 @@ func TestProcessTable(t *testing.T) {
 	}
 }
 
-func UniqueIndexMostColumnsCase(repo *tests.DataRepository) {
+func TestProcessTableIdOnly(t *testing.T) {
 
-	repo.ExpectWithRecords(ReadColumnNames, sqlmock.NewRows([]string{"column_name"}).AddRow(""), TableName)
-	repo.ExpectWithRecords(ReadPkColumnNames, sqlmock.NewRows([]string{"attname"}).AddRow(""), TableName)
-	repo.ExpectWithRecords(ReadPkSequence, sqlmock.NewRows([]string{"sequence_name"}).AddRow(""), TableName)
+	// Arrange
+	repo := tests.CreateDataRepository()
+	repo.ExpectWithRecords(ReadColumnNames, columnRows("id", IndexColumnName01), TableName, DefaultSchemaName)
+	repo.ExpectWithRecords(ReadIndexes, indexRows().AddRow("table_pk", true, "{id}", ""), TableName, DefaultSchemaName)
+	repo.ExpectWithRecords(ReadPkSequence, sequenceRows().AddRow("table_id_seq", ""), TableName, DefaultSchemaName)
+	repo.ExpectWithRecords(ReadReferenceConstraintNames, sqlmock.NewRows([]string{"constraint_name"}), TableName, DefaultSchemaName)
+	repo.ExpectWithRecords(ReadReferencedByConstraintNames, sqlmock.NewRows([]string{"constraint_name"}), TableName, DefaultSchemaName)
 
-	// Read indexes information to get three indexes
-	repo.ExpectWithRecords(
-		ReadUniqueIndexNames,
-		sqlmock.NewRows([]string{"indexrelid"}).
-			AddRow(UniqueIndexName01).
-			AddRow(UniqueIndexName02).
-			AddRow(UniqueIndexName03),
-		TableName,
-	)
-	// Read columns for index UniqueIndexName01
-	repo.ExpectWithRecords(
-		ReadIndexColumns,
-		sqlmock.NewRows([]string{"indexrelid"}).
-			// One column in the index
-			AddRow(PKColumnName),
-		UniqueIndexName01,
-	)
-	// Read columns for index UniqueIndexName02
-	repo.ExpectWithRecords(
-		ReadIndexColumns,
-		sqlmock.NewRows([]string{"indexrelid"}).
-			// Two columns in the index
-			AddRow(PKColumnName).
-			AddRow(IndexColumnName01),
-		UniqueIndexName02,
-	)
-	// Read columns for index UniqueIndexName03
+	// Act
+	table, _, _ := processTable(context.Background(), repo.DB, DefaultSchemaName, TableName, true, nil)
+
+	// Assert
+	if !table.IdOnly {
+		t.Errorf("Table with only a sequence backed PK should be flagged as id only")
+	}
+	idOnlyTables := IdOnlyTables(map[string]Table{TableName: table})
+	if !reflect.DeepEqual(idOnlyTables, []string{TableName}) {
+		t.Errorf("Id only tables report do not match: expected [%s], got %v", TableName, idOnlyTables)
+	}
+}
+
+func TestProcessTableWithoutKey(t *testing.T) {
+
+	// Arrange
+	repo := tests.CreateDataRepository()
+	repo.ExpectWithRecords(ReadColumnNames, columnRows("channel_id", "channel_family_id", "created", "modified"), TableName, DefaultSchemaName)
+	repo.ExpectWithRecords(ReadIndexes, indexRows(), TableName, DefaultSchemaName)
+	repo.ExpectWithRecords(ReadPkSequence, sequenceRows(), TableName, DefaultSchemaName)
+	repo.ExpectWithRecords(ReadReferenceConstraintNames, sqlmock.NewRows([]string{"constraint_name"}), TableName, DefaultSchemaName)
+	repo.ExpectWithRecords(ReadReferencedByConstraintNames, sqlmock.NewRows([]string{"constraint_name"}), TableName, DefaultSchemaName)
+
+	// Act
+	table, _, err := processTable(context.Background(), repo.DB, DefaultSchemaName, TableName, true, nil)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if table.MainUniqueIndexName != VirtualIndexName || table.IdOnly {
+		t.Errorf("Join table rows should be matched by a virtual index, got %s", table.MainUniqueIndexName)
+	}
+	// the rows are matched by the full column tuple, except the server specific timestamps
+	expectedColumns := []string{"channel_id", "channel_family_id"}
+	if !reflect.DeepEqual(table.UniqueIndexes[VirtualIndexName].Columns, expectedColumns) {
+		t.Errorf("Expected %v, got %v", expectedColumns, table.UniqueIndexes[VirtualIndexName].Columns)
+	}
+}
+
+func TestProcessTableStableMainUniqueIndex(t *testing.T) {
+
+	for i := 0; i < 20; i++ {
+		// Arrange
+		repo := tests.CreateDataRepository()
+		repo.ExpectWithRecords(ReadColumnNames, columnRows(PKColumnName), TableName, DefaultSchemaName)
+		// three indexes with the same number of columns, none on label, name or token
+		indexes := indexRows().AddRow("table_pk", true, "{"+PKColumnName+"}", "")
+		for _, indexName := range []string{UniqueIndexName03, UniqueIndexName01, UniqueIndexName02} {
+			indexes.AddRow(indexName, false, "{"+IndexColumnName01+","+IndexColumnName02+"}", "")
+		}
+		repo.ExpectWithRecords(ReadIndexes, indexes, TableName, DefaultSchemaName)
+		repo.ExpectWithRecords(ReadPkSequence, sequenceRows(), TableName, DefaultSchemaName)
+		repo.ExpectWithRecords(ReadReferenceConstraintNames, sqlmock.NewRows([]string{"constraint_name"}), TableName, DefaultSchemaName)
+		repo.ExpectWithRecords(ReadReferencedByConstraintNames, sqlmock.NewRows([]string{"constraint_name"}), TableName, DefaultSchemaName)
+
+		// Act
+		table, _, err := processTable(context.Background(), repo.DB, DefaultSchemaName, TableName, true, nil)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Unexpected error processing the table: %s", err)
+		}
+		if table.MainUniqueIndexName != UniqueIndexName01 {
+			t.Fatalf("Main unique index should be the first one by name: expected %s, got %s", UniqueIndexName01, table.MainUniqueIndexName)
+		}
+	}
+}
+
+func TestProcessTableSkipsPartialMainUniqueIndex(t *testing.T) {
+
+	// Arrange
+	repo := tests.CreateDataRepository()
+	repo.ExpectWithRecords(ReadColumnNames, columnRows(PKColumnName, "label", IndexColumnName01), TableName, DefaultSchemaName)
+	// the partial index on label would otherwise be preferred
+	repo.ExpectWithRecords(ReadIndexes,
+		indexRows().
+			AddRow("table_pk", true, "{"+PKColumnName+"}", "").
+			AddRow(UniqueIndexName01, false, "{label}", "(deleted IS NULL)").
+			AddRow(UniqueIndexName02, false, "{"+IndexColumnName01+"}", ""),
+		TableName, DefaultSchemaName)
+	repo.ExpectWithRecords(ReadPkSequence, sequenceRows(), TableName, DefaultSchemaName)
+	repo.ExpectWithRecords(ReadReferenceConstraintNames, sqlmock.NewRows([]string{"constraint_name"}), TableName, DefaultSchemaName)
+	repo.ExpectWithRecords(ReadReferencedByConstraintNames, sqlmock.NewRows([]string{"constraint_name"}), TableName, DefaultSchemaName)
+
+	// Act
+	table, _, err := processTable(context.Background(), repo.DB, DefaultSchemaName, TableName, true, nil)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error processing the table: %s", err)
+	}
+	if table.MainUniqueIndexName != UniqueIndexName02 {
+		t.Errorf("Partial unique index should not be the main one: expected %s, got %s", UniqueIndexName02, table.MainUniqueIndexName)
+	}
+	if table.UniqueIndexes[UniqueIndexName01].Predicate != "(deleted IS NULL)" {
+		t.Errorf("Partial unique index predicate was not read: got %v", table.UniqueIndexes[UniqueIndexName01])
+	}
+}
+
+func TestProcessTableWithLabelIndex(t *testing.T) {
+
+	// Arrange
+	repo := tests.CreateDataRepository()
+	repo.ExpectWithRecords(ReadColumnNames, columnRows("id", "label", "name", "org_id"), "rhnchannel", DefaultSchemaName)
+	// the label index wins over the name and the wider org index
+	repo.ExpectWithRecords(ReadIndexes,
+		indexRows().
+			AddRow("rhn_channel_id_pk", true, "{id}", "").
+			AddRow("rhn_channel_label_uq", false, "{label}", "").
+			AddRow("rhn_channel_name_uq", false, "{name}", "").
+			AddRow("rhn_channel_org_uq", false, "{name,org_id}", ""),
+		"rhnchannel", DefaultSchemaName)
+	repo.ExpectWithRecords(ReadPkSequence, sequenceRows().AddRow("rhn_channel_id_seq", ""), "rhnchannel", DefaultSchemaName)
+	repo.ExpectWithRecords(ReadReferenceConstraintNames, sqlmock.NewRows([]string{"constraint_name"}), "rhnchannel", DefaultSchemaName)
+	repo.ExpectWithRecords(ReadReferencedByConstraintNames, sqlmock.NewRows([]string{"constraint_name"}), "rhnchannel", DefaultSchemaName)
+
+	// Act
+	table, _, err := processTable(context.Background(), repo.DB, DefaultSchemaName, "rhnchannel", true, nil)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error processing the table: %s", err)
+	}
+	column := func(name string) Column {
+		return Column{Name: name, DataType: "numeric", IsNullable: true}
+	}
+	expected := Table{
+		Name:    "rhnchannel",
+		Export:  true,
+		Columns: []string{"id", "label", "name", "org_id"},
+		ColumnDefinitions: map[string]Column{
+			"id": column("id"), "label": column("label"), "name": column("name"), "org_id": column("org_id")},
+		ColumnIndexes: map[string]int{"id": 0, "label": 1, "name": 2, "org_id": 3},
+		PKColumns:     map[string]bool{"id": true},
+		PKSequence:    "rhn_channel_id_seq",
+		UniqueIndexes: map[string]UniqueIndex{
+			"rhn_channel_label_uq": {Name: "rhn_channel_label_uq", Columns: []string{"label"}},
+			"rhn_channel_name_uq":  {Name: "rhn_channel_name_uq", Columns: []string{"name"}},
+			"rhn_channel_org_uq":   {Name: "rhn_channel_org_uq", Columns: []string{"name", "org_id"}},
+		},
+		MainUniqueIndexName: "rhn_channel_label_uq",
+		References:          []Reference{},
+		ReferencedBy:        []Reference{},
+	}
+	if !reflect.DeepEqual(table, expected) {
+		t.Errorf("Table does not match:\nexpected %+v\ngot      %+v", expected, table)
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("Table was not read. Error message: %s", err)
+	}
+}
+
+func TestProcessSelfReferencingTable(t *testing.T) {
+
+	// Arrange
+	repo := tests.CreateDataRepository()
+	repo.ExpectWithRecords(ReadColumnNames, columnRows("id", "label", "parent_channel"), "rhnchannel", DefaultSchemaName)
+	repo.ExpectWithRecords(ReadIndexes,
+		indexRows().AddRow("rhn_channel_id_pk", true, "{id}", "").AddRow("rhn_channel_label_uq", false, "{label}", ""),
+		"rhnchannel", DefaultSchemaName)
+	repo.ExpectWithRecords(ReadPkSequence, sequenceRows().AddRow("rhn_channel_id_seq", ""), "rhnchannel", DefaultSchemaName)
+	// the same constraint is found both as a reference and as a referencing one
+	parentRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"column_name", "foreign_column_name", "condeferrable"}).AddRow("parent_channel", "id", false)
+	}
+	repo.ExpectWithRecords(ReadReferenceConstraintNames, sqlmock.NewRows([]string{"constraint_name"}).AddRow("rhn_channel_parent_ch_fk"), "rhnchannel", DefaultSchemaName)
+	repo.ExpectWithRecords(ReadReferenceConstraints, parentRows(), "rhnchannel", "rhn_channel_parent_ch_fk", DefaultSchemaName)
+	repo.ExpectWithRecords(ReadReferencedTable, sqlmock.NewRows([]string{"table_name"}).AddRow("rhnchannel"), "rhn_channel_parent_ch_fk", DefaultSchemaName)
+	repo.ExpectWithRecords(ReadReferencedByConstraintNames, sqlmock.NewRows([]string{"constraint_name"}).AddRow("rhn_channel_parent_ch_fk"), "rhnchannel", DefaultSchemaName)
+	repo.ExpectWithRecords(ReadReferencedByTable, sqlmock.NewRows([]string{"table_name"}).AddRow("rhnchannel"), "rhn_channel_parent_ch_fk", DefaultSchemaName)
+	repo.ExpectWithRecords(ReadReferenceConstraints, parentRows(), "rhnchannel", "rhn_channel_parent_ch_fk", DefaultSchemaName)
+
+	// Act
+	table, _, err := processTable(context.Background(), repo.DB, DefaultSchemaName, "rhnchannel", true, nil)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error processing the table: %s", err)
+	}
+	expectedReferences := []Reference{{TableName: "rhnchannel", ColumnMapping: map[string]string{"parent_channel": "id"}}}
+	if !reflect.DeepEqual(table.References, expectedReferences) {
+		t.Errorf("References do not match: expected %v, got %v", expectedReferences, table.References)
+	}
+	if !reflect.DeepEqual(table.ReferencedBy, expectedReferences) {
+		t.Errorf("Referenced by does not match: expected %v, got %v", expectedReferences, table.ReferencedBy)
+	}
+	if table.MainUniqueIndexName != "rhn_channel_label_uq" || table.IdOnly {
+		t.Errorf("Self referencing rows should be matched by label, got %s", table.MainUniqueIndexName)
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("Table was not read. Error message: %s", err)
+	}
+}
+
+// columnRows returns the rows of the table columns query
+func columnRows(names ...string) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"column_name", "data_type", "nullable", "column_default"})
+	for _, name := range names {
+		rows.AddRow(name, "numeric", true, "")
+	}
+	return rows
+}
+
+// indexRows returns an empty result of the indexes query
+func indexRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"indexrelid", "indisprimary", "columns", "predicate"})
+}
+
+// sequenceRows returns an empty result of the primary key sequence query
+func sequenceRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"sequence_name", "owner_column"})
+}
+
+// batchColumnRows returns an empty result of the batch columns query
+func batchColumnRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"table_name", "column_name", "data_type", "nullable", "column_default"})
+}
+
+func inheritanceRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"relname", "partitioned"})
+}
+
+func UniqueIndexMostColumnsCase(repo *tests.DataRepository) {
+
+	repo.ExpectWithRecords(ReadColumnNames, columnRows(""), TableName, DefaultSchemaName)
+	// Read indexes information to get three indexes, with one, two and three columns
 	repo.ExpectWithRecords(
-		ReadIndexColumns,
-		sqlmock.NewRows([]string{"indexrelid"}).
-			// Three columns in the index
-			AddRow(PKColumnName).
-			AddRow(IndexColumnName01).
-			AddRow(IndexColumnName02),
-		UniqueIndexName03,
+		ReadIndexes,
+		indexRows().
+			AddRow(UniqueIndexName01, false, "{"+PKColumnName+"}", "").
+			AddRow(UniqueIndexName02, false, "{"+IndexColumnName01+","+PKColumnName+"}", "").
+			AddRow(UniqueIndexName03, false, "{"+IndexColumnName01+","+IndexColumnName02+","+PKColumnName+"}", ""),
+		TableName, DefaultSchemaName,
 	)
+	repo.ExpectWithRecords(ReadPkSequence, sequenceRows().AddRow("", ""), TableName, DefaultSchemaName)
+
+	repo.ExpectWithRecords(ReadReferenceConstraintNames, sqlmock.NewRows([]string{"constraint_name"}), TableName, DefaultSchemaName)
+	repo.ExpectWithRecords(ReadReferencedByConstraintNames, sqlmock.NewRows([]string{"constraint_name"}), TableName, DefaultSchemaName)
+}
+
+func TestApplyColumnPrivileges(t *testing.T) {
+
+	// Arrange
+	repo := tests.CreateDataRepository()
+	newTables := func() map[string]Table {
+		return map[string]Table{
+			TableName: {
+				Name:            TableName,
+				Export:          true,
+				Columns:         []string{"id", IndexColumnName01, "secret", "mandatory"},
+				ColumnIndexes:   map[string]int{"id": 0, IndexColumnName01: 1, "secret": 2, "mandatory": 3},
+				PKColumns:       map[string]bool{"id": true},
+				UniqueIndexes:   map[string]UniqueIndex{UniqueIndexName01: {Name: UniqueIndexName01, Columns: []string{IndexColumnName01}}},
+				UnexportColumns: map[string]bool{},
+			},
+		}
+	}
+	columns := []string{"table_name", "column_name", "nullable", "has_default"}
+	repo.ExpectWithRecords(ReadUnreadableColumns, sqlmock.NewRows(columns).AddRow(TableName, "secret", true, false), DefaultSchemaName)
+	repo.ExpectWithRecords(ReadUnreadableColumns, sqlmock.NewRows(columns).
+		AddRow(TableName, "secret", true, false).
+		AddRow(TableName, "mandatory", false, false).
+		AddRow(TableName, IndexColumnName01, true, true), "tenant1")
+
+	// Act
+	droppedTables := newTables()
+	droppedErr := ApplyColumnPrivileges(repo.DB, droppedTables)
+	failedErr := ApplyColumnPrivilegesInSchema(repo.DB, "tenant1", newTables())
+
+	// Assert
+	if droppedErr != nil {
+		t.Errorf("Unreadable nullable column should be dropped without error, got %s", droppedErr)
+	}
+	table := droppedTables[TableName]
+	expectedColumns := []string{"id", IndexColumnName01, "mandatory"}
+	if !reflect.DeepEqual(table.Columns, expectedColumns) {
+		t.Errorf("Columns do not match: expected %v, got %v", expectedColumns, table.Columns)
+	}
+	if table.ColumnIndexes["mandatory"] != 2 {
+		t.Errorf("Column indexes should follow the remaining columns, got %v", table.ColumnIndexes)
+	}
+	expectedErr := "no SELECT privilege on columns required by the export: " +
+		TableName + ".mandatory (not null without default), " + TableName + "." + IndexColumnName01 + " (key or reference)"
+	if failedErr == nil || failedErr.Error() != expectedErr {
+		t.Errorf("Unexpected error: expected %s, got %v", expectedErr, failedErr)
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("Column privileges were not read. Error message: %s", err)
+	}
+}
+
+func TestReadCompositeReferenceConstraints(t *testing.T) {
+
+	// Arrange
+	repo := tests.CreateDataRepository()
+	// the child lists (arch_id, name_id) while the referenced unique key is (name_id, arch_id): the query pairs the
+	// columns, checked by TestReferenceQueriesPairColumnsByPosition, the mapping keeps the pairs
+	repo.ExpectWithRecords(ReadReferenceConstraints,
+		sqlmock.NewRows([]string{"column_name", "foreign_column_name", "condeferrable"}).
+			AddRow("child_arch_id", "arch_id", true).
+			AddRow("child_name_id", "name_id", true),
+		TableName, "child_parent_fk", DefaultSchemaName)
+
+	// Act
+	columnMap, deferrable, _ := readReferenceConstraints(context.Background(), repo.DB, DefaultSchemaName, TableName, "child_parent_fk")
+
+	// Assert
+	expected := map[string]string{"child_arch_id": "arch_id", "child_name_id": "name_id"}
+	if !reflect.DeepEqual(columnMap, expected) {
+		t.Errorf("Composite reference mapping does not match: expected %v, got %v", expected, columnMap)
+	}
+	if !deferrable {
+		t.Errorf("The foreign key should be deferrable")
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("Reference constraints were not read. Error message: %s", err)
+	}
+}
+
+// TestReferenceQueriesPairColumnsByPosition checks the queries pair the columns of the foreign keys by their position in
+// the constraint: the mocked queries can't tell, the columns of a composite key were joined by name without their
+// position before, giving all the local and referenced column combinations.
+func TestReferenceQueriesPairColumnsByPosition(t *testing.T) {
+
+	// Arrange
+	queries := map[string]string{
+		"ReadReferenceConstraints": ReadReferenceConstraints,
+		"ReadBatchReferences":      ReadBatchReferences,
+	}
+	pairing := []string{
+		// unnest of several arrays zips them: the n-th local column with the n-th referenced one
+		"CROSS JOIN LATERAL unnest(c.conkey, c.confkey) AS k(attnum, foreign_attnum)",
+		"JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = k.attnum",
+		"JOIN pg_attribute af ON af.attrelid = c.confrelid AND af.attnum = k.foreign_attnum",
+	}
+
+	for name, query := range queries {
+		// Act
+		normalized := strings.Join(strings.Fields(query), " ")
+
+		// Assert
+		for _, expected := range pairing {
+			if !strings.Contains(normalized, expected) {
+				t.Errorf("%s should pair the columns by position with %q", name, expected)
+			}
+		}
+		if strings.Contains(normalized, "constraint_column_usage") {
+			t.Errorf("%s should not read the referenced columns without their position", name)
+		}
+	}
+}
+
+func TestReadMissingReferenceConstraint(t *testing.T) {
+
+	// Arrange
+	repo := tests.CreateDataRepository()
+	repo.ExpectWithRecords(ReadReferenceConstraints,
+		sqlmock.NewRows([]string{"column_name", "foreign_column_name", "condeferrable"}),
+		TableName, "child_parent_fk", DefaultSchemaName)
+
+	// Act
+	_, _, err := readReferenceConstraints(context.Background(), repo.DB, DefaultSchemaName, TableName, "child_parent_fk")
+
+	// Assert
+	if err == nil || !strings.Contains(err.Error(), "child_parent_fk") {
+		t.Errorf("A foreign key without columns should be reported, got %v", err)
+	}
+}
+
+func TestProcessTableReadError(t *testing.T) {
+
+	// Arrange
+	repo := tests.CreateDataRepository()
+	connectionLost := errors.New("connection lost")
+	repo.ExpectWithRecords(ReadColumnNames,
+		columnRows("id").RowError(0, connectionLost), TableName, DefaultSchemaName)
+
+	// Act
+	_, _, err := processTable(context.Background(), repo.DB, DefaultSchemaName, TableName, true, nil)
+
+	// Assert
+	if !errors.Is(err, connectionLost) {
+		t.Fatalf("Row iteration error should be returned, got %v", err)
+	}
+	if !strings.HasPrefix(err.Error(), "reading columns for "+TableName+": ") || !strings.Contains(err.Error(), fmt.Sprintf("%q", ReadColumnNames)) {
+		t.Errorf("Error should name the table and the query, got %s", err)
+	}
+}
+
+func TestReadTable(t *testing.T) {
+
+	// Arrange
+	repo := tests.CreateDataRepository()
+	repo.ExpectWithRecords(ReadColumnNames, columnRows("id", "parent_id"), "child", DefaultSchemaName)
+	repo.ExpectWithRecords(ReadIndexes, indexRows().AddRow("table_pk", true, "{id}", ""), "child", DefaultSchemaName)
+	repo.ExpectWithRecords(ReadPkSequence, sequenceRows(), "child", DefaultSchemaName)
+	repo.ExpectWithRecords(ReadReferenceConstraintNames, sqlmock.NewRows([]string{"constraint_name"}).AddRow("parent_fk"), "child", DefaultSchemaName)
+	repo.ExpectWithRecords(ReadReferenceConstraints,
+		sqlmock.NewRows([]string{"column_name", "foreign_column_name", "condeferrable"}).AddRow("parent_id", "id", false),
+		"child", "parent_fk", DefaultSchemaName)
+	repo.ExpectWithRecords(ReadReferencedTable, sqlmock.NewRows([]string{"table_name"}).AddRow("parent"), "parent_fk", DefaultSchemaName)
+	repo.ExpectWithRecords(ReadReferencedByConstraintNames, sqlmock.NewRows([]string{"constraint_name"}), "child", DefaultSchemaName)
+	repo.ExpectWithRecords(ReadColumnNames, columnRows(), "missing", DefaultSchemaName)
 
-	repo.ExpectWithRecords(ReadReferenceConstraintNames, sqlmock.NewRows([]string{"constraint_name"}), TableName)
-	repo.ExpectWithRecords(ReadReferencedByConstraintNames, sqlmock.NewRows([]string{"constraint_name"}), TableName)
+	// Act
+	table, err := ReadTable(repo.DB, "Child")
+	_, missingErr := ReadTable(repo.DB, "missing")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error reading the table: %s", err)
+	}
+	expectedReferences := []Reference{{TableName: "parent", ColumnMapping: map[string]string{"parent_id": "id"}}}
+	if table.Name != "child" || !reflect.DeepEqual(table.References, expectedReferences) {
+		t.Errorf("Table does not match: got %v", table)
+	}
+	if missingErr == nil {
+		t.Errorf("Reading a missing table should fail")
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("Table was not read. Error message: %s", err)
+	}
+}
+
+func TestReadTableWithOwnedSequence(t *testing.T) {
+
+	// Arrange
+	repo := tests.CreateDataRepository()
+	// the serial recid column is part of a composite primary key and isn't named id
+	repo.ExpectWithRecords(ReadColumnNames, columnRows("recid", "org_id"), "rhnrecord", DefaultSchemaName)
+	repo.ExpectWithRecords(ReadIndexes, indexRows().AddRow("rhnrecord_pkey", true, "{org_id,recid}", ""), "rhnrecord", DefaultSchemaName)
+	repo.ExpectWithRecords(ReadPkSequence, sequenceRows().AddRow("rhnrecord_recid_seq", "recid"), "rhnrecord", DefaultSchemaName)
+	repo.ExpectWithRecords(ReadReferenceConstraintNames, sqlmock.NewRows([]string{"constraint_name"}), "rhnrecord", DefaultSchemaName)
+	repo.ExpectWithRecords(ReadReferencedByConstraintNames, sqlmock.NewRows([]string{"constraint_name"}), "rhnrecord", DefaultSchemaName)
+
+	// Act
+	table, err := ReadTable(repo.DB, "rhnrecord")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error reading the table: %s", err)
+	}
+	if table.PKSequence != "rhnrecord_recid_seq" || table.PKSequenceColumn != "recid" {
+		t.Errorf("Sequence owned by the recid column should be detected, got %q owned by %q", table.PKSequence, table.PKSequenceColumn)
+	}
+	if !reflect.DeepEqual(table.PKColumns, map[string]bool{"recid": true, "org_id": true}) {
+		t.Errorf("Composite primary key does not match: got %v", table.PKColumns)
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("Table was not read. Error message: %s", err)
+	}
+}
+
+func TestProcessTableAmbiguousReference(t *testing.T) {
+
+	// Arrange
+	repo := tests.CreateDataRepository()
+	repo.ExpectWithRecords(ReadColumnNames, columnRows("id", "parent_id"), TableName, DefaultSchemaName)
+	repo.ExpectWithRecords(ReadIndexes, indexRows().AddRow("table_pk", true, "{id}", ""), TableName, DefaultSchemaName)
+	repo.ExpectWithRecords(ReadPkSequence, sequenceRows(), TableName, DefaultSchemaName)
+	repo.ExpectWithRecords(ReadReferenceConstraintNames, sqlmock.NewRows([]string{"constraint_name"}).AddRow("parent_fk"), TableName, DefaultSchemaName)
+	repo.ExpectWithRecords(ReadReferenceConstraints,
+		sqlmock.NewRows([]string{"column_name", "foreign_column_name", "condeferrable"}).AddRow("parent_id", "id", false),
+		TableName, "parent_fk", DefaultSchemaName)
+	repo.ExpectWithRecords(ReadReferencedTable,
+		sqlmock.NewRows([]string{"table_name"}).AddRow("parent1").AddRow("parent2"), "parent_fk", DefaultSchemaName)
+
+	// Act
+	_, _, err := processTable(context.Background(), repo.DB, DefaultSchemaName, TableName, true, nil)
+
+	// Assert
+	if err == nil || !strings.Contains(err.Error(), "parent1, parent2") {
+		t.Errorf("Reference to several tables should be reported, got %v", err)
+	}
+}
+
+func TestReadTablesSchemaCancelled(t *testing.T) {
+
+	// Arrange
+	repo := tests.CreateDataRepository()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Act
+	_, err := ReadTablesSchemaContext(ctx, repo.DB, []string{"child", "parent"})
+
+	// Assert
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Cancellation should be returned, got %v", err)
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("No query should be run once cancelled. Error message: %s", err)
+	}
+}
+
+func TestReadTablesInSchema(t *testing.T) {
+
+	// Arrange
+	repo := tests.CreateDataRepository()
+	repo.ExpectWithRecords(ReadBatchColumnNames,
+		batchColumnRows().AddRow("arch", "id", "numeric", false, "nextval('arch_id_seq'::regclass)").
+			AddRow("arch", "label", "character varying(64)", false, ""),
+		pq.Array([]string{"arch"}), "tenant1")
+	repo.ExpectWithRecords(ReadBatchInheritance, inheritanceRows(), pq.Array([]string{"arch"}), "tenant1")
+	repo.ExpectWithRecords(ReadBatchReferences,
+		sqlmock.NewRows([]string{"conname", "relname", "relname", "attname", "attname", "condeferrable"}), pq.Array([]string{"arch"}), "tenant1")
+	repo.ExpectWithRecords(ReadIndexes,
+		indexRows().AddRow("arch_pk", true, "{id}", "").AddRow("arch_label_uq", false, "{label}", ""), "arch", "tenant1")
+	repo.ExpectWithRecords(ReadPkSequence, sequenceRows().AddRow("arch_id_seq", ""), "arch", "tenant1")
+
+	// Act
+	tables, err := ReadTablesInSchema(context.Background(), repo.DB, "tenant1", []string{"arch"})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error reading the schema: %s", err)
+	}
+	if tables["arch"].PKSequence != "arch_id_seq" || tables["arch"].MainUniqueIndexName != "arch_label_uq" ||
+		!reflect.DeepEqual(tables["arch"].PKColumns, map[string]bool{"id": true}) {
+		t.Errorf("Table was not read from the schema: got %v", tables["arch"])
+	}
+	expectedLabel := Column{Name: "label", DataType: "character varying(64)", IsNullable: false}
+	if !reflect.DeepEqual(tables["arch"].ColumnDefinitions["label"], expectedLabel) ||
+		tables["arch"].ColumnDefinitions["id"].ColumnDefault != "nextval('arch_id_seq'::regclass)" {
+		t.Errorf("Column definitions do not match: got %v", tables["arch"].ColumnDefinitions)
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("Schema name was not used in the queries. Error message: %s", err)
+	}
+}
+
+func TestReadQuotedTableNames(t *testing.T) {
+
+	// Arrange
+	repo := tests.CreateDataRepository()
+	tableNames := []string{"order", "RhnUpper"}
+	repo.ExpectWithRecords(ReadBatchColumnNames,
+		batchColumnRows().AddRow("order", "id", "numeric", false, "").AddRow("RhnUpper", "Id", "numeric", false, ""),
+		pq.Array(tableNames), DefaultSchemaName)
+	repo.ExpectWithRecords(ReadBatchInheritance, inheritanceRows(), pq.Array(tableNames), DefaultSchemaName)
+	repo.ExpectWithRecords(ReadBatchReferences,
+		sqlmock.NewRows([]string{"conname", "relname", "relname", "attname", "attname", "condeferrable"}), pq.Array(tableNames), DefaultSchemaName)
+	repo.ExpectWithRecords(ReadIndexes, indexRows().AddRow("\"order_pk\"", true, "{id}", ""), "order", DefaultSchemaName)
+	repo.ExpectWithRecords(ReadPkSequence, sequenceRows(), "order", DefaultSchemaName)
+	repo.ExpectWithRecords(ReadIndexes, indexRows().AddRow("\"RhnUpper_pk\"", true, "{Id}", ""), "RhnUpper", DefaultSchemaName)
+	repo.ExpectWithRecords(ReadPkSequence, sequenceRows(), "RhnUpper", DefaultSchemaName)
+
+	// Act
+	tables, err := ReadTablesSchema(repo.DB, []string{"ORDER", "\"RhnUpper\""})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error reading the schema: %s", err)
+	}
+	if tables["order"].Name != "order" || !tables["order"].PKColumns["id"] {
+		t.Errorf("Reserved word table was not read: got %v", tables["order"])
+	}
+	if tables["RhnUpper"].Name != "RhnUpper" || !reflect.DeepEqual(tables["RhnUpper"].Columns, []string{"Id"}) {
+		t.Errorf("Quoted table name should keep its case and be stored unquoted: got %v", tables)
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("Table names were not unquoted in the queries. Error message: %s", err)
+	}
+}
+
+func TestReadChannelPackageTables(t *testing.T) {
+
+	// Arrange
+	repo := tests.CreateDataRepository()
+	emptyTable := func(tableName string, pkColumns string) {
+		indexes := indexRows()
+		if pkColumns != "" {
+			indexes.AddRow(tableName+"_pk", true, pkColumns, "")
+		}
+		repo.ExpectWithRecords(ReadIndexes, indexes, tableName, DefaultSchemaName)
+		repo.ExpectWithRecords(ReadPkSequence, sequenceRows(), tableName, DefaultSchemaName)
+	}
+	references := sqlmock.NewRows([]string{"conname", "relname", "relname", "attname", "attname", "condeferrable"}).
+		AddRow("rhn_cp_cid_fk", "rhnchannelpackage", "rhnchannel", "channel_id", "id", false).
+		AddRow("rhn_cp_pid_fk", "rhnchannelpackage", "rhnpackage", "package_id", "id", false)
+	repo.ExpectWithRecords(ReadBatchColumnNames,
+		batchColumnRows().
+			AddRow("rhnchannelpackage", "channel_id", "numeric", true, "").AddRow("rhnchannelpackage", "package_id", "numeric", true, ""),
+		pq.Array([]string{"rhnchannelpackage"}), DefaultSchemaName)
+	repo.ExpectWithRecords(ReadBatchInheritance, inheritanceRows(), pq.Array([]string{"rhnchannelpackage"}), DefaultSchemaName)
+	repo.ExpectWithRecords(ReadBatchReferences, references, pq.Array([]string{"rhnchannelpackage"}), DefaultSchemaName)
+	emptyTable("rhnchannelpackage", "")
+	repo.ExpectWithRecords(ReadBatchColumnNames,
+		batchColumnRows().
+			AddRow("rhnchannel", "id", "numeric", true, "").AddRow("rhnchannel", "label", "numeric", true, "").
+			AddRow("rhnpackage", "id", "numeric", true, "").AddRow("rhnpackage", "name_id", "numeric", true, "").AddRow("rhnpackage", "evr_id", "numeric", true, "").
+			AddRow("rhnpackage", "package_arch_id", "numeric", true, "").AddRow("rhnpackage", "checksum_id", "numeric", true, "").AddRow("rhnpackage", "org_id", "numeric", true, ""),
+		pq.Array([]string{"rhnchannel", "rhnpackage"}), DefaultSchemaName)
+	repo.ExpectWithRecords(ReadBatchInheritance, inheritanceRows(), pq.Array([]string{"rhnchannel", "rhnpackage"}), DefaultSchemaName)
+	repo.ExpectWithRecords(ReadBatchReferences,
+		sqlmock.NewRows([]string{"conname", "relname", "relname", "attname", "attname", "condeferrable"}).
+			AddRow("rhn_cp_cid_fk", "rhnchannelpackage", "rhnchannel", "channel_id", "id", false).
+			AddRow("rhn_cp_pid_fk", "rhnchannelpackage", "rhnpackage", "package_id", "id", false),
+		pq.Array([]string{"rhnchannel", "rhnpackage"}), DefaultSchemaName)
+	repo.ExpectWithRecords(ReadIndexes,
+		indexRows().AddRow("rhn_channel_id_pk", true, "{id}", "").AddRow("rhn_channel_label_uq", false, "{label}", ""), "rhnchannel", DefaultSchemaName)
+	repo.ExpectWithRecords(ReadPkSequence, sequenceRows().AddRow("rhn_channel_id_seq", ""), "rhnchannel", DefaultSchemaName)
+	emptyTable("rhnpackage", "{id}")
+
+	// Act
+	tables, err := ReadTablesSchema(repo.DB, []string{"rhnchannelpackage"})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error reading the schema: %s", err)
+	}
+	expectedReferences := []Reference{
+		{TableName: "rhnchannel", ColumnMapping: map[string]string{"channel_id": "id"}},
+		{TableName: "rhnpackage", ColumnMapping: map[string]string{"package_id": "id"}},
+	}
+	if !reflect.DeepEqual(tables["rhnchannelpackage"].References, expectedReferences) {
+		t.Errorf("References do not match: expected %v, got %v", expectedReferences, tables["rhnchannelpackage"].References)
+	}
+	// the sequence backed id of the packages differs between servers: they are matched by their virtual index
+	rhnpackage := tables["rhnpackage"]
+	if rhnpackage.MainUniqueIndexName != VirtualIndexName || rhnpackage.IdOnly || rhnpackage.PKSequence != "RHN_PACKAGE_ID_SEQ" {
+		t.Errorf("Packages should be matched by their virtual index, got %v", rhnpackage)
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("Referenced tables were not read. Error message: %s", err)
+	}
+}
+
+func TestReadTablesSchemaConcurrently(t *testing.T) {
+
+	// Arrange
+	db, mock := tests.NewSqlMock(t)
+	mock.MatchExpectationsInOrder(false)
+	tableNames := []string{"table1", "table2", "table3", "table4"}
+	columns := batchColumnRows()
+	for _, tableName := range tableNames {
+		columns.AddRow(tableName, "id", "numeric", true, "")
+	}
+	mock.ExpectQuery(ReadBatchColumnNames).WithArgs(pq.Array(tableNames), DefaultSchemaName).WillReturnRows(columns)
+	mock.ExpectQuery(ReadBatchInheritance).WithArgs(pq.Array(tableNames), DefaultSchemaName).WillReturnRows(inheritanceRows())
+	mock.ExpectQuery(ReadBatchReferences).WithArgs(pq.Array(tableNames), DefaultSchemaName).
+		WillReturnRows(sqlmock.NewRows([]string{"conname", "relname", "relname", "attname", "attname", "condeferrable"}))
+	for _, tableName := range tableNames {
+		mock.ExpectQuery(ReadPkSequence).WithArgs(tableName, DefaultSchemaName).
+			WillReturnRows(sequenceRows().AddRow(tableName+"_id_seq", ""))
+		mock.ExpectQuery(ReadIndexes).WithArgs(tableName, DefaultSchemaName).
+			WillReturnRows(indexRows())
+	}
+	IntrospectionWorkers = 3
+	defer func() { IntrospectionWorkers = 1 }()
+
+	// Act
+	tables, err := ReadTablesSchema(db, tableNames)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error reading the schema: %s", err)
+	}
+	for _, tableName := range tableNames {
+		if tables[tableName].PKSequence != tableName+"_id_seq" {
+			t.Errorf("Table %s was not read: got %v", tableName, tables[tableName])
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Not all tables were read. Error message: %s", err)
+	}
+}
+
+func TestReadTablesSchemaMissingTables(t *testing.T) {
+
+	// Arrange
+	repo := tests.CreateDataRepository()
+	repo.ExpectWithRecords(ReadBatchColumnNames,
+		batchColumnRows().AddRow("rhnchannel", "id", "numeric", true, ""),
+		pq.Array([]string{"suseproducts", "rhnchannel", "suseproductchannel"}), DefaultSchemaName)
+	repo.ExpectWithRecords(ReadBatchInheritance, inheritanceRows(), pq.Array([]string{"suseproducts", "rhnchannel", "suseproductchannel"}), DefaultSchemaName)
+	repo.ExpectWithRecords(ReadBatchReferences,
+		sqlmock.NewRows([]string{"conname", "relname", "relname", "attname", "attname", "condeferrable"}),
+		pq.Array([]string{"suseproducts", "rhnchannel", "suseproductchannel"}), DefaultSchemaName)
+
+	// Act
+	_, err := ReadTablesSchema(repo.DB, []string{"suseproducts", "rhnchannel", "suseproductchannel"})
+
+	// Assert
+	expected := "tables missing from the public schema: suseproductchannel, suseproducts"
+	if err == nil || err.Error() != expected {
+		t.Errorf("Expected error %q, got %v", expected, err)
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("Schema was not read. Error message: %s", err)
+	}
+}
+
+func TestReadTablesSchemaPartitionedTables(t *testing.T) {
+
+	// Arrange
+	repo := tests.CreateDataRepository()
+	tableNames := []string{"rhnchannel", "rhnpackageevr"}
+	repo.ExpectWithRecords(ReadBatchColumnNames,
+		batchColumnRows().AddRow("rhnchannel", "id", "numeric", true, "").AddRow("rhnpackageevr", "id", "numeric", true, ""),
+		pq.Array(tableNames), DefaultSchemaName)
+	repo.ExpectWithRecords(ReadBatchInheritance, inheritanceRows().AddRow("rhnpackageevr", true), pq.Array(tableNames), DefaultSchemaName)
+
+	// Act
+	tables, err := ReadTablesSchema(repo.DB, tableNames)
+
+	// Assert
+	expected := "partitioned and inherited tables are not supported for export: rhnpackageevr (partitioned)"
+	if err == nil || err.Error() != expected || tables != nil {
+		t.Errorf("Expected error %q rather than an empty schema, got %v %v", expected, tables, err)
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("Schema was not read. Error message: %s", err)
+	}
+}
+
+func TestReadTablesSchemaInBatches(t *testing.T) {
+
+	// Arrange
+	repo := tests.CreateDataRepository()
+	emptyTable := func(tableName string, pkColumns string) {
+		indexes := indexRows()
+		if pkColumns != "" {
+			indexes.AddRow(tableName+"_pk", true, pkColumns, "")
+		}
+		repo.ExpectWithRecords(ReadIndexes, indexes, tableName, DefaultSchemaName)
+		repo.ExpectWithRecords(ReadPkSequence, sequenceRows(), tableName, DefaultSchemaName)
+	}
+	// one batch for the requested tables
+	repo.ExpectWithRecords(ReadBatchColumnNames,
+		batchColumnRows().
+			AddRow("child", "id", "numeric", true, "").AddRow("child", "parent_id", "numeric", true, "").AddRow("child", "arch_id", "numeric", true, "").
+			AddRow("parent", "id", "numeric", true, ""),
+		pq.Array([]string{"child", "parent"}), DefaultSchemaName)
+	repo.ExpectWithRecords(ReadBatchInheritance, inheritanceRows(), pq.Array([]string{"child", "parent"}), DefaultSchemaName)
+	repo.ExpectWithRecords(ReadBatchReferences,
+		sqlmock.NewRows([]string{"conname", "relname", "relname", "attname", "attname", "condeferrable"}).
+			AddRow("child_arch_fk", "child", "arch", "arch_id", "id", false).
+			AddRow("child_parent_fk", "child", "parent", "parent_id", "id", true),
+		pq.Array([]string{"child", "parent"}), DefaultSchemaName)
+	emptyTable("child", "{id}")
+	emptyTable("parent", "{id}")
+	// one batch for the referenced tables not requested
+	repo.ExpectWithRecords(ReadBatchColumnNames,
+		batchColumnRows().AddRow("arch", "id", "numeric", true, ""),
+		pq.Array([]string{"arch"}), DefaultSchemaName)
+	repo.ExpectWithRecords(ReadBatchInheritance, inheritanceRows(), pq.Array([]string{"arch"}), DefaultSchemaName)
+	repo.ExpectWithRecords(ReadBatchReferences,
+		sqlmock.NewRows([]string{"conname", "relname", "relname", "attname", "attname", "condeferrable"}).
+			AddRow("child_arch_fk", "child", "arch", "arch_id", "id", false),
+		pq.Array([]string{"arch"}), DefaultSchemaName)
+	emptyTable("arch", "{id}")
+	progress := make([]string, 0)
+	SetProgress(func(tableName string, index, total int) {
+		progress = append(progress, fmt.Sprintf("%s %d/%d", tableName, index, total))
+	})
+	defer SetProgress(nil)
+
+	// Act
+	tables, err := ReadTablesSchema(repo.DB, []string{"child", "Parent"})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error reading the schema: %s", err)
+	}
+	expectedReferences := []Reference{
+		{TableName: "arch", ColumnMapping: map[string]string{"arch_id": "id"}},
+		{TableName: "parent", ColumnMapping: map[string]string{"parent_id": "id"}, Deferrable: true},
+	}
+	if !reflect.DeepEqual(tables["child"].References, expectedReferences) {
+		t.Errorf("References do not match: expected %v, got %v", expectedReferences, tables["child"].References)
+	}
+	expectedReferencedBy := []Reference{{TableName: "child", ColumnMapping: map[string]string{"parent_id": "id"}, Deferrable: true}}
+	if !reflect.DeepEqual(tables["parent"].ReferencedBy, expectedReferencedBy) {
+		t.Errorf("Referenced by do not match: expected %v, got %v", expectedReferencedBy, tables["parent"].ReferencedBy)
+	}
+	if !tables["child"].Export || !tables["parent"].Export || tables["arch"].Export {
+		t.Errorf("Only the requested tables should be exported")
+	}
+	if !reflect.DeepEqual(tables["child"].Columns, []string{"id", "parent_id", "arch_id"}) || !tables["arch"].PKColumns["id"] {
+		t.Errorf("Columns were not read from the batch")
+	}
+	if !reflect.DeepEqual(progress, []string{"child 1/2", "parent 2/2", "arch 1/1"}) {
+		t.Errorf("Unexpected progress: %v", progress)
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("Schema was not read in batches. Error message: %s", err)
+	}
+}
+
+func TestReadTablesFromList(t *testing.T) {
+
+	// Arrange
+	repo := tests.CreateDataRepository()
+	var output bytes.Buffer
+	SetLogger(zerolog.New(&output))
+	defer func() { packageLogger = nil }()
+	repo.ExpectWithRecords(ReadBatchColumnNames,
+		batchColumnRows().
+			AddRow("child", "id", "numeric", true, "").AddRow("child", "arch_id", "numeric", true, "").
+			AddRow("parent", "id", "numeric", true, ""),
+		pq.Array([]string{"parent", "child"}), DefaultSchemaName)
+	repo.ExpectWithRecords(ReadBatchInheritance, inheritanceRows(), pq.Array([]string{"parent", "child"}), DefaultSchemaName)
+	repo.ExpectWithRecords(ReadBatchReferences,
+		sqlmock.NewRows([]string{"conname", "relname", "relname", "attname", "attname", "condeferrable"}).
+			AddRow("child_arch_fk", "child", "arch", "arch_id", "id", false),
+		pq.Array([]string{"parent", "child"}), DefaultSchemaName)
+	for _, tableName := range []string{"parent", "child"} {
+		repo.ExpectWithRecords(ReadIndexes, indexRows().AddRow(tableName+"_pk", true, "{id}", ""), tableName, DefaultSchemaName)
+		repo.ExpectWithRecords(ReadPkSequence, sequenceRows(), tableName, DefaultSchemaName)
+	}
+
+	// Act
+	tables, err := ReadTablesFromList(repo.DB, []string{"Parent", "child"})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error reading the schema: %s", err)
+	}
+	if len(tables) != 2 || tables[0].Name != "parent" || tables[1].Name != "child" {
+		t.Errorf("Only the listed tables should be read in order, got %v", tables)
+	}
+	// the referenced arch table is not read but reported
+	if !strings.Contains(output.String(), `"table":"child","referenced_table":"arch"`) {
+		t.Errorf("The reference to a table outside the list should be reported, got %s", output.String())
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unexpected queries. Error message: %s", err)
+	}
+}
+
+func TestReadTablesFromListContinueOnTableErrors(t *testing.T) {
+
+	// Arrange
+	repo := tests.CreateDataRepository()
+	tableNames := []string{"rhnchannel", "rhnpackage", "suseproducts"}
+	permissionDenied := errors.New("permission denied for table rhnpackage")
+	repo.ExpectWithRecords(ReadBatchColumnNames,
+		batchColumnRows().AddRow("rhnchannel", "id", "numeric", false, "").AddRow("rhnpackage", "id", "numeric", false, ""),
+		pq.Array(tableNames), DefaultSchemaName)
+	repo.ExpectWithRecords(ReadBatchInheritance, inheritanceRows(), pq.Array(tableNames), DefaultSchemaName)
+	repo.ExpectWithRecords(ReadBatchReferences,
+		sqlmock.NewRows([]string{"conname", "relname", "relname", "attname", "attname", "condeferrable"}), pq.Array(tableNames), DefaultSchemaName)
+	repo.ExpectWithRecords(ReadIndexes, indexRows().AddRow("rhn_channel_id_pk", true, "{id}", ""), "rhnchannel", DefaultSchemaName)
+	repo.ExpectWithRecords(ReadPkSequence, sequenceRows(), "rhnchannel", DefaultSchemaName)
+	repo.ExpectWithRecords(ReadIndexes, indexRows().AddRow("rhn_package_id_pk", true, "{id}", "").RowError(0, permissionDenied),
+		"rhnpackage", DefaultSchemaName)
+	ContinueOnTableErrors = true
+	defer func() { ContinueOnTableErrors = false }()
+
+	// Act
+	tables, err := ReadTablesFromList(repo.DB, tableNames)
+
+	// Assert
+	if len(tables) != 1 || tables[0].Name != "rhnchannel" {
+		t.Errorf("The readable tables should be returned, got %v", tables)
+	}
+	var skipped TableErrors
+	if !errors.As(err, &skipped) || len(skipped) != 2 || skipped[0].TableName != "rhnpackage" || !errors.Is(skipped[0], permissionDenied) ||
+		skipped[1].TableName != "suseproducts" {
+		t.Errorf("The errors of the skipped tables should be returned, got %v", err)
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unexpected queries. Error message: %s", err)
+	}
+}
+
+func TestReadTablesFromListContinueOnQueryTimeout(t *testing.T) {
+
+	// Arrange
+	db, mock := tests.NewSqlMock(t)
+	tableNames := []string{"rhnchannel", "rhnpackage"}
+	mock.ExpectQuery(ReadBatchColumnNames).WithArgs(pq.Array(tableNames), DefaultSchemaName).WillReturnRows(
+		batchColumnRows().AddRow("rhnchannel", "id", "numeric", false, "").AddRow("rhnpackage", "id", "numeric", false, ""))
+	mock.ExpectQuery(ReadBatchInheritance).WithArgs(pq.Array(tableNames), DefaultSchemaName).WillReturnRows(inheritanceRows())
+	mock.ExpectQuery(ReadBatchReferences).WithArgs(pq.Array(tableNames), DefaultSchemaName).
+		WillReturnRows(sqlmock.NewRows([]string{"conname", "relname", "relname", "attname", "attname", "condeferrable"}))
+	mock.ExpectQuery(ReadIndexes).WithArgs("rhnchannel", DefaultSchemaName).
+		WillReturnRows(indexRows().AddRow("rhn_channel_id_pk", true, "{id}", ""))
+	mock.ExpectQuery(ReadPkSequence).WithArgs("rhnchannel", DefaultSchemaName).WillReturnRows(sequenceRows())
+	// the rhnpackage table is locked by another process
+	mock.ExpectQuery(ReadIndexes).WithArgs("rhnpackage", DefaultSchemaName).WillDelayFor(time.Second).
+		WillReturnRows(indexRows().AddRow("rhn_package_id_pk", true, "{id}", ""))
+	ContinueOnTableErrors = true
+	QueryTimeout = 10 * time.Millisecond
+	defer func() {
+		ContinueOnTableErrors = false
+		QueryTimeout = 0
+	}()
+
+	// Act
+	tables, err := ReadTablesFromList(db, tableNames)
+
+	// Assert
+	if len(tables) != 1 || tables[0].Name != "rhnchannel" {
+		t.Errorf("The readable tables should be returned, got %v", tables)
+	}
+	var skipped TableErrors
+	if !errors.As(err, &skipped) || len(skipped) != 1 || skipped[0].TableName != "rhnpackage" ||
+		!errors.Is(skipped[0], context.DeadlineExceeded) {
+		t.Errorf("The table whose query timed out should be skipped, got %v", err)
+	}
+}
+
+func TestReadExistingTablesSchemaMissingTables(t *testing.T) {
+
+	// Arrange
+	repo := tests.CreateDataRepository()
+	tableNames := []string{"suseproducts", "rhnchannel", "suseproductchannel"}
+	repo.ExpectWithRecords(ReadBatchColumnNames,
+		batchColumnRows().AddRow("rhnchannel", "id", "numeric", true, ""),
+		pq.Array(tableNames), DefaultSchemaName)
+	repo.ExpectWithRecords(ReadBatchInheritance, inheritanceRows(), pq.Array(tableNames), DefaultSchemaName)
+	repo.ExpectWithRecords(ReadBatchReferences,
+		sqlmock.NewRows([]string{"conname", "relname", "relname", "attname", "attname", "condeferrable"}),
+		pq.Array(tableNames), DefaultSchemaName)
+	repo.ExpectWithRecords(ReadIndexes, indexRows(), "rhnchannel", DefaultSchemaName)
+	repo.ExpectWithRecords(ReadPkSequence, sequenceRows().AddRow("rhn_channel_id_seq", ""), "rhnchannel", DefaultSchemaName)
+
+	// Act
+	tables, missing, err := ReadExistingTablesSchema(context.Background(), repo.DB, tableNames)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error reading the schema: %s", err)
+	}
+	if len(tables) != 1 || tables["rhnchannel"].PKSequence != "rhn_channel_id_seq" {
+		t.Errorf("Only the existing table should be read, got %v", tables)
+	}
+	expected := []string{"suseproductchannel", "suseproducts"}
+	if !reflect.DeepEqual(missing, expected) {
+		t.Errorf("Expected missing tables %v, got %v", expected, missing)
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("Schema was not read. Error message: %s", err)
+	}
 }
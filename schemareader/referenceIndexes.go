@@ -0,0 +1,58 @@
+package schemareader
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ApplyReferenceIndexes overrides the unique index of the referenced table matching the referenced rows on the target,
+// for the references whose referenced rows are not found by its main unique index. The references are given as
+// table.column, a local column of the foreign key, mapped to the name of the unique index to use.
+// It fails if the reference or the index is unknown, if the index is partial or if the referenced table is a
+// dictionary table, matched by label. The references of the tables not in the schema are ignored.
+func ApplyReferenceIndexes(tables map[string]Table, indexes map[string]string) error {
+	for tableColumn, indexName := range indexes {
+		parts := strings.SplitN(tableColumn, ".", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("invalid reference %q: expected table.column", tableColumn)
+		}
+		table, ok := tables[strings.ToLower(parts[0])]
+		if !ok {
+			continue
+		}
+		position := -1
+		for i, reference := range table.References {
+			if _, ok := reference.ColumnMapping[parts[1]]; ok {
+				position = i
+				break
+			}
+		}
+		if position < 0 {
+			return fmt.Errorf("table %s has no foreign key on column %s", table.Name, parts[1])
+		}
+		reference := table.References[position]
+		referenced, ok := tables[reference.TableName]
+		if !ok {
+			return fmt.Errorf("table %s referenced by %s.%s is not in the schema", reference.TableName, table.Name, parts[1])
+		}
+		if referenced.IsDictionary {
+			return fmt.Errorf("table %s is a dictionary table: the references to it are matched by label", referenced.Name)
+		}
+		index, ok := referenced.UniqueIndexes[indexName]
+		if !ok || indexName == VirtualIndexName {
+			return fmt.Errorf("table %s has no unique index %s, available ones: %s", referenced.Name, indexName,
+				strings.Join(sortedIndexNames(fullUniqueIndexes(referenced.UniqueIndexes)), ", "))
+		}
+		if index.Predicate != "" {
+			return fmt.Errorf("unique index %s of %s is partial: it doesn't match the rows outside of %s", indexName, referenced.Name, index.Predicate)
+		}
+		// the references may be shared with other copies of the table
+		references := make([]Reference, len(table.References))
+		copy(references, table.References)
+		reference.UniqueIndexName = indexName
+		references[position] = reference
+		table.References = references
+		tables[table.Name] = table
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package schemareader
+
+import (
+	"strings"
+	"testing"
+)
+
+func referenceIndexTables() map[string]Table {
+	return map[string]Table{
+		"suseproducts": {
+			Name: "suseproducts",
+			UniqueIndexes: map[string]UniqueIndex{
+				"suseproducts_name_uq":    {Name: "suseproducts_name_uq", Columns: []string{"name"}},
+				"suseproducts_pid_uq":     {Name: "suseproducts_pid_uq", Columns: []string{"product_id"}},
+				"suseproducts_partial_uq": {Name: "suseproducts_partial_uq", Columns: []string{"friendly_name"}, Predicate: "base"},
+			},
+			MainUniqueIndexName: "suseproducts_name_uq",
+		},
+		"suseproductchannel": {
+			Name: "suseproductchannel",
+			References: []Reference{
+				{TableName: "rhnchannel", ColumnMapping: map[string]string{"channel_id": "id"}},
+				{TableName: "suseproducts", ColumnMapping: map[string]string{"product_id": "id"}},
+			},
+		},
+		"rhnchannel": {Name: "rhnchannel", IsDictionary: true},
+	}
+}
+
+func TestApplyReferenceIndexes(t *testing.T) {
+	// Arrange
+	tables := referenceIndexTables()
+	shared := tables["suseproductchannel"]
+
+	// Act
+	err := ApplyReferenceIndexes(tables, map[string]string{"SUSEPRODUCTCHANNEL.product_id": "suseproducts_pid_uq", "missing.column": "index"})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	references := tables["suseproductchannel"].References
+	if references[1].UniqueIndexName != "suseproducts_pid_uq" || references[0].UniqueIndexName != "" {
+		t.Errorf("Unexpected reference indexes: %v", references)
+	}
+	if shared.References[1].UniqueIndexName != "" {
+		t.Errorf("The references of the other copies of the table should be kept")
+	}
+}
+
+func TestApplyReferenceIndexesErrors(t *testing.T) {
+	cases := map[string]string{
+		"suseproductchannel.name_id":    "no foreign key on column name_id",
+		"suseproductchannel.product_id": "no unique index suseproducts_label_uq, available ones: suseproducts_name_uq, suseproducts_pid_uq",
+		"suseproductchannel.channel_id": "dictionary table",
+		"suseproductchannel":            "expected table.column",
+	}
+	for reference, expected := range cases {
+		// Arrange
+		tables := referenceIndexTables()
+
+		// Act
+		err := ApplyReferenceIndexes(tables, map[string]string{reference: "suseproducts_label_uq"})
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error containing %q for %s, got %v", expected, reference, err)
+		}
+	}
+	if err := ApplyReferenceIndexes(referenceIndexTables(), map[string]string{"suseproductchannel.product_id": "suseproducts_partial_uq"}); err == nil ||
+		!strings.Contains(err.Error(), "partial") {
+		t.Errorf("A partial index should be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package schemareader
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// QueryAttempts is the maximum number of times a query failing with a transient error is run
+var QueryAttempts = 4
+
+// QueryRetryDelay is the delay before retrying a query, doubled after each failed retry
+var QueryRetryDelay = 200 * time.Millisecond
+
+// QueryTimeout is the maximum duration of each attempt of a query, including the reading of its rows, 0 for no limit.
+// It stops the schema reading when a table is locked by another process instead of waiting forever.
+var QueryTimeout time.Duration
+
+// queryContext runs the query, retrying it with an exponential backoff when the connection failed.
+// Other errors, like syntax or permission ones, and the timed out queries are returned right away.
+// The returned function releases the context limiting the query to QueryTimeout: it is deferred by the caller once
+// done with the rows, the rows being read after returning. It is already called when an error is returned.
+func queryContext(ctx context.Context, db *sql.DB, query string, args ...interface{}) (*timedRows, context.CancelFunc, error) {
+	delay := QueryRetryDelay
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if QueryTimeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, QueryTimeout)
+		}
+		start := time.Now()
+		rows, err := db.QueryContext(attemptCtx, query, args...)
+		reportQuery(query, time.Since(start))
+		if err == nil {
+			return &timedRows{Rows: rows, ctx: ctx, attemptCtx: attemptCtx}, cancel, nil
+		}
+		timedOut := ctx.Err() == nil && attemptCtx.Err() != nil
+		cancel()
+		if timedOut {
+			return nil, cancel, queryTimeoutError{timeout: QueryTimeout, err: err}
+		}
+		if attempt >= QueryAttempts || !isTransientError(err) {
+			return nil, cancel, err
+		}
+		logger().Warn().Err(err).Int("attempt", attempt).Msgf("Query failed on a connection error, retrying in %s", delay)
+		select {
+		case <-ctx.Done():
+			return nil, cancel, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// timedRows are the rows of a query limited by QueryTimeout: the errors reading them once it expired are
+// queryTimeoutError, like the ones of the query itself
+type timedRows struct {
+	*sql.Rows
+	ctx        context.Context
+	attemptCtx context.Context
+}
+
+func (rows *timedRows) Scan(dest ...interface{}) error {
+	return rows.timeoutError(rows.Rows.Scan(dest...))
+}
+
+func (rows *timedRows) Err() error {
+	return rows.timeoutError(rows.Rows.Err())
+}
+
+// timeoutError wraps the error in a queryTimeoutError if the query timed out and not the whole read
+func (rows *timedRows) timeoutError(err error) error {
+	if err != nil && rows.ctx.Err() == nil && rows.attemptCtx.Err() != nil {
+		return queryTimeoutError{timeout: QueryTimeout, err: err}
+	}
+	return err
+}
+
+// queryTimeoutError is the error of a query stopped by QueryTimeout, a deadline of the query and not of the whole read
+type queryTimeoutError struct {
+	timeout time.Duration
+	err     error
+}
+
+func (e queryTimeoutError) Error() string {
+	return fmt.Sprintf("query timed out after %s: %s", e.timeout, e.err)
+}
+
+func (e queryTimeoutError) Unwrap() error {
+	return e.err
+}
+
+func (e queryTimeoutError) Is(target error) bool {
+	return target == context.DeadlineExceeded
+}
+
+// withTableName names the table in the error of a query which timed out reading its schema
+func withTableName(tableName string, err error) error {
+	var timeoutErr queryTimeoutError
+	if errors.As(err, &timeoutErr) {
+		return fmt.Errorf("reading schema of %s: %w", tableName, err)
+	}
+	return err
+}
+
+// isTransientError tells if the error is caused by a lost connection, and not by the query itself
+func isTransientError(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// class 08 is connection exception, 57P01 to 57P03 are the server shutting down or not accepting connections yet
+		return pqErr.Code.Class() == "08" || pqErr.Code == "57P01" || pqErr.Code == "57P02" || pqErr.Code == "57P03"
+	}
+	return false
+}
@@ -0,0 +1,190 @@
+package schemareader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/uyuni-project/inter-server-sync/tests"
+)
+
+func TestQueryRetriedOnConnectionError(t *testing.T) {
+
+	// Arrange
+	db, mock := tests.NewSqlMock(t)
+	QueryRetryDelay = time.Millisecond
+	defer func() { QueryRetryDelay = 200 * time.Millisecond }()
+	connectionReset := fmt.Errorf("read tcp: %w", syscall.ECONNRESET)
+	mock.ExpectQuery(ReadTableNames).WithArgs(DefaultSchemaName).WillReturnError(connectionReset)
+	mock.ExpectQuery(ReadTableNames).WithArgs(DefaultSchemaName).WillReturnError(&pq.Error{Code: "08006"})
+	mock.ExpectQuery(ReadTableNames).WithArgs(DefaultSchemaName).
+		WillReturnRows(sqlmock.NewRows([]string{"table_name"}).AddRow("rhnchannel"))
+
+	// Act
+	tableNames, err := readTableNames(context.Background(), db, DefaultSchemaName)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Transient errors should be retried, got %s", err)
+	}
+	if !reflect.DeepEqual(tableNames, []string{"rhnchannel"}) {
+		t.Errorf("Unexpected table names: %v", tableNames)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Query was not retried. Error message: %s", err)
+	}
+}
+
+func TestQueryNotRetriedOnQueryError(t *testing.T) {
+
+	// Arrange
+	db, mock := tests.NewSqlMock(t)
+	permissionDenied := &pq.Error{Code: "42501"}
+	mock.ExpectQuery(ReadTableNames).WithArgs(DefaultSchemaName).WillReturnError(permissionDenied)
+
+	// Act
+	_, err := readTableNames(context.Background(), db, DefaultSchemaName)
+
+	// Assert
+	if !errors.Is(err, permissionDenied) {
+		t.Errorf("Permission error should be returned, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unexpected queries. Error message: %s", err)
+	}
+}
+
+func TestQueryAttemptsLimit(t *testing.T) {
+
+	// Arrange
+	db, mock := tests.NewSqlMock(t)
+	QueryRetryDelay = time.Millisecond
+	QueryAttempts = 2
+	defer func() {
+		QueryRetryDelay = 200 * time.Millisecond
+		QueryAttempts = 4
+	}()
+	for i := 0; i < QueryAttempts; i++ {
+		mock.ExpectQuery(ReadTableNames).WithArgs(DefaultSchemaName).WillReturnError(fmt.Errorf("read tcp: %w", syscall.ECONNRESET))
+	}
+
+	// Act
+	_, err := readTableNames(context.Background(), db, DefaultSchemaName)
+
+	// Assert
+	if !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("Connection error should be returned after the last attempt, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Query was not run the expected number of times. Error message: %s", err)
+	}
+}
+
+func TestQueryStatsRecordsEachAttempt(t *testing.T) {
+
+	// Arrange
+	db, mock := tests.NewSqlMock(t)
+	QueryRetryDelay = time.Millisecond
+	defer func() { QueryRetryDelay = 200 * time.Millisecond }()
+	stats := &QueryStats{}
+	SetQueryHook(stats.Record)
+	defer SetQueryHook(nil)
+	mock.ExpectQuery(ReadTableNames).WithArgs(DefaultSchemaName).WillReturnError(&pq.Error{Code: "08006"})
+	mock.ExpectQuery(ReadTableNames).WithArgs(DefaultSchemaName).
+		WillReturnRows(sqlmock.NewRows([]string{"table_name"}).AddRow("rhnchannel"))
+
+	// Act
+	_, err := readTableNames(context.Background(), db, DefaultSchemaName)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if stats.Queries() != 2 {
+		t.Errorf("Each attempt should be counted: expected 2 queries, got %d", stats.Queries())
+	}
+	if stats.Duration() <= 0 {
+		t.Errorf("The query duration should be recorded, got %s", stats.Duration())
+	}
+}
+
+func TestQueryTimesOutOnLockedTable(t *testing.T) {
+
+	// Arrange
+	db, mock := tests.NewSqlMock(t)
+	QueryTimeout = 10 * time.Millisecond
+	defer func() { QueryTimeout = 0 }()
+	mock.ExpectQuery(ReadTableNames).WithArgs(DefaultSchemaName).WillDelayFor(time.Second).
+		WillReturnRows(sqlmock.NewRows([]string{"table_name"}).AddRow("rhnchannel"))
+
+	// Act
+	start := time.Now()
+	_, err := readTableNames(context.Background(), db, DefaultSchemaName)
+
+	// Assert
+	if err == nil || !strings.Contains(err.Error(), "query timed out after 10ms") {
+		t.Errorf("The query should time out, got %v", err)
+	}
+	if time.Since(start) >= time.Second {
+		t.Errorf("The query should not wait for the locked table")
+	}
+}
+
+func TestQueryTimeoutNamesTheTable(t *testing.T) {
+
+	// Arrange
+	db, mock := tests.NewSqlMock(t)
+	QueryTimeout = 10 * time.Millisecond
+	defer func() { QueryTimeout = 0 }()
+	mock.ExpectQuery(ReadColumnNames).WithArgs("rhnchannel", DefaultSchemaName).WillDelayFor(time.Second).
+		WillReturnRows(sqlmock.NewRows([]string{"column_name", "data_type", "is_nullable", "column_default"}))
+
+	// Act
+	_, err := ReadTable(db, "rhnchannel")
+
+	// Assert
+	if err == nil || !strings.HasPrefix(err.Error(), "reading schema of rhnchannel: ") || !strings.Contains(err.Error(), "query timed out after 10ms") {
+		t.Errorf("The timeout error should name the table, got %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("The timeout error should be a deadline error, got %v", err)
+	}
+}
+
+func TestQueryTimeoutWhileReadingRows(t *testing.T) {
+
+	// Arrange
+	db, mock := tests.NewSqlMock(t)
+	QueryTimeout = 10 * time.Millisecond
+	defer func() { QueryTimeout = 0 }()
+	mock.ExpectQuery(ReadTableNames).WithArgs(DefaultSchemaName).
+		WillReturnRows(sqlmock.NewRows([]string{"table_name"}).AddRow("rhnchannel").AddRow("rhnpackage"))
+
+	// Act
+	rows, cancel, err := queryContext(context.Background(), db, ReadTableNames, DefaultSchemaName)
+	if err != nil {
+		t.Fatalf("Unexpected query error: %s", err)
+	}
+	defer cancel()
+	defer rows.Close()
+	// the table is locked once the query started
+	time.Sleep(50 * time.Millisecond)
+	for rows.Next() {
+	}
+	err = rows.Err()
+
+	// Assert
+	if err == nil || !strings.Contains(err.Error(), "query timed out after 10ms") {
+		t.Errorf("The rows error should be a timeout, got %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("The rows error should be a deadline error, got %v", err)
+	}
+}
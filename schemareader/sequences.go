@@ -0,0 +1,46 @@
+package schemareader
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// readSequenceValue returns the last value generated by the sequence, 0 if it was never used
+func readSequenceValue(db *sql.DB, sequenceName string) (int64, error) {
+	query := `SELECT pg_sequence_last_value($1::regclass);`
+	rows, cancel, err := queryContext(context.Background(), db, query, sequenceName)
+	if err != nil {
+		return 0, fmt.Errorf("reading the value of sequence %s: executing %q: %w", sequenceName, query, err)
+	}
+	defer cancel()
+	defer rows.Close()
+
+	var value sql.NullInt64
+	for rows.Next() {
+		if err := rows.Scan(&value); err != nil {
+			return 0, fmt.Errorf("reading the value of sequence %s: extracting row of %q: %w", sequenceName, query, err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("reading the value of sequence %s: iterating rows of %q: %w", sequenceName, query, err)
+	}
+	return value.Int64, nil
+}
+
+// ApplySequenceValues reads the current value of the sequences generating the primary keys of the exported tables.
+// The values are not part of the schema: they have to be read again for each export.
+func ApplySequenceValues(db *sql.DB, tables map[string]Table) error {
+	for name, table := range tables {
+		if !table.Export || table.PKSequence == "" {
+			continue
+		}
+		value, err := readSequenceValue(db, table.PKSequence)
+		if err != nil {
+			return err
+		}
+		table.PKSequenceValue = value
+		tables[name] = table
+	}
+	return nil
+}
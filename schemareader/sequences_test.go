@@ -0,0 +1,51 @@
+package schemareader
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/uyuni-project/inter-server-sync/tests"
+)
+
+func TestApplySequenceValues(t *testing.T) {
+
+	// Arrange
+	repo := tests.CreateDataRepository()
+	tables := map[string]Table{
+		"rhnchannel":     {Name: "rhnchannel", Export: true, PKSequence: "rhn_channel_id_seq"},
+		"rhnchannelarch": {Name: "rhnchannelarch", Export: false, PKSequence: "rhn_channel_arch_id_seq"},
+		"rhnchannelfoo":  {Name: "rhnchannelfoo", Export: true},
+	}
+	repo.ExpectWithRecords(ReadSequenceValue,
+		sqlmock.NewRows([]string{"pg_sequence_last_value"}).AddRow(int64(1042)), "rhn_channel_id_seq")
+
+	// Act
+	err := ApplySequenceValues(repo.DB, tables)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error reading the sequences: %s", err)
+	}
+	if tables["rhnchannel"].PKSequenceValue != 1042 {
+		t.Errorf("Sequence value was not read: got %d", tables["rhnchannel"].PKSequenceValue)
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("Only the sequences of the exported tables should be read. Error message: %s", err)
+	}
+}
+
+func TestReadUnusedSequenceValue(t *testing.T) {
+
+	// Arrange
+	repo := tests.CreateDataRepository()
+	repo.ExpectWithRecords(ReadSequenceValue,
+		sqlmock.NewRows([]string{"pg_sequence_last_value"}).AddRow(nil), "rhn_channel_id_seq")
+
+	// Act
+	value, err := readSequenceValue(repo.DB, "rhn_channel_id_seq")
+
+	// Assert
+	if err != nil || value != 0 {
+		t.Errorf("A never used sequence should have no value: got %d, %v", value, err)
+	}
+}
@@ -0,0 +1,131 @@
+package schemareader
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// Snapshot is a pool of connections all reading the same consistent snapshot of the database:
+// the rows committed while reading the schema and exporting the data are not seen.
+type Snapshot struct {
+	// DB runs the queries in the snapshot, it can be used concurrently like any database pool
+	DB *sql.DB
+	// the transaction exporting the snapshot, which has to stay open while the snapshot is used
+	tx *sql.Tx
+}
+
+// OpenSnapshot opens a REPEATABLE READ read only transaction on the database and a pool of connections
+// importing its snapshot, connecting with the connection string.
+// The snapshot has to be closed to end the transactions.
+func OpenSnapshot(ctx context.Context, db *sql.DB, connectionString string) (*Snapshot, error) {
+	tx, snapshotId, err := exportSnapshot(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	connector, err := pq.NewConnector(connectionString)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("connecting to the snapshot: %w", err)
+	}
+	return &Snapshot{DB: sql.OpenDB(snapshotConnector{connector: connector, snapshotId: snapshotId}), tx: tx}, nil
+}
+
+// Close closes the connections of the snapshot and ends the transaction exporting it
+func (snapshot *Snapshot) Close() error {
+	err := snapshot.DB.Close()
+	if rollbackErr := snapshot.tx.Rollback(); err == nil {
+		err = rollbackErr
+	}
+	return err
+}
+
+// exportSnapshot opens the transaction whose snapshot is shared and returns its identifier
+func exportSnapshot(ctx context.Context, db *sql.DB) (*sql.Tx, string, error) {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, "", fmt.Errorf("starting the snapshot transaction: %w", err)
+	}
+	var snapshotId string
+	if err := tx.QueryRowContext(ctx, "SELECT pg_export_snapshot();").Scan(&snapshotId); err != nil {
+		tx.Rollback()
+		return nil, "", fmt.Errorf("exporting the snapshot: %w", err)
+	}
+	return tx, snapshotId, nil
+}
+
+// snapshotConnector opens connections with a transaction importing the snapshot, never committed:
+// all the queries run on the connection read the snapshot.
+type snapshotConnector struct {
+	connector  driver.Connector
+	snapshotId string
+}
+
+func (c snapshotConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	execer, ok := conn.(driver.ExecerContext)
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("the database driver can't import a snapshot")
+	}
+	queryer, ok := conn.(driver.QueryerContext)
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("the database driver can't query a snapshot")
+	}
+	statement := fmt.Sprintf("BEGIN ISOLATION LEVEL REPEATABLE READ READ ONLY; SET TRANSACTION SNAPSHOT %s;", pq.QuoteLiteral(c.snapshotId))
+	if _, err := execer.ExecContext(ctx, statement, nil); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("importing the snapshot %s: %w", c.snapshotId, err)
+	}
+	return &snapshotConn{Conn: conn, execer: execer, queryer: queryer}, nil
+}
+
+func (c snapshotConnector) Driver() driver.Driver {
+	return c.connector.Driver()
+}
+
+// inFailedTransaction is the PostgreSQL error of the statements run in a transaction aborted by a previous error
+const inFailedTransaction = "25P02"
+
+// snapshotConn is a connection reading the snapshot in its transaction. A failed query aborts the transaction and
+// the next ones fail until it ends: the aborted connection is discarded from the pool and its query run on another one.
+type snapshotConn struct {
+	driver.Conn
+	execer  driver.ExecerContext
+	queryer driver.QueryerContext
+	aborted bool
+}
+
+func (c *snapshotConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	result, err := c.execer.ExecContext(ctx, query, args)
+	return result, c.checkAborted(err)
+}
+
+func (c *snapshotConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := c.queryer.QueryContext(ctx, query, args)
+	return rows, c.checkAborted(err)
+}
+
+// IsValid tells the pool to discard the connection once its transaction is aborted
+func (c *snapshotConn) IsValid() bool {
+	return !c.aborted
+}
+
+// checkAborted returns driver.ErrBadConn for the statement rejected by the aborted transaction, for the pool to run it
+// again on another connection, or the error of the statement
+func (c *snapshotConn) checkAborted(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == inFailedTransaction {
+		c.aborted = true
+		return driver.ErrBadConn
+	}
+	return err
+}
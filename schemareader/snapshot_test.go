@@ -0,0 +1,109 @@
+package schemareader
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/uyuni-project/inter-server-sync/tests"
+)
+
+// recordingConn records the statements run on a connection
+type recordingConn struct {
+	statements []string
+	// the error of the queries, if any
+	queryErr error
+}
+
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c *recordingConn) Close() error                              { return nil }
+func (c *recordingConn) Begin() (driver.Tx, error)                 { return nil, driver.ErrSkip }
+func (c *recordingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.statements = append(c.statements, query)
+	return driver.ResultNoRows, nil
+}
+func (c *recordingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.statements = append(c.statements, query)
+	if c.queryErr != nil {
+		return nil, c.queryErr
+	}
+	return nil, driver.ErrSkip
+}
+
+type recordingConnector struct {
+	conn *recordingConn
+}
+
+func (c recordingConnector) Connect(ctx context.Context) (driver.Conn, error) { return c.conn, nil }
+func (c recordingConnector) Driver() driver.Driver                            { return nil }
+
+func TestExportSnapshot(t *testing.T) {
+
+	// Arrange
+	db, mock := tests.NewSqlMock(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT pg_export_snapshot();").
+		WillReturnRows(sqlmock.NewRows([]string{"pg_export_snapshot"}).AddRow("00000003-0000001B-1"))
+	mock.ExpectRollback()
+
+	// Act
+	tx, snapshotId, err := exportSnapshot(context.Background(), db)
+	if err == nil {
+		tx.Rollback()
+	}
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if snapshotId != "00000003-0000001B-1" {
+		t.Errorf("Unexpected snapshot: %s", snapshotId)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Snapshot was not exported as expected. Error message: %s", err)
+	}
+}
+
+func TestSnapshotConnectorImportsTheSnapshot(t *testing.T) {
+
+	// Arrange
+	conn := &recordingConn{}
+	connector := snapshotConnector{connector: recordingConnector{conn: conn}, snapshotId: "00000003-0000001B-1"}
+
+	// Act
+	_, err := connector.Connect(context.Background())
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := "BEGIN ISOLATION LEVEL REPEATABLE READ READ ONLY; SET TRANSACTION SNAPSHOT '00000003-0000001B-1';"
+	if len(conn.statements) != 1 || conn.statements[0] != expected {
+		t.Errorf("Unexpected statements run on the new connection: %v", conn.statements)
+	}
+}
+
+func TestSnapshotConnectorDiscardsAbortedConnections(t *testing.T) {
+
+	// Arrange
+	conn := &recordingConn{queryErr: &pq.Error{Code: "25P02", Message: "current transaction is aborted"}}
+	connector := snapshotConnector{connector: recordingConnector{conn: conn}, snapshotId: "00000003-0000001B-1"}
+	snapshotConn, err := connector.Connect(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	// Act
+	_, err = snapshotConn.(driver.QueryerContext).QueryContext(context.Background(), "SELECT 1;", nil)
+
+	// Assert
+	if !errors.Is(err, driver.ErrBadConn) {
+		t.Errorf("The query rejected by the aborted transaction should be run on another connection, got %v", err)
+	}
+	if snapshotConn.(driver.Validator).IsValid() {
+		t.Errorf("The connection with an aborted transaction should be discarded")
+	}
+}
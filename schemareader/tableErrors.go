@@ -0,0 +1,78 @@
+package schemareader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ContinueOnTableErrors skips the tables whose schema can't be read, like the ones without privileges or dropped
+// while reading, instead of stopping at the first error. The reads then return the tables they could read
+// with a TableErrors error listing the skipped ones.
+var ContinueOnTableErrors = false
+
+// TableError is the error reading the schema of a single table
+type TableError struct {
+	TableName string
+	Err       error
+}
+
+func (e TableError) Error() string {
+	return fmt.Sprintf("%s: %s", e.TableName, e.Err)
+}
+
+func (e TableError) Unwrap() error {
+	return e.Err
+}
+
+// TableErrors lists the tables skipped with ContinueOnTableErrors, sorted by name
+type TableErrors []TableError
+
+func (errs TableErrors) Error() string {
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	return fmt.Sprintf("schema of %d tables not read: %s", len(errs), strings.Join(messages, "; "))
+}
+
+// skipTable records the error of the table and returns true if the table can be skipped, false if the error has to
+// stop the read: with fail-fast or when the context of the read is done. The queries of the table which timed out
+// are skipped like the other errors of the table.
+func (errs *TableErrors) skipTable(ctx context.Context, tableName string, err error) bool {
+	if !ContinueOnTableErrors || ctx.Err() != nil {
+		return false
+	}
+	*errs = append(*errs, TableError{TableName: tableName, Err: err})
+	return true
+}
+
+// collect adds the errors of the tables skipped by another read and returns nil, or the error if it has to stop the read
+func (errs *TableErrors) collect(err error) error {
+	var skipped TableErrors
+	if errors.As(err, &skipped) {
+		*errs = append(*errs, skipped...)
+		return nil
+	}
+	return err
+}
+
+// err returns the sorted errors, nil if no table was skipped
+func (errs TableErrors) err() error {
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].TableName < errs[j].TableName })
+	return errs
+}
+
+func (errs TableErrors) contains(tableName string) bool {
+	for _, err := range errs {
+		if err.TableName == tableName {
+			return true
+		}
+	}
+	return false
+}
@@ -39,8 +39,11 @@ func applyTableFilters(table Table) Table {
 			Columns: append(table.UniqueIndexes["rhn_pe_v_r_e_uq"].Columns, "type")}
 		table.UniqueIndexes["rhn_pe_v_r_uq"] = UniqueIndex{Name: "rhn_pe_v_r_uq",
 			Columns: append(table.UniqueIndexes["rhn_pe_v_r_uq"].Columns, "type")}
+		// both unique indexes are partial on the epoch: the conflict target matching the row is chosen when writing it
+		table.MainUniqueIndexName = "rhn_pe_v_r_e_uq"
 	case "rhnpackage":
-		// We need to add a virtual unique constraint
+		// We need to add a virtual unique constraint:
+		// the sequence backed id differs between servers and there is no real unique index to match the packages
 		table.PKSequence = "RHN_PACKAGE_ID_SEQ"
 		virtualIndexColumns := []string{"name_id", "evr_id", "package_arch_id", "checksum_id", "org_id"}
 		table.UniqueIndexes[VirtualIndexName] = UniqueIndex{Name: VirtualIndexName, Columns: virtualIndexColumns}
@@ -69,6 +72,9 @@ func applyTableFilters(table Table) Table {
 		unexportColumns := make(map[string]bool)
 		unexportColumns["latest_config_revision_id"] = true
 		table.UnexportColumns = unexportColumns
+	case "rhnconfiginfo":
+		// all the unique indexes are partial: the conflict target matching the row is chosen when writing it
+		table.MainUniqueIndexName = "rhn_confinfo_ugf_se_uq"
 	case "rhnconfigcontent":
 		virtualIndexColumns := []string{"contents", "file_size", "checksum_id", "is_binary", "delim_start", "delim_end", "created"}
 		table.UniqueIndexes[VirtualIndexName] = UniqueIndex{Name: VirtualIndexName, Columns: virtualIndexColumns}
@@ -1,31 +1,223 @@
 package schemareader
 
+import (
+	"fmt"
+	"sort"
+)
+
+// DefaultSchemaName is the database schema of the tables when none is given
+const DefaultSchemaName = "public"
+
+// IntrospectionWorkers is the number of tables whose schema is read concurrently, the number of CPUs if not positive
+var IntrospectionWorkers = 0
+
 // Table represents a DB table to dump
 type Table struct {
-	Name            string
-	Export          bool
-	Columns         []string
-	UnexportColumns map[string]bool
-	ColumnIndexes   map[string]int
-	PKColumns       map[string]bool
-	PKSequence      string
+	Name   string
+	Export bool
+	// the ordered column names
+	Columns           []string
+	ColumnDefinitions map[string]Column
+	UnexportColumns   map[string]bool
+	ColumnIndexes     map[string]int
+	PKColumns         map[string]bool
+	PKSequence        string
+	// the column owning PKSequence, as set by ALTER SEQUENCE ... OWNED BY, empty if the sequence is only matched by its name
+	PKSequenceColumn string
+	// the last value of PKSequence, only set by ApplySequenceValues
+	PKSequenceValue int64
 	UniqueIndexes   map[string]UniqueIndex
 	// a unique index is main when it is the preferred "natural" key
 	MainUniqueIndexName string
-	References          []Reference
-	ReferencedBy        []Reference
+	// a table is id only when its sequence backed PK is the only key to match rows
+	IdOnly bool
+	// a dictionary table holds labelled values with server specific ids: its rows and the references to them are matched by label
+	IsDictionary bool
+	// a table is replaced by label when its rows are updated in place, keeping the target ids
+	ReplaceByLabel bool
+	// the rows of a copied table are written in a COPY block, without conflict check
+	CopyRows bool
+	// rows conflicting with a secondary unique index on the target are skipped instead of failing the import
+	SkipSecondaryUniqueConflicts bool
+	// the rows reached from their parents are only exported if modified since this date, empty to export all of them
+	ModifiedSince string
+	// at most this number of rows reached from their parents are exported, 0 to export all of them
+	RowLimit int
+	// only the rows matching this condition are exported, set by ApplyRowFilters
+	RowFilter string
+	// the rows breaking these references are not exported when reached from their parents, only set by ApplySkipOrphans
+	OrphanReferences []Reference
+	// only read by ApplyCheckConstraints
+	CheckConstraints []CheckConstraint
+	References       []Reference
+	ReferencedBy     []Reference
+}
+
+// Column represents the definition of a column of a Table
+type Column struct {
+	Name string
+	// DataType is the type with its modifiers, like character varying(128), or USER-DEFINED for the types created
+	// in the database
+	DataType   string
+	IsNullable bool
+	// the default value expression, empty if none
+	ColumnDefault string
 }
 
 // UniqueIndex represents an index among columns of a Table
 type UniqueIndex struct {
 	Name    string
 	Columns []string
+	// Predicate is the WHERE clause of a partial index, empty if the index covers all the rows
+	Predicate string
 }
 
 // Reference represents a foreign key relationship to a Table
 type Reference struct {
 	TableName     string
 	ColumnMapping map[string]string
+	// the constraint can be checked at the end of the transaction with SET CONSTRAINTS ALL DEFERRED
+	Deferrable bool
+	// the unique index of the referenced table matching the referenced rows on the target, its main one if empty,
+	// only set by ApplyReferenceIndexes
+	UniqueIndexName string
+}
+
+// IdOnlyTables returns the sorted names of the exportable tables which can only be matched by id
+func IdOnlyTables(tables map[string]Table) []string {
+	result := make([]string, 0)
+	for name, table := range tables {
+		if table.Export && table.IdOnly {
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// ValidateReferences returns a warning for each reference to a table missing from the tables or which couldn't be read
+func ValidateReferences(tables map[string]Table) []string {
+	tableNames := sortedTableNames(tables)
+
+	warnings := make([]string, 0)
+	for _, name := range tableNames {
+		for _, referenced := range missingReferences(tables, name) {
+			warnings = append(warnings, fmt.Sprintf("table %s references %s which is not in the schema read", name, referenced))
+		}
+	}
+	return warnings
+}
+
+// ReportInvalidReferences logs a warning with the table names as fields for each reference ValidateReferences returns
+func ReportInvalidReferences(tables map[string]Table) {
+	for _, name := range sortedTableNames(tables) {
+		for _, referenced := range missingReferences(tables, name) {
+			logger().Warn().Str("table", name).Str("referenced_table", referenced).
+				Msgf("Table %s references %s which is not in the schema read", name, referenced)
+		}
+	}
+}
+
+// ValidateMainUniqueIndexes returns a warning for each main unique index of an exported table matching the rows with
+// a reference to a table only identified by its sequence generated primary key: the referenced ids differ between
+// servers and the referenced rows have no natural key to look them up on the target.
+func ValidateMainUniqueIndexes(tables map[string]Table) []string {
+	warnings := make([]string, 0)
+	for _, name := range sortedTableNames(tables) {
+		table := tables[name]
+		if !table.Export || table.MainUniqueIndexName == "" {
+			continue
+		}
+		indexColumns := make(map[string]bool)
+		for _, column := range table.UniqueIndexes[table.MainUniqueIndexName].Columns {
+			indexColumns[column] = true
+		}
+		for _, reference := range table.References {
+			referenced, ok := tables[reference.TableName]
+			if !ok || !referencedBySequenceKey(referenced, reference) {
+				continue
+			}
+			for _, column := range reference.LocalColumns() {
+				if indexColumns[column] {
+					warnings = append(warnings, fmt.Sprintf("table %s matches its rows with %s which references the generated primary key of %s, "+
+						"a table without natural key", name, column, reference.TableName))
+					break
+				}
+			}
+		}
+	}
+	return warnings
+}
+
+// referencedBySequenceKey tells if the reference points to the sequence backed primary key of a table without natural key
+func referencedBySequenceKey(referenced Table, reference Reference) bool {
+	if referenced.PKSequence == "" || referenced.MainUniqueIndexName != "" || reference.UniqueIndexName != "" {
+		return false
+	}
+	for _, column := range reference.ForeignColumns() {
+		if !referenced.PKColumns[column] {
+			return false
+		}
+	}
+	return true
+}
+
+// ReportIncompleteMainUniqueIndexes logs each warning ValidateMainUniqueIndexes returns
+func ReportIncompleteMainUniqueIndexes(tables map[string]Table) {
+	for _, warning := range ValidateMainUniqueIndexes(tables) {
+		logger().Warn().Msg(warning)
+	}
+}
+
+// sortedTableNames returns the names of the tables in lexicographic order
+func sortedTableNames(tables map[string]Table) []string {
+	tableNames := make([]string, 0, len(tables))
+	for name := range tables {
+		tableNames = append(tableNames, name)
+	}
+	sort.Strings(tableNames)
+	return tableNames
+}
+
+// missingReferences returns the tables referenced by the named table which are missing or couldn't be read
+func missingReferences(tables map[string]Table, name string) []string {
+	result := make([]string, 0)
+	for _, reference := range tables[name].References {
+		if referenced, ok := tables[reference.TableName]; !ok || len(referenced.Columns) == 0 {
+			result = append(result, reference.TableName)
+		}
+	}
+	return result
+}
+
+// ReferencesTo returns the references of the table to the target table, in the order of the table references
+func (table *Table) ReferencesTo(target string) []Reference {
+	result := make([]Reference, 0)
+	for _, reference := range table.References {
+		if reference.TableName == target {
+			result = append(result, reference)
+		}
+	}
+	return result
+}
+
+// LocalColumns returns the sorted columns of the referencing table
+func (reference Reference) LocalColumns() []string {
+	result := make([]string, 0, len(reference.ColumnMapping))
+	for column := range reference.ColumnMapping {
+		result = append(result, column)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// ForeignColumns returns the columns of the referenced table, in the order of the LocalColumns they are mapped to
+func (reference Reference) ForeignColumns() []string {
+	result := make([]string, 0, len(reference.ColumnMapping))
+	for _, column := range reference.LocalColumns() {
+		result = append(result, reference.ColumnMapping[column])
+	}
+	return result
 }
 
 // we are returning just one reference, the first one which uses the column we want
@@ -38,3 +230,15 @@ func (table *Table) GetFirstReferenceFromColumn(columnName string) Reference {
 	}
 	return Reference{}
 }
+
+// SecondaryUniqueIndexes returns the sorted names of the real unique indexes not used to match the rows
+func (table *Table) SecondaryUniqueIndexes() []string {
+	result := make([]string, 0)
+	for name := range table.UniqueIndexes {
+		if name != table.MainUniqueIndexName && name != VirtualIndexName {
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,117 @@
+package schemareader
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateReferences(t *testing.T) {
+
+	// Arrange
+	tables := map[string]Table{
+		"rhnchannelpackage": {Name: "rhnchannelpackage", Columns: []string{"channel_id", "package_id"}, References: []Reference{
+			{TableName: "rhnchannel", ColumnMapping: map[string]string{"channel_id": "id"}},
+			{TableName: "rhnpackage", ColumnMapping: map[string]string{"package_id": "id"}},
+		}},
+		"rhnchannel": {Name: "rhnchannel", Columns: []string{"id"}, References: []Reference{
+			{TableName: "rhnchannelarch", ColumnMapping: map[string]string{"channel_arch_id": "id"}},
+		}},
+		// nonexisting tables referenced by the tables read are kept empty
+		"rhnchannelarch": {},
+	}
+
+	// Act
+	warnings := ValidateReferences(tables)
+
+	// Assert
+	expected := []string{
+		"table rhnchannel references rhnchannelarch which is not in the schema read",
+		"table rhnchannelpackage references rhnpackage which is not in the schema read",
+	}
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("Warnings do not match: expected %v, got %v", expected, warnings)
+	}
+}
+
+func TestReferencesTo(t *testing.T) {
+
+	// Arrange
+	cloned := Table{
+		Name: "rhnchannelcloned",
+		References: []Reference{
+			{TableName: "rhnchannel", ColumnMapping: map[string]string{"original_id": "id"}},
+			{TableName: "rhnorg", ColumnMapping: map[string]string{"org_id": "id"}},
+			{TableName: "rhnchannel", ColumnMapping: map[string]string{"id": "id"}},
+			{TableName: "suseproductchannel", ColumnMapping: map[string]string{"product_id": "product_id", "channel_id": "id"}},
+		},
+	}
+
+	// Act
+	channelReferences := cloned.ReferencesTo("rhnchannel")
+	composite := cloned.ReferencesTo("suseproductchannel")[0]
+
+	// Assert
+	if len(channelReferences) != 2 {
+		t.Fatalf("Expected the 2 references to rhnchannel, got %v", channelReferences)
+	}
+	if !reflect.DeepEqual(channelReferences[0].LocalColumns(), []string{"original_id"}) ||
+		!reflect.DeepEqual(channelReferences[1].LocalColumns(), []string{"id"}) {
+		t.Errorf("References should be returned in the table order, got %v", channelReferences)
+	}
+	if len(cloned.ReferencesTo("rhnpackage")) != 0 {
+		t.Errorf("No reference to a table not referenced was expected")
+	}
+	if !reflect.DeepEqual(composite.LocalColumns(), []string{"channel_id", "product_id"}) {
+		t.Errorf("Unexpected local columns: %v", composite.LocalColumns())
+	}
+	if !reflect.DeepEqual(composite.ForeignColumns(), []string{"id", "product_id"}) {
+		t.Errorf("Foreign columns should follow the local columns order, got %v", composite.ForeignColumns())
+	}
+}
+
+func TestValidateMainUniqueIndexes(t *testing.T) {
+
+	// Arrange
+	keyTable := func(name string, pkColumn string, sequence string, mainIndex string) Table {
+		table := Table{Name: name, Export: true, PKColumns: map[string]bool{pkColumn: true}, PKSequence: sequence,
+			UniqueIndexes: map[string]UniqueIndex{}, MainUniqueIndexName: mainIndex}
+		if mainIndex != "" {
+			table.UniqueIndexes[mainIndex] = UniqueIndex{Name: mainIndex, Columns: []string{"label"}}
+		}
+		return table
+	}
+	tables := map[string]Table{
+		// rows identified by a generated key not named id
+		"rhnsnapshot": keyTable("rhnsnapshot", "snapshot_id", "rhn_snapshot_id_seq", ""),
+		// rows identified by a natural key
+		"rhnchannel": keyTable("rhnchannel", "id", "rhn_channel_id_seq", "rhn_channel_label_uq"),
+		// rows identified by a key not generated by a sequence
+		"rhnpackagenevra": keyTable("rhnpackagenevra", "id", "", ""),
+		"rhnsnapshotchannel": {Name: "rhnsnapshotchannel", Export: true,
+			UniqueIndexes: map[string]UniqueIndex{
+				"rhn_snapshotchan_uq": {Name: "rhn_snapshotchan_uq", Columns: []string{"snapshot_id", "channel_id", "nevra_id"}}},
+			MainUniqueIndexName: "rhn_snapshotchan_uq",
+			References: []Reference{
+				{TableName: "rhnsnapshot", ColumnMapping: map[string]string{"snapshot_id": "snapshot_id"}},
+				{TableName: "rhnchannel", ColumnMapping: map[string]string{"channel_id": "id"}},
+				{TableName: "rhnpackagenevra", ColumnMapping: map[string]string{"nevra_id": "id"}},
+			}},
+		// the reference is not part of the main unique index
+		"rhnsnapshottag": {Name: "rhnsnapshottag", Export: true,
+			UniqueIndexes:       map[string]UniqueIndex{"rhn_st_name_uq": {Name: "rhn_st_name_uq", Columns: []string{"name"}}},
+			MainUniqueIndexName: "rhn_st_name_uq",
+			References:          []Reference{{TableName: "rhnsnapshot", ColumnMapping: map[string]string{"snapshot_id": "snapshot_id"}}}},
+	}
+
+	// Act
+	warnings := ValidateMainUniqueIndexes(tables)
+
+	// Assert
+	expected := []string{
+		"table rhnsnapshotchannel matches its rows with snapshot_id which references the generated primary key of rhnsnapshot, " +
+			"a table without natural key",
+	}
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("Warnings do not match: expected %v, got %v", expected, warnings)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"database/sql/driver"
 	"fmt"
+	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
 )
@@ -28,6 +29,17 @@ func CreateDataRepository() *DataRepository {
 	return &DataRepository{DB: db, mock: mock, Writer: writerAdapter, mockWriter: mockWriter}
 }
 
+// NewSqlMock returns a database mock matching the queries exactly, for the tests setting the expectations
+// DataRepository doesn't offer, like delays or statement executions
+func NewSqlMock(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("Unable to create the database mock: %s", err)
+	}
+	return db, mock
+}
+
 // Expect adds data to repository, which can then be retrieved by the tested function.
 func (repo *DataRepository) Expect(stm string, columns []string, numRecords int, args ...driver.Value) {
 